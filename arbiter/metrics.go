@@ -18,6 +18,7 @@ import (
 	"os"
 
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
@@ -31,30 +32,7 @@ var (
 			Help:      "save checkpoint tso of arbiter.",
 		})
 
-	queryHistogramVec = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: "binlog",
-			Subsystem: "arbiter",
-			Name:      "query_duration_time",
-			Help:      "Bucketed histogram of processing time (s) of a query to sync data to downstream.",
-			Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 18),
-		}, []string{"type"})
-
-	eventCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: "binlog",
-			Subsystem: "arbiter",
-			Name:      "event",
-			Help:      "the count of sql event(dml, ddl).",
-		}, []string{"type"})
-
-	queueSizeGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: "binlog",
-			Subsystem: "arbiter",
-			Name:      "queue_size",
-			Help:      "the size of queue",
-		}, []string{"name"})
+	loaderMetrics = loader.NewPipelineMetrics("binlog", "arbiter")
 
 	txnLatencySecondsHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
@@ -74,9 +52,7 @@ func init() {
 	Registry.MustRegister(prometheus.NewGoCollector())
 
 	Registry.MustRegister(checkpointTSOGauge)
-	Registry.MustRegister(queryHistogramVec)
-	Registry.MustRegister(eventCounter)
-	Registry.MustRegister(queueSizeGauge)
+	loaderMetrics.MustRegister(Registry)
 	Registry.MustRegister(txnLatencySecondsHistogram)
 }
 
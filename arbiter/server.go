@@ -118,10 +118,7 @@ func NewServer(cfg *Config) (srv *Server, err error) {
 	srv.load, err = newLoader(srv.downDB,
 		loader.WorkerCount(cfg.Down.WorkerCount),
 		loader.BatchSize(cfg.Down.BatchSize),
-		loader.Metrics(&loader.MetricsGroup{
-			EventCounterVec:   eventCounter,
-			QueryHistogramVec: queryHistogramVec,
-		}))
+		loader.Metrics(&loaderMetrics.MetricsGroup))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -310,8 +307,8 @@ func syncBinlogs(ctx context.Context, source <-chan *reader.Message, ld loader.L
 			return nil
 		}
 
-		queueSizeGauge.WithLabelValues("kafka_reader").Set(float64(len(source)))
-		queueSizeGauge.WithLabelValues("loader_input").Set(float64(len(dest)))
+		loaderMetrics.QueueSizeGauge.WithLabelValues("kafka_reader").Set(float64(len(source)))
+		loaderMetrics.QueueSizeGauge.WithLabelValues("loader_input").Set(float64(len(dest)))
 	}
 	return nil
 }
@@ -45,6 +45,10 @@ func (l *dummyLoader) Successes() <-chan *loader.Txn {
 	return l.successes
 }
 
+func (l *dummyLoader) Stats() loader.LoaderStats {
+	return loader.LoaderStats{}
+}
+
 func (l *dummyLoader) Input() chan<- *loader.Txn {
 	return l.input
 }
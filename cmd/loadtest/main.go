@@ -0,0 +1,96 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/loadtest"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"go.uber.org/zap"
+)
+
+func main() {
+	var (
+		cfg      loadtest.LoadTestConfig
+		host     string
+		port     int
+		user     string
+		password string
+		logLevel string
+	)
+
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.StringVar(&host, "host", "127.0.0.1", "host of the downstream database")
+	fs.IntVar(&port, "port", 3306, "port of the downstream database")
+	fs.StringVar(&user, "user", "root", "user of the downstream database")
+	fs.StringVar(&password, "password", "", "password of the downstream database")
+	fs.StringVar(&logLevel, "L", "info", "log level: debug, info, warn, error, fatal")
+	fs.IntVar(&cfg.Schemas, "schemas", 1, "count of schemas")
+	fs.IntVar(&cfg.Tables, "tables", 1, "count of tables in each schema")
+	fs.IntVar(&cfg.Rows, "rows", 1000, "count of distinct primary keys in each table")
+	fs.Float64Var(&cfg.InsertRatio, "insert-ratio", 1, "weight of inserts")
+	fs.Float64Var(&cfg.UpdateRatio, "update-ratio", 0, "weight of updates")
+	fs.Float64Var(&cfg.DeleteRatio, "delete-ratio", 0, "weight of deletes")
+	fs.IntVar(&cfg.DMLsPerTxn, "dmls-per-txn", 1, "count of DMLs in each txn")
+	fs.DurationVar(&cfg.Duration, "duration", 0, "duration of the load test, 0 means no limit")
+	fs.IntVar(&cfg.Txns, "txns", 0, "count of txns to feed, 0 means no limit")
+	fs.IntVar(&cfg.WorkerCount, "worker-count", 16, "worker count of loader")
+	fs.IntVar(&cfg.BatchSize, "batch-size", 20, "batch size of loader")
+
+	switch err := fs.Parse(os.Args[1:]); err {
+	case nil:
+	case flag.ErrHelp:
+		os.Exit(0)
+	default:
+		os.Exit(2)
+	}
+
+	if err := util.InitLogger(logLevel, ""); err != nil {
+		log.Fatal("Failed to initialize log", zap.Error(err))
+	}
+
+	if cfg.Duration <= 0 && cfg.Txns <= 0 {
+		log.Fatal("one of duration and txns must be set")
+	}
+
+	db, err := loader.CreateDB(user, password, host, port, nil)
+	if err != nil {
+		log.Fatal("create db failed", zap.Error(err))
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	util.SetupSignalHandler(func(_ os.Signal) {
+		cancel()
+	})
+
+	result, err := loadtest.RunLoadTest(ctx, cfg, db)
+	if result != nil {
+		fmt.Printf("txns: %d, succeeded: %d, elapsed: %s, throughput: %.2f txn/s\n",
+			result.Txns, result.Succeeded, result.Elapsed, result.Throughput)
+		fmt.Printf("latency p50: %s, p95: %s, p99: %s, error rate: %.4f\n",
+			result.LatencyP50, result.LatencyP95, result.LatencyP99, result.ErrorRate)
+	}
+	if err != nil {
+		log.Error("load test failed", zap.Error(err))
+		os.Exit(1)
+	}
+}
@@ -51,9 +51,15 @@ func NewCheckPoint(cfg *Config) (CheckPoint, error) {
 	)
 	switch cfg.CheckpointType {
 	case "mysql", "tidb":
-		cp, err = newMysql(cfg)
+		if cfg.DDLHistory {
+			cp, err = NewCompressedCheckpoint(cfg)
+		} else {
+			cp, err = newMysql(cfg)
+		}
 	case "file":
 		cp, err = NewFile(cfg.InitialCommitTS, cfg.CheckPointFile)
+	case "sqlite":
+		cp, err = NewSQLite(cfg.ClusterID, cfg.InitialCommitTS, cfg.CheckPointFile)
 	case "plugin":
 		if cfg.Db != nil {
 			cp, err = newMysql(cfg)
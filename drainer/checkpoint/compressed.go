@@ -0,0 +1,246 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// the count of the recent DDLs kept in memory and loaded from the DDL history table
+const defaultDDLHistoryLimit = 1000
+
+// DDLRecord is a DDL saved in the DDL history table.
+type DDLRecord struct {
+	CommitTS int64
+	SQL      string
+}
+
+// DDLRecorder is implemented by the CheckPoints keeping the history of the DDLs applied to downstream.
+type DDLRecorder interface {
+	// AddDDL adds a DDL applied to downstream to the history.
+	AddDDL(commitTS int64, sql string)
+}
+
+// CompressedCheckpoint wraps a MysqlCheckPoint and keeps the DDL history in the table `<table>_ddl_history`
+// beside the checkpoint table, which is created if it doesn't exist. The ddl_sql column is stored as
+// gzip-compressed bytes to keep the table small for long-lived channels. Only the recent DDLs are kept
+// in memory and loaded by Load.
+type CompressedCheckpoint struct {
+	*MysqlCheckPoint
+
+	ddlMu      sync.Mutex
+	pendingDDL []DDLRecord
+	history    []DDLRecord
+	// the max count of DDLs in history, defaultDDLHistoryLimit is used if it's 0
+	historyLimit int
+}
+
+var (
+	_ CheckPoint  = &CompressedCheckpoint{}
+	_ DDLRecorder = &CompressedCheckpoint{}
+)
+
+// NewCompressedCheckpoint returns a CompressedCheckpoint saving checkpoint and DDL history into mysql.
+func NewCompressedCheckpoint(cfg *Config) (*CompressedCheckpoint, error) {
+	cp, err := newMysql(cfg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	sp := &CompressedCheckpoint{MysqlCheckPoint: cp.(*MysqlCheckPoint)}
+
+	sql := genCreateDDLHistoryTable(sp.MysqlCheckPoint)
+	if _, err = sp.db.Exec(sql); err != nil {
+		sp.closeOnError()
+		return nil, errors.Annotatef(err, "exec failed, sql: %s", sql)
+	}
+
+	if err = sp.loadDDLHistory(); err != nil {
+		sp.closeOnError()
+		return nil, errors.Trace(err)
+	}
+	return sp, nil
+}
+
+func (sp *CompressedCheckpoint) closeOnError() {
+	if err := sp.Close(); err != nil {
+		log.Warn("failed to close checkpoint", zap.Error(err))
+	}
+}
+
+// AddDDL adds a DDL to the history, it will be saved with the next Save.
+func (sp *CompressedCheckpoint) AddDDL(commitTS int64, sql string) {
+	sp.ddlMu.Lock()
+	defer sp.ddlMu.Unlock()
+
+	sp.pendingDDL = append(sp.pendingDDL, DDLRecord{CommitTS: commitTS, SQL: sql})
+}
+
+// DDLHistory returns the recent DDLs loaded from or saved into the history table, in the order of commit ts.
+func (sp *CompressedCheckpoint) DDLHistory() []DDLRecord {
+	sp.ddlMu.Lock()
+	defer sp.ddlMu.Unlock()
+
+	history := make([]DDLRecord, len(sp.history))
+	copy(history, sp.history)
+	return history
+}
+
+// Load implements CheckPoint.Load interface
+func (sp *CompressedCheckpoint) Load() error {
+	if err := sp.MysqlCheckPoint.Load(); err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(sp.loadDDLHistory())
+}
+
+// Save implements CheckPoint.Save interface, the pending DDLs are saved before the checkpoint.
+func (sp *CompressedCheckpoint) Save(ts, secondaryTS int64, consistent bool) error {
+	if err := sp.saveDDLHistory(); err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(sp.MysqlCheckPoint.Save(ts, secondaryTS, consistent))
+}
+
+func (sp *CompressedCheckpoint) loadDDLHistory() error {
+	sp.ddlMu.Lock()
+	defer sp.ddlMu.Unlock()
+
+	selectSQL := genSelectDDLHistorySQL(sp.MysqlCheckPoint)
+	rows, err := sp.db.Query(selectSQL, sp.clusterID, sp.maxHistory())
+	if err != nil {
+		return errors.Annotatef(err, "query failed, sql: %s", selectSQL)
+	}
+	defer rows.Close()
+
+	var history []DDLRecord
+	for rows.Next() {
+		var (
+			commitTS int64
+			data     []byte
+		)
+		if err = rows.Scan(&commitTS, &data); err != nil {
+			return errors.Trace(err)
+		}
+
+		sql, err := decompress(data)
+		if err != nil {
+			return errors.Annotatef(err, "decompress ddl of commit ts %d failed", commitTS)
+		}
+		history = append(history, DDLRecord{CommitTS: commitTS, SQL: sql})
+	}
+	if err = rows.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	// the recent DDLs are selected in descending order
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	sp.history = history
+	return nil
+}
+
+func (sp *CompressedCheckpoint) saveDDLHistory() error {
+	sp.ddlMu.Lock()
+	defer sp.ddlMu.Unlock()
+
+	replaceSQL := genReplaceDDLHistorySQL(sp.MysqlCheckPoint)
+	for len(sp.pendingDDL) > 0 {
+		ddl := sp.pendingDDL[0]
+		data, err := compress(ddl.SQL)
+		if err != nil {
+			return errors.Annotatef(err, "compress ddl of commit ts %d failed", ddl.CommitTS)
+		}
+
+		if _, err = sp.db.Exec(replaceSQL, sp.clusterID, ddl.CommitTS, data); err != nil {
+			return errors.Annotatef(err, "exec failed, sql: %s", replaceSQL)
+		}
+
+		sp.appendHistory(ddl)
+		sp.pendingDDL = sp.pendingDDL[1:]
+	}
+
+	return nil
+}
+
+func (sp *CompressedCheckpoint) maxHistory() int {
+	if sp.historyLimit > 0 {
+		return sp.historyLimit
+	}
+	return defaultDDLHistoryLimit
+}
+
+// appendHistory must be called with ddlMu held.
+func (sp *CompressedCheckpoint) appendHistory(ddl DDLRecord) {
+	sp.history = append(sp.history, ddl)
+	if over := len(sp.history) - sp.maxHistory(); over > 0 {
+		// copy to release the underlying array of the dropped ones
+		sp.history = append([]DDLRecord(nil), sp.history[over:]...)
+	}
+}
+
+func compress(sql string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(sql)); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer r.Close()
+
+	sql, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return string(sql), nil
+}
+
+func ddlHistoryTable(sp *MysqlCheckPoint) string {
+	return fmt.Sprintf("%s.%s_ddl_history", sp.schema, sp.table)
+}
+
+func genCreateDDLHistoryTable(sp *MysqlCheckPoint) string {
+	return fmt.Sprintf("create table if not exists %s(clusterID bigint unsigned, commitTS bigint, ddl_sql MEDIUMBLOB, primary key(clusterID, commitTS))", ddlHistoryTable(sp))
+}
+
+func genReplaceDDLHistorySQL(sp *MysqlCheckPoint) string {
+	return fmt.Sprintf("replace into %s(clusterID, commitTS, ddl_sql) values(?, ?, ?)", ddlHistoryTable(sp))
+}
+
+func genSelectDDLHistorySQL(sp *MysqlCheckPoint) string {
+	return fmt.Sprintf("select commitTS, ddl_sql from %s where clusterID = ? order by commitTS desc limit ?", ddlHistoryTable(sp))
+}
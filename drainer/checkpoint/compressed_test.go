@@ -0,0 +1,213 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+var _ = Suite(&compressedSuite{})
+
+type compressedSuite struct{}
+
+// genLargeDDL returns a create table statement longer than 64 KB
+func genLargeDDL() string {
+	var b strings.Builder
+	b.WriteString("create table test.large(id int primary key")
+	for i := 0; b.Len() <= 64*1024; i++ {
+		fmt.Fprintf(&b, ", c%d varchar(255) comment 'column %d'", i, i)
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+func (s *compressedSuite) TestCompressRoundTrip(c *C) {
+	for _, sql := range []string{"", "create table test(id int)", genLargeDDL()} {
+		data, err := compress(sql)
+		c.Assert(err, IsNil)
+		got, err := decompress(data)
+		c.Assert(err, IsNil)
+		c.Assert(got, Equals, sql)
+	}
+
+	large := genLargeDDL()
+	data, err := compress(large)
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Less, len(large))
+
+	_, err = decompress([]byte("not gzip"))
+	c.Assert(err, NotNil)
+}
+
+func (s *compressedSuite) TestSaveAndLoad(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	cp := &CompressedCheckpoint{
+		MysqlCheckPoint: &MysqlCheckPoint{
+			db:        db,
+			clusterID: 1,
+			schema:    "db",
+			table:     "tbl",
+			TsMap:     make(map[string]int64),
+		},
+	}
+
+	large := genLargeDDL()
+	data, err := compress(large)
+	c.Assert(err, IsNil)
+
+	mock.ExpectExec(regexp.QuoteMeta("replace into db.tbl_ddl_history(clusterID, commitTS, ddl_sql) values(?, ?, ?)")).
+		WithArgs(1, 100, data).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("replace into db.tbl values.*").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	cp.AddDDL(100, large)
+	err = cp.Save(200, 0, true)
+	c.Assert(err, IsNil)
+	c.Assert(cp.DDLHistory(), DeepEquals, []DDLRecord{{CommitTS: 100, SQL: large}})
+
+	// the saved DDLs are not saved again
+	mock.ExpectExec("replace into db.tbl values.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	err = cp.Save(300, 0, true)
+	c.Assert(err, IsNil)
+
+	loaded := &CompressedCheckpoint{
+		MysqlCheckPoint: &MysqlCheckPoint{
+			db:        db,
+			clusterID: 1,
+			schema:    "db",
+			table:     "tbl",
+			TsMap:     make(map[string]int64),
+		},
+	}
+	mock.ExpectQuery("select checkPoint from db.tbl.*").
+		WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}).AddRow(`{"commitTS": 300, "consistent": true}`))
+	mock.ExpectQuery(regexp.QuoteMeta("select commitTS, ddl_sql from db.tbl_ddl_history where clusterID = ? order by commitTS desc limit ?")).
+		WithArgs(1, defaultDDLHistoryLimit).WillReturnRows(sqlmock.NewRows([]string{"commitTS", "ddl_sql"}).AddRow(100, data))
+
+	err = loaded.Load()
+	c.Assert(err, IsNil)
+	c.Assert(loaded.TS(), Equals, int64(300))
+	c.Assert(loaded.DDLHistory(), DeepEquals, []DDLRecord{{CommitTS: 100, SQL: large}})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *compressedSuite) TestSaveDDLFail(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	cp := &CompressedCheckpoint{
+		MysqlCheckPoint: &MysqlCheckPoint{db: db, clusterID: 1, schema: "db", table: "tbl"},
+	}
+	mock.ExpectExec("replace into db.tbl_ddl_history.*").WillReturnError(errors.New("fail ddl history"))
+
+	cp.AddDDL(100, "create table test(id int)")
+	err = cp.Save(200, 0, true)
+	c.Assert(err, ErrorMatches, ".*fail ddl history.*")
+	// the checkpoint is not saved and the DDL is kept to save next time
+	c.Assert(cp.TS(), Equals, int64(0))
+	c.Assert(cp.pendingDDL, HasLen, 1)
+	c.Assert(cp.DDLHistory(), HasLen, 0)
+}
+
+func (s *compressedSuite) TestHistoryLimit(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	newCheckpoint := func() *CompressedCheckpoint {
+		return &CompressedCheckpoint{
+			MysqlCheckPoint: &MysqlCheckPoint{db: db, clusterID: 1, schema: "db", table: "tbl", TsMap: make(map[string]int64)},
+			historyLimit:    2,
+		}
+	}
+
+	cp := newCheckpoint()
+	for ts := int64(100); ts <= 300; ts += 100 {
+		mock.ExpectExec("replace into db.tbl_ddl_history.*").WillReturnResult(sqlmock.NewResult(0, 1))
+		cp.AddDDL(ts, fmt.Sprintf("create table t%d(id int)", ts))
+	}
+	mock.ExpectExec("replace into db.tbl values.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(cp.Save(400, 0, true), IsNil)
+	// only the recent DDLs are kept
+	c.Assert(cp.DDLHistory(), DeepEquals, []DDLRecord{{200, "create table t200(id int)"}, {300, "create table t300(id int)"}})
+
+	// only the recent DDLs are loaded
+	rows := sqlmock.NewRows([]string{"commitTS", "ddl_sql"})
+	for _, ts := range []int64{300, 200} {
+		data, err := compress(fmt.Sprintf("create table t%d(id int)", ts))
+		c.Assert(err, IsNil)
+		rows.AddRow(ts, data)
+	}
+	mock.ExpectQuery("select checkPoint from db.tbl.*").
+		WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}).AddRow(`{"commitTS": 400, "consistent": true}`))
+	mock.ExpectQuery("select commitTS, ddl_sql from db.tbl_ddl_history.*").WithArgs(1, 2).WillReturnRows(rows)
+
+	loaded := newCheckpoint()
+	c.Assert(loaded.Load(), IsNil)
+	c.Assert(loaded.DDLHistory(), DeepEquals, cp.DDLHistory())
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *compressedSuite) TestNewCheckPoint(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	origOpen := sqlOpenDB
+	defer func() { sqlOpenDB = origOpen }()
+	sqlOpenDB = func(user, password string, host string, port int, tls *tls.Config) (*sql.DB, error) {
+		return db, nil
+	}
+
+	mock.ExpectExec("create schema.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists tidb_binlog.checkpoint\\(.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select checkPoint from tidb_binlog.checkpoint.*").WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}))
+	mock.ExpectExec("create table if not exists tidb_binlog.checkpoint_ddl_history.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select commitTS, ddl_sql from tidb_binlog.checkpoint_ddl_history.*").
+		WillReturnRows(sqlmock.NewRows([]string{"commitTS", "ddl_sql"}))
+
+	cp, err := NewCheckPoint(&Config{CheckpointType: "mysql", ClusterID: 1, InitialCommitTS: 100, DDLHistory: true})
+	c.Assert(err, IsNil)
+	c.Assert(cp, FitsTypeOf, &CompressedCheckpoint{})
+	c.Assert(cp.TS(), Equals, int64(100))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *compressedSuite) TestCloseOnCreationError(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	origOpen := sqlOpenDB
+	defer func() { sqlOpenDB = origOpen }()
+	sqlOpenDB = func(user, password string, host string, port int, tls *tls.Config) (*sql.DB, error) {
+		return db, nil
+	}
+
+	mock.ExpectExec("create schema.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists tidb_binlog.checkpoint\\(.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select checkPoint from tidb_binlog.checkpoint.*").WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}))
+	mock.ExpectExec("create table if not exists tidb_binlog.checkpoint_ddl_history.*").WillReturnError(errors.New("fail ddl history"))
+	mock.ExpectClose()
+
+	_, err = NewCompressedCheckpoint(&Config{ClusterID: 1})
+	c.Assert(err, ErrorMatches, ".*fail ddl history.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
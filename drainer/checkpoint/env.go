@@ -0,0 +1,94 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+)
+
+// the environment variables read by NewFromEnv
+const (
+	// EnvCheckpointType is the type of checkpoint, one of mysql, tidb, file and sqlite.
+	EnvCheckpointType = "TIDB_BINLOG_CHECKPOINT_TYPE"
+	// EnvCheckpointDSN is the DSN like `user:password@tcp(host:port)/schema` of the mysql and tidb checkpoint.
+	EnvCheckpointDSN = "TIDB_BINLOG_CHECKPOINT_DSN"
+	// EnvCheckpointFile is the path of the file and sqlite checkpoint.
+	EnvCheckpointFile = "TIDB_BINLOG_CHECKPOINT_FILE"
+)
+
+// NewFromEnv returns a CheckPoint configured by the environment variables, for the deployments
+// in containers. The schema of the DSN is used to save the checkpoint, the default one is used if it's empty.
+func NewFromEnv() (CheckPoint, error) {
+	cfg, err := configFromEnv()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return NewCheckPoint(cfg)
+}
+
+func configFromEnv() (*Config, error) {
+	tp := os.Getenv(EnvCheckpointType)
+	cfg := &Config{CheckpointType: tp}
+
+	switch tp {
+	case "":
+		return nil, errors.Errorf("environment variable %s is not set", EnvCheckpointType)
+	case "mysql", "tidb":
+		dsn := os.Getenv(EnvCheckpointDSN)
+		if dsn == "" {
+			return nil, errors.Errorf("environment variable %s is required by %s checkpoint", EnvCheckpointDSN, tp)
+		}
+		db, schema, err := parseDSN(dsn)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid %s", EnvCheckpointDSN)
+		}
+		cfg.Db = db
+		cfg.Schema = schema
+	case "file", "sqlite":
+		cfg.CheckPointFile = os.Getenv(EnvCheckpointFile)
+		if cfg.CheckPointFile == "" {
+			return nil, errors.Errorf("environment variable %s is required by %s checkpoint", EnvCheckpointFile, tp)
+		}
+	default:
+		return nil, errors.Errorf("unsupported checkpoint type %s of %s, should be mysql, tidb, file or sqlite", tp, EnvCheckpointType)
+	}
+	return cfg, nil
+}
+
+// parseDSN returns the DBConfig and schema of the DSN in the format of go-sql-driver/mysql.
+func parseDSN(dsn string) (*DBConfig, string, error) {
+	parsed, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+
+	db := &DBConfig{User: parsed.User, Password: parsed.Passwd}
+	if parsed.Net != "tcp" {
+		return nil, "", errors.Errorf("unsupported network %s, should be tcp", parsed.Net)
+	}
+	host, port, err := net.SplitHostPort(parsed.Addr)
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	db.Host = host
+	if db.Port, err = strconv.Atoi(port); err != nil {
+		return nil, "", errors.Annotatef(err, "invalid port %s", port)
+	}
+	return db, parsed.DBName, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/pingcap/errors"
+)
+
+func TestNewFromEnvMySQL(t *testing.T) {
+	for _, tp := range []string{"mysql", "tidb"} {
+		t.Run(tp, func(t *testing.T) {
+			var got DBConfig
+			origOpen := sqlOpenDB
+			defer func() { sqlOpenDB = origOpen }()
+			sqlOpenDB = func(user, password string, host string, port int, tls *tls.Config) (*sql.DB, error) {
+				got = DBConfig{User: user, Password: password, Host: host, Port: port}
+				return nil, errors.New("no db")
+			}
+
+			t.Setenv(EnvCheckpointType, tp)
+			t.Setenv(EnvCheckpointDSN, "binlog:secret@tcp(10.0.0.1:4000)/tidb_binlog_ckp")
+			_, err := NewFromEnv()
+			if err == nil || !regexp.MustCompile("no db").MatchString(err.Error()) {
+				t.Fatalf("expect the error of opening db, got %v", err)
+			}
+			expected := DBConfig{User: "binlog", Password: "secret", Host: "10.0.0.1", Port: 4000}
+			if got != expected {
+				t.Fatalf("expect connecting to %+v, got %+v", expected, got)
+			}
+
+			cfg, err := configFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Schema != "tidb_binlog_ckp" {
+				t.Fatalf("expect schema tidb_binlog_ckp, got %s", cfg.Schema)
+			}
+		})
+	}
+}
+
+func TestNewFromEnvFile(t *testing.T) {
+	for _, tp := range []string{"file", "sqlite"} {
+		t.Run(tp, func(t *testing.T) {
+			t.Setenv(EnvCheckpointType, tp)
+			t.Setenv(EnvCheckpointFile, filepath.Join(t.TempDir(), "savepoint"))
+			cp, err := NewFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cp.Close()
+
+			if err = cp.Save(100, 0, true); err != nil {
+				t.Fatal(err)
+			}
+			if cp.TS() != 100 {
+				t.Fatalf("expect ts 100, got %d", cp.TS())
+			}
+		})
+	}
+}
+
+func TestNewFromEnvMissing(t *testing.T) {
+	tests := []struct {
+		tp, dsn, file string
+		err           string
+	}{
+		{"", "", "", "TIDB_BINLOG_CHECKPOINT_TYPE is not set"},
+		{"mysql", "", "/tmp/savepoint", "TIDB_BINLOG_CHECKPOINT_DSN is required by mysql checkpoint"},
+		{"tidb", "binlog@unix(/tmp/mysql.sock)/", "", "unsupported network unix"},
+		{"mysql", "binlog@tcp(10.0.0.1:port)/", "", "invalid port port"},
+		{"file", "binlog@tcp(10.0.0.1:4000)/", "", "TIDB_BINLOG_CHECKPOINT_FILE is required by file checkpoint"},
+		{"sqlite", "", "", "TIDB_BINLOG_CHECKPOINT_FILE is required by sqlite checkpoint"},
+		{"kafka", "", "", "unsupported checkpoint type kafka"},
+	}
+	for _, test := range tests {
+		t.Setenv(EnvCheckpointType, test.tp)
+		t.Setenv(EnvCheckpointDSN, test.dsn)
+		t.Setenv(EnvCheckpointFile, test.file)
+		_, err := NewFromEnv()
+		if err == nil || !regexp.MustCompile(regexp.QuoteMeta(test.err)).MatchString(err.Error()) {
+			t.Errorf("type %q: expect error %q, got %v", test.tp, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrLockHeld indicates the DistributedLock is held by another session.
+	ErrLockHeld = errors.New("lock is held by another session")
+	// ErrLockClosed indicates the DistributedLock already closed.
+	ErrLockClosed = errors.New("lock already closed")
+)
+
+// DistributedLock is a MySQL advisory lock got by GET_LOCK, it's held by a dedicated connection
+// until RELEASE_LOCK or the connection is closed.
+// The lock is renewed by checking it's still held by the connection every ttl/3 in a background
+// goroutine, and is considered expired if it's not renewed in ttl, e.g. the connection is broken.
+type DistributedLock struct {
+	db   *sql.DB
+	name string
+	ttl  time.Duration
+
+	mu sync.Mutex
+	// the connection holding the lock, nil if the lock is not held
+	conn      *sql.Conn
+	renewedAt time.Time
+	closed    bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDistributedLock returns a DistributedLock named lockName, the lock is not got until Lock is called.
+func NewDistributedLock(db *sql.DB, lockName string, ttl time.Duration) *DistributedLock {
+	l := &DistributedLock{
+		db:   db,
+		name: lockName,
+		ttl:  ttl,
+		stop: make(chan struct{}),
+	}
+
+	l.wg.Add(1)
+	go l.renewLoop()
+	return l
+}
+
+// Lock gets the lock if it's not held or expired, it returns ErrLockHeld if the lock is held by another session.
+func (l *DistributedLock) Lock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return errors.Trace(ErrLockClosed)
+	}
+	if l.heldLocked() {
+		return nil
+	}
+	if l.conn != nil {
+		log.Warn("distributed lock expired", zap.String("name", l.name), zap.Time("renewed at", l.renewedAt))
+		if err := l.release(ctx); err != nil {
+			log.Warn("failed to release expired lock", zap.String("name", l.name), zap.Error(err))
+		}
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return errors.Annotate(err, "get connection for lock")
+	}
+	// GET_LOCK returns 1 if the lock is got, 0 if it's held by another session, NULL on error
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", l.name).Scan(&got); err != nil {
+		conn.Close()
+		return errors.Annotatef(err, "get lock %s", l.name)
+	}
+	if !got.Valid || got.Int64 != 1 {
+		conn.Close()
+		return errors.Annotatef(ErrLockHeld, "get lock %s", l.name)
+	}
+
+	l.conn = conn
+	l.renewedAt = time.Now()
+	log.Info("got distributed lock", zap.String("name", l.name))
+	return nil
+}
+
+// Held returns whether the lock is held and not expired.
+func (l *DistributedLock) Held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.heldLocked()
+}
+
+// heldLocked must be called with mu held.
+func (l *DistributedLock) heldLocked() bool {
+	return l.conn != nil && time.Since(l.renewedAt) < l.ttl
+}
+
+func (l *DistributedLock) renewLoop() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.renew(); err != nil {
+				log.Warn("failed to renew distributed lock", zap.String("name", l.name), zap.Error(err))
+			}
+		}
+	}
+}
+
+// renew updates the renewed time if the lock is still held by the connection.
+func (l *DistributedLock) renew() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.ttl)
+	defer cancel()
+
+	var held sql.NullInt64
+	if err := l.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", l.name).Scan(&held); err != nil {
+		return errors.Trace(err)
+	}
+	if !held.Valid || held.Int64 != 1 {
+		return errors.Errorf("lock %s is not held by the connection", l.name)
+	}
+
+	l.renewedAt = time.Now()
+	return nil
+}
+
+// release releases the lock by RELEASE_LOCK and returns the connection to the pool,
+// it must be called with mu held.
+func (l *DistributedLock) release(ctx context.Context) error {
+	defer func() {
+		if err := l.conn.Close(); err != nil {
+			log.Warn("failed to close the connection of lock", zap.String("name", l.name), zap.Error(err))
+		}
+		l.conn = nil
+	}()
+
+	if _, err := l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.name); err != nil {
+		return errors.Annotatef(err, "release lock %s", l.name)
+	}
+	return nil
+}
+
+// Close releases the lock by RELEASE_LOCK if it's held and stops renewing it.
+func (l *DistributedLock) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return errors.Trace(ErrLockClosed)
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	close(l.stop)
+	l.wg.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	if err := l.release(context.Background()); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("released distributed lock", zap.String("name", l.name))
+	return nil
+}
+
+// LockedCheckPoint wraps a CheckPoint to save the ts only when the DistributedLock is held,
+// so the drainers sharing the same checkpoint can't advance it concurrently.
+type LockedCheckPoint struct {
+	CheckPoint
+
+	lock *DistributedLock
+}
+
+var _ CheckPoint = &LockedCheckPoint{}
+
+// WithDistributedLock returns a LockedCheckPoint getting lock before saving into inner,
+// the lock is closed with the LockedCheckPoint.
+func WithDistributedLock(inner CheckPoint, lock *DistributedLock) *LockedCheckPoint {
+	return &LockedCheckPoint{
+		CheckPoint: inner,
+		lock:       lock,
+	}
+}
+
+// Save implements CheckPoint.Save interface
+func (sp *LockedCheckPoint) Save(ts, secondaryTS int64, consistent bool) error {
+	if err := sp.lock.Lock(context.Background()); err != nil {
+		return errors.Annotate(err, "save checkpoint without lock")
+	}
+
+	return errors.Trace(sp.CheckPoint.Save(ts, secondaryTS, consistent))
+}
+
+// Close implements CheckPoint.Close interface
+func (sp *LockedCheckPoint) Close() error {
+	if err := sp.lock.Close(); err != nil {
+		log.Warn("failed to close distributed lock", zap.Error(err))
+	}
+
+	return errors.Trace(sp.CheckPoint.Close())
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+var _ = Suite(&lockSuite{})
+
+type lockSuite struct{}
+
+func (s *lockSuite) expectGetLock(mock sqlmock.Sqlmock, result int) {
+	mock.ExpectQuery("SELECT GET_LOCK.*").WithArgs("drainer").
+		WillReturnRows(sqlmock.NewRows([]string{"GET_LOCK"}).AddRow(result))
+}
+
+func (s *lockSuite) expectReleaseLock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec("SELECT RELEASE_LOCK.*").WithArgs("drainer").WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func (s *lockSuite) TestLock(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	s.expectGetLock(mock, 1)
+	s.expectReleaseLock(mock)
+
+	lock := NewDistributedLock(db, "drainer", time.Minute)
+	c.Assert(lock.Held(), IsFalse)
+	c.Assert(lock.Lock(context.Background()), IsNil)
+	c.Assert(lock.Held(), IsTrue)
+	// no need to get the lock again
+	c.Assert(lock.Lock(context.Background()), IsNil)
+
+	c.Assert(lock.Close(), IsNil)
+	c.Assert(lock.Held(), IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	c.Assert(errors.Cause(lock.Lock(context.Background())), Equals, ErrLockClosed)
+	c.Assert(errors.Cause(lock.Close()), Equals, ErrLockClosed)
+}
+
+func (s *lockSuite) TestContention(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	s.expectGetLock(mock, 0)
+
+	lock := NewDistributedLock(db, "drainer", time.Minute)
+	err = lock.Lock(context.Background())
+	c.Assert(errors.Cause(err), Equals, ErrLockHeld)
+	c.Assert(lock.Held(), IsFalse)
+
+	// nothing to release
+	c.Assert(lock.Close(), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *lockSuite) TestTTLExpiry(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	s.expectGetLock(mock, 1)
+	// the lock is lost, e.g. killed by the DBA
+	for i := 0; i < 100; i++ {
+		mock.ExpectQuery("SELECT IS_USED_LOCK.*").WithArgs("drainer").
+			WillReturnRows(sqlmock.NewRows([]string{"held"}).AddRow(0))
+	}
+
+	const ttl = 30 * time.Millisecond
+	lock := NewDistributedLock(db, "drainer", ttl)
+	defer lock.Close()
+	c.Assert(lock.Lock(context.Background()), IsNil)
+	c.Assert(lock.Held(), IsTrue)
+
+	time.Sleep(ttl + 10*time.Millisecond)
+	c.Assert(lock.Held(), IsFalse)
+
+	// got again after releasing the expired one
+	s.expectReleaseLock(mock)
+	s.expectGetLock(mock, 1)
+	c.Assert(lock.Lock(context.Background()), IsNil)
+	c.Assert(lock.Held(), IsTrue)
+}
+
+func (s *lockSuite) TestRenew(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	s.expectGetLock(mock, 1)
+	for i := 0; i < 100; i++ {
+		mock.ExpectQuery("SELECT IS_USED_LOCK.*").WithArgs("drainer").
+			WillReturnRows(sqlmock.NewRows([]string{"held"}).AddRow(1))
+	}
+
+	const ttl = 30 * time.Millisecond
+	lock := NewDistributedLock(db, "drainer", ttl)
+	defer lock.Close()
+	c.Assert(lock.Lock(context.Background()), IsNil)
+
+	time.Sleep(3 * ttl)
+	c.Assert(lock.Held(), IsTrue)
+}
+
+func (s *lockSuite) TestLockedCheckPoint(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	inner, err := NewFile(10, filepath.Join(c.MkDir(), "savepoint"))
+	c.Assert(err, IsNil)
+	cp := WithDistributedLock(inner, NewDistributedLock(db, "drainer", time.Minute))
+
+	// another drainer holds the lock
+	s.expectGetLock(mock, 0)
+	err = cp.Save(20, 0, false)
+	c.Assert(errors.Cause(err), Equals, ErrLockHeld)
+	c.Assert(cp.TS(), Equals, int64(10))
+
+	s.expectGetLock(mock, 1)
+	c.Assert(cp.Save(30, 0, false), IsNil)
+	c.Assert(cp.TS(), Equals, int64(30))
+
+	s.expectReleaseLock(mock)
+	c.Assert(cp.Close(), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
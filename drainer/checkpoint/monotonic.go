@@ -0,0 +1,97 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// the count of the recent saved ts kept by MonotonicCheckPoint
+const monotonicHistorySize = 100
+
+// MonotonicCheckPoint wraps a CheckPoint to detect the anomalies of the saved ts for debugging,
+// the ts are still saved into the inner CheckPoint when anomalies are detected.
+type MonotonicCheckPoint struct {
+	CheckPoint
+
+	maxJump int64
+	alertFn func(prev, next int64)
+
+	mu sync.Mutex
+	// the recent saved ts, history[next] is the oldest one when the history is full
+	history []int64
+	next    int
+}
+
+var _ CheckPoint = &MonotonicCheckPoint{}
+
+// EnsureMonotonic returns a MonotonicCheckPoint calling alertFn before saving the ts if it's less than
+// the last one, or greater than the last one by more than maxJump, maxJump <= 0 means no limit.
+func EnsureMonotonic(inner CheckPoint, maxJump int64, alertFn func(prev, next int64)) *MonotonicCheckPoint {
+	return &MonotonicCheckPoint{
+		CheckPoint: inner,
+		maxJump:    maxJump,
+		alertFn:    alertFn,
+		history:    make([]int64, 0, monotonicHistorySize),
+	}
+}
+
+// Save implements CheckPoint.Save interface
+func (sp *MonotonicCheckPoint) Save(ts, secondaryTS int64, consistent bool) error {
+	sp.mu.Lock()
+	prev := sp.lastTS()
+	if prev > 0 && (ts < prev || (sp.maxJump > 0 && ts-prev > sp.maxJump)) {
+		log.Warn("non-monotonic checkpoint ts", zap.Int64("prev", prev), zap.Int64("next", ts), zap.Int64("max jump", sp.maxJump))
+		if sp.alertFn != nil {
+			sp.alertFn(prev, ts)
+		}
+	}
+	sp.record(ts)
+	sp.mu.Unlock()
+
+	return errors.Trace(sp.CheckPoint.Save(ts, secondaryTS, consistent))
+}
+
+// History returns the recent saved ts from the oldest to the latest.
+func (sp *MonotonicCheckPoint) History() []int64 {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	history := make([]int64, 0, len(sp.history))
+	history = append(history, sp.history[sp.next:]...)
+	return append(history, sp.history[:sp.next]...)
+}
+
+// lastTS returns the last saved ts, or the ts of inner CheckPoint if nothing is saved yet.
+// it must be called with mu held.
+func (sp *MonotonicCheckPoint) lastTS() int64 {
+	if len(sp.history) == 0 {
+		return sp.CheckPoint.TS()
+	}
+	return sp.history[(sp.next+len(sp.history)-1)%len(sp.history)]
+}
+
+// record must be called with mu held.
+func (sp *MonotonicCheckPoint) record(ts int64) {
+	if len(sp.history) < monotonicHistorySize {
+		sp.history = append(sp.history, ts)
+		return
+	}
+	sp.history[sp.next] = ts
+	sp.next = (sp.next + 1) % monotonicHistorySize
+}
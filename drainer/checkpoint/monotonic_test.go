@@ -0,0 +1,82 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&monotonicSuite{})
+
+type monotonicSuite struct{}
+
+type tsJump struct {
+	prev, next int64
+}
+
+func (s *monotonicSuite) newCheckPoint(c *C, initialTS int64) (*MonotonicCheckPoint, *[]tsJump) {
+	inner, err := NewFile(initialTS, filepath.Join(c.MkDir(), "savepoint"))
+	c.Assert(err, IsNil)
+
+	var jumps []tsJump
+	cp := EnsureMonotonic(inner, 100, func(prev, next int64) {
+		jumps = append(jumps, tsJump{prev, next})
+	})
+	return cp, &jumps
+}
+
+func (s *monotonicSuite) TestNormalProgression(c *C) {
+	cp, jumps := s.newCheckPoint(c, 10)
+
+	for _, ts := range []int64{10, 20, 20, 120, 150} {
+		c.Assert(cp.Save(ts, 0, false), IsNil)
+		c.Assert(cp.TS(), Equals, ts)
+	}
+	c.Assert(*jumps, HasLen, 0)
+	c.Assert(cp.History(), DeepEquals, []int64{10, 20, 20, 120, 150})
+
+	// only the recent ts are kept
+	for ts := int64(151); ts <= 300; ts++ {
+		c.Assert(cp.Save(ts, 0, false), IsNil)
+	}
+	history := cp.History()
+	c.Assert(history, HasLen, monotonicHistorySize)
+	c.Assert(history[0], Equals, int64(201))
+	c.Assert(history[monotonicHistorySize-1], Equals, int64(300))
+	c.Assert(*jumps, HasLen, 0)
+}
+
+func (s *monotonicSuite) TestForwardJump(c *C) {
+	cp, jumps := s.newCheckPoint(c, 10)
+
+	// compared with the ts of inner checkpoint at first
+	c.Assert(cp.Save(200, 0, false), IsNil)
+	c.Assert(cp.Save(250, 0, false), IsNil)
+	c.Assert(cp.Save(351, 0, false), IsNil)
+	c.Assert(*jumps, DeepEquals, []tsJump{{10, 200}, {250, 351}})
+	// still saved
+	c.Assert(cp.TS(), Equals, int64(351))
+}
+
+func (s *monotonicSuite) TestBackwardJump(c *C) {
+	cp, jumps := s.newCheckPoint(c, 0)
+
+	c.Assert(cp.Save(50, 0, false), IsNil)
+	c.Assert(cp.Save(40, 0, false), IsNil)
+	c.Assert(cp.Save(45, 0, false), IsNil)
+	c.Assert(*jumps, DeepEquals, []tsJump{{50, 40}})
+	c.Assert(cp.TS(), Equals, int64(45))
+}
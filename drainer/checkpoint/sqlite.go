@@ -0,0 +1,220 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/pingcap/errors"
+
+	// sqlite driver
+	_ "modernc.org/sqlite"
+)
+
+const sqliteCheckPointTable = "checkpoint"
+
+// SQLiteCheckPoint is a CheckPoint saved in a local SQLite database, the table is the same as the one
+// of MysqlCheckPoint, so the checkpoint is saved atomically without a remote MySQL.
+type SQLiteCheckPoint struct {
+	sync.RWMutex
+	closed          bool
+	clusterID       uint64
+	initialCommitTS int64
+
+	db *sql.DB
+
+	ConsistentSaved bool             `toml:"consistent" json:"consistent"`
+	CommitTS        int64            `toml:"commitTS" json:"commitTS"`
+	TsMap           map[string]int64 `toml:"ts-map" json:"ts-map"`
+}
+
+var _ CheckPoint = &SQLiteCheckPoint{}
+
+// NewSQLite creates a SQLiteCheckPoint saved in the SQLite database file at path.
+func NewSQLite(clusterID uint64, initialCommitTS int64, path string) (*SQLiteCheckPoint, error) {
+	// the txns begin with a RESERVED lock, so CompareAndSave can't be interleaved by other processes
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_txlock=immediate&_pragma=synchronous(FULL)", path))
+	if err != nil {
+		return nil, errors.Annotatef(err, "open sqlite %s", path)
+	}
+	// SQLite allows only one writer at a time
+	db.SetMaxOpenConns(1)
+
+	stmt := fmt.Sprintf("create table if not exists %s(clusterID bigint unsigned primary key, checkPoint MEDIUMTEXT)", sqliteCheckPointTable)
+	if _, err = db.Exec(stmt); err != nil {
+		db.Close()
+		return nil, errors.Annotatef(err, "exec failed, sql: %s", stmt)
+	}
+
+	sp := &SQLiteCheckPoint{
+		db:              db,
+		clusterID:       clusterID,
+		initialCommitTS: initialCommitTS,
+		TsMap:           make(map[string]int64),
+	}
+	if err := sp.Load(); err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+	return sp, nil
+}
+
+// Load implements CheckPoint.Load interface
+func (sp *SQLiteCheckPoint) Load() error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	defer func() {
+		if sp.CommitTS == 0 {
+			sp.CommitTS = sp.initialCommitTS
+		}
+	}()
+
+	str, err := sp.query(sp.db)
+	if err != nil || len(str) == 0 {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(json.Unmarshal([]byte(str), sp))
+}
+
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// query returns the saved checkpoint, or "" if nothing is saved.
+func (sp *SQLiteCheckPoint) query(q queryer) (string, error) {
+	var str string
+	stmt := fmt.Sprintf("select checkPoint from %s where clusterID = ?", sqliteCheckPointTable)
+	err := q.QueryRow(stmt, sp.clusterID).Scan(&str)
+	if err != nil && err != sql.ErrNoRows {
+		return "", errors.Annotatef(err, "QueryRow failed, sql: %s", stmt)
+	}
+	return str, nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// save must be called with the lock held.
+func (sp *SQLiteCheckPoint) save(e execer, ts, secondaryTS int64, consistent bool) error {
+	sp.CommitTS = ts
+	sp.ConsistentSaved = consistent
+
+	if secondaryTS > 0 {
+		sp.TsMap["primary-ts"] = ts
+		sp.TsMap["secondary-ts"] = secondaryTS
+	}
+
+	b, err := json.Marshal(sp)
+	if err != nil {
+		return errors.Annotate(err, "json marshal failed")
+	}
+
+	stmt := fmt.Sprintf("replace into %s values(?, ?)", sqliteCheckPointTable)
+	if _, err = e.Exec(stmt, sp.clusterID, string(b)); err != nil {
+		return errors.Annotatef(err, "exec failed, sql: %s", stmt)
+	}
+	return nil
+}
+
+// Save implements CheckPoint.Save interface
+func (sp *SQLiteCheckPoint) Save(ts, secondaryTS int64, consistent bool) error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	return errors.Trace(sp.save(sp.db, ts, secondaryTS, consistent))
+}
+
+// CompareAndSave saves the ts only if the saved commit ts is expectedTS, it returns false if not,
+// the comparison and the saving are done in one txn.
+func (sp *SQLiteCheckPoint) CompareAndSave(expectedTS, ts, secondaryTS int64, consistent bool) (bool, error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return false, errors.Trace(ErrCheckPointClosed)
+	}
+
+	tx, err := sp.db.Begin()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer tx.Rollback()
+
+	str, err := sp.query(tx)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	saved := struct {
+		CommitTS int64 `json:"commitTS"`
+	}{CommitTS: sp.initialCommitTS}
+	if len(str) > 0 {
+		if err := json.Unmarshal([]byte(str), &saved); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+	if saved.CommitTS != expectedTS {
+		return false, nil
+	}
+
+	if err := sp.save(tx, ts, secondaryTS, consistent); err != nil {
+		return false, errors.Trace(err)
+	}
+	return true, errors.Trace(tx.Commit())
+}
+
+// IsConsistent implements CheckPoint interface
+func (sp *SQLiteCheckPoint) IsConsistent() bool {
+	sp.RLock()
+	defer sp.RUnlock()
+
+	return sp.ConsistentSaved
+}
+
+// TS implements CheckPoint.TS interface
+func (sp *SQLiteCheckPoint) TS() int64 {
+	sp.RLock()
+	defer sp.RUnlock()
+
+	return sp.CommitTS
+}
+
+// Close implements CheckPoint.Close interface
+func (sp *SQLiteCheckPoint) Close() error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	err := sp.db.Close()
+	if err == nil {
+		sp.closed = true
+	}
+	return errors.Trace(err)
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"path/filepath"
+	"sync"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+var _ = Suite(&sqliteSuite{})
+
+type sqliteSuite struct{}
+
+func (s *sqliteSuite) TestSaveAndLoad(c *C) {
+	path := filepath.Join(c.MkDir(), "savepoint.db")
+	cp, err := NewSQLite(1, 10, path)
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(10))
+	c.Assert(cp.IsConsistent(), IsFalse)
+
+	c.Assert(cp.Save(20, 15, true), IsNil)
+	c.Assert(cp.TS(), Equals, int64(20))
+	c.Assert(cp.Close(), IsNil)
+	c.Assert(errors.Cause(cp.Save(30, 0, false)), Equals, ErrCheckPointClosed)
+	c.Assert(errors.Cause(cp.Close()), Equals, ErrCheckPointClosed)
+
+	cp, err = NewSQLite(1, 10, path)
+	c.Assert(err, IsNil)
+	defer cp.Close()
+	c.Assert(cp.TS(), Equals, int64(20))
+	c.Assert(cp.IsConsistent(), IsTrue)
+	c.Assert(cp.TsMap, DeepEquals, map[string]int64{"primary-ts": 20, "secondary-ts": 15})
+
+	// the checkpoints of different clusters are saved separately
+	other, err := NewSQLite(2, 5, path)
+	c.Assert(err, IsNil)
+	defer other.Close()
+	c.Assert(other.TS(), Equals, int64(5))
+}
+
+func (s *sqliteSuite) TestConcurrentSave(c *C) {
+	path := filepath.Join(c.MkDir(), "savepoint.db")
+	cp, err := NewSQLite(1, 0, path)
+	c.Assert(err, IsNil)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				c.Check(cp.Save(int64(i*100+j), 0, false), IsNil)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	ts := cp.TS()
+	c.Assert(cp.Close(), IsNil)
+
+	cp, err = NewSQLite(1, 0, path)
+	c.Assert(err, IsNil)
+	defer cp.Close()
+	c.Assert(cp.TS(), Equals, ts)
+}
+
+func (s *sqliteSuite) TestCrashAndReload(c *C) {
+	path := filepath.Join(c.MkDir(), "savepoint.db")
+	cp, err := NewSQLite(1, 0, path)
+	c.Assert(err, IsNil)
+	c.Assert(cp.Save(100, 0, true), IsNil)
+
+	// reload while the first one is not closed, as if the process crashed after saving
+	reloaded, err := NewSQLite(1, 0, path)
+	c.Assert(err, IsNil)
+	defer reloaded.Close()
+	c.Assert(reloaded.TS(), Equals, int64(100))
+	c.Assert(reloaded.IsConsistent(), IsTrue)
+	c.Assert(cp.db.Close(), IsNil)
+}
+
+func (s *sqliteSuite) TestCompareAndSave(c *C) {
+	path := filepath.Join(c.MkDir(), "savepoint.db")
+	cp, err := NewSQLite(1, 10, path)
+	c.Assert(err, IsNil)
+	defer cp.Close()
+
+	// compared with the initial commit ts if nothing is saved
+	saved, err := cp.CompareAndSave(10, 20, 0, false)
+	c.Assert(err, IsNil)
+	c.Assert(saved, IsTrue)
+	c.Assert(cp.TS(), Equals, int64(20))
+
+	saved, err = cp.CompareAndSave(10, 30, 0, false)
+	c.Assert(err, IsNil)
+	c.Assert(saved, IsFalse)
+	c.Assert(cp.TS(), Equals, int64(20))
+
+	// another drainer advances the checkpoint
+	other, err := NewSQLite(1, 10, path)
+	c.Assert(err, IsNil)
+	defer other.Close()
+	c.Assert(other.Save(40, 0, false), IsNil)
+
+	saved, err = cp.CompareAndSave(20, 50, 0, false)
+	c.Assert(err, IsNil)
+	c.Assert(saved, IsFalse)
+
+	saved, err = cp.CompareAndSave(40, 50, 0, true)
+	c.Assert(err, IsNil)
+	c.Assert(saved, IsTrue)
+	c.Assert(other.Load(), IsNil)
+	c.Assert(other.TS(), Equals, int64(50))
+	c.Assert(other.IsConsistent(), IsTrue)
+}
@@ -48,6 +48,9 @@ type Config struct {
 	ClusterID       uint64
 	InitialCommitTS int64
 	CheckPointFile  string `toml:"dir" json:"dir"`
+
+	// keep the DDL history by CompressedCheckpoint, only for the mysql and tidb types
+	DDLHistory bool
 }
 
 func setDefaultConfig(cfg *Config) {
@@ -82,6 +82,10 @@ type SyncerConfig struct {
 	DisableDispatchFile *bool `toml:"disable-dispatch" json:"disable-dispatch"`
 	EnableDispatchFile  *bool `toml:"enable-dispatch" json:"enable-dispatch"`
 	SafeMode            bool  `toml:"safe-mode" json:"safe-mode"`
+	// save checkpoint every n synced txns instead of every 3 seconds if it's > 0
+	CheckpointSyncInterval int `toml:"checkpoint-sync-interval" json:"checkpoint-sync-interval"`
+	// compare the schemas of synced tables with the downstream ones every n seconds if it's > 0
+	SchemaHashCheckInterval int `toml:"schema-hash-check-interval" json:"schema-hash-check-interval"`
 	// for backward compatibility.
 	// disable* is keep for backward compatibility.
 	// if both setted, the disable one take affect.
@@ -140,6 +144,8 @@ func (c *SyncerConfig) EnableCausality() bool {
 type RelayConfig struct {
 	LogDir      string `toml:"log-dir" json:"log-dir"`
 	MaxFileSize int64  `toml:"max-file-size" json:"max-file-size"`
+	// LogCompression compresses every binlog in the relay log with snappy.
+	LogCompression bool `toml:"log-compression" json:"log-compression"`
 }
 
 // IsEnabled return true if we need to handle relay log.
@@ -208,9 +214,10 @@ func NewConfig() *Config {
 	fs.Int64Var(&cfg.SyncerCfg.ChannelID, "channel-id", 0, "sync channel id ")
 	fs.StringVar(&cfg.SyncerCfg.IgnoreSchemas, "ignore-schemas", "INFORMATION_SCHEMA,PERFORMANCE_SCHEMA,mysql", "disable sync those schemas")
 	fs.IntVar(&cfg.SyncerCfg.WorkerCount, "c", 16, "parallel worker count")
-	fs.StringVar(&cfg.SyncerCfg.DestDBType, "dest-db-type", "mysql", "target db type: mysql or tidb or file or kafka; see syncer section in conf/drainer.toml")
+	fs.StringVar(&cfg.SyncerCfg.DestDBType, "dest-db-type", "mysql", "target db type: mysql or tidb or file or kafka or s3 or nats or webhook; see syncer section in conf/drainer.toml")
 	fs.StringVar(&cfg.SyncerCfg.Relay.LogDir, "relay-log-dir", "", "path to relay log of syncer")
 	fs.Int64Var(&cfg.SyncerCfg.Relay.MaxFileSize, "relay-max-file-size", 10485760, "max file size of each relay log")
+	fs.BoolVar(&cfg.SyncerCfg.Relay.LogCompression, "relay-log-compression", false, "compress the relay log with snappy")
 	fs.BoolVar(cfg.SyncerCfg.DisableDispatchFlag, "disable-dispatch", false, "DEPRECATED, use enable-dispatch")
 	fs.BoolVar(cfg.SyncerCfg.EnableDispatchFlag, "enable-dispatch", true, "enable dispatching sqls that in one same binlog; if set false, work-count and txn-batch would be useless")
 	fs.BoolVar(&cfg.SyncerCfg.SafeMode, "safe-mode", false, "enable safe mode to make syncer reentrant")
@@ -331,7 +338,7 @@ func (cfg *Config) Parse(args []string) error {
 }
 
 func (c *SyncerConfig) adjustWorkCount() {
-	if c.DestDBType == "file" || c.DestDBType == "kafka" {
+	if c.DestDBType == "file" || c.DestDBType == "kafka" || c.DestDBType == "s3" || c.DestDBType == "nats" || c.DestDBType == "webhook" {
 		c.WorkerCount = 1
 	} else if !c.EnableDispatch() {
 		c.WorkerCount = 1
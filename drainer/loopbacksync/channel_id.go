@@ -0,0 +1,45 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loopbacksync
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// GenerateChannelID returns the channel id of the drainer in the cluster, so the drainers of different clusters
+// don't need to be assigned channel ids manually to avoid collision. The id is the FNV-64a hash of clusterID
+// and drainerID, which is always positive and is the same for the same inputs.
+func GenerateChannelID(clusterID uint64, drainerID string) int64 {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], clusterID)
+
+	h := fnv.New64a()
+	// the writes of hash.Hash never fail
+	_, _ = h.Write(buf[:])
+	_, _ = h.Write([]byte(drainerID))
+
+	id := int64(h.Sum64() & math.MaxInt64)
+	if id == 0 {
+		// 0 means the channel id is not set
+		id = 1
+	}
+	return id
+}
+
+// ValidateChannelID checks whether id is the channel id generated by GenerateChannelID for clusterID and drainerID.
+func ValidateChannelID(id int64, clusterID uint64, drainerID string) bool {
+	return id == GenerateChannelID(clusterID, drainerID)
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loopbacksync
+
+import (
+	"fmt"
+
+	"github.com/pingcap/check"
+)
+
+type channelIDSuite struct{}
+
+var _ = check.Suite(&channelIDSuite{})
+
+func (s *channelIDSuite) TestDeterministic(c *check.C) {
+	id := GenerateChannelID(6789, "drainer-1:8249")
+	c.Assert(id > 0, check.IsTrue)
+	for i := 0; i < 10; i++ {
+		c.Assert(GenerateChannelID(6789, "drainer-1:8249"), check.Equals, id)
+	}
+
+	c.Assert(ValidateChannelID(id, 6789, "drainer-1:8249"), check.IsTrue)
+	c.Assert(ValidateChannelID(id, 6790, "drainer-1:8249"), check.IsFalse)
+	c.Assert(ValidateChannelID(id, 6789, "drainer-2:8249"), check.IsFalse)
+	c.Assert(ValidateChannelID(id+1, 6789, "drainer-1:8249"), check.IsFalse)
+}
+
+func (s *channelIDSuite) TestUnique(c *check.C) {
+	ids := make(map[int64]string)
+	for clusterID := uint64(0); clusterID < 50; clusterID++ {
+		for i := 0; i < 50; i++ {
+			drainerID := fmt.Sprintf("drainer-%d:8249", i)
+			id := GenerateChannelID(clusterID, drainerID)
+			c.Assert(id > 0, check.IsTrue)
+
+			key := fmt.Sprintf("%d/%s", clusterID, drainerID)
+			prev, ok := ids[id]
+			c.Assert(ok, check.IsFalse, check.Commentf("%s and %s have the same channel id %d", prev, key, id))
+			ids[id] = key
+		}
+	}
+
+	// the cluster id isn't simply concatenated with the drainer id
+	c.Assert(GenerateChannelID(1, "2"), check.Not(check.Equals), GenerateChannelID(12, ""))
+}
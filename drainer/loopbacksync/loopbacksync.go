@@ -24,8 +24,10 @@ import (
 )
 
 const (
+	markDBName    = "retl"
+	markTableName = "_drainer_repl_mark"
 	//MarkTableName mark table name
-	MarkTableName = "retl._drainer_repl_mark"
+	MarkTableName = markDBName + "." + markTableName
 	//ID syncer worker coroutine id
 	ID = "id"
 	//ChannelID channel id
@@ -47,6 +49,9 @@ type LoopBackSync struct {
 	ChannelID       int64
 	LoopbackControl bool
 	SyncDDL         bool
+	// RecordID is the count of rows initialized in the mark table for the channel,
+	// the ids of rows are from 0 to RecordID-1.
+	RecordID int64
 }
 
 //NewLoopBackSyncInfo return LoopBackSyncInfo objec
@@ -76,19 +81,85 @@ func CreateMarkTable(db *sql.DB) error {
 
 // InitMarkTableData init rowNum rows in the mark table for channelID.
 func InitMarkTableData(db *sql.DB, rowNum int, channelID int64) error {
+	return errors.Trace(replaceMarkRows(db, 0, rowNum, channelID))
+}
+
+const markTableExistsSQL = `
+SELECT COUNT(*) FROM information_schema.tables
+WHERE table_schema = ? AND table_name = ?;`
+
+// InitMarkTableIfNeeded creates the mark table and inits info.RecordID rows for info.ChannelID in it,
+// unless the table exists with exactly info.RecordID rows for the channel, in which case the rows
+// may be in use by the in-flight replication and are kept as they are.
+func InitMarkTableIfNeeded(db *sql.DB, info *LoopBackSync) error {
+	var tables int
+	if err := db.QueryRow(markTableExistsSQL, markDBName, markTableName).Scan(&tables); err != nil {
+		return errors.Annotate(err, "failed to check whether mark table exists")
+	}
+	if tables > 0 {
+		count, err := countMarkRows(db, info.ChannelID)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if count == info.RecordID {
+			log.Info("mark table is initialized already", zap.Int64("channel id", info.ChannelID),
+				zap.Int64("rows", count))
+			return nil
+		}
+		log.Warn("reinit mark table", zap.Int64("channel id", info.ChannelID),
+			zap.Int64("rows", count), zap.Int64("expect", info.RecordID))
+	} else if err := CreateMarkTable(db); err != nil {
+		return errors.Trace(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// remove the rows out of range left by a run with more workers
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s >= ?", MarkTableName, ChannelID, ID)
+	_, err = tx.Exec(query, info.ChannelID, info.RecordID)
+	if err == nil && info.RecordID > 0 {
+		err = replaceMarkRows(tx, 0, int(info.RecordID), info.ChannelID)
+	}
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Error("failed to rollback", zap.Error(rbErr))
+		}
+		return errors.Annotatef(err, "failed to init %d rows of mark table", info.RecordID)
+	}
+
+	return errors.Trace(tx.Commit())
+}
+
+func countMarkRows(db *sql.DB, channelID int64) (int64, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", MarkTableName, ChannelID)
+	var count int64
+	if err := db.QueryRow(query, channelID).Scan(&count); err != nil {
+		return 0, errors.Annotate(err, "failed to count rows of mark table")
+	}
+	return count, nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// replaceMarkRows inits the rows with ids in [from, to) in the mark table for channelID.
+func replaceMarkRows(db execer, from, to int, channelID int64) error {
 	var builder strings.Builder
 	holder := "(?,?,?,?)"
 	columns := fmt.Sprintf("(%s,%s,%s,%s) ", ID, ChannelID, Val, ChannelInfo)
 	builder.WriteString("REPLACE INTO " + MarkTableName + columns + " VALUES ")
-	for i := 0; i < rowNum; i++ {
-		if i > 0 {
+	for i := from; i < to; i++ {
+		if i > from {
 			builder.WriteByte(',')
 		}
 		builder.WriteString(holder)
 	}
 
 	var args []interface{}
-	for id := 0; id < rowNum; id++ {
+	for id := from; id < to; id++ {
 		args = append(args, id, channelID, 1 /* value */, "" /*channel_info*/)
 	}
 
@@ -101,6 +172,48 @@ func InitMarkTableData(db *sql.DB, rowNum int, channelID int64) error {
 	return nil
 }
 
+// MarkTableRebalancer adjusts the rows of the mark table when the worker count is changed,
+// every worker needs a row with the id of it in the mark table.
+type MarkTableRebalancer struct{}
+
+// Rebalance adds or removes the rows of info.ChannelID in the mark table in a transaction to make
+// the ids of rows from 0 to newWorkerCount-1, and sets info.RecordID to newWorkerCount if succeed.
+func (MarkTableRebalancer) Rebalance(db *sql.DB, info *LoopBackSync, newWorkerCount int) error {
+	if newWorkerCount <= 0 {
+		return errors.Errorf("invalid worker count %d", newWorkerCount)
+	}
+	if int64(newWorkerCount) == info.RecordID {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if int64(newWorkerCount) > info.RecordID {
+		err = replaceMarkRows(tx, int(info.RecordID), newWorkerCount, info.ChannelID)
+	} else {
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s >= ?", MarkTableName, ChannelID, ID)
+		_, err = tx.Exec(query, info.ChannelID, newWorkerCount)
+	}
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Error("failed to rollback", zap.Error(rbErr))
+		}
+		return errors.Annotatef(err, "failed to rebalance mark table from %d to %d rows", info.RecordID, newWorkerCount)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("rebalance mark table", zap.Int64("channel id", info.ChannelID),
+		zap.Int64("from", info.RecordID), zap.Int("to", newWorkerCount))
+	info.RecordID = int64(newWorkerCount)
+	return nil
+}
+
 // CleanMarkTableData clean up the data in mark table.
 func CleanMarkTableData(db *sql.DB, channelID int64) error {
 	sql := fmt.Sprintf("delete from %s where %s = ? ", MarkTableName, ChannelID)
@@ -120,3 +233,43 @@ func UpdateMark(tx *sql.Tx, id int64, channelID int64) error {
 
 	return errors.Trace(err)
 }
+
+// MarkTableHealthCheck checks the rows of the channel in the mark table are not deleted externally.
+func MarkTableHealthCheck(db *sql.DB, info *LoopBackSync) error {
+	count, err := countMarkRows(db, info.ChannelID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if count == info.RecordID {
+		return nil
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", ID, MarkTableName, ChannelID)
+	rows, err := db.Query(query, info.ChannelID)
+	if err != nil {
+		return errors.Annotate(err, "failed to query ids of mark table")
+	}
+	defer rows.Close()
+
+	present := make(map[int64]struct{}, count)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return errors.Trace(err)
+		}
+		present[id] = struct{}{}
+	}
+	if err = rows.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	var missing []string
+	for id := int64(0); id < info.RecordID; id++ {
+		if _, ok := present[id]; !ok {
+			missing = append(missing, fmt.Sprintf("missing row %s=%d %s=%d", ID, id, ChannelID, info.ChannelID))
+		}
+	}
+
+	return errors.Errorf("mark table %s has %d rows for channel %d, expect %d: %s",
+		MarkTableName, count, info.ChannelID, info.RecordID, strings.Join(missing, "; "))
+}
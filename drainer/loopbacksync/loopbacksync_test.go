@@ -20,6 +20,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
 )
 
 func Test(t *testing.T) { check.TestingT(t) }
@@ -78,6 +79,63 @@ func (s *loopbackSuite) TestInitMarkTableData(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *loopbackSuite) TestInitMarkTableIfNeeded(c *check.C) {
+	existsSQL := regexp.QuoteMeta("SELECT COUNT(*) FROM information_schema.tables")
+	countSQL := regexp.QuoteMeta("SELECT COUNT(*) FROM retl._drainer_repl_mark WHERE channel_id = ?")
+	deleteSQL := regexp.QuoteMeta("DELETE FROM retl._drainer_repl_mark WHERE channel_id = ? AND id >= ?")
+	info := &LoopBackSync{ChannelID: 1, RecordID: 3}
+	var args []driver.Value
+	for id := 0; id < 3; id++ {
+		args = append(args, id, info.ChannelID, 1 /*value*/, "" /*channel_info*/)
+	}
+
+	// fresh init
+	db, mk, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mk.ExpectQuery(existsSQL).WithArgs("retl", "_drainer_repl_mark").
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	mk.ExpectExec(regexp.QuoteMeta(CreateMarkDBDDL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mk.ExpectExec(regexp.QuoteMeta(CreateMarkTableDDL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mk.ExpectBegin()
+	mk.ExpectExec(deleteSQL).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mk.ExpectExec("REPLACE INTO .*").WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 3))
+	mk.ExpectCommit()
+	c.Assert(InitMarkTableIfNeeded(db, info), check.IsNil)
+	c.Assert(mk.ExpectationsWereMet(), check.IsNil)
+
+	// already initialized, the rows are not touched
+	db, mk, err = sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mk.ExpectQuery(existsSQL).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mk.ExpectQuery(countSQL).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(3))
+	c.Assert(InitMarkTableIfNeeded(db, info), check.IsNil)
+	c.Assert(mk.ExpectationsWereMet(), check.IsNil)
+
+	// partial data, the rows are reinitialized
+	db, mk, err = sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mk.ExpectQuery(existsSQL).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mk.ExpectQuery(countSQL).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(5))
+	mk.ExpectBegin()
+	mk.ExpectExec(deleteSQL).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 2))
+	mk.ExpectExec("REPLACE INTO .*").WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 3))
+	mk.ExpectCommit()
+	c.Assert(InitMarkTableIfNeeded(db, info), check.IsNil)
+	c.Assert(mk.ExpectationsWereMet(), check.IsNil)
+
+	// failed to init
+	db, mk, err = sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mk.ExpectQuery(existsSQL).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mk.ExpectQuery(countSQL).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	mk.ExpectBegin()
+	mk.ExpectExec(deleteSQL).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mk.ExpectExec("REPLACE INTO .*").WillReturnError(errors.New("replace fail"))
+	mk.ExpectRollback()
+	c.Assert(InitMarkTableIfNeeded(db, info), check.ErrorMatches, "failed to init 3 rows of mark table: replace fail")
+	c.Assert(mk.ExpectationsWereMet(), check.IsNil)
+}
+
 func (s *loopbackSuite) TestCleanMarkTableData(c *check.C) {
 	db, mk, err := sqlmock.New()
 	c.Assert(err, check.IsNil)
@@ -111,3 +169,92 @@ func (s *loopbackSuite) TestUpdateMark(c *check.C) {
 	err = mk.ExpectationsWereMet()
 	c.Assert(err, check.IsNil)
 }
+
+func (s *loopbackSuite) TestMarkTableHealthCheck(c *check.C) {
+	db, mk, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	info := &LoopBackSync{ChannelID: 1, RecordID: 3}
+	countSQL := regexp.QuoteMeta("SELECT COUNT(*) FROM retl._drainer_repl_mark WHERE channel_id = ?")
+	idsSQL := regexp.QuoteMeta("SELECT id FROM retl._drainer_repl_mark WHERE channel_id = ?")
+
+	// correct
+	mk.ExpectQuery(countSQL).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(3))
+	err = MarkTableHealthCheck(db, info)
+	c.Assert(err, check.IsNil)
+
+	// missing rows
+	mk.ExpectQuery(countSQL).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mk.ExpectQuery(idsSQL).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	err = MarkTableHealthCheck(db, info)
+	c.Assert(err, check.ErrorMatches, "mark table .* has 1 rows for channel 1, expect 3: "+
+		"missing row id=0 channel_id=1; missing row id=2 channel_id=1")
+
+	// empty table
+	mk.ExpectQuery(countSQL).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	mk.ExpectQuery(idsSQL).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	err = MarkTableHealthCheck(db, info)
+	c.Assert(err, check.ErrorMatches, "mark table .* has 0 rows for channel 1, expect 3: "+
+		"missing row id=0 channel_id=1; missing row id=1 channel_id=1; missing row id=2 channel_id=1")
+
+	// no row is expected
+	mk.ExpectQuery(countSQL).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	err = MarkTableHealthCheck(db, &LoopBackSync{ChannelID: 1})
+	c.Assert(err, check.IsNil)
+
+	c.Assert(mk.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *loopbackSuite) TestRebalanceScaleUp(c *check.C) {
+	db, mk, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	info := &LoopBackSync{ChannelID: 1, RecordID: 4}
+	var args []driver.Value
+	for id := 4; id < 8; id++ {
+		args = append(args, id, info.ChannelID, 1 /*value*/, "" /*channel_info*/)
+	}
+	mk.ExpectBegin()
+	mk.ExpectExec("REPLACE INTO .*").WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 4))
+	mk.ExpectCommit()
+
+	err = MarkTableRebalancer{}.Rebalance(db, info, 8)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.RecordID, check.Equals, int64(8))
+	c.Assert(mk.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *loopbackSuite) TestRebalanceScaleDown(c *check.C) {
+	db, mk, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	info := &LoopBackSync{ChannelID: 1, RecordID: 8}
+	mk.ExpectBegin()
+	mk.ExpectExec(regexp.QuoteMeta("DELETE FROM retl._drainer_repl_mark WHERE channel_id = ? AND id >= ?")).
+		WithArgs(info.ChannelID, 4).WillReturnResult(sqlmock.NewResult(0, 4))
+	mk.ExpectCommit()
+
+	err = MarkTableRebalancer{}.Rebalance(db, info, 4)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.RecordID, check.Equals, int64(4))
+	c.Assert(mk.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *loopbackSuite) TestRebalanceFailed(c *check.C) {
+	db, mk, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	info := &LoopBackSync{ChannelID: 1, RecordID: 8}
+	mk.ExpectBegin()
+	mk.ExpectExec("DELETE FROM .*").WillReturnError(errors.New("delete failed"))
+	mk.ExpectRollback()
+
+	err = MarkTableRebalancer{}.Rebalance(db, info, 4)
+	c.Assert(err, check.ErrorMatches, ".*from 8 to 4 rows: delete failed")
+	c.Assert(info.RecordID, check.Equals, int64(8))
+	c.Assert(mk.ExpectationsWereMet(), check.IsNil)
+
+	// nothing to do
+	err = MarkTableRebalancer{}.Rebalance(db, info, 8)
+	c.Assert(err, check.IsNil)
+	c.Assert(MarkTableRebalancer{}.Rebalance(db, info, 0), check.NotNil)
+}
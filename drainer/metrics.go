@@ -16,6 +16,7 @@ package drainer
 import (
 	"github.com/pingcap/tidb-binlog/drainer/sync"
 	bf "github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -52,6 +53,14 @@ var (
 			Help:      "Total count of binlog which is disorder.",
 		})
 
+	schemaHashMismatchCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "schema_hash_mismatch_total",
+			Help:      "Total count of downstream tables whose schema diverges from the upstream one.",
+		})
+
 	eventCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "binlog",
@@ -77,6 +86,14 @@ var (
 			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 22),
 		})
 
+	checkpointUnsavedTxnsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "checkpoint_unsaved_txns",
+			Help:      "the count of synced txns not saved in checkpoint yet.",
+		})
+
 	executeHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: "binlog",
@@ -120,12 +137,42 @@ var (
 			Name:      "queue_size",
 			Help:      "the size of queue",
 		}, []string{"name"})
+
+	kafkaSyncerOffsetGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "kafka_syncer_offset",
+			Help:      "the offset of the latest item consumed and confirmed by kafka syncer.",
+		}, []string{"type"})
+
+	systemSchemaSkipCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "loader",
+			Name:      "system_schema_skip_total",
+			Help:      "Total count of the DMLs and DDLs of system schemas dropped by the mysql syncer.",
+		})
+
+	loaderMetrics = newLoaderMetrics()
 )
 
 var registry = prometheus.NewRegistry()
 
+// newLoaderMetrics returns the metrics of loader, the queries and queues of loader are observed
+// by the metrics of drainer, and the events are counted by Syncer.
+func newLoaderMetrics() *loader.PipelineMetrics {
+	m := loader.NewPipelineMetrics("binlog", "loader")
+	m.EventCounterVec = nil
+	m.QueryHistogramVec = queryHistogramVec
+	m.QueueSizeGauge = queueSizeGauge
+	return m
+}
+
 func init() {
-	sync.QueueSizeGauge = queueSizeGauge
+	sync.LoaderMetrics = loaderMetrics
+	sync.KafkaOffsetGauge = kafkaSyncerOffsetGauge
+	sync.SystemSchemaSkipCounter = systemSchemaSkipCounter
 
 	registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
 	registry.MustRegister(prometheus.NewGoCollector())
@@ -134,12 +181,15 @@ func init() {
 	registry.MustRegister(errorCount)
 	registry.MustRegister(checkpointTSOGauge)
 	registry.MustRegister(checkpointDelayHistogram)
+	registry.MustRegister(checkpointUnsavedTxnsGauge)
 	registry.MustRegister(eventCounter)
+	registry.MustRegister(schemaHashMismatchCounter)
 	registry.MustRegister(executeHistogram)
 	registry.MustRegister(binlogReachDurationHistogram)
 	registry.MustRegister(readBinlogSizeHistogram)
-	registry.MustRegister(queryHistogramVec)
-	registry.MustRegister(queueSizeGauge)
+	registry.MustRegister(kafkaSyncerOffsetGauge)
+	registry.MustRegister(systemSchemaSkipCounter)
+	loaderMetrics.MustRegister(registry)
 
 	// for pb using it
 	bf.InitMetircs(registry)
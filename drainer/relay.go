@@ -6,6 +6,7 @@ import (
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
 	"github.com/pingcap/tidb-binlog/drainer/relay"
 	"github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
 	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
 	"go.uber.org/zap"
@@ -38,7 +39,7 @@ func feedByRelayLogIfNeed(cfg *Config) error {
 		return nil
 	}
 
-	reader, err := relay.NewReader(scfg.Relay.LogDir, 1 /* readBufferSize */)
+	reader, err := createRelayReader(scfg.Relay, 1 /* readBufferSize */)
 	if err != nil {
 		return errors.Annotate(err, "failed to create reader")
 	}
@@ -64,6 +65,30 @@ func feedByRelayLogIfNeed(cfg *Config) error {
 	return nil
 }
 
+// createRelayer creates a relay.Relayer by cfg, the relay log is compressed if cfg.LogCompression is set.
+func createRelayer(cfg RelayConfig, tableInfoGetter translator.TableInfoGetter) (relay.Relayer, error) {
+	if cfg.LogCompression {
+		r, err := relay.NewCompressingRelayer(cfg.LogDir, cfg.MaxFileSize, tableInfoGetter)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return r, nil
+	}
+	return relay.NewRelayer(cfg.LogDir, cfg.MaxFileSize, tableInfoGetter)
+}
+
+// createRelayReader creates a relay.Reader reading the relay log written by the relay.Relayer from createRelayer.
+func createRelayReader(cfg RelayConfig, readBufferSize int) (relay.Reader, error) {
+	if cfg.LogCompression {
+		r, err := relay.NewDecompressingReader(cfg.LogDir, readBufferSize)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return r, nil
+	}
+	return relay.NewReader(cfg.LogDir, readBufferSize)
+}
+
 // feedByRelayLog will take over the `ld loader.Loader`.
 func feedByRelayLog(r relay.Reader, ld loader.Loader, cp checkpoint.CheckPoint) error {
 	checkpointTS := cp.TS()
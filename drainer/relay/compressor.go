@@ -0,0 +1,72 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"github.com/golang/snappy"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+)
+
+var (
+	_ Relayer = &CompressingRelayer{}
+	_ Reader  = &DecompressingReader{}
+)
+
+// CompressingRelayer is a Relayer compressing every binlog with snappy before it's written into the relay log.
+// The relay log written by it can only be read by DecompressingReader.
+type CompressingRelayer struct {
+	*relayer
+}
+
+// NewCompressingRelayer creates a CompressingRelayer.
+func NewCompressingRelayer(dir string, maxFileSize int64, tableInfoGetter translator.TableInfoGetter) (*CompressingRelayer, error) {
+	r, err := NewRelayer(dir, maxFileSize, tableInfoGetter)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	cr := &CompressingRelayer{relayer: r.(*relayer)}
+	cr.encode = compressPayload
+	return cr, nil
+}
+
+// DecompressingReader is a Reader reading the relay log written by CompressingRelayer.
+type DecompressingReader struct {
+	*reader
+}
+
+// NewDecompressingReader creates a DecompressingReader.
+func NewDecompressingReader(dir string, readBufferSize int) (*DecompressingReader, error) {
+	r, err := NewReader(dir, readBufferSize)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	dr := &DecompressingReader{reader: r.(*reader)}
+	dr.decode = decompressPayload
+	return dr, nil
+}
+
+func compressPayload(data []byte) []byte {
+	return snappy.Encode(nil, data)
+}
+
+func decompressPayload(payload []byte) ([]byte, error) {
+	data, err := snappy.Decode(nil, payload)
+	if err != nil {
+		return nil, errors.Annotate(err, "decompress relay log entry")
+	}
+	return data, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+var _ = Suite(&testCompressorSuite{})
+
+type testCompressorSuite struct {
+	translator.BinlogGenerator
+}
+
+func (s *testCompressorSuite) TestRoundTrip(c *C) {
+	dir := c.MkDir()
+	// small file size to write across files
+	relayer, err := NewCompressingRelayer(dir, 4096, s)
+	c.Assert(err, IsNil)
+
+	sets := []func(){s.SetDDL, func() { s.SetInsert(c) }, func() { s.SetUpdate(c) }, func() { s.SetDelete(c) }}
+	var expected []*obinlog.Binlog
+	for i := 0; i < 100; i++ {
+		sets[i%len(sets)]()
+		binlog, err := translator.TiBinlogToSecondaryBinlog(s, s.Schema, s.Table, s.TiBinlog, s.PV)
+		c.Assert(err, IsNil)
+		expected = append(expected, binlog)
+
+		_, err = relayer.WriteBinlog(s.Schema, s.Table, s.TiBinlog, s.PV)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(relayer.Close(), IsNil)
+
+	reader, err := NewDecompressingReader(dir, 8)
+	c.Assert(err, IsNil)
+	reader.Run()
+	var binlogs []*obinlog.Binlog
+	for binlog := range reader.Binlogs() {
+		binlogs = append(binlogs, binlog)
+	}
+	c.Assert(<-reader.Error(), IsNil)
+	c.Assert(reader.Close(), IsNil)
+
+	c.Assert(binlogs, HasLen, len(expected))
+	for i := range expected {
+		c.Assert(binlogs[i], DeepEquals, expected[i], Commentf("binlog #%d", i))
+	}
+}
+
+func (s *testCompressorSuite) TestReadUncompressed(c *C) {
+	dir := c.MkDir()
+	relayer, err := NewRelayer(dir, 0, s)
+	c.Assert(err, IsNil)
+	s.SetDDL()
+	_, err = relayer.WriteBinlog(s.Schema, s.Table, s.TiBinlog, s.PV)
+	c.Assert(err, IsNil)
+	c.Assert(relayer.Close(), IsNil)
+
+	reader, err := NewDecompressingReader(dir, 8)
+	c.Assert(err, IsNil)
+	reader.Run()
+	for range reader.Binlogs() {
+		c.Fatal("the uncompressed binlog should not be read")
+	}
+	c.Assert(<-reader.Error(), ErrorMatches, "decompress relay log entry.*")
+	c.Assert(reader.Close(), IsNil)
+}
+
+// newTypicalPayload returns a marshaled binlog inserting rows into a table like the ones of an order system.
+func newTypicalPayload(rows int) []byte {
+	columns := []*obinlog.ColumnInfo{
+		{Name: "id", MysqlType: "bigint", IsPrimaryKey: true},
+		{Name: "user_id", MysqlType: "bigint"},
+		{Name: "status", MysqlType: "varchar"},
+		{Name: "amount", MysqlType: "double"},
+		{Name: "address", MysqlType: "varchar"},
+		{Name: "created_at", MysqlType: "datetime"},
+	}
+	table := &obinlog.Table{
+		SchemaName: proto.String("shop"),
+		TableName:  proto.String("orders"),
+		ColumnInfo: columns,
+	}
+	for i := 0; i < rows; i++ {
+		row := &obinlog.Row{Columns: []*obinlog.Column{
+			{Int64Value: proto.Int64(int64(100000 + i))},
+			{Int64Value: proto.Int64(int64(i % 97))},
+			{StringValue: proto.String([]string{"created", "paid", "shipped"}[i%3])},
+			{DoubleValue: proto.Float64(float64(i%1000) + 0.99)},
+			{StringValue: proto.String(fmt.Sprintf("No.%d, Example Road, Example City", i%50))},
+			{StringValue: proto.String(fmt.Sprintf("2019-11-%02d 12:%02d:%02d", i%28+1, i%60, i%60))},
+		}}
+		table.Mutations = append(table.Mutations, &obinlog.TableMutation{
+			Type: obinlog.MutationType_Insert.Enum(),
+			Row:  row,
+		})
+	}
+	binlog := &obinlog.Binlog{
+		Type:     obinlog.BinlogType_DML,
+		CommitTs: 412345678901234567,
+		DmlData:  &obinlog.DMLData{Tables: []*obinlog.Table{table}},
+	}
+	data, err := binlog.Marshal()
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// BenchmarkCompressPayload compresses binlogs inserting 100 rows, and reports the ratio of the original size
+// to the compressed size.
+func BenchmarkCompressPayload(b *testing.B) {
+	data := newTypicalPayload(100)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	var compressed []byte
+	for i := 0; i < b.N; i++ {
+		compressed = compressPayload(data)
+	}
+	b.ReportMetric(float64(len(data))/float64(len(compressed)), "ratio")
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	tb "github.com/pingcap/tipb/go-binlog"
+)
+
+// the length of the binary form of BinlogPosition
+const binlogPositionLen = 12
+
+// BinlogPosition is the position of an entry in relay log, it's the sequence of the relay log file and
+// the offset in the file. The positions are ordered by FileSeq and then Offset.
+type BinlogPosition struct {
+	FileSeq uint32
+	Offset  uint64
+}
+
+// newBinlogPosition converts the position used by binlogfile to BinlogPosition.
+func newBinlogPosition(pos tb.Pos) BinlogPosition {
+	return BinlogPosition{FileSeq: uint32(pos.Suffix), Offset: uint64(pos.Offset)}
+}
+
+// binlogPos converts p to the position used by binlogfile.
+func (p BinlogPosition) binlogPos() tb.Pos {
+	return tb.Pos{Suffix: uint64(p.FileSeq), Offset: int64(p.Offset)}
+}
+
+// Less returns whether p is before other.
+func (p BinlogPosition) Less(other BinlogPosition) bool {
+	if p.FileSeq != other.FileSeq {
+		return p.FileSeq < other.FileSeq
+	}
+	return p.Offset < other.Offset
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, the FileSeq and Offset are encoded in big endian,
+// so the encoded positions are in the same order as the positions.
+func (p BinlogPosition) MarshalBinary() ([]byte, error) {
+	data := make([]byte, binlogPositionLen)
+	binary.BigEndian.PutUint32(data, p.FileSeq)
+	binary.BigEndian.PutUint64(data[4:], p.Offset)
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (p *BinlogPosition) UnmarshalBinary(data []byte) error {
+	if len(data) != binlogPositionLen {
+		return errors.Errorf("invalid binlog position of %d bytes, expect %d", len(data), binlogPositionLen)
+	}
+	p.FileSeq = binary.BigEndian.Uint32(data)
+	p.Offset = binary.BigEndian.Uint64(data[4:])
+	return nil
+}
+
+// String formats p like `3:1024`.
+func (p BinlogPosition) String() string {
+	return fmt.Sprintf("%d:%d", p.FileSeq, p.Offset)
+}
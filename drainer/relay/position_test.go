@@ -0,0 +1,89 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"bytes"
+	"math"
+
+	. "github.com/pingcap/check"
+	tb "github.com/pingcap/tipb/go-binlog"
+)
+
+var _ = Suite(&testPositionSuite{})
+
+type testPositionSuite struct{}
+
+func (s *testPositionSuite) TestLess(c *C) {
+	tests := []struct {
+		a, b BinlogPosition
+		less bool
+	}{
+		// same file, different offset
+		{BinlogPosition{FileSeq: 1, Offset: 10}, BinlogPosition{FileSeq: 1, Offset: 11}, true},
+		{BinlogPosition{FileSeq: 1, Offset: 11}, BinlogPosition{FileSeq: 1, Offset: 10}, false},
+		// equal
+		{BinlogPosition{FileSeq: 1, Offset: 10}, BinlogPosition{FileSeq: 1, Offset: 10}, false},
+		{BinlogPosition{}, BinlogPosition{}, false},
+		// different files, the offset doesn't matter
+		{BinlogPosition{FileSeq: 1, Offset: math.MaxUint64}, BinlogPosition{FileSeq: 2, Offset: 0}, true},
+		{BinlogPosition{FileSeq: 2, Offset: 0}, BinlogPosition{FileSeq: 1, Offset: math.MaxUint64}, false},
+		{BinlogPosition{FileSeq: math.MaxUint32 - 1, Offset: 1}, BinlogPosition{FileSeq: math.MaxUint32}, true},
+	}
+	for _, t := range tests {
+		c.Assert(t.a.Less(t.b), Equals, t.less, Commentf("%s < %s", t.a, t.b))
+	}
+}
+
+func (s *testPositionSuite) TestBinaryRoundTrip(c *C) {
+	positions := []BinlogPosition{
+		{},
+		{FileSeq: 1, Offset: 1024},
+		{FileSeq: 1, Offset: 1025},
+		{FileSeq: 2, Offset: 0},
+		{FileSeq: math.MaxUint32, Offset: math.MaxUint64},
+	}
+
+	var last []byte
+	for i, pos := range positions {
+		data, err := pos.MarshalBinary()
+		c.Assert(err, IsNil)
+		c.Assert(data, HasLen, binlogPositionLen)
+
+		var decoded BinlogPosition
+		c.Assert(decoded.UnmarshalBinary(data), IsNil)
+		c.Assert(decoded, Equals, pos)
+
+		// the encoded positions are in the same order
+		if i > 0 {
+			c.Assert(bytes.Compare(last, data) < 0, IsTrue, Commentf("%s", pos))
+		}
+		last = data
+	}
+
+	var pos BinlogPosition
+	c.Assert(pos.UnmarshalBinary([]byte{1, 2, 3}), ErrorMatches, "invalid binlog position of 3 bytes, expect 12")
+	c.Assert(pos.UnmarshalBinary(nil), NotNil)
+}
+
+func (s *testPositionSuite) TestString(c *C) {
+	c.Assert(BinlogPosition{FileSeq: 3, Offset: 1024}.String(), Equals, "3:1024")
+	c.Assert(BinlogPosition{}.String(), Equals, "0:0")
+}
+
+func (s *testPositionSuite) TestBinlogPos(c *C) {
+	pos := tb.Pos{Suffix: 3, Offset: 1024}
+	c.Assert(newBinlogPosition(pos), Equals, BinlogPosition{FileSeq: 3, Offset: 1024})
+	c.Assert(newBinlogPosition(pos).binlogPos(), Equals, pos)
+}
@@ -15,6 +15,7 @@ package relay
 
 import (
 	"context"
+	"io"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
@@ -44,6 +45,8 @@ type reader struct {
 	binlogger binlogfile.Binlogger
 	binlogs   chan *obinlog.Binlog
 	err       chan error
+	// decode transforms the payload before it's unmarshaled, nil means unmarshaling it as it is.
+	decode func(payload []byte) ([]byte, error)
 }
 
 // NewReader creates a relay reader.
@@ -79,8 +82,15 @@ func (r *reader) Run() context.CancelFunc {
 				break
 			}
 
+			payload := blg.Payload
+			if r.decode != nil {
+				if payload, err = r.decode(payload); err != nil {
+					break
+				}
+			}
+
 			secondaryBinlog := new(obinlog.Binlog)
-			if err = secondaryBinlog.Unmarshal(blg.Payload); err != nil {
+			if err = secondaryBinlog.Unmarshal(payload); err != nil {
 				break
 			}
 
@@ -129,3 +139,72 @@ func (r *reader) Close() error {
 	}
 	return errors.Trace(err)
 }
+
+// the number of entries read from relay log files at a time by BinlogReader
+const binlogReaderBatchSize = 64
+
+// Item is a binlog read from relay log and the position right after it.
+// Note it can't be a sync.Item because drainer/sync depends on this package,
+// and the relay log only keeps the translated secondary binlog.
+type Item struct {
+	Binlog *obinlog.Binlog
+	Pos    BinlogPosition
+}
+
+// BinlogReader reads the entries of relay log files one by one from a given position.
+type BinlogReader struct {
+	binlogger binlogfile.Binlogger
+	pos       BinlogPosition
+	entities  []binlog.Entity
+}
+
+// NewBinlogReader creates a BinlogReader reading the entries after fromPos in dir,
+// a zero fromPos means reading from the beginning.
+func NewBinlogReader(dir string, fromPos BinlogPosition) (*BinlogReader, error) {
+	binlogger, err := binlogfile.OpenBinlogger(dir, binlogfile.SegmentSizeBytes)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &BinlogReader{
+		binlogger: binlogger,
+		pos:       fromPos,
+	}, nil
+}
+
+// Next returns the next binlog in relay log, io.EOF is returned if there is no more binlog.
+func (r *BinlogReader) Next(ctx context.Context) (*Item, error) {
+	select {
+	case <-ctx.Done():
+		return nil, errors.Trace(ctx.Err())
+	default:
+	}
+
+	if len(r.entities) == 0 {
+		entities, err := r.binlogger.ReadFrom(r.pos.binlogPos(), binlogReaderBatchSize)
+		if err != nil {
+			return nil, errors.Annotatef(err, "read relay log from %s", r.pos)
+		}
+		if len(entities) == 0 {
+			return nil, io.EOF
+		}
+		r.entities = entities
+	}
+
+	entity := r.entities[0]
+	r.entities = r.entities[1:]
+
+	pos := newBinlogPosition(entity.Pos)
+	secondaryBinlog := new(obinlog.Binlog)
+	if err := secondaryBinlog.Unmarshal(entity.Payload); err != nil {
+		return nil, errors.Annotatef(err, "unmarshal relay log at %s", pos)
+	}
+	r.pos = pos
+
+	return &Item{Binlog: secondaryBinlog, Pos: pos}, nil
+}
+
+// Close releases resources.
+func (r *BinlogReader) Close() error {
+	return errors.Trace(r.binlogger.Close())
+}
@@ -14,10 +14,13 @@
 package relay
 
 import (
+	"context"
+	"io"
 	"os"
 	"path"
 
 	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
 	"github.com/pingcap/tidb-binlog/pkg/file"
@@ -151,3 +154,58 @@ func (r *testReaderSuite) TestCancelRead(c *C) {
 	cancelFunc()
 	c.Assert(<-relayReader.Error(), ErrorMatches, "context canceled")
 }
+
+func (r *testReaderSuite) TestBinlogReader(c *C) {
+	dir := c.MkDir()
+	// small file size to read across files
+	relayer, err := NewRelayer(dir, 10, r)
+	c.Assert(err, IsNil)
+
+	var positions []BinlogPosition
+	for _, set := range []func(){r.SetDDL, func() { r.SetInsert(c) }, func() { r.SetUpdate(c) }, func() { r.SetDelete(c) }} {
+		set()
+		pos, err := relayer.WriteBinlog(r.Schema, r.Table, r.TiBinlog, r.PV)
+		c.Assert(err, IsNil)
+		positions = append(positions, pos)
+	}
+	c.Assert(relayer.Close(), IsNil)
+
+	reader, err := NewBinlogReader(dir, BinlogPosition{})
+	c.Assert(err, IsNil)
+	var types []loader.DMLType
+	for i := 0; ; i++ {
+		item, err := reader.Next(context.Background())
+		if err == io.EOF {
+			c.Assert(i, Equals, 4)
+			break
+		}
+		c.Assert(err, IsNil)
+		c.Assert(item.Pos, DeepEquals, positions[i])
+
+		txn, err := loader.SecondaryBinlogToTxn(item.Binlog)
+		c.Assert(err, IsNil)
+		if i == 0 {
+			c.Assert(txn.DDL.Database, Equals, "test")
+			continue
+		}
+		types = append(types, txn.DMLs[0].Tp)
+	}
+	c.Assert(types, DeepEquals, []loader.DMLType{loader.InsertDMLType, loader.UpdateDMLType, loader.DeleteDMLType})
+	c.Assert(reader.Close(), IsNil)
+
+	// read from the position of the second binlog
+	reader, err = NewBinlogReader(dir, positions[1])
+	c.Assert(err, IsNil)
+	item, err := reader.Next(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(item.Pos, DeepEquals, positions[2])
+	txn, err := loader.SecondaryBinlogToTxn(item.Binlog)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DMLs[0].Tp, Equals, loader.UpdateDMLType)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = reader.Next(ctx)
+	c.Assert(errors.Cause(err), Equals, context.Canceled)
+	c.Assert(reader.Close(), IsNil)
+}
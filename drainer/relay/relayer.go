@@ -27,10 +27,10 @@ const defaultMaxFileSize = 10 * 1024 * 1024
 // Relayer is the interface for writing relay log.
 type Relayer interface {
 	// WriteBinlog writes binlog to relay log file.
-	WriteBinlog(schema string, table string, tiBinlog *tb.Binlog, pv *tb.PrewriteValue) (tb.Pos, error)
+	WriteBinlog(schema string, table string, tiBinlog *tb.Binlog, pv *tb.PrewriteValue) (BinlogPosition, error)
 
 	// GCBinlog removes unused relay log files.
-	GCBinlog(pos tb.Pos)
+	GCBinlog(pos BinlogPosition)
 
 	// Close releases resources.
 	Close() error
@@ -39,8 +39,10 @@ type Relayer interface {
 type relayer struct {
 	tableInfoGetter translator.TableInfoGetter
 	binlogger       binlogfile.Binlogger
-	// nextGCFileSuffix is file suffix of the relay log file to be removed.
-	nextGCFileSuffix uint64
+	// nextGCFileSeq is the sequence of the relay log file to be removed.
+	nextGCFileSeq uint32
+	// encode transforms the marshaled binlog before it's written, nil means writing it as it is.
+	encode func(data []byte) []byte
 }
 
 // NewRelayer creates a relayer.
@@ -61,8 +63,8 @@ func NewRelayer(dir string, maxFileSize int64, tableInfoGetter translator.TableI
 }
 
 // WriteBinlog writes binlog to relay log.
-func (r *relayer) WriteBinlog(schema string, table string, tiBinlog *tb.Binlog, pv *tb.PrewriteValue) (tb.Pos, error) {
-	pos := tb.Pos{}
+func (r *relayer) WriteBinlog(schema string, table string, tiBinlog *tb.Binlog, pv *tb.PrewriteValue) (BinlogPosition, error) {
+	pos := BinlogPosition{}
 	binlog, err := translator.TiBinlogToSecondaryBinlog(r.tableInfoGetter, schema, table, tiBinlog, pv)
 	if err != nil {
 		return pos, errors.Trace(err)
@@ -73,20 +75,24 @@ func (r *relayer) WriteBinlog(schema string, table string, tiBinlog *tb.Binlog,
 		return pos, errors.Trace(err)
 	}
 
-	pos, err = r.binlogger.WriteTail(&tb.Entity{Payload: data})
+	if r.encode != nil {
+		data = r.encode(data)
+	}
+
+	binlogPos, err := r.binlogger.WriteTail(&tb.Entity{Payload: data})
 	if err != nil {
 		return pos, errors.Trace(err)
 	}
 
-	return pos, nil
+	return newBinlogPosition(binlogPos), nil
 }
 
 // GCBinlog removes unused relay log file.
-func (r *relayer) GCBinlog(pos tb.Pos) {
-	// If the file suffix increases, it means previous files are useless.
-	if pos.Suffix > r.nextGCFileSuffix {
-		r.binlogger.GCByPos(pos)
-		r.nextGCFileSuffix = pos.Suffix
+func (r *relayer) GCBinlog(pos BinlogPosition) {
+	// If the file sequence increases, it means previous files are useless.
+	if pos.FileSeq > r.nextGCFileSeq {
+		r.binlogger.GCByPos(pos.binlogPos())
+		r.nextGCFileSeq = pos.FileSeq
 	}
 }
 
@@ -55,13 +55,13 @@ func (r *testRelayerSuite) TestWriteBinlog(c *C) {
 	r.SetDDL()
 	pos1, err := relayer.WriteBinlog(r.Schema, r.Table, r.TiBinlog, r.PV)
 	c.Assert(err, IsNil)
-	c.Assert(pos1.Suffix, Equals, uint64(0))
-	c.Assert(pos1.Offset, Greater, int64(0))
+	c.Assert(pos1.FileSeq, Equals, uint32(0))
+	c.Assert(pos1.Offset, Greater, uint64(0))
 
 	r.SetInsert(c)
 	pos2, err := relayer.WriteBinlog(r.Schema, r.Table, r.TiBinlog, r.PV)
 	c.Assert(err, IsNil)
-	c.Assert(pos2.Suffix, Equals, uint64(0))
+	c.Assert(pos2.FileSeq, Equals, uint32(0))
 	c.Assert(pos2.Offset, Greater, pos1.Offset)
 }
 
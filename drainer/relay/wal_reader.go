@@ -0,0 +1,203 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/pingcap/tidb-binlog/pkg/file"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+// the max interval to check the relay log files again when no change is notified, in case the
+// file system doesn't support notification.
+var walTailPollInterval = time.Second
+
+// WALTailReader reads the entries of relay log files from a given position like `tail -f`,
+// it blocks at the end of relay log until new entries are written.
+// Unlike BinlogReader, it doesn't lock the directory, so it can read while the Relayer is writing.
+// WALTailReader is not safe for concurrent use, cancel the blocking Next before calling Close.
+type WALTailReader struct {
+	dir string
+	// the position right after the last entry returned
+	pos     BinlogPosition
+	file    *os.File
+	br      *bufio.Reader
+	watcher *fsnotify.Watcher
+}
+
+// NewWALTailReader creates a WALTailReader reading the entries after pos in dir,
+// a zero pos means reading from the beginning.
+func NewWALTailReader(dir string, pos BinlogPosition) (*WALTailReader, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, errors.Annotatef(err, "watch relay log directory %s", dir)
+	}
+
+	return &WALTailReader{
+		dir:     dir,
+		pos:     pos,
+		watcher: watcher,
+	}, nil
+}
+
+// Next returns the next binlog in relay log, it blocks until a new binlog is written or ctx is done.
+func (r *WALTailReader) Next(ctx context.Context) (*Item, error) {
+	for {
+		if err := r.openFile(); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if r.file != nil {
+			item, err := r.readEntry()
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return item, errors.Trace(err)
+			}
+
+			hasNext, err := r.hasNextFile()
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if hasNext {
+				// the file is complete once the next one is created, so read it again in case
+				// the entry at the end is written right after the last read.
+				item, err = r.readEntry()
+				switch err {
+				case nil:
+					return item, nil
+				case io.EOF:
+					r.closeFile()
+					r.pos = BinlogPosition{FileSeq: r.pos.FileSeq + 1}
+					continue
+				default:
+					return nil, errors.Annotatef(err, "read relay log at %s", r.pos)
+				}
+			}
+		}
+
+		if err := r.wait(ctx); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+}
+
+// openFile opens the relay log file of r.pos if it's not opened yet, r.file is left nil if the file
+// is not created yet.
+func (r *WALTailReader) openFile() error {
+	if r.file != nil {
+		return nil
+	}
+
+	names, err := binlogfile.ReadBinlogNames(r.dir)
+	if errors.Cause(err) == binlogfile.ErrFileNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	idx, ok := binlogfile.SearchIndex(names, uint64(r.pos.FileSeq))
+	if !ok {
+		if first, _, err := binlogfile.ParseBinlogName(names[0]); err == nil && first > uint64(r.pos.FileSeq) {
+			return errors.Errorf("relay log at %s is purged", r.pos)
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(path.Join(r.dir, names[idx]), os.O_RDONLY, file.PrivateFileMode)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err = f.Seek(int64(r.pos.Offset), io.SeekStart); err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	r.file = f
+	r.br = bufio.NewReader(f)
+	return nil
+}
+
+// readEntry reads the entry at r.pos, the file is rewound to r.pos if it reaches the end of the file,
+// so the partially written entry can be read again.
+func (r *WALTailReader) readEntry() (*Item, error) {
+	payload, length, err := binlogfile.Decode(r.br)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if _, seekErr := r.file.Seek(int64(r.pos.Offset), io.SeekStart); seekErr != nil {
+				return nil, errors.Trace(seekErr)
+			}
+			r.br.Reset(r.file)
+			return nil, err
+		}
+		return nil, errors.Annotatef(err, "decode relay log at %s", r.pos)
+	}
+
+	secondaryBinlog := new(obinlog.Binlog)
+	if err := secondaryBinlog.Unmarshal(payload); err != nil {
+		return nil, errors.Annotatef(err, "unmarshal relay log at %s", r.pos)
+	}
+	r.pos.Offset += uint64(length)
+
+	return &Item{Binlog: secondaryBinlog, Pos: r.pos}, nil
+}
+
+func (r *WALTailReader) hasNextFile() (bool, error) {
+	names, err := binlogfile.ReadBinlogNames(r.dir)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	last, _, err := binlogfile.ParseBinlogName(names[len(names)-1])
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return last > uint64(r.pos.FileSeq), nil
+}
+
+// wait blocks until any relay log file is changed, or walTailPollInterval elapses.
+func (r *WALTailReader) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case <-r.watcher.Events:
+	case err := <-r.watcher.Errors:
+		return errors.Annotate(err, "watch relay log directory")
+	case <-time.After(walTailPollInterval):
+	}
+	return nil
+}
+
+func (r *WALTailReader) closeFile() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+		r.br = nil
+	}
+}
+
+// Close releases resources.
+func (r *WALTailReader) Close() error {
+	r.closeFile()
+	return errors.Trace(r.watcher.Close())
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+var _ = Suite(&testWALTailReaderSuite{})
+
+type testWALTailReaderSuite struct {
+	translator.BinlogGenerator
+	origPollInterval time.Duration
+}
+
+func (r *testWALTailReaderSuite) SetUpSuite(c *C) {
+	// make sure the reader is woken up by the notification instead of polling
+	r.origPollInterval = walTailPollInterval
+	walTailPollInterval = time.Minute
+}
+
+func (r *testWALTailReaderSuite) TearDownSuite(c *C) {
+	walTailPollInterval = r.origPollInterval
+}
+
+type nextResult struct {
+	item *Item
+	err  error
+}
+
+// nextAsync calls reader.Next in a new goroutine and returns the channel of its result.
+func nextAsync(ctx context.Context, reader *WALTailReader) <-chan nextResult {
+	ch := make(chan nextResult, 1)
+	go func() {
+		item, err := reader.Next(ctx)
+		ch <- nextResult{item, err}
+	}()
+	return ch
+}
+
+func (r *testWALTailReaderSuite) assertBlocked(c *C, ch <-chan nextResult) {
+	select {
+	case res := <-ch:
+		c.Fatalf("reader is not blocked at the end of relay log, got %+v", res)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func (r *testWALTailReaderSuite) waitResult(c *C, ch <-chan nextResult) *Item {
+	select {
+	case res := <-ch:
+		c.Assert(res.err, IsNil)
+		return res.item
+	case <-time.After(5 * time.Second):
+		c.Fatal("reader hasn't read the new binlog in 5s")
+	}
+	return nil
+}
+
+func (r *testWALTailReaderSuite) TestTail(c *C) {
+	dir := c.MkDir()
+	// small file size to read across files
+	relayer, err := NewRelayer(dir, 10, r)
+	c.Assert(err, IsNil)
+	defer relayer.Close()
+
+	r.SetDDL()
+	pos, err := relayer.WriteBinlog(r.Schema, r.Table, r.TiBinlog, r.PV)
+	c.Assert(err, IsNil)
+
+	reader, err := NewWALTailReader(dir, BinlogPosition{})
+	c.Assert(err, IsNil)
+	defer reader.Close()
+
+	item, err := reader.Next(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(item.Pos, DeepEquals, pos)
+	txn, err := loader.SecondaryBinlogToTxn(item.Binlog)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DDL.Database, Equals, "test")
+
+	// the entries written while the reader is blocked are returned
+	for _, tp := range []loader.DMLType{loader.InsertDMLType, loader.UpdateDMLType, loader.DeleteDMLType} {
+		ch := nextAsync(context.Background(), reader)
+		r.assertBlocked(c, ch)
+
+		switch tp {
+		case loader.InsertDMLType:
+			r.SetInsert(c)
+		case loader.UpdateDMLType:
+			r.SetUpdate(c)
+		case loader.DeleteDMLType:
+			r.SetDelete(c)
+		}
+		pos, err = relayer.WriteBinlog(r.Schema, r.Table, r.TiBinlog, r.PV)
+		c.Assert(err, IsNil)
+
+		item = r.waitResult(c, ch)
+		c.Assert(item.Pos, DeepEquals, pos)
+		txn, err = loader.SecondaryBinlogToTxn(item.Binlog)
+		c.Assert(err, IsNil)
+		c.Assert(txn.DMLs[0].Tp, Equals, tp)
+	}
+	c.Assert(pos.FileSeq > 0, IsTrue)
+
+	// cancelled while blocked
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := nextAsync(ctx, reader)
+	r.assertBlocked(c, ch)
+	cancel()
+	res := <-ch
+	c.Assert(errors.Cause(res.err), Equals, context.Canceled)
+}
+
+func (r *testWALTailReaderSuite) TestFromPosition(c *C) {
+	dir := c.MkDir()
+	relayer, err := NewRelayer(dir, 10, r)
+	c.Assert(err, IsNil)
+	defer relayer.Close()
+
+	var positions []BinlogPosition
+	r.SetInsert(c)
+	for i := 0; i < 3; i++ {
+		pos, err := relayer.WriteBinlog(r.Schema, r.Table, r.TiBinlog, r.PV)
+		c.Assert(err, IsNil)
+		positions = append(positions, pos)
+	}
+
+	reader, err := NewWALTailReader(dir, positions[1])
+	c.Assert(err, IsNil)
+	defer reader.Close()
+
+	item, err := reader.Next(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(item.Pos, DeepEquals, positions[2])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := nextAsync(ctx, reader)
+	r.assertBlocked(c, ch)
+	cancel()
+	c.Assert(errors.Cause((<-ch).err), Equals, context.Canceled)
+}
+
+func (r *testWALTailReaderSuite) TestNoRelayLogYet(c *C) {
+	dir := c.MkDir()
+	reader, err := NewWALTailReader(dir, BinlogPosition{})
+	c.Assert(err, IsNil)
+	defer reader.Close()
+
+	ch := nextAsync(context.Background(), reader)
+	r.assertBlocked(c, ch)
+
+	relayer, err := NewRelayer(dir, 0, r)
+	c.Assert(err, IsNil)
+	defer relayer.Close()
+	r.SetDDL()
+	pos, err := relayer.WriteBinlog(r.Schema, r.Table, r.TiBinlog, r.PV)
+	c.Assert(err, IsNil)
+
+	item := r.waitResult(c, ch)
+	c.Assert(item.Pos, DeepEquals, pos)
+}
+
+func (r *testWALTailReaderSuite) TestNotExistDir(c *C) {
+	_, err := NewWALTailReader("/not-exist-relay-log-dir", BinlogPosition{})
+	c.Assert(err, ErrorMatches, ".*watch relay log directory.*")
+}
@@ -62,6 +62,10 @@ func (ld *noOpLoader) Successes() <-chan *loader.Txn {
 	return ld.success
 }
 
+func (ld *noOpLoader) Stats() loader.LoaderStats {
+	return loader.LoaderStats{}
+}
+
 func (ld *noOpLoader) SetSafeMode(bool) {
 }
 
@@ -69,6 +73,14 @@ func (ld *noOpLoader) GetSafeMode() bool {
 	return false
 }
 
+func (ld *noOpLoader) WorkerCount() int {
+	return 1
+}
+
+func (ld *noOpLoader) SetWorkerCount(int) error {
+	return nil
+}
+
 var _ loader.Loader = &noOpLoader{}
 
 func (s *relaySuite) TestFeedByRealyLog(c *check.C) {
@@ -14,6 +14,7 @@
 package drainer
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -27,7 +28,10 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/encrypt"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb/kv"
@@ -203,7 +207,16 @@ func createSyncer(etcdURLs string, cp checkpoint.CheckPoint, cfg *SyncerConfig)
 		return nil, errors.Trace(err)
 	}
 
-	syncer, err = NewSyncer(cp, cfg, jobs)
+	opts := []SyncerOption{WithCheckpointSyncInterval(cfg.CheckpointSyncInterval)}
+	if cfg.SchemaHashCheckInterval > 0 && (cfg.DestDBType == "mysql" || cfg.DestDBType == "tidb") {
+		db, err := loader.CreateDB(cfg.To.User, cfg.To.Password, cfg.To.Host, cfg.To.Port, cfg.To.TLS)
+		if err != nil {
+			return nil, errors.Annotate(err, "create db for schema hash check")
+		}
+		opts = append(opts, WithSchemaHashCheck(db, time.Duration(cfg.SchemaHashCheckInterval)*time.Second))
+	}
+
+	syncer, err = NewSyncer(cp, cfg, jobs, opts...)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -395,6 +408,157 @@ func (s *Server) GetLatestTS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// PauseSyncer pauses replicating binlogs to downstream without stopping the drainer.
+func (s *Server) PauseSyncer(w http.ResponseWriter, r *http.Request) {
+	s.applySyncerAction(w, "pause", s.syncer.Pause)
+}
+
+// ResumeSyncer resumes replicating binlogs paused by PauseSyncer.
+func (s *Server) ResumeSyncer(w http.ResponseWriter, r *http.Request) {
+	s.applySyncerAction(w, "resume", s.syncer.Resume)
+}
+
+func (s *Server) applySyncerAction(w http.ResponseWriter, action string, fn func() error) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	log.Info("receive syncer action request", zap.String("action", action))
+
+	resp := util.SuccessResponse(fmt.Sprintf("%s syncer success!", action), nil)
+	if err := fn(); err != nil {
+		resp = util.ErrResponsef("%s syncer failed: %v", action, err)
+	}
+	err := rd.JSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// FlushCheckpoint saves the checkpoint after all the binlogs sent to downstream are executed.
+func (s *Server) FlushCheckpoint(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	log.Info("receive flush checkpoint request")
+
+	var resp *util.Response
+	if err := s.syncer.FlushCheckpoint(r.Context()); err != nil {
+		resp = util.ErrResponsef("flush checkpoint failed: %v", err)
+	} else {
+		resp = util.SuccessResponse("flush checkpoint success!", map[string]int64{"ts": s.syncer.GetLatestCommitTS()})
+	}
+	err := rd.JSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// SwitchDownstream switches the downstream to the one in the request body like the `[syncer.to]` section
+// of the config in JSON, after the binlogs sent to the current downstream are executed.
+func (s *Server) SwitchDownstream(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+
+	var resp *util.Response
+	cfg, err := decodeDownstreamConfig(r)
+	if err == nil {
+		log.Info("receive switch downstream request", zap.String("host", cfg.Host), zap.Int("port", cfg.Port))
+		err = s.syncer.SwitchDownstream(r.Context(), cfg)
+	}
+	if err != nil {
+		resp = util.ErrResponsef("switch downstream failed: %v", err)
+	} else {
+		resp = util.SuccessResponse("switch downstream success!", nil)
+	}
+	err = rd.JSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+func decodeDownstreamConfig(r *http.Request) (*dsync.DBConfig, error) {
+	cfg := new(dsync.DBConfig)
+	if err := json.NewDecoder(r.Body).Decode(cfg); err != nil {
+		return nil, errors.Annotate(err, "decode downstream config")
+	}
+	if len(cfg.Host) == 0 || cfg.Port == 0 {
+		return nil, errors.New("host and port of the downstream are required")
+	}
+
+	if len(cfg.EncryptedPassword) > 0 {
+		decrypt, err := encrypt.Decrypt(cfg.EncryptedPassword)
+		if err != nil {
+			return nil, errors.Annotate(err, "failed to decrypt password in `encrypted_password`")
+		}
+		cfg.Password = decrypt
+	}
+
+	var err error
+	if cfg.TLS, err = cfg.Security.ToTLSConfig(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return cfg, nil
+}
+
+// GetLoaderErrors returns the recent errors of loader for post-mortem analysis.
+func (s *Server) GetLoaderErrors(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	errs := dsync.LoaderErrorRecorder.Errors()
+	err := rd.JSON(w, http.StatusOK, util.SuccessResponse("get loader errors success!", errs))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// SetLoaderWorkers changes the number of workers of the loader by the body like `{"workers": 8}`.
+func (s *Server) SetLoaderWorkers(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+
+	var resp *util.Response
+	var req struct {
+		Workers int `json:"workers"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		err = errors.Annotate(err, "decode the worker count")
+	} else {
+		log.Info("receive set loader workers request", zap.Int("workers", req.Workers))
+		err = s.syncer.SetLoaderWorkerCount(req.Workers)
+	}
+	if err != nil {
+		resp = util.ErrResponsef("set loader workers failed: %v", err)
+	} else {
+		resp = util.SuccessResponse("set loader workers success!", map[string]int{"workers": req.Workers})
+	}
+	err = rd.JSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetLag returns the replication lag of the downstream in milliseconds.
+func (s *Server) GetLag(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	var resp *util.Response
+	lag, err := s.syncer.Lag()
+	if err != nil {
+		resp = util.ErrResponsef("get lag failed: %v", err)
+	} else {
+		resp = util.SuccessResponse("get lag success!", map[string]int64{"lag_ms": lag.Milliseconds()})
+	}
+	err = rd.JSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
 // commitStatus commit the node's last status to pd when close the server.
 func (s *Server) commitStatus() {
 	// update this node
@@ -436,6 +600,14 @@ func (s *Server) initAPIRouter() *mux.Router {
 	router.HandleFunc("/status", s.collector.Status).Methods("GET")
 	router.HandleFunc("/commit_ts", s.GetLatestTS).Methods("GET")
 	router.HandleFunc("/state/{nodeID}/{action}", s.ApplyAction).Methods("PUT")
+	router.HandleFunc("/debug/loader/errors", s.GetLoaderErrors).Methods("GET")
+	router.HandleFunc("/debug/lag", s.GetLag).Methods("GET")
+	router.HandleFunc("/pause", s.PauseSyncer).Methods("PUT")
+	router.HandleFunc("/resume", s.ResumeSyncer).Methods("PUT")
+	router.HandleFunc("/checkpoint/flush", s.FlushCheckpoint).Methods("PUT")
+	router.HandleFunc("/downstream/switch", s.SwitchDownstream).Methods("PUT")
+	router.HandleFunc("/loader/workers", s.SetLoaderWorkers).Methods("PUT")
+	router.Handle("/drainer/status", NewStatusHandler(s.syncer, s.cp)).Methods("GET")
 	prometheus.DefaultGatherer = registry
 	router.Handle("/metrics", promhttp.Handler())
 	return router
@@ -21,12 +21,14 @@ import (
 	"net/http/httptest"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
 	. "github.com/pingcap/check"
 	pd "github.com/pingcap/pd/v4/client"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/pkg/etcd"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/security"
@@ -39,6 +41,26 @@ var _ = Suite(&testServerSuite{})
 
 type testServerSuite struct{}
 
+func (t *testServerSuite) TestGetLoaderErrors(c *C) {
+	server := Server{}
+	router := server.initAPIRouter()
+
+	req := httptest.NewRequest("GET", "/debug/loader/errors", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	var decoded util.Response
+	err := json.Unmarshal(body, &decoded)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Code, Equals, 200)
+	_, ok := decoded.Data.([]interface{})
+	c.Assert(ok, IsTrue)
+}
+
 func (t *testServerSuite) TestGetLatestTS(c *C) {
 	cp := dummyCheckpoint{commitTS: 1984}
 	server := Server{
@@ -68,6 +90,161 @@ func (t *testServerSuite) TestGetLatestTS(c *C) {
 	c.Assert(int64(ts), Equals, int64(1984))
 }
 
+type pausableSyncer struct {
+	*interceptSyncer
+	paused bool
+}
+
+func (s *pausableSyncer) Pause() error {
+	s.paused = true
+	return nil
+}
+
+func (s *pausableSyncer) Resume() error {
+	s.paused = false
+	return nil
+}
+
+func (t *testServerSuite) TestPauseResumeSyncer(c *C) {
+	dsyncer := &pausableSyncer{interceptSyncer: newInterceptSyncer()}
+	server := Server{
+		syncer: &Syncer{
+			dsyncer: dsyncer,
+		},
+	}
+	router := server.initAPIRouter()
+
+	request := func(path string) util.Response {
+		req := httptest.NewRequest("PUT", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resp := w.Result()
+		c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		var decoded util.Response
+		err := json.Unmarshal(body, &decoded)
+		c.Assert(err, IsNil)
+		return decoded
+	}
+
+	c.Assert(request("/pause").Code, Equals, 200)
+	c.Assert(dsyncer.paused, IsTrue)
+	c.Assert(request("/resume").Code, Equals, 200)
+	c.Assert(dsyncer.paused, IsFalse)
+
+	// the syncer doesn't support pausing
+	server.syncer.dsyncer = newInterceptSyncer()
+	decoded := request("/pause")
+	c.Assert(decoded.Code, Not(Equals), 200)
+	c.Assert(decoded.Message, Matches, ".*not supported.*")
+}
+
+func (t *testServerSuite) TestSwitchDownstream(c *C) {
+	server := Server{
+		syncer: &Syncer{
+			dsyncer: newInterceptSyncer(),
+		},
+	}
+	router := server.initAPIRouter()
+
+	request := func(cfg string) util.Response {
+		req := httptest.NewRequest("PUT", "/downstream/switch", strings.NewReader(cfg))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resp := w.Result()
+		c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		var decoded util.Response
+		err := json.Unmarshal(body, &decoded)
+		c.Assert(err, IsNil)
+		return decoded
+	}
+
+	decoded := request("{")
+	c.Assert(decoded.Code, Not(Equals), 200)
+	c.Assert(decoded.Message, Matches, ".*decode downstream config.*")
+
+	decoded = request(`{"user": "root"}`)
+	c.Assert(decoded.Code, Not(Equals), 200)
+	c.Assert(decoded.Message, Matches, ".*host and port of the downstream are required.*")
+
+	// only the mysql syncer supports switching downstream
+	decoded = request(`{"host": "127.0.0.1", "port": 3306, "user": "root"}`)
+	c.Assert(decoded.Code, Not(Equals), 200)
+	c.Assert(decoded.Message, Matches, ".*not supported.*")
+}
+
+func (t *testServerSuite) TestSetLoaderWorkers(c *C) {
+	server := Server{
+		syncer: &Syncer{
+			dsyncer: newInterceptSyncer(),
+		},
+	}
+	router := server.initAPIRouter()
+
+	request := func(workers string) util.Response {
+		req := httptest.NewRequest("PUT", "/loader/workers", strings.NewReader(workers))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resp := w.Result()
+		c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		var decoded util.Response
+		err := json.Unmarshal(body, &decoded)
+		c.Assert(err, IsNil)
+		return decoded
+	}
+
+	decoded := request("{")
+	c.Assert(decoded.Code, Not(Equals), 200)
+	c.Assert(decoded.Message, Matches, ".*decode the worker count.*")
+
+	// only the mysql syncer supports changing the workers of loader
+	decoded = request(`{"workers": 4}`)
+	c.Assert(decoded.Code, Not(Equals), 200)
+	c.Assert(decoded.Message, Matches, ".*not supported.*")
+}
+
+func (t *testServerSuite) TestGetLag(c *C) {
+	server := Server{
+		syncer: &Syncer{
+			dsyncer: &dsync.MysqlSyncer{},
+		},
+	}
+	router := server.initAPIRouter()
+
+	request := func() util.Response {
+		req := httptest.NewRequest("GET", "/debug/lag", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resp := w.Result()
+		c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		var decoded util.Response
+		err := json.Unmarshal(body, &decoded)
+		c.Assert(err, IsNil)
+		return decoded
+	}
+
+	decoded := request()
+	c.Assert(decoded.Code, Equals, 200)
+	c.Assert(decoded.Data, DeepEquals, map[string]interface{}{"lag_ms": float64(0)})
+
+	// only the mysql syncer supports getting lag
+	server.syncer.dsyncer = newInterceptSyncer()
+	decoded = request()
+	c.Assert(decoded.Code, Not(Equals), 200)
+	c.Assert(decoded.Message, Matches, ".*not supported.*")
+}
+
 func (t *testServerSuite) TestNotify(c *C) {
 	server := Server{
 		collector: &Collector{
@@ -16,11 +16,21 @@ package drainer
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	"go.uber.org/zap"
 )
 
+// the states of DrainerStatus
+const (
+	StateRunning = "running"
+	StatePaused  = "paused"
+	StateError   = "error"
+)
+
 // HTTPStatus exposes current status of the collector via HTTP
 type HTTPStatus struct {
 	PumpPos map[string]int64 `json:"PumpPos"`
@@ -35,3 +45,74 @@ func (s *HTTPStatus) Status(w http.ResponseWriter, r *http.Request) {
 		log.Error("Failed to encode status", zap.Error(err), zap.Any("status", *s))
 	}
 }
+
+// DrainerStatus is the replication status of drainer for external monitoring.
+type DrainerStatus struct {
+	State string `json:"state"`
+	// the commit ts of the latest binlog received by the syncer
+	CurrentTS    int64 `json:"current_ts"`
+	CheckpointTS int64 `json:"checkpoint_ts"`
+	LagMs        int64 `json:"lag_ms"`
+	// the count of workers executing DMLs, only for mysql and tidb
+	WorkersActive int    `json:"workers_active"`
+	ErrorMessage  string `json:"error_message,omitempty"`
+	// in nanoseconds
+	Uptime time.Duration `json:"uptime"`
+}
+
+// StatusSyncer is the syncer reported by the status handler, it's implemented by Syncer.
+type StatusSyncer interface {
+	CurrentTS() int64
+	Lag() (time.Duration, error)
+	IsPaused() bool
+	WorkersActive() int
+	Err() error
+}
+
+type statusHandler struct {
+	syncer    StatusSyncer
+	cp        checkpoint.CheckPoint
+	startTime time.Time
+}
+
+// NewStatusHandler returns the handler serving the DrainerStatus of syncer as JSON,
+// the uptime is counted from the time it's created.
+func NewStatusHandler(syncer StatusSyncer, cp checkpoint.CheckPoint) http.Handler {
+	return &statusHandler{syncer: syncer, cp: cp, startTime: time.Now()}
+}
+
+func (h *statusHandler) status() *DrainerStatus {
+	status := &DrainerStatus{
+		State:         StateRunning,
+		CurrentTS:     h.syncer.CurrentTS(),
+		CheckpointTS:  h.cp.TS(),
+		WorkersActive: h.syncer.WorkersActive(),
+		Uptime:        time.Since(h.startTime),
+	}
+
+	if err := h.syncer.Err(); err != nil {
+		status.State = StateError
+		status.ErrorMessage = err.Error()
+	} else if h.syncer.IsPaused() {
+		status.State = StatePaused
+	}
+
+	lag, err := h.syncer.Lag()
+	if err != nil && status.CheckpointTS > 0 {
+		// the lag of downstream is unknown, use the one of checkpoint instead
+		physical := oracle.ExtractPhysical(uint64(status.CheckpointTS))
+		lag = time.Since(time.Unix(0, physical*int64(time.Millisecond)))
+	}
+	status.LagMs = lag.Milliseconds()
+
+	return status
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := h.status()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Error("Failed to encode status", zap.Error(err), zap.Any("status", status))
+	}
+}
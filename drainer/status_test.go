@@ -0,0 +1,122 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type statusSuite struct{}
+
+var _ = check.Suite(&statusSuite{})
+
+type fakeStatusSyncer struct {
+	currentTS int64
+	lag       time.Duration
+	lagErr    error
+	paused    bool
+	workers   int
+	err       error
+}
+
+func (s *fakeStatusSyncer) CurrentTS() int64            { return s.currentTS }
+func (s *fakeStatusSyncer) Lag() (time.Duration, error) { return s.lag, s.lagErr }
+func (s *fakeStatusSyncer) IsPaused() bool              { return s.paused }
+func (s *fakeStatusSyncer) WorkersActive() int          { return s.workers }
+func (s *fakeStatusSyncer) Err() error                  { return s.err }
+
+type fixedCheckpoint struct {
+	checkpoint.CheckPoint
+	ts int64
+}
+
+func (cp *fixedCheckpoint) TS() int64 { return cp.ts }
+
+func (s *statusSuite) getStatus(c *check.C, syncer StatusSyncer, cp checkpoint.CheckPoint) map[string]interface{} {
+	handler := NewStatusHandler(syncer, cp)
+	req := httptest.NewRequest("GET", "/drainer/status", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, "application/json")
+	var status map[string]interface{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &status), check.IsNil)
+	return status
+}
+
+func (s *statusSuite) TestRunning(c *check.C) {
+	syncer := &fakeStatusSyncer{currentTS: 200, lag: 1500 * time.Millisecond, workers: 4}
+	status := s.getStatus(c, syncer, &fixedCheckpoint{ts: 100})
+
+	c.Assert(status["uptime"], check.FitsTypeOf, float64(0))
+	delete(status, "uptime")
+	c.Assert(status, check.DeepEquals, map[string]interface{}{
+		"state":          "running",
+		"current_ts":     float64(200),
+		"checkpoint_ts":  float64(100),
+		"lag_ms":         float64(1500),
+		"workers_active": float64(4),
+	})
+}
+
+func (s *statusSuite) TestPausedAndError(c *check.C) {
+	syncer := &fakeStatusSyncer{paused: true}
+	status := s.getStatus(c, syncer, &fixedCheckpoint{})
+	c.Assert(status["state"], check.Equals, "paused")
+	c.Assert(status["error_message"], check.IsNil)
+
+	// error takes precedence over paused
+	syncer.err = errors.New("failed to add item")
+	status = s.getStatus(c, syncer, &fixedCheckpoint{})
+	c.Assert(status["state"], check.Equals, "error")
+	c.Assert(status["error_message"], check.Equals, "failed to add item")
+}
+
+func (s *statusSuite) TestLagOfCheckpoint(c *check.C) {
+	// the lag of downstream is not supported, e.g. kafka
+	syncer := &fakeStatusSyncer{lagErr: dsync.ErrNotSupported}
+	ts := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Minute)), 0)
+	status := s.getStatus(c, syncer, &fixedCheckpoint{ts: int64(ts)})
+
+	lag := status["lag_ms"].(float64)
+	c.Assert(lag >= float64(time.Minute/time.Millisecond), check.IsTrue)
+	c.Assert(lag < float64(2*time.Minute/time.Millisecond), check.IsTrue)
+}
+
+func (s *statusSuite) TestSyncerStatus(c *check.C) {
+	syncer := &Syncer{dsyncer: &pausableSyncer{}}
+	c.Assert(syncer.IsPaused(), check.IsFalse)
+	c.Assert(syncer.Pause(), check.IsNil)
+	c.Assert(syncer.IsPaused(), check.IsTrue)
+	c.Assert(syncer.Resume(), check.IsNil)
+	c.Assert(syncer.IsPaused(), check.IsFalse)
+
+	// not paused if the dsyncer fails to pause
+	syncer = &Syncer{dsyncer: &interceptSyncer{}}
+	c.Assert(errors.Cause(syncer.Pause()), check.Equals, dsync.ErrNotSupported)
+	c.Assert(syncer.IsPaused(), check.IsFalse)
+
+	c.Assert(syncer.WorkersActive(), check.Equals, 0)
+	c.Assert(syncer.Err(), check.IsNil)
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+// DDLLogger records the DDLs skipped by MysqlSyncer, so they can be applied to the downstream manually.
+type DDLLogger interface {
+	LogDDL(ddl *loader.DDL, commitTS int64) error
+}
+
+// FileDDLLogger appends the skipped DDLs to a file as SQL statements.
+type FileDDLLogger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var _ DDLLogger = &FileDDLLogger{}
+
+// NewFileDDLLogger opens the file at path to append the skipped DDLs, the file is created if not exists.
+func NewFileDDLLogger(path string) (*FileDDLLogger, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Annotatef(err, "open ddl log file %s", path)
+	}
+	return &FileDDLLogger{file: f}, nil
+}
+
+// LogDDL implements DDLLogger interface.
+func (l *FileDDLLogger) LogDDL(ddl *loader.DDL, commitTS int64) error {
+	stmt := fmt.Sprintf("-- commit ts: %d\nUSE `%s`;\n%s;\n", commitTS, ddl.Database, strings.TrimSuffix(strings.TrimSpace(ddl.SQL), ";"))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.WriteString(stmt); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(l.file.Sync())
+}
+
+// Close closes the file.
+func (l *FileDDLLogger) Close() error {
+	return errors.Trace(l.file.Close())
+}
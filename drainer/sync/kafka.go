@@ -17,6 +17,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -25,13 +26,25 @@ import (
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
 var maxWaitTimeToSendMSG = time.Second * 30
 var stallWriteSize = 90 * 1024 * 1024
 
-var _ Syncer = &KafkaSyncer{}
+var _ WatermarkSyncer = &KafkaSyncer{}
+
+// KafkaOffsetGauge to be used.
+var KafkaOffsetGauge *prometheus.GaugeVec
+
+// WatermarkSyncer is a Syncer can tell how far it has advanced.
+type WatermarkSyncer interface {
+	Syncer
+	// Watermark returns the offset of the latest item read by Sync, and the offset of
+	// the latest item written to downstream successfully, the items are numbered from 1.
+	Watermark() (consumed, confirmed int64)
+}
 
 // KafkaSyncer sync data to kafka
 type KafkaSyncer struct {
@@ -47,6 +60,10 @@ type KafkaSyncer struct {
 
 	lastSuccessTime time.Time
 
+	// the count of items sent to producer and acked by kafka
+	consumed  int64
+	confirmed int64
+
 	shutdown chan struct{}
 	*baseSyncer
 }
@@ -134,6 +151,20 @@ func (p *KafkaSyncer) Sync(item *Item) error {
 	return nil
 }
 
+// Watermark implements WatermarkSyncer interface
+func (p *KafkaSyncer) Watermark() (consumed, confirmed int64) {
+	// load confirmed first so it's never greater than consumed
+	confirmed = atomic.LoadInt64(&p.confirmed)
+	consumed = atomic.LoadInt64(&p.consumed)
+	return
+}
+
+func (p *KafkaSyncer) updateOffsetGauge(tp string, offset int64) {
+	if KafkaOffsetGauge != nil {
+		KafkaOffsetGauge.WithLabelValues(tp).Set(float64(offset))
+	}
+}
+
 // Close implements Syncer interface
 func (p *KafkaSyncer) Close() error {
 	close(p.shutdown)
@@ -176,6 +207,8 @@ func (p *KafkaSyncer) saveBinlog(binlog *obinlog.Binlog, item *Item) error {
 		}
 	}
 
+	// count it before sending, so it's counted before acked
+	p.updateOffsetGauge("consumed", atomic.AddInt64(&p.consumed, 1))
 	select {
 	case p.producer.Input() <- msg:
 		return nil
@@ -209,6 +242,7 @@ func (p *KafkaSyncer) run() {
 			delete(p.toBeAckCommitTS, commitTs)
 			p.toBeAckCommitTSMu.Unlock()
 
+			p.updateOffsetGauge("confirmed", atomic.AddInt64(&p.confirmed, 1))
 			p.success <- item
 		}
 		close(p.success)
@@ -0,0 +1,84 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var _ = check.Suite(&kafkaSuite{})
+
+type kafkaSuite struct{}
+
+func (s *kafkaSuite) TestWatermark(c *check.C) {
+	const count = 100
+
+	origGauge := KafkaOffsetGauge
+	KafkaOffsetGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "kafka_syncer_offset"}, []string{"type"})
+	defer func() { KafkaOffsetGauge = origGauge }()
+
+	origNewAsyncProducer := newAsyncProducer
+	defer func() { newAsyncProducer = origNewAsyncProducer }()
+	newAsyncProducer = func(addrs []string, config *sarama.Config) (sarama.AsyncProducer, error) {
+		producer := mocks.NewAsyncProducer(c, config)
+		for i := 0; i < count; i++ {
+			producer.ExpectInputAndSucceed()
+		}
+		return producer, nil
+	}
+
+	syncer, err := NewKafka(&DBConfig{KafkaVersion: "0.8.2.0"}, nil)
+	c.Assert(err, check.IsNil)
+
+	consumed, confirmed := syncer.Watermark()
+	c.Assert(consumed, check.Equals, int64(0))
+	c.Assert(confirmed, check.Equals, int64(0))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range syncer.Successes() {
+			consumed, confirmed := syncer.Watermark()
+			c.Check(confirmed <= consumed, check.IsTrue, check.Commentf("consumed: %d, confirmed: %d", consumed, confirmed))
+		}
+	}()
+
+	gen := translator.BinlogGenerator{}
+	for i := 0; i < count; i++ {
+		gen.SetDDL()
+		item := &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}
+		item.Binlog.CommitTs = int64(i + 1)
+		c.Assert(syncer.Sync(item), check.IsNil)
+		consumed, confirmed := syncer.Watermark()
+		c.Assert(consumed, check.Equals, int64(i+1))
+		c.Assert(confirmed <= consumed, check.IsTrue)
+	}
+
+	c.Assert(syncer.Close(), check.IsNil)
+	<-done
+
+	consumed, confirmed = syncer.Watermark()
+	c.Assert(consumed, check.Equals, int64(count))
+	c.Assert(confirmed, check.Equals, int64(count))
+	for _, tp := range []string{"consumed", "confirmed"} {
+		var metric dto.Metric
+		c.Assert(KafkaOffsetGauge.WithLabelValues(tp).Write(&metric), check.IsNil)
+		c.Assert(metric.GetGauge().GetValue(), check.Equals, float64(count))
+	}
+}
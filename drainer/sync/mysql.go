@@ -14,9 +14,12 @@
 package sync
 
 import (
+	"context"
 	"database/sql"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
 
@@ -25,22 +28,270 @@ import (
 	"github.com/pingcap/tidb-binlog/drainer/relay"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 var _ Syncer = &MysqlSyncer{}
 
-// QueueSizeGauge to be used.
-var QueueSizeGauge *prometheus.GaugeVec
+// LoaderMetrics to be used, the QueryHistogramVec and EventCounterVec of it are ignored.
+var LoaderMetrics *loader.PipelineMetrics
+
+// the min interval between two latency alerts of MysqlSyncer
+var latencyAlertDebounceInterval = time.Minute
+
+// SystemSchemaSkipCounter counts the DMLs and DDLs of system schemas dropped by MysqlSyncer.
+var SystemSchemaSkipCounter prometheus.Counter
+
+// the schemas whose DMLs and DDLs are dropped by WithIgnoreSystemSchemas
+var systemSchemas = map[string]struct{}{
+	"mysql":              {},
+	"information_schema": {},
+	"performance_schema": {},
+	"sys":                {},
+}
+
+// LoaderErrorRecorder keeps the recent errors of loader, it's exposed by the debug API of drainer.
+var LoaderErrorRecorder = loader.NewErrorRecorder(100)
+
+// SchemaChangeNotifier is called with the DDL before it's applied to the downstream.
+type SchemaChangeNotifier func(schema, table, ddlSQL string, commitTS int64)
 
 // MysqlSyncer sync binlog to Mysql
 type MysqlSyncer struct {
-	db      *sql.DB
-	loader  loader.Loader
-	relayer relay.Relayer
+	// protects db, loader, switchDone and stopped, the first three are replaced by SwitchDownstream
+	loaderMu sync.RWMutex
+	db       *sql.DB
+	loader   loader.Loader
+	// receives the result of the replaced loader when it quits
+	switchDone chan error
+	// set when the loader quits without being replaced, the syncer can't be switched then
+	stopped bool
+	relayer    relay.Relayer
+	// held by Sync when sending txns to loader, SwitchDownstream locks it to stop Sync
+	syncMu sync.RWMutex
+	// creates the loader of the new downstream in SwitchDownstream
+	newLoader func(db *sql.DB, cfg *DBConfig) (loader.Loader, error)
+	sqlMode   *string
+	// the safe mode set by SetSafeMode, accessed atomically
+	safeMode int32
+	// used to map the column types in DDL
+	destDBType string
+	// map the column types in DDL by loader.MapDDLColumnTypes
+	mapColumnTypes bool
+	// report the commit ts instead of the applied ts of downstream
+	useCommitTS bool
+	// remove the AUTO_INCREMENT table option from DDL
+	stripAutoIncrement bool
+
+	ignoreSystemSchemas bool
+	// the commit ts of the last item received by Sync, accessed atomically
+	lastItemCommitTS int64
+
+	latencyThreshold time.Duration
+	latencyAlertFn   func(lag time.Duration)
+	// the unix nano time of the last latency alert, accessed atomically
+	lastLatencyAlert int64
+
+	schemaChangeNotifier SchemaChangeNotifier
+	shouldSkip           func(item *Item) bool
+	skipDDL              func(ddl *loader.DDL) bool
+	ddlLogger            DDLLogger
+	pauser               pauser
+	pending              pendingItems
 	*baseSyncer
 }
 
+// pauser blocks the callers of wait when paused.
+type pauser struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+}
+
+// setPaused must be called with mu held.
+func (p *pauser) setPaused(paused bool) {
+	if p.cond == nil {
+		p.cond = sync.NewCond(&p.mu)
+	}
+	p.paused = paused
+	if !paused {
+		p.cond.Broadcast()
+	}
+}
+
+func (p *pauser) pause() {
+	p.mu.Lock()
+	p.setPaused(true)
+	p.mu.Unlock()
+}
+
+func (p *pauser) resume() {
+	p.mu.Lock()
+	p.setPaused(false)
+	p.mu.Unlock()
+}
+
+func (p *pauser) wait() {
+	p.mu.Lock()
+	for p.paused {
+		p.cond.Wait()
+	}
+	p.mu.Unlock()
+}
+
+// pendingItems counts the items synced but not sent to Successes yet.
+type pendingItems struct {
+	mu    sync.Mutex
+	count int
+	// closed when count drops to 0
+	drained chan struct{}
+}
+
+func (p *pendingItems) add() {
+	p.mu.Lock()
+	if p.count == 0 {
+		p.drained = make(chan struct{})
+	}
+	p.count++
+	p.mu.Unlock()
+}
+
+func (p *pendingItems) done() {
+	p.mu.Lock()
+	p.count--
+	if p.count == 0 {
+		close(p.drained)
+	}
+	p.mu.Unlock()
+}
+
+// drainedChan returns a channel closed when no item is pending.
+func (p *pendingItems) drainedChan() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.count == 0 {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	return p.drained
+}
+
+// A MysqlSyncerOption sets options of MysqlSyncer.
+type MysqlSyncerOption func(*MysqlSyncer)
+
+// WithSchemaChangeNotifier set the callback to notify external systems (like schema registries) on DDL.
+// fn is called synchronously before the DDL is applied, a panic in fn is recovered and logged.
+func WithSchemaChangeNotifier(fn func(schema, table, ddlSQL string, commitTS int64)) MysqlSyncerOption {
+	return func(m *MysqlSyncer) {
+		m.schemaChangeNotifier = fn
+	}
+}
+
+// WithLatencyAlert makes Sync call alertFn when the Lag is greater than threshold, alertFn is called
+// asynchronously at most once per minute to avoid alert storms.
+func WithLatencyAlert(threshold time.Duration, alertFn func(lag time.Duration)) MysqlSyncerOption {
+	return func(m *MysqlSyncer) {
+		m.latencyThreshold = threshold
+		m.latencyAlertFn = alertFn
+	}
+}
+
+// WithShouldSkip set the predicate to skip items, the items fn returns true for are reported by Successes
+// without being replicated to downstream. fn is called in Sync, so it should be fast.
+func WithShouldSkip(fn func(item *Item) bool) MysqlSyncerOption {
+	return func(m *MysqlSyncer) {
+		m.shouldSkip = fn
+	}
+}
+
+// WithSkipDDL makes the MysqlSyncer not apply the DDLs fn returns true for, like the DDLs of downstream
+// tables managed separately. The skipped DDLs are logged (and written to the DDLLogger set by WithDDLLogger),
+// then reported by Successes as if they're applied.
+func WithSkipDDL(fn func(ddl *loader.DDL) bool) MysqlSyncerOption {
+	return func(m *MysqlSyncer) {
+		m.skipDDL = fn
+	}
+}
+
+// WithDDLLogger set the DDLLogger to record the DDLs skipped by WithSkipDDL, the item fails to sync
+// if the DDL can't be recorded.
+func WithDDLLogger(l DDLLogger) MysqlSyncerOption {
+	return func(m *MysqlSyncer) {
+		m.ddlLogger = l
+	}
+}
+
+// UseCommitTS makes the MysqlSyncer report the upstream commit ts of the txn as the AppliedTS of Item,
+// which is saved as the secondary ts of checkpoint, instead of the ts applied in downstream. It's reported
+// with the applied ts of TiDB downstream, or at most once per commitTSReportInterval for the downstream
+// without applied ts like MySQL, since every Item with AppliedTS makes the checkpoint saved immediately.
+func UseCommitTS(use bool) MysqlSyncerOption {
+	return func(m *MysqlSyncer) {
+		m.useCommitTS = use
+	}
+}
+
+// WithMapColumnTypes makes the MysqlSyncer map the column types in DDL to the ones accepted by the
+// downstream by loader.MapDDLColumnTypes, the DDL is passed as is if it fails to be mapped.
+func WithMapColumnTypes(enabled bool) MysqlSyncerOption {
+	return func(m *MysqlSyncer) {
+		m.mapColumnTypes = enabled
+	}
+}
+
+// WithStripAutoIncrement makes the MysqlSyncer remove the `AUTO_INCREMENT=N` table option from DDL,
+// so the auto increment counter of downstream tables is not changed by the upstream one.
+func WithStripAutoIncrement(enabled bool) MysqlSyncerOption {
+	return func(m *MysqlSyncer) {
+		m.stripAutoIncrement = enabled
+	}
+}
+
+// WithIgnoreSystemSchemas makes the MysqlSyncer drop the DMLs and DDLs of the system schemas `mysql`,
+// `information_schema`, `performance_schema` and `sys`, which may break downstream if they're replicated
+// by accident. It's enabled by default.
+func WithIgnoreSystemSchemas(enabled bool) MysqlSyncerOption {
+	return func(m *MysqlSyncer) {
+		m.ignoreSystemSchemas = enabled
+	}
+}
+
+func isSystemSchema(schema string) bool {
+	_, ok := systemSchemas[strings.ToLower(schema)]
+	return ok
+}
+
+// dropSystemSchemaDMLs removes the DMLs of system schemas from txn, and returns the number of them.
+func dropSystemSchemaDMLs(txn *loader.Txn) int {
+	dmls := txn.DMLs[:0]
+	for _, dml := range txn.DMLs {
+		if !isSystemSchema(dml.Database) {
+			dmls = append(dmls, dml)
+		}
+	}
+	dropped := len(txn.DMLs) - len(dmls)
+	txn.DMLs = dmls
+	return dropped
+}
+
+func countSystemSchemaSkips(n int) {
+	if SystemSchemaSkipCounter != nil {
+		SystemSchemaSkipCounter.Add(float64(n))
+	}
+}
+
+// the min interval to report the commit ts by UseCommitTS without applied ts, it's the same as the interval
+// of the loader getting the applied ts of TiDB.
+var commitTSReportInterval = time.Minute
+
 // should only be used for unit test to create mock db
 var createDB = loader.CreateDBWithSQLMode
 
@@ -61,13 +312,16 @@ func CreateLoader(
 	var opts []loader.Option
 	opts = append(opts, loader.WorkerCount(worker), loader.BatchSize(batchSize), loader.SaveAppliedTS(destDBType == "tidb"), loader.SetloopBackSyncInfo(info))
 	if queryHistogramVec != nil {
-		opts = append(opts, loader.Metrics(&loader.MetricsGroup{
-			QueryHistogramVec: queryHistogramVec,
-			EventCounterVec:   nil,
-			QueueSizeGauge:    QueueSizeGauge,
-		}))
+		var metrics loader.MetricsGroup
+		if LoaderMetrics != nil {
+			metrics = LoaderMetrics.MetricsGroup
+		}
+		metrics.QueryHistogramVec = queryHistogramVec
+		metrics.EventCounterVec = nil
+		opts = append(opts, loader.Metrics(&metrics))
 	}
 
+	opts = append(opts, loader.WithErrorRecorder(LoaderErrorRecorder))
 	opts = append(opts, loader.EnableDispatch(enableDispatch))
 	opts = append(opts, loader.EnableCausality(enableCausility))
 	opts = append(opts, loader.Merge(cfg.Merge))
@@ -98,18 +352,54 @@ func NewMysqlSyncer(
 	info *loopbacksync.LoopBackSync,
 	enableDispatch bool,
 	enableCausility bool,
+	opts ...MysqlSyncerOption,
 ) (*MysqlSyncer, error) {
 	if cfg.TLS != nil {
 		log.Info("enable TLS to connect downstream MySQL/TiDB")
 	}
 
+	newLoader := func(db *sql.DB, cfg *DBConfig) (loader.Loader, error) {
+		return CreateLoader(db, cfg, worker, batchSize, queryHistogramVec, sqlMode, destDBType, info, enableDispatch, enableCausility)
+	}
+
+	db, err := openDownstream(cfg, sqlMode)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	loader, err := newLoader(db, cfg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	s := &MysqlSyncer{
+		db:                  db,
+		loader:              loader,
+		newLoader:           newLoader,
+		sqlMode:             sqlMode,
+		relayer:             relayer,
+		destDBType:          destDBType,
+		ignoreSystemSchemas: true,
+		baseSyncer:          newBaseSyncer(tableInfoGetter),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// openDownstream connects to the downstream of cfg, the STRICT_TRANS_TABLES sql mode is removed
+// in the partial column sync mode.
+func openDownstream(cfg *DBConfig, sqlMode *string) (*sql.DB, error) {
 	db, err := createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.TLS, sqlMode)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	syncMode := loader.SyncMode(cfg.SyncMode)
-	if syncMode == loader.SyncPartialColumn {
+	if loader.SyncMode(cfg.SyncMode) == loader.SyncPartialColumn {
 		var oldMode, newMode string
 		oldMode, newMode, err = relaxSQLMode(db)
 		if err != nil {
@@ -126,21 +416,7 @@ func NewMysqlSyncer(
 		}
 	}
 
-	loader, err := CreateLoader(db, cfg, worker, batchSize, queryHistogramVec, sqlMode, destDBType, info, enableDispatch, enableCausility)
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-
-	s := &MysqlSyncer{
-		db:         db,
-		loader:     loader,
-		relayer:    relayer,
-		baseSyncer: newBaseSyncer(tableInfoGetter),
-	}
-
-	go s.run()
-
-	return s, nil
+	return db, nil
 }
 
 // set newMode as the oldMode query from db by removing "STRICT_TRANS_TABLES".
@@ -168,12 +444,88 @@ func relaxSQLMode(db *sql.DB) (oldMode string, newMode string, err error) {
 
 // SetSafeMode make the MysqlSyncer to use safe mode or not
 func (m *MysqlSyncer) SetSafeMode(mode bool) bool {
-	m.loader.SetSafeMode(mode)
+	var v int32
+	if mode {
+		v = 1
+	}
+	atomic.StoreInt32(&m.safeMode, v)
+	m.getLoader().SetSafeMode(mode)
 	return true
 }
 
+func (m *MysqlSyncer) getLoader() loader.Loader {
+	m.loaderMu.RLock()
+	defer m.loaderMu.RUnlock()
+	return m.loader
+}
+
+// SwitchDownstream replaces the downstream by the one of newCfg without restarting drainer, like
+// migrating to a new MySQL instance. Sync is blocked until the txns sent to the current downstream are
+// executed, then a loader of the new downstream replaces the current one and the current db is closed.
+// The current downstream keeps being used if it fails before the replacement. The config file of drainer
+// is not changed, so it should be updated too before restarting drainer.
+func (m *MysqlSyncer) SwitchDownstream(ctx context.Context, newCfg *DBConfig) error {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	log.Info("switching downstream", zap.String("host", newCfg.Host), zap.Int("port", newCfg.Port))
+	select {
+	case <-m.pending.drainedChan():
+	case <-m.errCh:
+		return m.err
+	case <-ctx.Done():
+		return errors.Annotate(ctx.Err(), "wait for the txns to be executed")
+	}
+
+	db, err := openDownstream(newCfg, m.sqlMode)
+	if err != nil {
+		return errors.Annotate(err, "connect to the new downstream")
+	}
+	ld, err := m.newLoader(db, newCfg)
+	if err != nil {
+		db.Close()
+		return errors.Annotate(err, "create loader of the new downstream")
+	}
+	if atomic.LoadInt32(&m.safeMode) == 1 {
+		ld.SetSafeMode(true)
+	}
+
+	done := make(chan error, 1)
+	m.loaderMu.Lock()
+	if m.stopped {
+		m.loaderMu.Unlock()
+		db.Close()
+		return errors.New("mysql syncer is closed")
+	}
+	oldDB, oldLoader := m.db, m.loader
+	m.db, m.loader, m.switchDone = db, ld, done
+	m.loaderMu.Unlock()
+
+	oldLoader.Close()
+	err = <-done
+	oldDB.Close()
+	if err != nil {
+		return errors.Annotate(err, "close the loader of the old downstream")
+	}
+
+	log.Info("downstream is switched", zap.String("host", newCfg.Host), zap.Int("port", newCfg.Port))
+	return nil
+}
+
 // Sync implements Syncer interface
 func (m *MysqlSyncer) Sync(item *Item) error {
+	m.pauser.wait()
+	m.syncMu.RLock()
+	defer m.syncMu.RUnlock()
+	atomic.StoreInt64(&m.lastItemCommitTS, item.Binlog.GetCommitTs())
+	if m.latencyAlertFn != nil {
+		m.checkLatency()
+	}
+
+	if m.shouldSkip != nil && m.shouldSkip(item) {
+		return errors.Trace(m.skip(item))
+	}
+
 	// `relayer` is nil if relay log is disabled.
 	if m.relayer != nil {
 		pos, err := m.relayer.WriteBinlog(item.Schema, item.Table, item.Binlog, item.PrewriteValue)
@@ -189,19 +541,214 @@ func (m *MysqlSyncer) Sync(item *Item) error {
 	}
 	txn.Metadata = item
 
+	if m.ignoreSystemSchemas {
+		if txn.DDL != nil && isSystemSchema(txn.DDL.Database) {
+			log.Warn("skip the DDL of system schema", zap.String("schema", txn.DDL.Database), zap.String("sql", txn.DDL.SQL))
+			countSystemSchemaSkips(1)
+			return errors.Trace(m.skip(item))
+		}
+		if dropped := dropSystemSchemaDMLs(txn); dropped > 0 {
+			log.Warn("skip the DMLs of system schemas", zap.Int("dmls", dropped), zap.Int64("commit ts", item.Binlog.GetCommitTs()))
+			countSystemSchemaSkips(dropped)
+			if len(txn.DMLs) == 0 && txn.DDL == nil {
+				return errors.Trace(m.skip(item))
+			}
+		}
+	}
+
+	if txn.DDL != nil {
+		if m.mapColumnTypes {
+			sql, err := loader.MapDDLColumnTypes(txn.DDL.SQL, m.destDBType)
+			if err != nil {
+				// the downstream may still accept it, leave it to the loader.
+				log.Warn("failed to map column types of ddl", zap.String("sql", txn.DDL.SQL), zap.Error(err))
+			} else {
+				txn.DDL.SQL = sql
+			}
+		}
+		if m.stripAutoIncrement {
+			sql, err := loader.StripAutoIncrementOption(txn.DDL.SQL)
+			if err != nil {
+				// the downstream may still accept it, leave it to the loader.
+				log.Warn("failed to strip auto increment option of ddl", zap.String("sql", txn.DDL.SQL), zap.Error(err))
+			} else {
+				txn.DDL.SQL = sql
+			}
+		}
+	}
+
+	if txn.DDL != nil && m.skipDDL != nil && m.skipDDL(txn.DDL) {
+		return errors.Trace(m.logSkippedDDL(item, txn.DDL))
+	}
+
+	if txn.DDL != nil && m.schemaChangeNotifier != nil {
+		m.notifySchemaChange(txn.DDL, item.Binlog.GetCommitTs())
+	}
+
+	m.startWriteSpan(item)
+	m.pending.add()
 	select {
 	case <-m.errCh:
+		m.pending.done()
+		finishWriteSpan(item, m.err)
 		return m.err
-	case m.loader.Input() <- txn:
+	case m.getLoader().Input() <- txn:
 		return nil
 	}
 }
 
+// startWriteSpan starts the span of writing item to downstream as a child of item.SpanContext,
+// it's finished when the item is sent to Successes.
+func (m *MysqlSyncer) startWriteSpan(item *Item) {
+	if !item.SpanContext.IsValid() {
+		return
+	}
+	ctx := trace.ContextWithSpanContext(context.Background(), item.SpanContext)
+	_, item.writeSpan = otel.Tracer(TracerName).Start(ctx, "drainer.mysql.write")
+	item.writeSpan.SetAttributes(attribute.Int64("commit_ts", item.Binlog.GetCommitTs()))
+	if item.Binlog.DdlJobId > 0 {
+		item.writeSpan.SetAttributes(attribute.Bool("ddl", true))
+	}
+}
+
+func finishWriteSpan(item *Item, err error) {
+	if item.writeSpan == nil {
+		return
+	}
+	if err != nil {
+		item.writeSpan.RecordError(err)
+		item.writeSpan.SetStatus(codes.Error, err.Error())
+	}
+	item.writeSpan.End()
+	item.writeSpan = nil
+}
+
+// skip reports the item as success without replicating it, the previous items are waited
+// to be reported first to keep the order of successes.
+func (m *MysqlSyncer) skip(item *Item) error {
+	select {
+	case <-m.pending.drainedChan():
+	case <-m.errCh:
+		return m.err
+	}
+
+	select {
+	case m.success <- item:
+		return nil
+	case <-m.errCh:
+		return m.err
+	}
+}
+
+// logSkippedDDL records the DDL not applied to the downstream, and reports the item as success.
+func (m *MysqlSyncer) logSkippedDDL(item *Item, ddl *loader.DDL) error {
+	commitTS := item.Binlog.GetCommitTs()
+	log.Info("skip applying ddl", zap.String("schema", ddl.Database), zap.String("table", ddl.Table),
+		zap.String("sql", ddl.SQL), zap.Int64("commit ts", commitTS))
+	if m.ddlLogger != nil {
+		if err := m.ddlLogger.LogDDL(ddl, commitTS); err != nil {
+			return errors.Annotatef(err, "log the skipped ddl %s", ddl.SQL)
+		}
+	}
+	return errors.Trace(m.skip(item))
+}
+
+// FlushCheckpoint implements Syncer interface, it waits for all the txns sent to loader
+// to be executed and sent to Successes.
+func (m *MysqlSyncer) FlushCheckpoint(ctx context.Context) error {
+	select {
+	case <-m.pending.drainedChan():
+		return nil
+	case <-m.errCh:
+		return m.err
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+}
+
+// Lag returns the duration between now and the commit time of the last item received by Sync,
+// 0 is returned if no item is received yet.
+func (m *MysqlSyncer) Lag() time.Duration {
+	ts := atomic.LoadInt64(&m.lastItemCommitTS)
+	if ts == 0 {
+		return 0
+	}
+
+	physical := oracle.ExtractPhysical(uint64(ts))
+	return time.Since(time.Unix(0, physical*int64(time.Millisecond)))
+}
+
+// LoaderStats returns the statistics of the loader executing the binlogs.
+func (m *MysqlSyncer) LoaderStats() loader.LoaderStats {
+	return m.getLoader().Stats()
+}
+
+// SetLoaderWorkerCount changes the number of workers of the loader executing the binlogs. The loader
+// created by SwitchDownstream uses the worker count of the config again.
+func (m *MysqlSyncer) SetLoaderWorkerCount(n int) error {
+	return errors.Trace(m.getLoader().SetWorkerCount(n))
+}
+
+// checkLatency calls the latencyAlertFn in a new goroutine if the lag exceeds latencyThreshold
+// and no alert is sent in latencyAlertDebounceInterval.
+func (m *MysqlSyncer) checkLatency() {
+	lag := m.Lag()
+	if lag <= m.latencyThreshold {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&m.lastLatencyAlert)
+	if last != 0 && now-last < int64(latencyAlertDebounceInterval) {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&m.lastLatencyAlert, last, now) {
+		return
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error("latency alert panic", zap.Duration("lag", lag), zap.Reflect("recover", r))
+			}
+		}()
+		m.latencyAlertFn(lag)
+	}()
+}
+
+// Pause implements Syncer interface, the txns already sent to loader are still executed.
+func (m *MysqlSyncer) Pause() error {
+	m.pauser.pause()
+	log.Info("mysql syncer is paused")
+	return nil
+}
+
+// Resume implements Syncer interface
+func (m *MysqlSyncer) Resume() error {
+	m.pauser.resume()
+	log.Info("mysql syncer is resumed")
+	return nil
+}
+
+func (m *MysqlSyncer) notifySchemaChange(ddl *loader.DDL, commitTS int64) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("schema change notifier panic",
+				zap.String("schema", ddl.Database),
+				zap.String("table", ddl.Table),
+				zap.String("sql", ddl.SQL),
+				zap.Reflect("recover", r))
+		}
+	}()
+
+	m.schemaChangeNotifier(ddl.Database, ddl.Table, ddl.SQL, commitTS)
+}
+
 // Close implements Syncer interface
 func (m *MysqlSyncer) Close() error {
-	m.loader.Close()
+	m.getLoader().Close()
 
-	err := <-m.Error()
+	err := <-m.ErrorContext(context.Background())
 
 	if m.relayer != nil {
 		closeRelayerErr := m.relayer.Close()
@@ -214,6 +761,35 @@ func (m *MysqlSyncer) Close() error {
 }
 
 func (m *MysqlSyncer) run() {
+	var err error
+	for {
+		ld := m.getLoader()
+		err = m.runLoader(ld)
+
+		m.loaderMu.Lock()
+		replaced, done := m.loader != ld, m.switchDone
+		m.stopped = !replaced || err != nil
+		stopped := m.stopped
+		m.loaderMu.Unlock()
+		if replaced {
+			// replaced by SwitchDownstream, the new loader is left unused if the old one fails.
+			done <- err
+		}
+		if stopped {
+			break
+		}
+	}
+
+	close(m.success)
+	log.Info("Successes chan quit")
+	m.loaderMu.RLock()
+	m.db.Close()
+	m.loaderMu.RUnlock()
+	m.setErr(err)
+}
+
+// runLoader runs ld until it quits, the executed txns are sent to Successes.
+func (m *MysqlSyncer) runLoader(ld loader.Loader) error {
 	var wg sync.WaitGroup
 
 	// handle success
@@ -221,22 +797,26 @@ func (m *MysqlSyncer) run() {
 	go func() {
 		defer wg.Done()
 
-		for txn := range m.loader.Successes() {
+		var lastCommitTSReport time.Time
+		for txn := range ld.Successes() {
 			item := txn.Metadata.(*Item)
 			item.AppliedTS = txn.AppliedTS
+			if m.useCommitTS && (txn.AppliedTS > 0 || time.Since(lastCommitTSReport) >= commitTSReportInterval) {
+				item.AppliedTS = txn.CommitTS
+				lastCommitTSReport = time.Now()
+			}
 			if m.relayer != nil {
 				m.relayer.GCBinlog(item.RelayLogPos)
 			}
+			finishWriteSpan(item, nil)
 			m.success <- item
+			m.pending.done()
 		}
-		close(m.success)
-		log.Info("Successes chan quit")
 	}()
 
 	// run loader
-	err := m.loader.Run()
+	err := ld.Run()
 
 	wg.Wait()
-	m.db.Close()
-	m.setErr(err)
+	return err
 }
@@ -13,6 +13,13 @@
 package sync
 
 import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -22,6 +29,14 @@ import (
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ = check.Suite(&mysqlSuite{})
@@ -48,6 +63,10 @@ func (l *fakeMySQLLoader) Successes() <-chan *loader.Txn {
 	return l.successes
 }
 
+func (l *fakeMySQLLoader) Stats() loader.LoaderStats {
+	return loader.LoaderStats{}
+}
+
 func (s *mysqlSuite) TestMySQLSyncerAvoidBlock(c *check.C) {
 	var infoGetter translator.TableInfoGetter
 	// create mysql syncer
@@ -70,12 +89,10 @@ func (s *mysqlSuite) TestMySQLSyncerAvoidBlock(c *check.C) {
 		Schema:        gen.Schema,
 		Table:         gen.Table,
 	}
-	select {
-	case err := <-syncer.Error():
-		c.Assert(err, check.ErrorMatches, ".*MySQLSyncerMockTest.*")
-	case <-time.After(time.Second):
-		c.Fatal("mysql syncer hasn't quit in 1s after some error occurs in loader")
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := <-syncer.ErrorContext(ctx)
+	c.Assert(err, check.ErrorMatches, ".*MySQLSyncerMockTest.*", check.Commentf("mysql syncer hasn't quit in 1s after some error occurs in loader"))
 
 	finishSync := make(chan struct{})
 	go func() {
@@ -113,6 +130,10 @@ func (l *fakeMySQLLoaderForRelayer) Successes() <-chan *loader.Txn {
 	return l.successes
 }
 
+func (l *fakeMySQLLoaderForRelayer) Stats() loader.LoaderStats {
+	return loader.LoaderStats{}
+}
+
 func (l *fakeMySQLLoaderForRelayer) Close() {
 	close(l.successes)
 }
@@ -169,6 +190,325 @@ func (s *mysqlSuite) TestMySQLSyncerWithRelayer(c *check.C) {
 	c.Assert(len(names), check.Equals, 2)
 }
 
+type schemaChange struct {
+	schema   string
+	table    string
+	sql      string
+	commitTS int64
+}
+
+func (s *mysqlSuite) TestSchemaChangeNotifier(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	fakeMySQLLoaderImpl := &fakeMySQLLoaderForRelayer{
+		successes: make(chan *loader.Txn, 8),
+		input:     make(chan *loader.Txn),
+	}
+	db, _, _ := sqlmock.New()
+
+	var changes []schemaChange
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     fakeMySQLLoaderImpl,
+		baseSyncer: newBaseSyncer(gen),
+	}
+	WithSchemaChangeNotifier(func(schema, table, ddlSQL string, commitTS int64) {
+		changes = append(changes, schemaChange{schema, table, ddlSQL, commitTS})
+	})(syncer)
+	defer syncer.Close()
+
+	go syncer.run()
+
+	gen.SetDDL()
+	err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+
+	gen.SetInsert(c)
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+
+	gen.SetDDL()
+	gen.TiBinlog.DdlQuery = []byte("alter table test add column name varchar(24)")
+	gen.TiBinlog.CommitTs = 300
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+
+	// wait for all binlogs processed
+	for i := 0; i < 3; i++ {
+		select {
+		case <-syncer.Successes():
+		case <-time.After(time.Second):
+			c.Fatal("mysql syncer hasn't synced item in 1s")
+		}
+	}
+
+	c.Assert(changes, check.DeepEquals, []schemaChange{
+		{"test", "test", "create table test(id int)", 200},
+		{"test", "test", "alter table test add column name varchar(24)", 300},
+	})
+}
+
+func (s *mysqlSuite) TestPanicSchemaChangeNotifier(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	fakeMySQLLoaderImpl := &fakeMySQLLoaderForRelayer{
+		successes: make(chan *loader.Txn, 8),
+		input:     make(chan *loader.Txn),
+	}
+	db, _, _ := sqlmock.New()
+
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     fakeMySQLLoaderImpl,
+		baseSyncer: newBaseSyncer(gen),
+	}
+	WithSchemaChangeNotifier(func(schema, table, ddlSQL string, commitTS int64) {
+		panic("schema registry unavailable")
+	})(syncer)
+	defer syncer.Close()
+
+	go syncer.run()
+
+	gen.SetDDL()
+	err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+
+	select {
+	case <-syncer.Successes():
+	case <-time.After(time.Second):
+		c.Fatal("mysql syncer hasn't synced the DDL in 1s after the notifier panics")
+	}
+}
+
+func (s *mysqlSuite) TestMapDDLColumnTypes(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	input := make(chan *loader.Txn, 1)
+	db, _, _ := sqlmock.New()
+
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     &fakeMySQLLoaderForRelayer{input: input},
+		destDBType: "mysql",
+		baseSyncer: newBaseSyncer(gen),
+	}
+
+	// the DDL is passed as is by default
+	gen.SetDDL()
+	gen.TiBinlog.DdlQuery = []byte("create table test(id int, b tinyblob)")
+	err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn := <-input
+	c.Assert(txn.DDL.SQL, check.Equals, "create table test(id int, b tinyblob)")
+
+	WithMapColumnTypes(true)(syncer)
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn = <-input
+	c.Assert(txn.DDL.SQL, check.Equals, "create table test(id int, b BLOB(255))")
+
+	// the comments for TiDB are kept
+	gen.TiBinlog.DdlQuery = []byte("create table test(id bigint primary key /*T![clustered_index] CLUSTERED */, b tinyblob) " +
+		"/*!90000 SHARD_ROW_ID_BITS=4 */")
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn = <-input
+	c.Assert(txn.DDL.SQL, check.Equals, "create table test(id bigint primary key /*T![clustered_index] CLUSTERED */, b BLOB(255)) "+
+		"/*!90000 SHARD_ROW_ID_BITS=4 */")
+
+	// the unparsable DDL is passed to the loader as is
+	gen.TiBinlog.DdlQuery = []byte("create table test(id int, b tinyblob) unknown_option")
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn = <-input
+	c.Assert(txn.DDL.SQL, check.Equals, "create table test(id int, b tinyblob) unknown_option")
+}
+
+type fakeMySQLLoaderWithAppliedTS struct {
+	fakeMySQLLoaderForRelayer
+	appliedTS int64
+}
+
+func (l *fakeMySQLLoaderWithAppliedTS) Run() error {
+	go func() {
+		for txn := range l.input {
+			txn.AppliedTS = l.appliedTS
+			l.successes <- txn
+		}
+	}()
+	return nil
+}
+
+func (s *mysqlSuite) TestUseCommitTS(c *check.C) {
+	getAppliedTS := func(useCommitTS bool) int64 {
+		gen := &translator.BinlogGenerator{}
+		ld := &fakeMySQLLoaderWithAppliedTS{
+			fakeMySQLLoaderForRelayer: fakeMySQLLoaderForRelayer{
+				successes: make(chan *loader.Txn, 1),
+				input:     make(chan *loader.Txn),
+			},
+			appliedTS: 500,
+		}
+		db, _, _ := sqlmock.New()
+		syncer := &MysqlSyncer{
+			db:         db,
+			loader:     ld,
+			baseSyncer: newBaseSyncer(gen),
+		}
+		UseCommitTS(useCommitTS)(syncer)
+		go syncer.run()
+		defer syncer.Close()
+
+		gen.SetDDL()
+		err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+		c.Assert(err, check.IsNil)
+
+		select {
+		case item := <-syncer.Successes():
+			return item.AppliedTS
+		case <-time.After(time.Second):
+			c.Fatal("mysql syncer hasn't synced the item in 1s")
+		}
+		return 0
+	}
+
+	c.Assert(getAppliedTS(false), check.Equals, int64(500))
+	c.Assert(getAppliedTS(true), check.Equals, int64(200))
+}
+
+func (s *mysqlSuite) TestUseCommitTSForMySQL(c *check.C) {
+	getAppliedTS := func(useCommitTS bool) []int64 {
+		gen := &translator.BinlogGenerator{}
+		ld := &fakeMySQLLoaderWithAppliedTS{
+			fakeMySQLLoaderForRelayer: fakeMySQLLoaderForRelayer{
+				successes: make(chan *loader.Txn, 1),
+				input:     make(chan *loader.Txn),
+			},
+		}
+		db, _, _ := sqlmock.New()
+		syncer := &MysqlSyncer{
+			db:         db,
+			loader:     ld,
+			baseSyncer: newBaseSyncer(gen),
+			destDBType: "mysql",
+		}
+		UseCommitTS(useCommitTS)(syncer)
+		go syncer.run()
+		defer syncer.Close()
+
+		var appliedTSs []int64
+		for i := 0; i < 2; i++ {
+			gen.SetDDL()
+			err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+			c.Assert(err, check.IsNil)
+
+			select {
+			case item := <-syncer.Successes():
+				appliedTSs = append(appliedTSs, item.AppliedTS)
+			case <-time.After(time.Second):
+				c.Fatal("mysql syncer hasn't synced the item in 1s")
+			}
+		}
+		return appliedTSs
+	}
+
+	// MySQL never reports the applied ts, so the checkpoint only gets the commit ts by UseCommitTS,
+	// and at most once per commitTSReportInterval.
+	c.Assert(getAppliedTS(false), check.DeepEquals, []int64{0, 0})
+	c.Assert(getAppliedTS(true), check.DeepEquals, []int64{200, 0})
+}
+
+func (s *mysqlSuite) TestPauseResume(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	input := make(chan *loader.Txn)
+	db, _, _ := sqlmock.New()
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     &fakeMySQLLoaderForRelayer{input: input},
+		baseSyncer: newBaseSyncer(gen),
+	}
+	gen.SetDDL()
+	item := &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}
+
+	// not paused
+	go func() {
+		c.Assert(syncer.Sync(item), check.IsNil)
+	}()
+	select {
+	case <-input:
+	case <-time.After(time.Second):
+		c.Fatal("mysql syncer hasn't synced the item in 1s")
+	}
+
+	c.Assert(syncer.Pause(), check.IsNil)
+	// pausing twice is fine
+	c.Assert(syncer.Pause(), check.IsNil)
+	synced := make(chan struct{})
+	go func() {
+		c.Assert(syncer.Sync(item), check.IsNil)
+		close(synced)
+	}()
+	select {
+	case <-input:
+		c.Fatal("mysql syncer shouldn't sync item when paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	c.Assert(syncer.Resume(), check.IsNil)
+	select {
+	case <-input:
+	case <-time.After(time.Second):
+		c.Fatal("mysql syncer hasn't synced the item in 1s after resumed")
+	}
+	<-synced
+}
+
+func (s *mysqlSuite) TestPauseDuringActiveTxn(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	input := make(chan *loader.Txn)
+	db, _, _ := sqlmock.New()
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     &fakeMySQLLoaderForRelayer{input: input},
+		baseSyncer: newBaseSyncer(gen),
+	}
+	gen.SetDDL()
+	item := &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}
+
+	// the first item is blocked by the busy loader when pausing
+	active := make(chan struct{})
+	go func() {
+		c.Assert(syncer.Sync(item), check.IsNil)
+		c.Assert(syncer.Sync(item), check.IsNil)
+		close(active)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(syncer.Pause(), check.IsNil)
+
+	// the active one is still synced, but not the next one
+	select {
+	case <-input:
+	case <-time.After(time.Second):
+		c.Fatal("mysql syncer hasn't synced the active item in 1s")
+	}
+	select {
+	case <-input:
+		c.Fatal("mysql syncer shouldn't sync item when paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	c.Assert(syncer.Resume(), check.IsNil)
+	select {
+	case <-input:
+	case <-time.After(time.Second):
+		c.Fatal("mysql syncer hasn't synced the item in 1s after resumed")
+	}
+	<-active
+}
+
+func (s *mysqlSuite) TestPauseNotSupported(c *check.C) {
+	syncer := newBaseSyncer(nil)
+	c.Assert(syncer.Pause(), check.Equals, ErrNotSupported)
+	c.Assert(syncer.Resume(), check.Equals, ErrNotSupported)
+}
+
 func (s *mysqlSuite) TestRelaxSQLMode(c *check.C) {
 	tests := []struct {
 		oldMode string
@@ -194,3 +534,630 @@ func (s *mysqlSuite) TestRelaxSQLMode(c *check.C) {
 		c.Assert(getNew, check.Equals, test.newMode)
 	}
 }
+
+func (s *mysqlSuite) TestLag(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	input := make(chan *loader.Txn, 1)
+	db, _, _ := sqlmock.New()
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     &fakeMySQLLoaderForRelayer{input: input},
+		baseSyncer: newBaseSyncer(gen),
+	}
+	c.Assert(syncer.Lag(), check.Equals, time.Duration(0))
+
+	gen.SetDDL()
+	commitTime := time.Now().Add(-3 * time.Second)
+	gen.TiBinlog.CommitTs = int64(oracle.ComposeTS(oracle.GetPhysical(commitTime), 0))
+	item := &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(item), check.IsNil)
+
+	lag := syncer.Lag()
+	c.Assert(lag >= 3*time.Second && lag < 3*time.Second+100*time.Millisecond, check.IsTrue, check.Commentf("lag: %v", lag))
+}
+
+func (s *mysqlSuite) TestLatencyAlert(c *check.C) {
+	origInterval := latencyAlertDebounceInterval
+	latencyAlertDebounceInterval = time.Hour
+	defer func() { latencyAlertDebounceInterval = origInterval }()
+
+	gen := &translator.BinlogGenerator{}
+	input := make(chan *loader.Txn, 3)
+	db, _, _ := sqlmock.New()
+	alerts := make(chan time.Duration, 3)
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     &fakeMySQLLoaderForRelayer{input: input},
+		baseSyncer: newBaseSyncer(gen),
+	}
+	WithLatencyAlert(10*time.Millisecond, func(lag time.Duration) {
+		alerts <- lag
+	})(syncer)
+
+	gen.SetDDL()
+	gen.TiBinlog.CommitTs = int64(oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Second)), 0))
+	item := &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}
+	for i := 0; i < 3; i++ {
+		c.Assert(syncer.Sync(item), check.IsNil)
+	}
+
+	select {
+	case lag := <-alerts:
+		c.Assert(lag >= time.Second, check.IsTrue, check.Commentf("lag: %v", lag))
+	case <-time.After(time.Second):
+		c.Fatal("latency alert isn't sent in 1s")
+	}
+	// only alert once in the debounce window
+	select {
+	case <-alerts:
+		c.Fatal("latency alert is sent more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func (s *mysqlSuite) TestFlushCheckpoint(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	ld := &fakeMySQLLoaderForRelayer{
+		successes: make(chan *loader.Txn),
+		input:     make(chan *loader.Txn, 100),
+	}
+	db, _, _ := sqlmock.New()
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     ld,
+		baseSyncer: newBaseSyncer(gen),
+	}
+
+	// nothing to flush
+	c.Assert(syncer.FlushCheckpoint(context.Background()), check.IsNil)
+
+	gen.SetDDL()
+	for i := 0; i < 100; i++ {
+		c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	}
+
+	// the txns are not executed by loader yet
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Assert(errors.Cause(syncer.FlushCheckpoint(ctx)), check.Equals, context.DeadlineExceeded)
+
+	received := make(chan int)
+	go func() {
+		var n int
+		for range syncer.Successes() {
+			n++
+		}
+		received <- n
+	}()
+	go syncer.run()
+
+	c.Assert(syncer.FlushCheckpoint(context.Background()), check.IsNil)
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-received, check.Equals, 100)
+}
+
+type recordingMySQLLoader struct {
+	fakeMySQLLoaderForRelayer
+	synced []*Item
+}
+
+func (l *recordingMySQLLoader) Run() error {
+	go func() {
+		for txn := range l.input {
+			l.synced = append(l.synced, txn.Metadata.(*Item))
+			l.successes <- txn
+		}
+	}()
+	return nil
+}
+
+// syncWithShouldSkip syncs the items and returns the items sent to loader and the items reported by Successes.
+func (s *mysqlSuite) syncWithShouldSkip(c *check.C, fn func(item *Item) bool, items []*Item) (synced []*Item, successes []*Item) {
+	return s.syncWithOptions(c, items, WithShouldSkip(fn))
+}
+
+// syncWithOptions syncs the items by the MysqlSyncer with opts, and returns the items sent to loader
+// and the items reported by Successes.
+func (s *mysqlSuite) syncWithOptions(c *check.C, items []*Item, opts ...MysqlSyncerOption) (synced []*Item, successes []*Item) {
+	return s.syncWithTableInfoGetter(c, &translator.BinlogGenerator{}, items, opts...)
+}
+
+// syncWithTableInfoGetter is like syncWithOptions, but translates the items by getter.
+func (s *mysqlSuite) syncWithTableInfoGetter(c *check.C, getter translator.TableInfoGetter, items []*Item,
+	opts ...MysqlSyncerOption) (synced []*Item, successes []*Item) {
+	ld := &recordingMySQLLoader{
+		fakeMySQLLoaderForRelayer: fakeMySQLLoaderForRelayer{
+			successes: make(chan *loader.Txn),
+			input:     make(chan *loader.Txn),
+		},
+	}
+	db, _, _ := sqlmock.New()
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     ld,
+		baseSyncer: newBaseSyncer(getter),
+	}
+	for _, opt := range opts {
+		opt(syncer)
+	}
+	go syncer.run()
+
+	done := make(chan struct{})
+	go func() {
+		for item := range syncer.Successes() {
+			successes = append(successes, item)
+			if len(successes) == len(items) {
+				close(done)
+			}
+		}
+	}()
+
+	for _, item := range items {
+		c.Assert(syncer.Sync(item), check.IsNil)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		c.Fatal("mysql syncer hasn't reported all items in 1s")
+	}
+	return ld.synced, successes
+}
+
+func (s *mysqlSuite) genDDLItems(schemas []string, commitTSs []int64) []*Item {
+	gen := &translator.BinlogGenerator{}
+	gen.SetDDL()
+
+	var items []*Item
+	for i, schema := range schemas {
+		binlog := *gen.TiBinlog
+		binlog.CommitTs = commitTSs[i]
+		items = append(items, &Item{Binlog: &binlog, Schema: schema, Table: gen.Table})
+	}
+	return items
+}
+
+func (s *mysqlSuite) TestShouldSkipBySchema(c *check.C) {
+	items := s.genDDLItems([]string{"test", "skipped", "test", "skipped"}, []int64{1, 2, 3, 4})
+	synced, successes := s.syncWithShouldSkip(c, func(item *Item) bool {
+		return item.Schema == "skipped"
+	}, items)
+
+	c.Assert(synced, check.DeepEquals, []*Item{items[0], items[2]})
+	// the order of successes is kept
+	c.Assert(successes, check.DeepEquals, items)
+}
+
+func (s *mysqlSuite) TestShouldSkipByCommitTS(c *check.C) {
+	items := s.genDDLItems([]string{"test", "test", "test", "test"}, []int64{50, 100, 199, 200})
+	synced, successes := s.syncWithShouldSkip(c, func(item *Item) bool {
+		ts := item.Binlog.GetCommitTs()
+		return ts >= 100 && ts < 200
+	}, items)
+
+	c.Assert(synced, check.DeepEquals, []*Item{items[0], items[3]})
+	c.Assert(successes, check.DeepEquals, items)
+}
+
+func (s *mysqlSuite) TestWriteSpan(c *check.C) {
+	recorder := tracetest.NewSpanRecorder()
+	origProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(origProvider)
+
+	_, parent := otel.Tracer(TracerName).Start(context.Background(), "drainer.sync")
+	items := s.genDDLItems([]string{"test", "test"}, []int64{1, 2})
+	items[0].SpanContext = parent.SpanContext()
+	_, successes := s.syncWithShouldSkip(c, func(*Item) bool { return false }, items)
+	c.Assert(successes, check.HasLen, 2)
+	parent.End()
+
+	// only the item with SpanContext is traced
+	spans := recorder.Ended()
+	c.Assert(spans, check.HasLen, 2)
+	write := spans[0]
+	c.Assert(write.Name(), check.Equals, "drainer.mysql.write")
+	c.Assert(write.Parent().SpanID(), check.Equals, parent.SpanContext().SpanID())
+	c.Assert(write.SpanContext().TraceID(), check.Equals, parent.SpanContext().TraceID())
+	c.Assert(write.Attributes(), check.DeepEquals, []attribute.KeyValue{
+		attribute.Int64("commit_ts", 1),
+		attribute.Bool("ddl", true),
+	})
+}
+
+func (s *mysqlSuite) TestWriteSpanWithNoopTracer(c *check.C) {
+	origProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	defer otel.SetTracerProvider(origProvider)
+
+	items := s.genDDLItems([]string{"test"}, []int64{1})
+	_, span := otel.Tracer(TracerName).Start(context.Background(), "drainer.sync")
+	items[0].SpanContext = span.SpanContext()
+	_, successes := s.syncWithShouldSkip(c, func(*Item) bool { return false }, items)
+	c.Assert(successes, check.HasLen, 1)
+}
+
+func (s *mysqlSuite) TestStripAutoIncrement(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	input := make(chan *loader.Txn, 1)
+	db, _, _ := sqlmock.New()
+
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     &fakeMySQLLoaderForRelayer{input: input},
+		baseSyncer: newBaseSyncer(gen),
+	}
+	WithStripAutoIncrement(true)(syncer)
+
+	tests := []struct {
+		ddl      string
+		expected string
+	}{
+		{
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB AUTO_INCREMENT=100 DEFAULT CHARSET=utf8",
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB DEFAULT CHARSET=utf8",
+		},
+		{
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB, auto_increment = 100",
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB",
+		},
+		{
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) AUTO_INCREMENT=100, ENGINE=InnoDB",
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB",
+		},
+		{"ALTER TABLE t AUTO_INCREMENT=1", "ALTER TABLE t"},
+		{"ALTER TABLE t ADD COLUMN c INT", "ALTER TABLE t ADD COLUMN c INT"},
+		// the string literals are kept
+		{"ALTER TABLE t COMMENT 'AUTO_INCREMENT=5'", "ALTER TABLE t COMMENT 'AUTO_INCREMENT=5'"},
+	}
+
+	gen.SetDDL()
+	for _, t := range tests {
+		gen.TiBinlog.DdlQuery = []byte(t.ddl)
+		err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+		c.Assert(err, check.IsNil)
+		txn := <-input
+		c.Assert(txn.DDL.SQL, check.Equals, t.expected, check.Commentf("ddl: %s", t.ddl))
+	}
+
+	// the DDL is passed as is when disabled
+	WithStripAutoIncrement(false)(syncer)
+	gen.TiBinlog.DdlQuery = []byte(tests[0].ddl)
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	txn := <-input
+	c.Assert(txn.DDL.SQL, check.Equals, tests[0].ddl)
+}
+
+// systemTableGetter places the tables of BinlogGenerator in a system schema.
+type systemTableGetter struct {
+	*translator.BinlogGenerator
+}
+
+func (g systemTableGetter) SchemaAndTableName(id int64) (string, string, bool) {
+	return "mysql", "user", true
+}
+
+// swapSystemSchemaSkipCounter replaces SystemSchemaSkipCounter with a new counter for test.
+func swapSystemSchemaSkipCounter() (counter prometheus.Counter, restore func()) {
+	orig := SystemSchemaSkipCounter
+	SystemSchemaSkipCounter = prometheus.NewCounter(prometheus.CounterOpts{Name: "system_schema_skip_total"})
+	return SystemSchemaSkipCounter, func() { SystemSchemaSkipCounter = orig }
+}
+
+func counterValue(c *check.C, counter prometheus.Counter) float64 {
+	var metric dto.Metric
+	c.Assert(counter.Write(&metric), check.IsNil)
+	return metric.GetCounter().GetValue()
+}
+
+func (s *mysqlSuite) TestIgnoreSystemSchemaDMLs(c *check.C) {
+	counter, restore := swapSystemSchemaSkipCounter()
+	defer restore()
+
+	gen := &translator.BinlogGenerator{}
+	gen.SetAllDML(c)
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV}
+
+	// the DMLs of mysql.user never reach the loader
+	synced, successes := s.syncWithTableInfoGetter(c, systemTableGetter{gen}, []*Item{item}, WithIgnoreSystemSchemas(true))
+	c.Assert(synced, check.HasLen, 0)
+	c.Assert(successes, check.DeepEquals, []*Item{item})
+	c.Assert(counterValue(c, counter), check.Equals, float64(3))
+
+	// they're replicated when disabled
+	synced, successes = s.syncWithTableInfoGetter(c, systemTableGetter{gen}, []*Item{item}, WithIgnoreSystemSchemas(false))
+	c.Assert(synced, check.DeepEquals, []*Item{item})
+	c.Assert(successes, check.DeepEquals, []*Item{item})
+	c.Assert(counterValue(c, counter), check.Equals, float64(3))
+}
+
+func (s *mysqlSuite) TestIgnoreSystemSchemaDDLs(c *check.C) {
+	counter, restore := swapSystemSchemaSkipCounter()
+	defer restore()
+
+	items := s.genDDLItems([]string{"test", "mysql", "INFORMATION_SCHEMA", "performance_schema", "sys", "mysql_test"},
+		[]int64{1, 2, 3, 4, 5, 6})
+	synced, successes := s.syncWithOptions(c, items, WithIgnoreSystemSchemas(true))
+	c.Assert(synced, check.DeepEquals, []*Item{items[0], items[5]})
+	c.Assert(successes, check.DeepEquals, items)
+	c.Assert(counterValue(c, counter), check.Equals, float64(4))
+}
+
+func (s *mysqlSuite) TestDropSystemSchemaDMLs(c *check.C) {
+	user := &loader.DML{Database: "mysql", Table: "user", Tp: loader.InsertDMLType}
+	t1 := &loader.DML{Database: "test", Table: "t1", Tp: loader.InsertDMLType}
+	t2 := &loader.DML{Database: "test", Table: "t2", Tp: loader.UpdateDMLType}
+	stats := &loader.DML{Database: "Performance_Schema", Table: "events_statements_current", Tp: loader.DeleteDMLType}
+
+	txn := &loader.Txn{DMLs: []*loader.DML{user, t1, stats, t2}}
+	c.Assert(dropSystemSchemaDMLs(txn), check.Equals, 2)
+	c.Assert(txn.DMLs, check.DeepEquals, []*loader.DML{t1, t2})
+
+	c.Assert(dropSystemSchemaDMLs(txn), check.Equals, 0)
+	c.Assert(txn.DMLs, check.DeepEquals, []*loader.DML{t1, t2})
+}
+
+type recordingDDLLogger struct {
+	ddls []string
+	err  error
+}
+
+func (l *recordingDDLLogger) LogDDL(ddl *loader.DDL, commitTS int64) error {
+	if l.err != nil {
+		return l.err
+	}
+	l.ddls = append(l.ddls, fmt.Sprintf("%d %s.%s %s", commitTS, ddl.Database, ddl.Table, ddl.SQL))
+	return nil
+}
+
+func (s *mysqlSuite) TestSkipDDLAlways(c *check.C) {
+	items := s.genDDLItems([]string{"test", "test"}, []int64{1, 2})
+	ddlLogger := &recordingDDLLogger{}
+	synced, successes := s.syncWithOptions(c, items, WithSkipDDL(func(*loader.DDL) bool { return true }), WithDDLLogger(ddlLogger))
+
+	c.Assert(synced, check.HasLen, 0)
+	c.Assert(successes, check.DeepEquals, items)
+	c.Assert(ddlLogger.ddls, check.DeepEquals, []string{
+		"1 test.test create table test(id int)",
+		"2 test.test create table test(id int)",
+	})
+}
+
+func (s *mysqlSuite) TestSkipDDLNever(c *check.C) {
+	items := s.genDDLItems([]string{"test", "test"}, []int64{1, 2})
+	ddlLogger := &recordingDDLLogger{}
+	synced, successes := s.syncWithOptions(c, items, WithSkipDDL(func(*loader.DDL) bool { return false }), WithDDLLogger(ddlLogger))
+
+	c.Assert(synced, check.DeepEquals, items)
+	c.Assert(successes, check.DeepEquals, items)
+	c.Assert(ddlLogger.ddls, check.HasLen, 0)
+}
+
+func (s *mysqlSuite) TestSkipDDLBySchema(c *check.C) {
+	items := s.genDDLItems([]string{"test", "managed", "test", "managed"}, []int64{1, 2, 3, 4})
+	// the skipped DDLs are only logged without DDLLogger
+	synced, successes := s.syncWithOptions(c, items, WithSkipDDL(func(ddl *loader.DDL) bool {
+		return ddl.Database == "managed"
+	}))
+
+	c.Assert(synced, check.DeepEquals, []*Item{items[0], items[2]})
+	// the order of successes is kept
+	c.Assert(successes, check.DeepEquals, items)
+}
+
+func (s *mysqlSuite) TestSkipDDLLogFailed(c *check.C) {
+	db, _, _ := sqlmock.New()
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     &fakeMySQLLoaderForRelayer{input: make(chan *loader.Txn)},
+		baseSyncer: newBaseSyncer(&translator.BinlogGenerator{}),
+	}
+	WithSkipDDL(func(*loader.DDL) bool { return true })(syncer)
+	WithDDLLogger(&recordingDDLLogger{err: errors.New("disk full")})(syncer)
+
+	items := s.genDDLItems([]string{"test"}, []int64{1})
+	c.Assert(syncer.Sync(items[0]), check.ErrorMatches, ".*log the skipped ddl.*disk full")
+}
+
+func (s *mysqlSuite) TestFileDDLLogger(c *check.C) {
+	path := filepath.Join(c.MkDir(), "skipped_ddl.sql")
+	ddlLogger, err := NewFileDDLLogger(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(ddlLogger.LogDDL(&loader.DDL{Database: "test", Table: "t1", SQL: "create table t1(id int);"}, 1), check.IsNil)
+	c.Assert(ddlLogger.Close(), check.IsNil)
+
+	// the file is appended
+	ddlLogger, err = NewFileDDLLogger(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(ddlLogger.LogDDL(&loader.DDL{Database: "test", Table: "t1", SQL: "alter table t1 add column a int"}, 2), check.IsNil)
+	c.Assert(ddlLogger.Close(), check.IsNil)
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "-- commit ts: 1\nUSE `test`;\ncreate table t1(id int);\n"+
+		"-- commit ts: 2\nUSE `test`;\nalter table t1 add column a int;\n")
+}
+
+func newRecordingMySQLLoader() *recordingMySQLLoader {
+	return &recordingMySQLLoader{
+		fakeMySQLLoaderForRelayer: fakeMySQLLoaderForRelayer{
+			successes: make(chan *loader.Txn),
+			input:     make(chan *loader.Txn),
+		},
+	}
+}
+
+// newSwitchTestSyncer returns a running MysqlSyncer whose new downstream is created by newLoader,
+// the old db expects to be closed.
+func (s *mysqlSuite) newSwitchTestSyncer(c *check.C, newLoader func(db *sql.DB, cfg *DBConfig) (loader.Loader, error)) (
+	*MysqlSyncer, *recordingMySQLLoader, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mock.ExpectClose()
+
+	ld := newRecordingMySQLLoader()
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     ld,
+		newLoader:  newLoader,
+		baseSyncer: newBaseSyncer(&translator.BinlogGenerator{}),
+	}
+	go syncer.run()
+	return syncer, ld, mock
+}
+
+func mockCreateDB(c *check.C, err error) (restore func()) {
+	oldCreateDB := createDB
+	createDB = func(string, string, string, int, *tls.Config, *string) (*sql.DB, error) {
+		if err != nil {
+			return nil, err
+		}
+		db, _, dbErr := sqlmock.New()
+		c.Assert(dbErr, check.IsNil)
+		return db, nil
+	}
+	return func() { createDB = oldCreateDB }
+}
+
+func (s *mysqlSuite) TestSwitchDownstream(c *check.C) {
+	defer mockCreateDB(c, nil)()
+
+	newLd := newRecordingMySQLLoader()
+	syncer, oldLd, oldMock := s.newSwitchTestSyncer(c, func(db *sql.DB, cfg *DBConfig) (loader.Loader, error) {
+		c.Assert(cfg.Host, check.Equals, "new-mysql")
+		return newLd, nil
+	})
+
+	received := make(chan []*Item)
+	go func() {
+		var items []*Item
+		for item := range syncer.Successes() {
+			items = append(items, item)
+		}
+		received <- items
+	}()
+
+	items := s.genDDLItems([]string{"test", "test", "test", "test"}, []int64{1, 2, 3, 4})
+	c.Assert(syncer.Sync(items[0]), check.IsNil)
+	c.Assert(syncer.Sync(items[1]), check.IsNil)
+
+	c.Assert(syncer.SwitchDownstream(context.Background(), &DBConfig{Host: "new-mysql", Port: 3306}), check.IsNil)
+	c.Assert(oldMock.ExpectationsWereMet(), check.IsNil)
+
+	c.Assert(syncer.Sync(items[2]), check.IsNil)
+	c.Assert(syncer.Sync(items[3]), check.IsNil)
+	c.Assert(syncer.FlushCheckpoint(context.Background()), check.IsNil)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	c.Assert(<-received, check.DeepEquals, items)
+	c.Assert(oldLd.synced, check.DeepEquals, items[:2])
+	c.Assert(newLd.synced, check.DeepEquals, items[2:])
+}
+
+func (s *mysqlSuite) TestSwitchDownstreamUnderLoad(c *check.C) {
+	defer mockCreateDB(c, nil)()
+
+	newLd := newRecordingMySQLLoader()
+	syncer, oldLd, _ := s.newSwitchTestSyncer(c, func(db *sql.DB, cfg *DBConfig) (loader.Loader, error) {
+		return newLd, nil
+	})
+
+	const count = 1000
+	received := make(chan []*Item)
+	go func() {
+		var items []*Item
+		for item := range syncer.Successes() {
+			items = append(items, item)
+		}
+		received <- items
+	}()
+
+	commitTSs := make([]int64, count)
+	schemas := make([]string, count)
+	for i := range commitTSs {
+		commitTSs[i] = int64(i + 1)
+		schemas[i] = "test"
+	}
+	items := s.genDDLItems(schemas, commitTSs)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	half := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		for i, item := range items {
+			if i == count/2 {
+				close(half)
+			}
+			c.Assert(syncer.Sync(item), check.IsNil)
+		}
+	}()
+	<-half
+	c.Assert(syncer.SwitchDownstream(context.Background(), &DBConfig{Host: "new-mysql", Port: 3306}), check.IsNil)
+	wg.Wait()
+
+	c.Assert(syncer.FlushCheckpoint(context.Background()), check.IsNil)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	// every item is executed once in order
+	c.Assert(<-received, check.DeepEquals, items)
+	c.Assert(len(oldLd.synced) >= count/2, check.IsTrue)
+	c.Assert(append(oldLd.synced, newLd.synced...), check.DeepEquals, items)
+}
+
+func (s *mysqlSuite) TestSwitchDownstreamFailed(c *check.C) {
+	restore := mockCreateDB(c, errors.New("connection refused"))
+	newLd := newRecordingMySQLLoader()
+	createLoaderErr := errors.New("unknown database")
+	syncer, oldLd, _ := s.newSwitchTestSyncer(c, func(db *sql.DB, cfg *DBConfig) (loader.Loader, error) {
+		if createLoaderErr != nil {
+			return nil, createLoaderErr
+		}
+		return newLd, nil
+	})
+
+	received := make(chan []*Item)
+	go func() {
+		var items []*Item
+		for item := range syncer.Successes() {
+			items = append(items, item)
+		}
+		received <- items
+	}()
+
+	items := s.genDDLItems([]string{"test", "test", "test"}, []int64{1, 2, 3})
+	c.Assert(syncer.Sync(items[0]), check.IsNil)
+
+	// the old downstream keeps being used if the new one can't be connected
+	err := syncer.SwitchDownstream(context.Background(), &DBConfig{Host: "new-mysql", Port: 3306})
+	c.Assert(err, check.ErrorMatches, ".*connect to the new downstream.*connection refused")
+	restore()
+	c.Assert(syncer.Sync(items[1]), check.IsNil)
+
+	defer mockCreateDB(c, nil)()
+	err = syncer.SwitchDownstream(context.Background(), &DBConfig{Host: "new-mysql", Port: 3306})
+	c.Assert(err, check.ErrorMatches, ".*create loader of the new downstream.*unknown database")
+	c.Assert(syncer.Sync(items[2]), check.IsNil)
+
+	c.Assert(syncer.FlushCheckpoint(context.Background()), check.IsNil)
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-received, check.DeepEquals, items)
+	c.Assert(oldLd.synced, check.DeepEquals, items)
+	c.Assert(newLd.synced, check.HasLen, 0)
+}
+
+func (s *mysqlSuite) TestSwitchDownstreamTimeout(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	syncer := &MysqlSyncer{
+		db:         db,
+		loader:     &fakeMySQLLoaderForRelayer{input: make(chan *loader.Txn, 1)},
+		baseSyncer: newBaseSyncer(&translator.BinlogGenerator{}),
+	}
+
+	// the txn is never executed by the loader
+	c.Assert(syncer.Sync(s.genDDLItems([]string{"test"}, []int64{1})[0]), check.IsNil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = syncer.SwitchDownstream(ctx, &DBConfig{Host: "new-mysql", Port: 3306})
+	c.Assert(errors.Cause(err), check.Equals, context.DeadlineExceeded)
+}
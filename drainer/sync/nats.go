@@ -0,0 +1,303 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"go.uber.org/zap"
+)
+
+var (
+	defaultNATSStream      = "binlog"
+	defaultNATSMaxInFlight = 1024
+)
+
+var _ Syncer = &NATSSyncer{}
+
+// NATSMessage is the message published to NATS JetStream,
+// DML is published to subject binlog.{schema}.{table}.{dmlType} and DDL to binlog.ddl.{schema}.
+// The characters not allowed in the subject tokens, `.`, `*`, `>` and whitespaces, and `%` in the
+// schema and table names are escaped as `%XX` of the hex code.
+type NATSMessage struct {
+	CommitTS  int64                  `json:"commit-ts"`
+	Schema    string                 `json:"schema"`
+	Table     string                 `json:"table"`
+	Type      string                 `json:"type"`
+	Values    map[string]interface{} `json:"values,omitempty"`
+	OldValues map[string]interface{} `json:"old-values,omitempty"`
+	SQL       string                 `json:"sql,omitempty"`
+}
+
+// natsPendingAck is a published message waiting for the ack, item is set for the last message of it,
+// or without future if the item has no message. The item is reported as success once the ack is received,
+// as the messages are acknowledged in order.
+type natsPendingAck struct {
+	future nats.PubAckFuture
+	item   *Item
+}
+
+// natsPublishing is a message to be published for an item.
+type natsPublishing struct {
+	subject string
+	msg     *NATSMessage
+}
+
+// NATSSyncer sync data to NATS JetStream
+type NATSSyncer struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+
+	// limit the count of unacknowledged messages
+	inFlight chan struct{}
+	pending  chan *natsPendingAck
+
+	shutdown chan struct{}
+	*baseSyncer
+}
+
+// NewNATSSyncer returns a instance of NATSSyncer
+func NewNATSSyncer(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*NATSSyncer, error) {
+	if len(cfg.NATSURL) == 0 {
+		return nil, errors.New("nats-url must be set when syncing to nats")
+	}
+
+	stream := cfg.NATSStream
+	if len(stream) == 0 {
+		stream = defaultNATSStream
+	}
+	maxInFlight := cfg.NATSMaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = defaultNATSMaxInFlight
+	}
+
+	conn, err := nats.Connect(cfg.NATSURL, nats.Name("tidb-binlog-drainer"))
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to connect nats %s", cfg.NATSURL)
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, errors.Trace(err)
+	}
+
+	if _, err = js.StreamInfo(stream); err != nil {
+		log.Info("create nats stream", zap.String("stream", stream), zap.NamedError("info error", err))
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     stream,
+			Subjects: []string{"binlog.>"},
+		})
+		if err != nil {
+			conn.Close()
+			return nil, errors.Annotatef(err, "failed to create nats stream %s", stream)
+		}
+	}
+
+	s := &NATSSyncer{
+		conn:       conn,
+		js:         js,
+		inFlight:   make(chan struct{}, maxInFlight),
+		pending:    make(chan *natsPendingAck, maxInFlight),
+		shutdown:   make(chan struct{}),
+		baseSyncer: newBaseSyncer(tableInfoGetter),
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// SetSafeMode should be ignore by NATSSyncer
+func (s *NATSSyncer) SetSafeMode(mode bool) bool {
+	return false
+}
+
+// Sync implements Syncer interface
+func (s *NATSSyncer) Sync(item *Item) error {
+	txn, err := translator.TiBinlogToTxn(s.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue, item.ShouldSkip)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	commitTS := item.Binlog.GetCommitTs()
+	var publishings []natsPublishing
+
+	if txn.DDL != nil {
+		msg := &NATSMessage{
+			CommitTS: commitTS,
+			Schema:   txn.DDL.Database,
+			Table:    txn.DDL.Table,
+			Type:     "ddl",
+			SQL:      txn.DDL.SQL,
+		}
+		subject := fmt.Sprintf("binlog.ddl.%s", natsSubjectToken(txn.DDL.Database))
+		publishings = append(publishings, natsPublishing{subject: subject, msg: msg})
+	}
+
+	for _, dml := range txn.DMLs {
+		msg := &NATSMessage{
+			CommitTS:  commitTS,
+			Schema:    dml.Database,
+			Table:     dml.Table,
+			Type:      natsDMLType(dml.Tp),
+			Values:    dml.Values,
+			OldValues: dml.OldValues,
+		}
+		subject := fmt.Sprintf("binlog.%s.%s.%s", natsSubjectToken(dml.Database), natsSubjectToken(dml.Table), msg.Type)
+		publishings = append(publishings, natsPublishing{subject: subject, msg: msg})
+	}
+
+	if len(publishings) == 0 {
+		return errors.Trace(s.addPending(&natsPendingAck{item: item}))
+	}
+
+	// the acks are waited as the messages are published, so a txn can have more messages than max-in-flight
+	for i, publishing := range publishings {
+		future, err := s.publish(publishing.subject, publishing.msg)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		p := &natsPendingAck{future: future}
+		if i == len(publishings)-1 {
+			p.item = item
+		}
+		if err = s.addPending(p); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *NATSSyncer) addPending(p *natsPendingAck) error {
+	select {
+	case s.pending <- p:
+		return nil
+	case <-s.errCh:
+		return errors.Trace(s.err)
+	}
+}
+
+// natsSubjectToken escapes name to be used as a token of subject.
+func natsSubjectToken(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch ch := name[i]; ch {
+		case '.', '*', '>', '%', ' ', '\t', '\r', '\n', '\v', '\f':
+			fmt.Fprintf(&b, "%%%02X", ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// publish publishes the msg asynchronously, it blocks when the in-flight count exceeds the limit.
+func (s *NATSSyncer) publish(subject string, msg *NATSMessage) (nats.PubAckFuture, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Annotate(err, "json marshal failed")
+	}
+
+	select {
+	case s.inFlight <- struct{}{}:
+	case <-s.errCh:
+		return nil, errors.Trace(s.err)
+	}
+
+	future, err := s.js.PublishAsync(subject, data)
+	if err != nil {
+		<-s.inFlight
+		return nil, errors.Annotatef(err, "failed to publish to %s", subject)
+	}
+
+	return future, nil
+}
+
+// Close implements Syncer interface, it waits the acks of published messages before quit.
+func (s *NATSSyncer) Close() error {
+	close(s.shutdown)
+
+	err := <-s.Error()
+
+	return err
+}
+
+func (s *NATSSyncer) waitAck(p *natsPendingAck) error {
+	if future := p.future; future != nil {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			return errors.Annotatef(err, "failed to publish to %s", future.Msg().Subject)
+		case <-time.After(maxWaitTimeToSendMSG):
+			return errors.Errorf("fail to get ack from nats after %v, check if nats is up and working", maxWaitTimeToSendMSG)
+		}
+		<-s.inFlight
+	}
+
+	if p.item != nil {
+		s.success <- p.item
+	}
+	return nil
+}
+
+func (s *NATSSyncer) run() {
+	defer close(s.success)
+	defer s.conn.Close()
+
+	for {
+		select {
+		case p := <-s.pending:
+			if err := s.waitAck(p); err != nil {
+				log.Error("fail to publish to nats", zap.Error(err))
+				s.setErr(err)
+				return
+			}
+		case <-s.shutdown:
+			for {
+				select {
+				case p := <-s.pending:
+					if err := s.waitAck(p); err != nil {
+						s.setErr(err)
+						return
+					}
+				default:
+					s.setErr(nil)
+					return
+				}
+			}
+		}
+	}
+}
+
+func natsDMLType(tp loader.DMLType) string {
+	switch tp {
+	case loader.InsertDMLType:
+		return "insert"
+	case loader.UpdateDMLType:
+		return "update"
+	case loader.DeleteDMLType:
+		return "delete"
+	}
+	return "unknown"
+}
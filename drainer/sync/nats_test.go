@@ -0,0 +1,185 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+)
+
+var _ = check.Suite(&natsSuite{})
+
+type natsSuite struct {
+	server *server.Server
+}
+
+func (s *natsSuite) SetUpTest(c *check.C) {
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = c.MkDir()
+	s.server = natstest.RunServer(&opts)
+}
+
+func (s *natsSuite) TearDownTest(c *check.C) {
+	s.server.Shutdown()
+}
+
+func (s *natsSuite) TestRequireURL(c *check.C) {
+	_, err := NewNATSSyncer(&DBConfig{}, nil)
+	c.Assert(err, check.ErrorMatches, ".*nats-url.*")
+}
+
+func (s *natsSuite) TestPublish(c *check.C) {
+	conn, err := nats.Connect(s.server.ClientURL())
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("binlog.>")
+	c.Assert(err, check.IsNil)
+
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewNATSSyncer(&DBConfig{NATSURL: s.server.ClientURL(), NATSMaxInFlight: 2}, gen)
+	c.Assert(err, check.IsNil)
+
+	var items []*Item
+	gen.SetDDL()
+	items = append(items, &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(syncer.Sync(items[0]), check.IsNil)
+
+	for _, set := range []func(*check.C){gen.SetInsert, gen.SetUpdate, gen.SetDelete} {
+		set(c)
+		item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+		items = append(items, item)
+		c.Assert(syncer.Sync(item), check.IsNil)
+	}
+
+	for _, item := range items {
+		select {
+		case success := <-syncer.Successes():
+			c.Assert(success, check.Equals, item)
+		case <-time.After(5 * time.Second):
+			c.Fatal("can't get success item from nats syncer")
+		}
+	}
+
+	expected := []struct {
+		subject string
+		tp      string
+	}{
+		{"binlog.ddl.test", "ddl"},
+		{"binlog.test.account.insert", "insert"},
+		{"binlog.test.account.update", "update"},
+		{"binlog.test.account.delete", "delete"},
+	}
+	for _, e := range expected {
+		msg, err := sub.NextMsg(5 * time.Second)
+		c.Assert(err, check.IsNil)
+		c.Assert(msg.Subject, check.Equals, e.subject)
+
+		var m NATSMessage
+		c.Assert(json.Unmarshal(msg.Data, &m), check.IsNil)
+		c.Assert(m.Type, check.Equals, e.tp)
+		c.Assert(m.CommitTS, check.Equals, int64(200))
+		if e.tp == "ddl" {
+			c.Assert(m.SQL, check.Equals, "create table test(id int)")
+		} else {
+			c.Assert(m.Values, check.Not(check.HasLen), 0)
+		}
+		if e.tp == "update" {
+			c.Assert(m.OldValues, check.Not(check.HasLen), 0)
+		}
+	}
+
+	c.Assert(syncer.Close(), check.IsNil)
+}
+
+func (s *natsSuite) TestBlockWhenExceedMaxInFlight(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewNATSSyncer(&DBConfig{NATSURL: s.server.ClientURL(), NATSMaxInFlight: 1}, gen)
+	c.Assert(err, check.IsNil)
+
+	// occupy the only in-flight slot
+	syncer.inFlight <- struct{}{}
+
+	gen.SetDDL()
+	item := &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}
+	done := make(chan error, 1)
+	go func() {
+		done <- syncer.Sync(item)
+	}()
+
+	select {
+	case <-done:
+		c.Fatal("Sync should block when the in-flight count exceeds max-in-flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	<-syncer.inFlight
+	select {
+	case err := <-done:
+		c.Assert(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("Sync should continue after the in-flight message is acknowledged")
+	}
+
+	select {
+	case success := <-syncer.Successes():
+		c.Assert(success, check.Equals, item)
+	case <-time.After(5 * time.Second):
+		c.Fatal("can't get success item from nats syncer")
+	}
+
+	c.Assert(syncer.Close(), check.IsNil)
+}
+
+func (s *natsSuite) TestTxnExceedMaxInFlight(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewNATSSyncer(&DBConfig{NATSURL: s.server.ClientURL(), NATSMaxInFlight: 2}, gen)
+	c.Assert(err, check.IsNil)
+
+	// the txn has 3 DMLs
+	gen.SetAllDML(c)
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	done := make(chan error, 1)
+	go func() {
+		done <- syncer.Sync(item)
+	}()
+
+	select {
+	case err := <-done:
+		c.Assert(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("Sync is blocked by the txn with more DMLs than max-in-flight")
+	}
+	select {
+	case success := <-syncer.Successes():
+		c.Assert(success, check.Equals, item)
+	case <-time.After(5 * time.Second):
+		c.Fatal("can't get success item from nats syncer")
+	}
+	c.Assert(syncer.Close(), check.IsNil)
+}
+
+func (s *natsSuite) TestSubjectToken(c *check.C) {
+	c.Assert(natsSubjectToken("test"), check.Equals, "test")
+	c.Assert(natsSubjectToken("a.b"), check.Equals, "a%2Eb")
+	c.Assert(natsSubjectToken("*> \t%"), check.Equals, "%2A%3E%20%09%25")
+	c.Assert(natsSubjectToken("表"), check.Equals, "表")
+}
@@ -19,7 +19,7 @@ type SyncerDemo struct {
 //Sync is the method that interface must implement
 func (sd *SyncerDemo) Sync(item *Item) error {
 	//demo
-	log.Info("item", zap.String("%s", fmt.Sprintf("%v", item)))
+	log.Info("item", zap.String("%s", fmt.Sprintf("%v", item)), zap.Bool("safe mode", sd.SafeMode()))
 	sd.success <- item
 	return nil
 }
@@ -29,11 +29,6 @@ func (sd *SyncerDemo) Close() error {
 	return nil
 }
 
-//SetSafeMode is the method that interface must implement
-func (sd *SyncerDemo) SetSafeMode(mode bool) bool {
-	return false
-}
-
 //NewSyncerDemo is a syncer demo
 func NewSyncerDemo(
 	cfg *DBConfig,
@@ -0,0 +1,223 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+var (
+	defaultS3UploadThresholdBytes = 64 * 1024 * 1024
+	defaultS3FlushInterval        = time.Minute
+	// the part size used by multipart upload
+	s3PartSize int64 = 16 * 1024 * 1024
+)
+
+var _ Syncer = &S3Syncer{}
+
+// s3Uploader is the subset of manager.Uploader used by S3Syncer.
+type s3Uploader interface {
+	Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
+
+// newS3Uploader will only be changed in unit test for mock
+var newS3Uploader = func(cfg *DBConfig) (s3Uploader, error) {
+	var opts []func(*config.LoadOptions) error
+	if len(cfg.S3Region) > 0 {
+		opts = append(opts, config.WithRegion(cfg.S3Region))
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	uploader := manager.NewUploader(s3.NewFromConfig(awsCfg), func(u *manager.Uploader) {
+		u.PartSize = s3PartSize
+	})
+	return uploader, nil
+}
+
+// S3Syncer archives binlog to Amazon S3 as newline-delimited JSON
+type S3Syncer struct {
+	uploader  s3Uploader
+	bucket    string
+	prefix    string
+	clusterID uint64
+
+	uploadThresholdBytes int
+	flushInterval        time.Duration
+
+	mu            sync.Mutex
+	buf           strings.Builder
+	items         []*Item
+	lastFlushTime time.Time
+
+	shutdown chan struct{}
+	*baseSyncer
+}
+
+// NewS3Syncer returns a instance of S3Syncer
+func NewS3Syncer(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*S3Syncer, error) {
+	if len(cfg.S3Bucket) == 0 {
+		return nil, errors.New("s3-bucket must be set when syncing to s3")
+	}
+
+	uploader, err := newS3Uploader(cfg)
+	if err != nil {
+		return nil, errors.Annotate(err, "failed to create s3 uploader")
+	}
+
+	s := &S3Syncer{
+		uploader:             uploader,
+		bucket:               cfg.S3Bucket,
+		prefix:               cfg.S3Prefix,
+		clusterID:            cfg.ClusterID,
+		uploadThresholdBytes: defaultS3UploadThresholdBytes,
+		flushInterval:        defaultS3FlushInterval,
+		lastFlushTime:        time.Now(),
+		shutdown:             make(chan struct{}),
+		baseSyncer:           newBaseSyncer(tableInfoGetter),
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// SetSafeMode should be ignore by S3Syncer
+func (s *S3Syncer) SetSafeMode(mode bool) bool {
+	return false
+}
+
+// Sync implements Syncer interface
+func (s *S3Syncer) Sync(item *Item) error {
+	select {
+	case <-s.errCh:
+		return s.err
+	default:
+	}
+
+	txn, err := translator.TiBinlogToTxn(s.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue, item.ShouldSkip)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	data, err := json.Marshal(txn)
+	if err != nil {
+		return errors.Annotate(err, "json marshal failed")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Write(data)
+	s.buf.WriteByte('\n')
+	s.items = append(s.items, item)
+
+	if s.buf.Len() >= s.uploadThresholdBytes {
+		return errors.Trace(s.flush())
+	}
+
+	return nil
+}
+
+// Close implements Syncer interface, the remaining buffer will be uploaded before quit
+func (s *S3Syncer) Close() error {
+	close(s.shutdown)
+
+	err := <-s.Error()
+
+	return err
+}
+
+// objectKey returns the key of the object as {prefix}/{date}/{clusterID}/{commitTS}.ndjson
+func (s *S3Syncer) objectKey(commitTS int64) string {
+	date := oracle.GetTimeFromTS(uint64(commitTS)).UTC().Format("2006-01-02")
+	return path.Join(s.prefix, date, fmt.Sprintf("%d", s.clusterID), fmt.Sprintf("%d.ndjson", commitTS))
+}
+
+// flush uploads the buffered txns and marks them success, must hold the lock.
+func (s *S3Syncer) flush() error {
+	s.lastFlushTime = time.Now()
+	if len(s.items) == 0 {
+		return nil
+	}
+
+	key := s.objectKey(s.items[len(s.items)-1].Binlog.GetCommitTs())
+	_, err := s.uploader.Upload(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader(s.buf.String()),
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to upload %s to s3 bucket %s", key, s.bucket)
+	}
+
+	log.Debug("upload binlog to s3", zap.String("key", key), zap.Int("size", s.buf.Len()), zap.Int("txns", len(s.items)))
+
+	for _, item := range s.items {
+		s.success <- item
+	}
+	s.items = s.items[:0]
+	s.buf.Reset()
+
+	return nil
+}
+
+func (s *S3Syncer) run() {
+	defer close(s.success)
+
+	ticker := time.NewTicker(s.flushInterval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			var err error
+			if time.Since(s.lastFlushTime) >= s.flushInterval {
+				err = s.flush()
+			}
+			s.mu.Unlock()
+			if err != nil {
+				log.Error("fail to upload binlog to s3", zap.Error(err))
+				s.setErr(err)
+				return
+			}
+		case <-s.shutdown:
+			s.mu.Lock()
+			err := s.flush()
+			s.mu.Unlock()
+			s.setErr(err)
+			return
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+var _ = check.Suite(&s3Suite{})
+
+type s3Suite struct{}
+
+type mockS3Uploader struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	bucket  string
+	err     error
+}
+
+func (m *mockS3Uploader) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bucket = *input.Bucket
+	m.objects[*input.Key] = data
+	return &manager.UploadOutput{}, nil
+}
+
+func (m *mockS3Uploader) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for k := range m.objects {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *s3Suite) newSyncer(c *check.C, uploader *mockS3Uploader, infoGetter translator.TableInfoGetter) *S3Syncer {
+	oldNewS3Uploader := newS3Uploader
+	newS3Uploader = func(*DBConfig) (s3Uploader, error) {
+		return uploader, nil
+	}
+	defer func() {
+		newS3Uploader = oldNewS3Uploader
+	}()
+
+	cfg := &DBConfig{S3Bucket: "archive", S3Prefix: "binlog", ClusterID: 42}
+	syncer, err := NewS3Syncer(cfg, infoGetter)
+	c.Assert(err, check.IsNil)
+	return syncer
+}
+
+func (s *s3Suite) TestRequireBucket(c *check.C) {
+	_, err := NewS3Syncer(&DBConfig{}, nil)
+	c.Assert(err, check.ErrorMatches, ".*s3-bucket.*")
+}
+
+func (s *s3Suite) TestObjectKey(c *check.C) {
+	syncer := &S3Syncer{prefix: "binlog", clusterID: 42}
+	// physical time 2020-04-01 00:00:00 UTC
+	ts := int64(1585699200000) << 18
+	c.Assert(syncer.objectKey(ts), check.Equals, "binlog/2020-04-01/42/415681531084800000.ndjson")
+}
+
+func (s *s3Suite) TestUploadOnClose(c *check.C) {
+	uploader := &mockS3Uploader{objects: make(map[string][]byte)}
+	gen := &translator.BinlogGenerator{}
+	syncer := s.newSyncer(c, uploader, gen)
+
+	gen.SetInsert(c)
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	err := syncer.Sync(item)
+	c.Assert(err, check.IsNil)
+
+	gen.SetDDL()
+	ddlItem := &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}
+	err = syncer.Sync(ddlItem)
+	c.Assert(err, check.IsNil)
+
+	// nothing is uploaded before reaching threshold or flush interval
+	c.Assert(uploader.keys(), check.HasLen, 0)
+
+	var successes []*Item
+	done := make(chan struct{})
+	go func() {
+		for item := range syncer.Successes() {
+			successes = append(successes, item)
+		}
+		close(done)
+	}()
+
+	err = syncer.Close()
+	c.Assert(err, check.IsNil)
+	<-done
+
+	c.Assert(successes, check.DeepEquals, []*Item{item, ddlItem})
+	c.Assert(uploader.bucket, check.Equals, "archive")
+	keys := uploader.keys()
+	c.Assert(keys, check.HasLen, 1)
+	c.Assert(keys[0], check.Matches, `binlog/\d{4}-\d{2}-\d{2}/42/200\.ndjson`)
+
+	scanner := bufio.NewScanner(strings.NewReader(string(uploader.objects[keys[0]])))
+	var txns []*loader.Txn
+	for scanner.Scan() {
+		txn := new(loader.Txn)
+		c.Assert(json.Unmarshal(scanner.Bytes(), txn), check.IsNil)
+		txns = append(txns, txn)
+	}
+	c.Assert(txns, check.HasLen, 2)
+	c.Assert(txns[0].DMLs, check.HasLen, 1)
+	c.Assert(txns[0].DMLs[0].Tp, check.Equals, loader.InsertDMLType)
+	c.Assert(txns[1].DDL.SQL, check.Equals, "create table test(id int)")
+}
+
+func (s *s3Suite) TestUploadByThreshold(c *check.C) {
+	oldThreshold := defaultS3UploadThresholdBytes
+	defaultS3UploadThresholdBytes = 1
+	defer func() {
+		defaultS3UploadThresholdBytes = oldThreshold
+	}()
+
+	uploader := &mockS3Uploader{objects: make(map[string][]byte)}
+	gen := &translator.BinlogGenerator{}
+	syncer := s.newSyncer(c, uploader, gen)
+
+	gen.SetDDL()
+	err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	c.Assert(uploader.keys(), check.HasLen, 1)
+
+	select {
+	case <-syncer.Successes():
+	case <-time.After(time.Second):
+		c.Fatal("can't get success item after uploading")
+	}
+
+	err = syncer.Close()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *s3Suite) TestUploadByInterval(c *check.C) {
+	oldInterval := defaultS3FlushInterval
+	defaultS3FlushInterval = 20 * time.Millisecond
+	defer func() {
+		defaultS3FlushInterval = oldInterval
+	}()
+
+	uploader := &mockS3Uploader{objects: make(map[string][]byte)}
+	gen := &translator.BinlogGenerator{}
+	syncer := s.newSyncer(c, uploader, gen)
+
+	gen.SetDDL()
+	err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+
+	select {
+	case <-syncer.Successes():
+	case <-time.After(time.Second):
+		c.Fatal("can't get success item after flush interval")
+	}
+	c.Assert(uploader.keys(), check.HasLen, 1)
+
+	err = syncer.Close()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *s3Suite) TestUploadFail(c *check.C) {
+	uploader := &mockS3Uploader{objects: make(map[string][]byte), err: errors.New("access denied")}
+	gen := &translator.BinlogGenerator{}
+	syncer := s.newSyncer(c, uploader, gen)
+
+	gen.SetDDL()
+	err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+
+	err = syncer.Close()
+	c.Assert(err, check.ErrorMatches, ".*access denied.*")
+}
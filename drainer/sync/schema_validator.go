@@ -0,0 +1,174 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"go.uber.org/zap"
+)
+
+const defaultSchemaValidationTimeout = 30 * time.Second
+
+// the interval to query the downstream schema when it doesn't match the upstream one
+var schemaValidationInterval = 100 * time.Millisecond
+
+// SchemaSyncValidator wraps a Syncer to make sure the DDL of a table is applied at downstream
+// before the DMLs of the table, in case the DMLs need the columns added by the DDL.
+// After a DDL is synced, the DMLs of the table are blocked until all the columns of the
+// upstream table are found in INFORMATION_SCHEMA.COLUMNS of downstream.
+type SchemaSyncValidator struct {
+	Syncer
+
+	db         *sql.DB
+	infoGetter translator.TableInfoGetter
+	timeout    time.Duration
+
+	mu sync.Mutex
+	// the tables whose DDL is synced but not validated yet, keyed by tableKey
+	pending map[string]struct{}
+}
+
+// A SchemaSyncValidatorOption sets options of SchemaSyncValidator.
+type SchemaSyncValidatorOption func(*SchemaSyncValidator)
+
+// WithSchemaValidationTimeout sets the max time to wait for the downstream schema to match
+// the upstream one, Sync returns an error if it's not matched in time.
+func WithSchemaValidationTimeout(timeout time.Duration) SchemaSyncValidatorOption {
+	return func(v *SchemaSyncValidator) {
+		v.timeout = timeout
+	}
+}
+
+// NewSchemaSyncValidator returns a SchemaSyncValidator wrapping syncer, db is used to query
+// the downstream schema.
+func NewSchemaSyncValidator(syncer Syncer, db *sql.DB, infoGetter translator.TableInfoGetter, opts ...SchemaSyncValidatorOption) *SchemaSyncValidator {
+	v := &SchemaSyncValidator{
+		Syncer:     syncer,
+		db:         db,
+		infoGetter: infoGetter,
+		timeout:    defaultSchemaValidationTimeout,
+		pending:    make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Sync implements Syncer interface
+func (v *SchemaSyncValidator) Sync(item *Item) error {
+	if item.Binlog.DdlJobId > 0 {
+		if !item.ShouldSkip && len(item.Table) > 0 {
+			v.mu.Lock()
+			v.pending[tableKey(item.Schema, item.Table)] = struct{}{}
+			v.mu.Unlock()
+		}
+		return v.Syncer.Sync(item)
+	}
+
+	if item.PrewriteValue != nil {
+		for _, mutation := range item.PrewriteValue.GetMutations() {
+			if err := v.validate(mutation.GetTableId()); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return v.Syncer.Sync(item)
+}
+
+// validate waits until the downstream schema of the table matches the upstream one
+// if there's a DDL of the table not validated yet.
+func (v *SchemaSyncValidator) validate(tableID int64) error {
+	schema, table, ok := v.infoGetter.SchemaAndTableName(tableID)
+	if !ok {
+		return nil
+	}
+	key := tableKey(schema, table)
+	v.mu.Lock()
+	_, ok = v.pending[key]
+	v.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	info, ok := v.infoGetter.TableByID(tableID)
+	if !ok {
+		return nil
+	}
+
+	start := time.Now()
+	deadline := start.Add(v.timeout)
+	for {
+		missing, err := v.missingColumns(schema, table, info)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if len(missing) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("schema of `%s`.`%s` is not synced in %s, missing columns: %v", schema, table, v.timeout, missing)
+		}
+		time.Sleep(schemaValidationInterval)
+	}
+
+	v.mu.Lock()
+	delete(v.pending, key)
+	v.mu.Unlock()
+	log.Debug("schema validated", zap.String("schema", schema), zap.String("table", table), zap.Duration("take", time.Since(start)))
+	return nil
+}
+
+// missingColumns returns the writable columns of info not found at downstream.
+func (v *SchemaSyncValidator) missingColumns(schema, table string, info *model.TableInfo) ([]string, error) {
+	rows, err := v.db.Query("SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", schema, table)
+	if err != nil {
+		return nil, errors.Annotatef(err, "query columns of `%s`.`%s`", schema, table)
+	}
+	defer rows.Close()
+
+	downstream := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errors.Trace(err)
+		}
+		downstream[strings.ToLower(name)] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var missing []string
+	for _, col := range info.Columns {
+		if col.State != model.StatePublic || col.IsGenerated() {
+			continue
+		}
+		if _, ok := downstream[col.Name.L]; !ok {
+			missing = append(missing, col.Name.O)
+		}
+	}
+	return missing, nil
+}
+
+func tableKey(schema, table string) string {
+	return strings.ToLower(schema) + "." + strings.ToLower(table)
+}
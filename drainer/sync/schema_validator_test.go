@@ -0,0 +1,132 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+)
+
+var _ = check.Suite(&schemaValidatorSuite{})
+
+type schemaValidatorSuite struct{}
+
+type recordingSyncer struct {
+	Syncer
+	synced []*Item
+}
+
+func (s *recordingSyncer) Sync(item *Item) error {
+	s.synced = append(s.synced, item)
+	return nil
+}
+
+// genItems returns a DDL item of `test`.`account` and an insert item of it.
+func (s *schemaValidatorSuite) genItems(c *check.C) (*translator.BinlogGenerator, *Item, *Item) {
+	gen := &translator.BinlogGenerator{}
+	gen.SetDDL()
+	ddl := &Item{
+		Binlog: gen.TiBinlog,
+		Schema: "test",
+		Table:  "account",
+	}
+	ddl.Binlog.DdlQuery = []byte("alter table account add column sex enum('male', 'female')")
+
+	gen.SetInsert(c)
+	dml := &Item{
+		Binlog:        gen.TiBinlog,
+		PrewriteValue: gen.PV,
+		Schema:        gen.Schema,
+		Table:         gen.Table,
+	}
+	return gen, ddl, dml
+}
+
+func (s *schemaValidatorSuite) expectColumns(mock sqlmock.Sqlmock, columns ...string) {
+	rows := sqlmock.NewRows([]string{"COLUMN_NAME"})
+	for _, col := range columns {
+		rows.AddRow(col)
+	}
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS.*").
+		WithArgs("test", "account").WillReturnRows(rows)
+}
+
+func (s *schemaValidatorSuite) TestWaitForColumn(c *check.C) {
+	origInterval := schemaValidationInterval
+	schemaValidationInterval = time.Millisecond
+	defer func() { schemaValidationInterval = origInterval }()
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	s.expectColumns(mock, "id", "name")
+	s.expectColumns(mock, "id", "name", "sex")
+
+	gen, ddl, dml := s.genItems(c)
+	inner := &recordingSyncer{}
+	validator := NewSchemaSyncValidator(inner, db, gen)
+
+	c.Assert(validator.Sync(ddl), check.IsNil)
+	c.Assert(validator.Sync(dml), check.IsNil)
+	c.Assert(inner.synced, check.DeepEquals, []*Item{ddl, dml})
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// no more validation until the next DDL
+	c.Assert(validator.Sync(dml), check.IsNil)
+	c.Assert(inner.synced, check.HasLen, 3)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *schemaValidatorSuite) TestTimeout(c *check.C) {
+	origInterval := schemaValidationInterval
+	schemaValidationInterval = time.Millisecond
+	defer func() { schemaValidationInterval = origInterval }()
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 100; i++ {
+		s.expectColumns(mock, "id", "name")
+	}
+
+	gen, ddl, dml := s.genItems(c)
+	inner := &recordingSyncer{}
+	validator := NewSchemaSyncValidator(inner, db, gen, WithSchemaValidationTimeout(10*time.Millisecond))
+
+	c.Assert(validator.Sync(ddl), check.IsNil)
+	err = validator.Sync(dml)
+	c.Assert(err, check.ErrorMatches, ".*schema of `test`.`account` is not synced.*missing columns: \\[SEX\\].*")
+	c.Assert(inner.synced, check.DeepEquals, []*Item{ddl})
+}
+
+func (s *schemaValidatorSuite) TestNoDDL(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	gen, ddl, dml := s.genItems(c)
+	inner := &recordingSyncer{}
+	validator := NewSchemaSyncValidator(inner, db, gen)
+
+	// the skipped DDL is not applied at downstream, so nothing to validate
+	ddl.ShouldSkip = true
+	c.Assert(validator.Sync(ddl), check.IsNil)
+	c.Assert(validator.Sync(dml), check.IsNil)
+	c.Assert(inner.synced, check.DeepEquals, []*Item{ddl, dml})
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
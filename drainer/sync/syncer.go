@@ -14,19 +14,30 @@
 package sync
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
 
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/relay"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	pb "github.com/pingcap/tipb/go-binlog"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// TracerName is the name of the OpenTelemetry tracer starting the spans of drainer.
+const TracerName = "github.com/pingcap/tidb-binlog/drainer"
+
+// ErrNotSupported is returned by the Syncer doesn't support the operation.
+var ErrNotSupported = errors.New("not supported by the syncer")
+
 // Item contains information about binlog
 type Item struct {
 	Binlog        *pb.Binlog
 	PrewriteValue *pb.PrewriteValue // only for DML
 	Schema        string
 	Table         string
-	RelayLogPos   pb.Pos
+	RelayLogPos   relay.BinlogPosition
 
 	// the applied TS executed in downstream, only for tidb
 	AppliedTS int64
@@ -34,6 +45,12 @@ type Item struct {
 	// currently only used for signal the syncer to learn that the downstream schema is changed
 	// when we don't replicate DDL.
 	ShouldSkip bool
+
+	// the trace context of the binlog started by drainer, not propagated from pump, the syncers start
+	// the spans of writing it to downstream as the children of it if it's valid.
+	SpanContext trace.SpanContext
+	// the span of writing the item to downstream, only used by MysqlSyncer
+	writeSpan trace.Span
 }
 
 func (i *Item) String() string {
@@ -53,12 +70,22 @@ type Syncer interface {
 	Close() error
 	// SetSafeMode make the Syncer to use safe mode or not. If no need to handle, it should return false
 	SetSafeMode(mode bool) bool
+	// Pause makes the Syncer stop replicating new items to downstream until Resume is called,
+	// `Sync` blocks when paused. It returns ErrNotSupported if the Syncer can't be paused.
+	Pause() error
+	// Resume continues the replication paused by Pause.
+	Resume() error
+	// FlushCheckpoint blocks until all the items passed to Sync are sent to Successes, so the caller
+	// can save the checkpoint of them. It returns ErrNotSupported if the Syncer can't be flushed.
+	FlushCheckpoint(ctx context.Context) error
 }
 
 type baseSyncer struct {
 	*baseError
 	success         chan *Item
 	tableInfoGetter translator.TableInfoGetter
+	// only used by the syncers don't implement SetSafeMode themselves, like plugins
+	safeMode int32
 }
 
 func newBaseSyncer(tableInfoGetter translator.TableInfoGetter) *baseSyncer {
@@ -76,5 +103,35 @@ func (s *baseSyncer) Successes() <-chan *Item {
 
 // Error implements Syncer interface
 func (s *baseSyncer) Error() <-chan error {
-	return s.error()
+	return s.ErrorContext(context.Background())
+}
+
+// Pause implements Syncer interface
+func (s *baseSyncer) Pause() error {
+	return ErrNotSupported
+}
+
+// Resume implements Syncer interface
+func (s *baseSyncer) Resume() error {
+	return ErrNotSupported
+}
+
+// FlushCheckpoint implements Syncer interface
+func (s *baseSyncer) FlushCheckpoint(ctx context.Context) error {
+	return ErrNotSupported
+}
+
+// SetSafeMode implements Syncer interface, the syncers embedding baseSyncer can check it by SafeMode.
+func (s *baseSyncer) SetSafeMode(mode bool) bool {
+	var v int32
+	if mode {
+		v = 1
+	}
+	atomic.SwapInt32(&s.safeMode, v)
+	return true
+}
+
+// SafeMode returns whether the syncer is in safe mode.
+func (s *baseSyncer) SafeMode() bool {
+	return atomic.LoadInt32(&s.safeMode) != 0
 }
@@ -13,6 +13,7 @@
 package sync
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"reflect"
@@ -24,6 +25,7 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/Shopify/sarama/mocks"
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 )
 
@@ -156,3 +158,42 @@ func closeSyncers(c *check.C, syncers []Syncer) {
 		c.Logf("close %T success", syncer)
 	}
 }
+
+type syncerDemoSuite struct{}
+
+var _ = check.Suite(&syncerDemoSuite{})
+
+func (s *syncerDemoSuite) TestSetSafeMode(c *check.C) {
+	syncer, err := NewSyncerDemo(nil, "", nil, 1, 1, nil, nil, "", nil, nil, false, false)
+	c.Assert(err, check.IsNil)
+	demo := syncer.(*SyncerDemo)
+	c.Assert(demo.SafeMode(), check.IsFalse)
+
+	// handled by the embedded baseSyncer
+	c.Assert(syncer.SetSafeMode(true), check.IsTrue)
+	c.Assert(demo.SafeMode(), check.IsTrue)
+	c.Assert(syncer.SetSafeMode(false), check.IsTrue)
+	c.Assert(demo.SafeMode(), check.IsFalse)
+}
+
+type baseErrorSuite struct{}
+
+var _ = check.Suite(&baseErrorSuite{})
+
+func (s *baseErrorSuite) TestErrorContext(c *check.C) {
+	b := newBaseError()
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := b.ErrorContext(ctx)
+	cancel()
+	c.Assert(<-errCh, check.Equals, context.Canceled)
+
+	// the error set later is still received by the other channels
+	errCh = b.ErrorContext(context.Background())
+	b.setErr(errors.New("sync failed"))
+	c.Assert(<-errCh, check.ErrorMatches, "sync failed")
+
+	// the error is received even if ctx is done after setErr
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Assert(<-b.ErrorContext(ctx), check.ErrorMatches, "sync failed")
+}
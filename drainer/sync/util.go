@@ -14,6 +14,7 @@
 package sync
 
 import (
+	"context"
 	"crypto/tls"
 
 	// mysql driver
@@ -44,6 +45,18 @@ type DBConfig struct {
 	KafkaMaxMessages int    `toml:"kafka-max-messages" json:"kafka-max-messages"`
 	KafkaClientID    string `toml:"kafka-client-id" json:"kafka-client-id"`
 	TopicName        string `toml:"topic-name" json:"topic-name"`
+
+	S3Bucket string `toml:"s3-bucket" json:"s3-bucket"`
+	S3Prefix string `toml:"s3-prefix" json:"s3-prefix"`
+	S3Region string `toml:"s3-region" json:"s3-region"`
+
+	NATSURL         string `toml:"nats-url" json:"nats-url"`
+	NATSStream      string `toml:"nats-stream" json:"nats-stream"`
+	NATSMaxInFlight int    `toml:"nats-max-in-flight" json:"nats-max-in-flight"`
+
+	WebhookURL string `toml:"webhook-url" json:"webhook-url"`
+	// the secret to sign the requests by HMAC-SHA256, no signature if it's empty.
+	WebhookSecret string `toml:"webhook-secret" json:"webhook-secret"`
 	// get it from pd
 	ClusterID uint64 `toml:"-" json:"-"`
 }
@@ -60,6 +73,8 @@ type CheckpointConfig struct {
 	Port              int             `toml:"port" json:"port"`
 	Security          security.Config `toml:"security" json:"security"`
 	TLS               *tls.Config     `toml:"-" json:"-"`
+	// keep the history of the DDLs applied to downstream, only for the mysql and tidb types
+	DDLHistory bool `toml:"ddl-history" json:"ddl-history"`
 }
 
 type baseError struct {
@@ -73,11 +88,16 @@ func newBaseError() *baseError {
 	}
 }
 
-func (b *baseError) error() <-chan error {
+// ErrorContext returns a channel receiving the error set by setErr, or ctx.Err() if ctx is done first.
+func (b *baseError) ErrorContext(ctx context.Context) <-chan error {
 	ret := make(chan error, 1)
 	go func() {
-		<-b.errCh
-		ret <- b.err
+		select {
+		case <-b.errCh:
+			ret <- b.err
+		case <-ctx.Done():
+			ret <- ctx.Err()
+		}
 	}()
 
 	return ret
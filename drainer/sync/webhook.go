@@ -0,0 +1,275 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"go.uber.org/zap"
+)
+
+// WebhookSignatureHeader is the header of the HMAC-SHA256 signature of the request body,
+// the value is like `sha256={hex digest}`. It's only set when the webhook-secret is configured.
+const WebhookSignatureHeader = "X-Binlog-Signature"
+
+var (
+	defaultWebhookFlushInterval = time.Second
+	webhookMaxRetries           = 5
+	// the wait time before the first retry, it's doubled for every retry
+	webhookRetryInterval = time.Second
+	webhookTimeout       = 30 * time.Second
+)
+
+var _ Syncer = &WebhookSyncer{}
+
+// WebhookSyncer POSTs binlog to an HTTP endpoint, every request carries a JSON array of txns.
+type WebhookSyncer struct {
+	client    *http.Client
+	url       string
+	secret    []byte
+	batchSize int
+
+	flushInterval time.Duration
+
+	// protects the buffered txns, it's never held during the POST
+	mu            sync.Mutex
+	txns          []*loader.Txn
+	items         []*Item
+	lastFlushTime time.Time
+
+	// serializes the flushes so the items are reported in order, the first error of them is kept
+	// and returned by the following ones, so no txn is posted after the failed ones.
+	flushMu  sync.Mutex
+	flushErr error
+
+	// canceled by Close to interrupt the POST and the wait before retrying
+	ctx      context.Context
+	cancel   context.CancelFunc
+	shutdown chan struct{}
+	*baseSyncer
+}
+
+// NewWebhookSyncer returns a instance of WebhookSyncer, at most batchSize txns are sent in one request.
+func NewWebhookSyncer(cfg *DBConfig, batchSize int, tableInfoGetter translator.TableInfoGetter) (*WebhookSyncer, error) {
+	if len(cfg.WebhookURL) == 0 {
+		return nil, errors.New("webhook-url must be set when syncing to webhook")
+	}
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &WebhookSyncer{
+		client:        &http.Client{Timeout: webhookTimeout},
+		url:           cfg.WebhookURL,
+		secret:        []byte(cfg.WebhookSecret),
+		batchSize:     batchSize,
+		flushInterval: defaultWebhookFlushInterval,
+		lastFlushTime: time.Now(),
+		ctx:           ctx,
+		cancel:        cancel,
+		shutdown:      make(chan struct{}),
+		baseSyncer:    newBaseSyncer(tableInfoGetter),
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// SetSafeMode should be ignore by WebhookSyncer
+func (s *WebhookSyncer) SetSafeMode(mode bool) bool {
+	return false
+}
+
+// Sync implements Syncer interface
+func (s *WebhookSyncer) Sync(item *Item) error {
+	select {
+	case <-s.errCh:
+		return s.err
+	default:
+	}
+
+	txn, err := translator.TiBinlogToTxn(s.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue, item.ShouldSkip)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	s.mu.Lock()
+	s.txns = append(s.txns, txn)
+	s.items = append(s.items, item)
+	full := len(s.txns) >= s.batchSize
+	s.mu.Unlock()
+
+	if full {
+		return errors.Trace(s.flush(s.ctx, webhookMaxRetries))
+	}
+
+	return nil
+}
+
+// Close implements Syncer interface, the POST in progress is interrupted, and the buffered txns
+// are sent without retry before quit.
+func (s *WebhookSyncer) Close() error {
+	s.cancel()
+	close(s.shutdown)
+
+	err := <-s.Error()
+
+	return err
+}
+
+// sign returns the HMAC-SHA256 signature of body.
+func (s *WebhookSyncer) sign(body []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post sends body to the webhook, it retries at most maxRetries times with exponential backoff on network
+// errors and 5xx responses. It stops when ctx is done.
+func (s *WebhookSyncer) post(ctx context.Context, body []byte, maxRetries int) error {
+	var err error
+	interval := webhookRetryInterval
+	for i := 0; i <= maxRetries; i++ {
+		if i > 0 {
+			log.Warn("retry to post binlog to webhook", zap.Int("retry", i), zap.Duration("interval", interval), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return errors.Annotatef(ctx.Err(), "stop retrying to post binlog to webhook, last error: %v", err)
+			case <-time.After(interval):
+			}
+			interval *= 2
+		}
+
+		var retryable bool
+		if retryable, err = s.postOnce(ctx, body); err == nil || !retryable {
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Annotatef(err, "failed to post binlog to webhook after %d retries", maxRetries)
+}
+
+func (s *WebhookSyncer) postOnce(ctx context.Context, body []byte) (retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, strings.NewReader(string(body)))
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, s.sign(body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, errors.Trace(err)
+	}
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500:
+		return true, errors.Errorf("webhook responds %s", resp.Status)
+	default:
+		return false, errors.Errorf("webhook responds %s", resp.Status)
+	}
+}
+
+// flush takes the buffered txns, sends them by post and marks them success.
+func (s *WebhookSyncer) flush(ctx context.Context, maxRetries int) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	if s.flushErr != nil {
+		return s.flushErr
+	}
+
+	s.mu.Lock()
+	txns, items := s.txns, s.items
+	s.txns, s.items = nil, nil
+	s.lastFlushTime = time.Now()
+	s.mu.Unlock()
+
+	if len(txns) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(txns)
+	if err != nil {
+		s.flushErr = errors.Annotate(err, "json marshal failed")
+		return s.flushErr
+	}
+
+	if err = s.post(ctx, body, maxRetries); err != nil {
+		s.flushErr = errors.Trace(err)
+		return s.flushErr
+	}
+
+	log.Debug("post binlog to webhook", zap.Int("size", len(body)), zap.Int("txns", len(txns)))
+
+	for _, item := range items {
+		s.success <- item
+	}
+
+	return nil
+}
+
+func (s *WebhookSyncer) run() {
+	defer close(s.success)
+
+	ticker := time.NewTicker(s.flushInterval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			due := time.Since(s.lastFlushTime) >= s.flushInterval
+			s.mu.Unlock()
+			var err error
+			// the buffered txns are left to the flush on shutdown once Close is called
+			if due && s.ctx.Err() == nil {
+				err = s.flush(s.ctx, webhookMaxRetries)
+			}
+			if err != nil {
+				log.Error("fail to post binlog to webhook", zap.Error(err))
+				s.setErr(err)
+				return
+			}
+		case <-s.shutdown:
+			// s.ctx is canceled, the POST is only bounded by the timeout of client
+			err := s.flush(context.Background(), 0)
+			s.setErr(err)
+			return
+		}
+	}
+}
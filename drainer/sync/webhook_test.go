@@ -0,0 +1,279 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+var _ = check.Suite(&webhookSuite{})
+
+type webhookSuite struct {
+	origRetryInterval time.Duration
+}
+
+func (s *webhookSuite) SetUpTest(c *check.C) {
+	s.origRetryInterval = webhookRetryInterval
+	webhookRetryInterval = 10 * time.Millisecond
+}
+
+func (s *webhookSuite) TearDownTest(c *check.C) {
+	webhookRetryInterval = s.origRetryInterval
+}
+
+func (s *webhookSuite) syncItems(c *check.C, syncer Syncer, gen *translator.BinlogGenerator) {
+	for _, set := range []func(*check.C){gen.SetInsert, gen.SetUpdate, gen.SetDelete} {
+		set(c)
+		item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+		c.Assert(syncer.Sync(item), check.IsNil)
+
+		select {
+		case success := <-syncer.Successes():
+			c.Assert(success, check.Equals, item)
+		case <-time.After(5 * time.Second):
+			c.Fatal("can't get success item from webhook syncer")
+		}
+	}
+}
+
+func (s *webhookSuite) TestRequireURL(c *check.C) {
+	_, err := NewWebhookSyncer(&DBConfig{}, 1, nil)
+	c.Assert(err, check.ErrorMatches, ".*webhook-url.*")
+}
+
+func (s *webhookSuite) TestPost(c *check.C) {
+	var txns []*loader.Txn
+	bodies := make(chan []byte, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, http.MethodPost)
+		c.Check(r.Header.Get(WebhookSignatureHeader), check.Equals, "")
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, check.IsNil)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewWebhookSyncer(&DBConfig{WebhookURL: server.URL}, 1, gen)
+	c.Assert(err, check.IsNil)
+
+	s.syncItems(c, syncer, gen)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	close(bodies)
+	for body := range bodies {
+		var batch []*loader.Txn
+		c.Assert(json.Unmarshal(body, &batch), check.IsNil)
+		c.Assert(batch, check.HasLen, 1)
+		txns = append(txns, batch...)
+	}
+	c.Assert(txns, check.HasLen, 3)
+	c.Assert(txns[0].DMLs[0].Tp, check.Equals, loader.InsertDMLType)
+	c.Assert(txns[1].DMLs[0].Tp, check.Equals, loader.UpdateDMLType)
+	c.Assert(txns[2].DMLs[0].Tp, check.Equals, loader.DeleteDMLType)
+	c.Assert(txns[0].DMLs[0].Values, check.Not(check.HasLen), 0)
+}
+
+func (s *webhookSuite) TestBatch(c *check.C) {
+	sizes := make(chan int, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []*loader.Txn
+		c.Check(json.NewDecoder(r.Body).Decode(&batch), check.IsNil)
+		sizes <- len(batch)
+	}))
+	defer server.Close()
+
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewWebhookSyncer(&DBConfig{WebhookURL: server.URL}, 2, gen)
+	c.Assert(err, check.IsNil)
+
+	for _, set := range []func(*check.C){gen.SetInsert, gen.SetUpdate} {
+		set(c)
+		item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+		c.Assert(syncer.Sync(item), check.IsNil)
+	}
+	for i := 0; i < 2; i++ {
+		<-syncer.Successes()
+	}
+	c.Assert(syncer.Close(), check.IsNil)
+	close(sizes)
+	c.Assert(<-sizes, check.Equals, 2)
+	_, ok := <-sizes
+	c.Assert(ok, check.IsFalse)
+}
+
+func (s *webhookSuite) TestRetryOn500(c *check.C) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewWebhookSyncer(&DBConfig{WebhookURL: server.URL}, 1, gen)
+	c.Assert(err, check.IsNil)
+
+	gen.SetInsert(c)
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(item), check.IsNil)
+	c.Assert(<-syncer.Successes(), check.Equals, item)
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(3))
+	c.Assert(syncer.Close(), check.IsNil)
+}
+
+func (s *webhookSuite) TestNoRetryOn400(c *check.C) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewWebhookSyncer(&DBConfig{WebhookURL: server.URL}, 1, gen)
+	c.Assert(err, check.IsNil)
+
+	gen.SetInsert(c)
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(item), check.ErrorMatches, ".*400 Bad Request.*")
+	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
+	// the failed txn is never posted again
+	c.Assert(syncer.Close(), check.ErrorMatches, ".*400 Bad Request.*")
+}
+
+func (s *webhookSuite) TestSignature(c *check.C) {
+	secret := "s3cr3t"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, check.IsNil)
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(r.Header.Get(WebhookSignatureHeader)), []byte(expected)) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewWebhookSyncer(&DBConfig{WebhookURL: server.URL, WebhookSecret: secret}, 1, gen)
+	c.Assert(err, check.IsNil)
+	s.syncItems(c, syncer, gen)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	syncer, err = NewWebhookSyncer(&DBConfig{WebhookURL: server.URL, WebhookSecret: "wrong"}, 1, gen)
+	c.Assert(err, check.IsNil)
+	gen.SetInsert(c)
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(item), check.ErrorMatches, ".*401 Unauthorized.*")
+	c.Assert(syncer.Close(), check.ErrorMatches, ".*401 Unauthorized.*")
+}
+
+func (s *webhookSuite) TestCloseInterruptsRetry(c *check.C) {
+	webhookRetryInterval = time.Hour
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewWebhookSyncer(&DBConfig{WebhookURL: server.URL}, 1, gen)
+	c.Assert(err, check.IsNil)
+
+	gen.SetInsert(c)
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	syncErr := make(chan error, 1)
+	go func() {
+		syncErr <- syncer.Sync(item)
+	}()
+	for start := time.Now(); atomic.LoadInt32(&requests) == 0; time.Sleep(time.Millisecond) {
+		c.Assert(time.Since(start) < time.Second, check.IsTrue)
+	}
+
+	closeErr := make(chan error, 1)
+	go func() {
+		closeErr <- syncer.Close()
+	}()
+	select {
+	case err := <-closeErr:
+		c.Assert(err, check.ErrorMatches, ".*context canceled.*")
+	case <-time.After(time.Second):
+		c.Fatal("Close is blocked by the retry of webhook syncer")
+	}
+	c.Assert(<-syncErr, check.ErrorMatches, ".*context canceled.*")
+}
+
+func (s *webhookSuite) TestSyncDuringPost(c *check.C) {
+	release := make(chan struct{})
+	sizes := make(chan int, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []*loader.Txn
+		c.Check(json.NewDecoder(r.Body).Decode(&batch), check.IsNil)
+		sizes <- len(batch)
+		<-release
+	}))
+	defer server.Close()
+
+	gen := &translator.BinlogGenerator{}
+	syncer, err := NewWebhookSyncer(&DBConfig{WebhookURL: server.URL}, 2, gen)
+	c.Assert(err, check.IsNil)
+
+	var items []*Item
+	for _, set := range []func(*check.C){gen.SetInsert, gen.SetUpdate, gen.SetDelete} {
+		set(c)
+		items = append(items, &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table})
+	}
+	c.Assert(syncer.Sync(items[0]), check.IsNil)
+	flushErr := make(chan error, 1)
+	go func() {
+		flushErr <- syncer.Sync(items[1])
+	}()
+	c.Assert(<-sizes, check.Equals, 2)
+
+	// the buffer isn't locked by the POST in progress
+	syncErr := make(chan error, 1)
+	go func() {
+		syncErr <- syncer.Sync(items[2])
+	}()
+	select {
+	case err := <-syncErr:
+		c.Assert(err, check.IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("Sync is blocked by the POST in progress")
+	}
+
+	close(release)
+	c.Assert(<-flushErr, check.IsNil)
+	for _, item := range items {
+		c.Assert(<-syncer.Successes(), check.Equals, item)
+	}
+	c.Assert(syncer.Close(), check.IsNil)
+}
@@ -14,8 +14,11 @@
 package drainer
 
 import (
+	"context"
+	"database/sql"
 	"reflect"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -26,6 +29,8 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
@@ -33,6 +38,7 @@ import (
 	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	pb "github.com/pingcap/tipb/go-binlog"
 )
@@ -59,12 +65,51 @@ type Syncer struct {
 
 	dsyncer dsync.Syncer
 
+	// save checkpoint every checkpointSyncInterval successes if it's > 0
+	checkpointSyncInterval int
+	// the requests to save checkpoint immediately, handled by handleSuccess
+	flushReqs chan chan struct{}
+
+	// compare the schemas of the tables in hashCheckTables with the ones in schemaHashDB every schemaHashInterval
+	schemaHashDB       *sql.DB
+	schemaHashInterval time.Duration
+	hashCheckTables    map[int64]struct{}
+
+	// accessed atomically
+	paused    int32
+	currentTS int64
+
+	errMu sync.Mutex
+	// the error that stops the syncer
+	err error
+
 	shutdown chan struct{}
 	closed   chan struct{}
 }
 
+// A SyncerOption sets options of Syncer.
+type SyncerOption func(*Syncer)
+
+// WithCheckpointSyncInterval makes the checkpoint saved every n successes instead of every 3 seconds,
+// the checkpoint is still saved immediately for DDL and when the Syncer quits.
+func WithCheckpointSyncInterval(n int) SyncerOption {
+	return func(s *Syncer) {
+		s.checkpointSyncInterval = n
+	}
+}
+
+// WithSchemaHashCheck makes the Syncer compare the schemas of the tables synced during the last interval
+// with the downstream ones in db, db is closed when the Syncer quits.
+func WithSchemaHashCheck(db *sql.DB, interval time.Duration) SyncerOption {
+	return func(s *Syncer) {
+		s.schemaHashDB = db
+		s.schemaHashInterval = interval
+		s.hashCheckTables = make(map[int64]struct{})
+	}
+}
+
 // NewSyncer returns a Drainer instance
-func NewSyncer(cp checkpoint.CheckPoint, cfg *SyncerConfig, jobs []*model.Job) (*Syncer, error) {
+func NewSyncer(cp checkpoint.CheckPoint, cfg *SyncerConfig, jobs []*model.Job, opts ...SyncerOption) (*Syncer, error) {
 	syncer := new(Syncer)
 	syncer.cfg = cfg
 	syncer.cp = cp
@@ -72,6 +117,7 @@ func NewSyncer(cp checkpoint.CheckPoint, cfg *SyncerConfig, jobs []*model.Job) (
 	syncer.lastSyncTime = time.Now()
 	syncer.shutdown = make(chan struct{})
 	syncer.closed = make(chan struct{})
+	syncer.flushReqs = make(chan chan struct{})
 
 	var ignoreDBs []string
 	if len(cfg.IgnoreSchemas) > 0 {
@@ -92,6 +138,10 @@ func NewSyncer(cp checkpoint.CheckPoint, cfg *SyncerConfig, jobs []*model.Job) (
 		return nil, errors.Trace(err)
 	}
 
+	for _, opt := range opts {
+		opt(syncer)
+	}
+
 	return syncer, nil
 }
 
@@ -102,6 +152,21 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema, info *loopbacksync.LoopBac
 		if err != nil {
 			return nil, errors.Annotate(err, "fail to create kafka dsyncer")
 		}
+	case "s3":
+		dsyncer, err = dsync.NewS3Syncer(cfg.To, schema)
+		if err != nil {
+			return nil, errors.Annotate(err, "fail to create s3 dsyncer")
+		}
+	case "nats":
+		dsyncer, err = dsync.NewNATSSyncer(cfg.To, schema)
+		if err != nil {
+			return nil, errors.Annotate(err, "fail to create nats dsyncer")
+		}
+	case "webhook":
+		dsyncer, err = dsync.NewWebhookSyncer(cfg.To, cfg.TxnBatch, schema)
+		if err != nil {
+			return nil, errors.Annotate(err, "fail to create webhook dsyncer")
+		}
 	case "file":
 		dsyncer, err = dsync.NewPBSyncer(cfg.To.BinlogFileDir, cfg.To.BinlogFileRetentionTime, schema)
 		if err != nil {
@@ -110,7 +175,7 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema, info *loopbacksync.LoopBac
 	case "mysql", "tidb":
 		var relayer relay.Relayer
 		if cfg.Relay.IsEnabled() {
-			if relayer, err = relay.NewRelayer(cfg.Relay.LogDir, cfg.Relay.MaxFileSize, schema); err != nil {
+			if relayer, err = createRelayer(cfg.Relay, schema); err != nil {
 				return nil, errors.Annotate(err, "fail to create relayer")
 			}
 		}
@@ -132,7 +197,7 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema, info *loopbacksync.LoopBac
 
 		var relayer relay.Relayer
 		if cfg.Relay.IsEnabled() {
-			if relayer, err = relay.NewRelayer(cfg.Relay.LogDir, cfg.Relay.MaxFileSize, schema); err != nil {
+			if relayer, err = createRelayer(cfg.Relay, schema); err != nil {
 				return nil, errors.Annotate(err, "fail to create relayer")
 			}
 		}
@@ -151,6 +216,11 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema, info *loopbacksync.LoopBac
 // Start starts to sync.
 func (s *Syncer) Start() error {
 	err := s.run()
+	if err != nil {
+		s.errMu.Lock()
+		s.err = err
+		s.errMu.Unlock()
+	}
 
 	return errors.Trace(err)
 }
@@ -174,6 +244,17 @@ func (s *Syncer) addDMLCount(tp pb.MutationType, nums int) {
 	}
 }
 
+// syncItem passes item to dsyncer in the span of it. The span is a drainer-local root, the trace isn't
+// continued from pump since the binlog of pump has no field to carry the trace context.
+func (s *Syncer) syncItem(item *dsync.Item) error {
+	_, span := otel.Tracer(dsync.TracerName).Start(context.Background(), "drainer.sync")
+	span.SetAttributes(attribute.Int64("commit_ts", item.Binlog.GetCommitTs()))
+	defer span.End()
+
+	item.SpanContext = span.SpanContext()
+	return s.dsyncer.Sync(item)
+}
+
 func (s *Syncer) addDDLCount() {
 	eventCounter.WithLabelValues("DDL").Add(1)
 }
@@ -206,6 +287,29 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 	successes := s.dsyncer.Successes()
 	var lastSaveTS int64
 	lastSaveTime := time.Now()
+	// count of successes after the last save
+	var unsaved int
+
+	// handleItem returns whether the checkpoint should be saved immediately for the item
+	handleItem := func(item *dsync.Item) (saveNow bool, appliedTS int64) {
+		s.lastSyncTime = time.Now()
+		unsaved++
+		checkpointUnsavedTxnsGauge.Set(float64(unsaved))
+		ts := item.Binlog.CommitTs
+		if ts > atomic.LoadInt64(lastTS) {
+			atomic.StoreInt64(lastTS, ts)
+		}
+
+		if recorder, ok := s.cp.(checkpoint.DDLRecorder); ok && item.Binlog.DdlJobId > 0 && !item.ShouldSkip {
+			recorder.AddDDL(ts, string(item.Binlog.DdlQuery))
+		}
+
+		// save ASAP for DDL, and if FinishTS > 0, we should save the ts map
+		if item.Binlog.DdlJobId > 0 || item.AppliedTS > 0 {
+			return true, item.AppliedTS
+		}
+		return false, 0
+	}
 
 	for {
 		if successes == nil && fakeBinlog == nil {
@@ -215,6 +319,7 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 		var (
 			saveNow   = false
 			appliedTS int64
+			flushed   chan struct{}
 		)
 
 		select {
@@ -223,18 +328,7 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 				successes = nil
 				break
 			}
-
-			s.lastSyncTime = time.Now()
-			ts := item.Binlog.CommitTs
-			if ts > atomic.LoadInt64(lastTS) {
-				atomic.StoreInt64(lastTS, ts)
-			}
-
-			// save ASAP for DDL, and if FinishTS > 0, we should save the ts map
-			if item.Binlog.DdlJobId > 0 || item.AppliedTS > 0 {
-				saveNow = true
-				appliedTS = item.AppliedTS
-			}
+			saveNow, appliedTS = handleItem(item)
 
 		case binlog, ok := <-fakeBinlog:
 			if !ok {
@@ -245,31 +339,132 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 			if ts > atomic.LoadInt64(lastTS) {
 				atomic.StoreInt64(lastTS, ts)
 			}
+
+		case flushed = <-s.flushReqs:
+			// the successes may be buffered in the channel, handle them first
+			for len(successes) > 0 {
+				if _, ts := handleItem(<-successes); ts > 0 {
+					appliedTS = ts
+				}
+			}
+			saveNow = true
 		}
 
 		ts := atomic.LoadInt64(lastTS)
 		if ts > lastSaveTS {
-			if saveNow || time.Since(lastSaveTime) > 3*time.Second {
+			if saveNow || s.shouldSaveCheckpoint(lastSaveTime, unsaved) {
 				s.savePoint(ts, appliedTS)
 				lastSaveTime = time.Now()
 				lastSaveTS = ts
 				appliedTS = 0
+				unsaved = 0
+				checkpointUnsavedTxnsGauge.Set(0)
 				eventCounter.WithLabelValues("savepoint").Add(1)
 			}
 			delay := oracle.GetPhysical(time.Now()) - oracle.ExtractPhysical(uint64(ts))
 			checkpointDelayHistogram.Observe(float64(delay) / 1e3)
 		}
+		if flushed != nil {
+			close(flushed)
+		}
 	}
 
 	ts := atomic.LoadInt64(lastTS)
 	if ts > lastSaveTS {
 		s.savePoint(ts, 0)
+		checkpointUnsavedTxnsGauge.Set(0)
 		eventCounter.WithLabelValues("savepoint").Add(1)
 	}
 
 	log.Info("handleSuccess quit")
 }
 
+func (s *Syncer) addHashCheckTables(muts []pb.TableMutation) {
+	if s.hashCheckTables == nil {
+		return
+	}
+	for _, mut := range muts {
+		s.hashCheckTables[mut.GetTableId()] = struct{}{}
+	}
+}
+
+// schemaHashQueryTimeout is the timeout to get the schema hash of a downstream table.
+var schemaHashQueryTimeout = 10 * time.Second
+
+// tableSchemaHash is the upstream schema hash of a table to compare with the downstream one.
+type tableSchemaHash struct {
+	schema string
+	table  string
+	hash   string
+}
+
+// takeSchemaHashes returns the upstream schema hashes of the tables synced since the last call,
+// it must be called in the goroutine handling the binlogs as s.schema isn't thread safe.
+func (s *Syncer) takeSchemaHashes() []tableSchemaHash {
+	var hashes []tableSchemaHash
+	for id := range s.hashCheckTables {
+		delete(s.hashCheckTables, id)
+
+		info, ok := s.schema.TableByID(id)
+		if !ok {
+			continue
+		}
+		schema, table, ok := s.schema.SchemaAndTableName(id)
+		if !ok {
+			continue
+		}
+		hashes = append(hashes, tableSchemaHash{schema: schema, table: table, hash: util.HashTableInfo(info)})
+	}
+	return hashes
+}
+
+// checkSchemaHashes compares the upstream schema hashes with the downstream ones, each query to the downstream
+// is cancelled after schemaHashQueryTimeout or when ctx is done. The mismatches are only logged since
+// the downstream may be altered intentionally.
+func (s *Syncer) checkSchemaHashes(ctx context.Context, hashes []tableSchemaHash) {
+	for _, h := range hashes {
+		queryCtx, cancel := context.WithTimeout(ctx, schemaHashQueryTimeout)
+		downstream, err := util.HashSchema(queryCtx, s.schemaHashDB, h.schema, h.table)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warn("failed to get the schema hash of downstream table",
+				zap.String("schema", h.schema), zap.String("table", h.table), zap.Error(err))
+			continue
+		}
+		if h.hash != downstream {
+			schemaHashMismatchCounter.Inc()
+			log.Warn("the schema of downstream table diverges from the upstream one",
+				zap.String("schema", h.schema), zap.String("table", h.table),
+				zap.String("upstream hash", h.hash), zap.String("downstream hash", downstream))
+		}
+	}
+}
+
+// startSchemaHashCheck compares the schemas of the tables synced since the last check with the downstream ones
+// in a new goroutine, the returned channel is closed when it's done, nil is returned if there is nothing to check.
+func (s *Syncer) startSchemaHashCheck(ctx context.Context) chan struct{} {
+	hashes := s.takeSchemaHashes()
+	if len(hashes) == 0 {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.checkSchemaHashes(ctx, hashes)
+	}()
+	return done
+}
+
+func (s *Syncer) shouldSaveCheckpoint(lastSaveTime time.Time, unsaved int) bool {
+	if s.checkpointSyncInterval > 0 {
+		return unsaved >= s.checkpointSyncInterval
+	}
+	return time.Since(lastSaveTime) > 3*time.Second
+}
+
 func (s *Syncer) savePoint(ts, secondaryTS int64) {
 	if ts < s.cp.TS() {
 		log.Error("save ts is less than checkpoint ts %d", zap.Int64("save ts", ts), zap.Int64("checkpoint ts", s.cp.TS()))
@@ -311,6 +506,24 @@ func (s *Syncer) run() error {
 
 	var lastAddComitTS int64
 	dsyncError := s.dsyncer.Error()
+
+	var schemaHashCheck <-chan time.Time
+	// closed when the running schema hash check is done
+	var schemaHashChecking chan struct{}
+	if s.schemaHashDB != nil && s.schemaHashInterval > 0 {
+		defer s.schemaHashDB.Close()
+		ticker := time.NewTicker(s.schemaHashInterval)
+		defer ticker.Stop()
+		schemaHashCheck = ticker.C
+	}
+	schemaHashCtx, cancelSchemaHash := context.WithCancel(context.Background())
+	defer func() {
+		// the check must quit before schemaHashDB is closed
+		cancelSchemaHash()
+		if schemaHashChecking != nil {
+			<-schemaHashChecking
+		}
+	}()
 ForLoop:
 	for {
 		// check if we can safely push a fake binlog
@@ -332,6 +545,17 @@ ForLoop:
 		case pushFakeBinlog <- fakeBinlog:
 			pushFakeBinlog = nil
 			continue
+		case <-schemaHashCheck:
+			if schemaHashChecking != nil {
+				select {
+				case <-schemaHashChecking:
+				default:
+					// the tables synced in the meantime are checked next time
+					continue
+				}
+			}
+			schemaHashChecking = s.startSchemaHashCheck(schemaHashCtx)
+			continue
 		case b = <-s.input:
 			queueSizeGauge.WithLabelValues("syncer_input").Set(float64(len(s.input)))
 			log.Debug("consume binlog item", zap.Stringer("item", b))
@@ -341,6 +565,7 @@ ForLoop:
 		startTS := binlog.GetStartTs()
 		commitTS := binlog.GetCommitTs()
 		jobID := binlog.GetDdlJobId()
+		atomic.StoreInt64(&s.currentTS, commitTS)
 
 		if isIgnoreTxnCommitTS(s.cfg.IgnoreTxnCommitTS, commitTS) {
 			log.Warn("skip txn", zap.Stringer("binlog", b.binlog))
@@ -394,9 +619,10 @@ ForLoop:
 
 			if !ignore && !isFilterTransaction {
 				s.addDMLEventMetrics(preWrite.GetMutations())
+				s.addHashCheckTables(preWrite.GetMutations())
 				beginTime := time.Now()
 				lastAddComitTS = binlog.GetCommitTs()
-				err = s.dsyncer.Sync(&dsync.Item{Binlog: binlog, PrewriteValue: preWrite})
+				err = s.syncItem(&dsync.Item{Binlog: binlog, PrewriteValue: preWrite})
 				if err != nil {
 					err = errors.Annotatef(err, "failed to add item")
 					break ForLoop
@@ -463,7 +689,7 @@ ForLoop:
 			log.Info("add ddl item to syncer, you can add this commit ts to `ignore-txn-commit-ts` to skip this ddl if needed",
 				zap.String("sql", sql), zap.Int64("commit ts", binlog.CommitTs))
 
-			err = s.dsyncer.Sync(&dsync.Item{Binlog: binlog, PrewriteValue: nil, Schema: schema, Table: table, ShouldSkip: shouldSkip})
+			err = s.syncItem(&dsync.Item{Binlog: binlog, PrewriteValue: nil, Schema: schema, Table: table, ShouldSkip: shouldSkip})
 			if err != nil {
 				err = errors.Annotatef(err, "add to dsyncer, commit ts %d", binlog.CommitTs)
 				break ForLoop
@@ -574,11 +800,110 @@ func (s *Syncer) Add(b *binlogItem) {
 func (s *Syncer) Close() error {
 	log.Debug("closing syncer")
 	close(s.shutdown)
+	// don't block the quitting by a paused dsyncer, the error only means it can't be paused.
+	if s.dsyncer != nil {
+		_ = s.dsyncer.Resume()
+	}
 	<-s.closed
 	log.Debug("syncer is closed")
 	return nil
 }
 
+// Pause pauses replicating binlogs to downstream.
+func (s *Syncer) Pause() error {
+	if err := s.dsyncer.Pause(); err != nil {
+		return errors.Trace(err)
+	}
+	atomic.StoreInt32(&s.paused, 1)
+	return nil
+}
+
+// Resume resumes replicating binlogs to downstream.
+func (s *Syncer) Resume() error {
+	if err := s.dsyncer.Resume(); err != nil {
+		return errors.Trace(err)
+	}
+	atomic.StoreInt32(&s.paused, 0)
+	return nil
+}
+
+// IsPaused returns whether the syncer is paused by Pause.
+func (s *Syncer) IsPaused() bool {
+	return atomic.LoadInt32(&s.paused) == 1
+}
+
+// Err returns the error that stops the syncer, nil if it's running or closed normally.
+func (s *Syncer) Err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.err
+}
+
+// CurrentTS returns the commit ts of the latest binlog received.
+func (s *Syncer) CurrentTS() int64 {
+	return atomic.LoadInt64(&s.currentTS)
+}
+
+// WorkersActive returns the count of workers executing DMLs, it's always 0 except for mysql and tidb.
+func (s *Syncer) WorkersActive() int {
+	syncer, ok := s.dsyncer.(*dsync.MysqlSyncer)
+	if !ok {
+		return 0
+	}
+	return int(syncer.LoaderStats().WorkersActive)
+}
+
+// Lag returns the replication lag of the downstream, only mysql and tidb are supported now.
+func (s *Syncer) Lag() (time.Duration, error) {
+	syncer, ok := s.dsyncer.(*dsync.MysqlSyncer)
+	if !ok {
+		return 0, dsync.ErrNotSupported
+	}
+	return syncer.Lag(), nil
+}
+
+// SetLoaderWorkerCount changes the number of workers of the loader, only mysql and tidb are supported now.
+func (s *Syncer) SetLoaderWorkerCount(n int) error {
+	syncer, ok := s.dsyncer.(*dsync.MysqlSyncer)
+	if !ok {
+		return dsync.ErrNotSupported
+	}
+	return errors.Trace(syncer.SetLoaderWorkerCount(n))
+}
+
+// SwitchDownstream switches the downstream to the one of cfg, only mysql and tidb are supported now.
+func (s *Syncer) SwitchDownstream(ctx context.Context, cfg *dsync.DBConfig) error {
+	syncer, ok := s.dsyncer.(*dsync.MysqlSyncer)
+	if !ok {
+		return dsync.ErrNotSupported
+	}
+	return errors.Trace(syncer.SwitchDownstream(ctx, cfg))
+}
+
+// FlushCheckpoint waits for all the binlogs sent to downstream to be executed and saves the checkpoint
+// immediately. It returns ErrNotSupported if the downstream syncer can't be flushed.
+func (s *Syncer) FlushCheckpoint(ctx context.Context) error {
+	if err := s.dsyncer.FlushCheckpoint(ctx); err != nil {
+		return errors.Trace(err)
+	}
+
+	flushed := make(chan struct{})
+	select {
+	case s.flushReqs <- flushed:
+	case <-s.closed:
+		return errors.New("syncer is closed")
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+}
+
 // GetLastSyncTime returns lastSyncTime
 func (s *Syncer) GetLastSyncTime() time.Time {
 	return s.lastSyncTime
@@ -631,6 +956,19 @@ func (s *interceptSyncer) SetSafeMode(mode bool) bool {
 	return false
 }
 
+func (s *interceptSyncer) Pause() error {
+	return dsync.ErrNotSupported
+}
+
+func (s *interceptSyncer) Resume() error {
+	return dsync.ErrNotSupported
+}
+
+// FlushCheckpoint returns immediately because the items are sent to successes in Sync.
+func (s *interceptSyncer) FlushCheckpoint(ctx context.Context) error {
+	return nil
+}
+
 func (s *interceptSyncer) Sync(item *dsync.Item) error {
 	s.items = append(s.items, item)
 
@@ -14,8 +14,14 @@
 package drainer
 
 import (
+	"context"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+	dto "github.com/prometheus/client_model/go"
+
 	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
 
@@ -23,6 +29,7 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
 	pb "github.com/pingcap/tipb/go-binlog"
 )
@@ -205,6 +212,193 @@ func (s *syncerSuite) TestNewSyncer(c *check.C) {
 	c.Assert(syncer.GetLatestCommitTS(), check.Greater, lastNoneFakeTS)
 }
 
+type countSaveCheckpoint struct {
+	checkpoint.CheckPoint
+	saved []int64
+}
+
+func (cp *countSaveCheckpoint) Save(ts, secondaryTS int64, consistent bool) error {
+	cp.saved = append(cp.saved, ts)
+	return nil
+}
+
+func (cp *countSaveCheckpoint) TS() int64 {
+	if len(cp.saved) == 0 {
+		return 0
+	}
+	return cp.saved[len(cp.saved)-1]
+}
+
+type successesSyncer struct {
+	dsync.Syncer
+	successes chan *dsync.Item
+}
+
+func (s *successesSyncer) Successes() <-chan *dsync.Item {
+	return s.successes
+}
+
+func (s *syncerSuite) testCheckpointSyncInterval(c *check.C, txns int) []int64 {
+	cp := &countSaveCheckpoint{}
+	dsyncer := &successesSyncer{successes: make(chan *dsync.Item, txns)}
+	syncer := &Syncer{cp: cp, dsyncer: dsyncer}
+	WithCheckpointSyncInterval(10)(syncer)
+
+	for i := 1; i <= txns; i++ {
+		dsyncer.successes <- &dsync.Item{Binlog: &pb.Binlog{CommitTs: int64(i)}}
+	}
+	close(dsyncer.successes)
+
+	fakeBinlog := make(chan *pb.Binlog)
+	close(fakeBinlog)
+	var lastTS int64
+	syncer.handleSuccess(fakeBinlog, &lastTS)
+	c.Assert(lastTS, check.Equals, int64(txns))
+
+	return cp.saved
+}
+
+func (s *syncerSuite) TestCheckpointSyncInterval(c *check.C) {
+	saved := s.testCheckpointSyncInterval(c, 100)
+	c.Assert(saved, check.HasLen, 10)
+	for i, ts := range saved {
+		c.Assert(ts, check.Equals, int64((i+1)*10))
+	}
+
+	// the latest ts is saved when quit
+	saved = s.testCheckpointSyncInterval(c, 95)
+	c.Assert(saved, check.HasLen, 10)
+	c.Assert(saved[8], check.Equals, int64(90))
+	c.Assert(saved[9], check.Equals, int64(95))
+}
+
+type ddlRecordingCheckpoint struct {
+	countSaveCheckpoint
+	ddls []checkpoint.DDLRecord
+}
+
+func (cp *ddlRecordingCheckpoint) AddDDL(commitTS int64, sql string) {
+	cp.ddls = append(cp.ddls, checkpoint.DDLRecord{CommitTS: commitTS, SQL: sql})
+}
+
+func (s *syncerSuite) TestRecordDDL(c *check.C) {
+	cp := &ddlRecordingCheckpoint{}
+	dsyncer := &successesSyncer{successes: make(chan *dsync.Item, 3)}
+	syncer := &Syncer{cp: cp, dsyncer: dsyncer}
+
+	dsyncer.successes <- &dsync.Item{Binlog: &pb.Binlog{CommitTs: 1}}
+	dsyncer.successes <- &dsync.Item{Binlog: &pb.Binlog{CommitTs: 2, DdlJobId: 1, DdlQuery: []byte("create table t(id int)")}}
+	// the DDL not replicated to downstream is not recorded
+	dsyncer.successes <- &dsync.Item{Binlog: &pb.Binlog{CommitTs: 3, DdlJobId: 2, DdlQuery: []byte("drop table t")}, ShouldSkip: true}
+	close(dsyncer.successes)
+
+	fakeBinlog := make(chan *pb.Binlog)
+	close(fakeBinlog)
+	var lastTS int64
+	syncer.handleSuccess(fakeBinlog, &lastTS)
+	c.Assert(cp.ddls, check.DeepEquals, []checkpoint.DDLRecord{{CommitTS: 2, SQL: "create table t(id int)"}})
+}
+
+func (s *syncerSuite) TestCheckSchemaHash(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, check.IsNil)
+	syncer := &Syncer{schema: schema}
+	WithSchemaHashCheck(db, time.Minute)(syncer)
+
+	intType := types.NewFieldType(mysql.TypeLong)
+	intType.Flen = 11
+	for id, name := range map[int64]string{1: "same", 2: "diverged"} {
+		schema.tables[id] = &model.TableInfo{
+			ID:      id,
+			Name:    model.NewCIStr(name),
+			Columns: []*model.ColumnInfo{{Name: model.NewCIStr("id"), FieldType: *intType, State: model.StatePublic}},
+		}
+		schema.tableIDToName[id] = TableName{Schema: "test", Table: name}
+	}
+
+	mismatches := func() float64 {
+		var metric dto.Metric
+		c.Assert(schemaHashMismatchCounter.Write(&metric), check.IsNil)
+		return metric.GetCounter().GetValue()
+	}
+	before := mismatches()
+
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE, ORDINAL_POSITION FROM INFORMATION_SCHEMA.COLUMNS.*").
+		WithArgs("test", "same").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "ORDINAL_POSITION"}).AddRow("id", "int(11)", 1))
+	mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE, ORDINAL_POSITION FROM INFORMATION_SCHEMA.COLUMNS.*").
+		WithArgs("test", "diverged").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "ORDINAL_POSITION"}).AddRow("id", "bigint(20)", 1))
+
+	// the unknown table 3 is skipped
+	syncer.addHashCheckTables([]pb.TableMutation{{TableId: 1}, {TableId: 2}, {TableId: 3}})
+	hashes := syncer.takeSchemaHashes()
+	c.Assert(hashes, check.HasLen, 2)
+	c.Assert(syncer.hashCheckTables, check.HasLen, 0)
+	syncer.checkSchemaHashes(context.Background(), hashes)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	c.Assert(mismatches(), check.Equals, before+1)
+
+	// nothing is checked if no table is synced
+	c.Assert(syncer.startSchemaHashCheck(context.Background()), check.IsNil)
+	c.Assert(mismatches(), check.Equals, before+1)
+}
+
+func (s *syncerSuite) TestCheckSchemaHashTimeout(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	syncer := &Syncer{}
+	WithSchemaHashCheck(db, time.Minute)(syncer)
+
+	origTimeout := schemaHashQueryTimeout
+	schemaHashQueryTimeout = 100 * time.Millisecond
+	defer func() { schemaHashQueryTimeout = origTimeout }()
+
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "ORDINAL_POSITION"}).AddRow("id", "int(11)", 1)
+	}
+	mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE, ORDINAL_POSITION FROM INFORMATION_SCHEMA.COLUMNS.*").
+		WithArgs("test", "t1").WillDelayFor(time.Hour).WillReturnRows(rows())
+	mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE, ORDINAL_POSITION FROM INFORMATION_SCHEMA.COLUMNS.*").
+		WithArgs("test", "t2").WillDelayFor(time.Hour).WillReturnRows(rows())
+
+	// the stuck query is cut off by the timeout and the next table is still checked
+	hashes := []tableSchemaHash{{schema: "test", table: "t1"}, {schema: "test", table: "t2"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		syncer.checkSchemaHashes(ctx, hashes)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("the schema hash check isn't cut off by the timeout")
+	}
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the check quits once ctx is cancelled
+	mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE, ORDINAL_POSITION FROM INFORMATION_SCHEMA.COLUMNS.*").
+		WithArgs("test", "t1").WillDelayFor(time.Hour).WillReturnRows(rows())
+	schemaHashQueryTimeout = time.Hour
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		syncer.checkSchemaHashes(ctx, hashes)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("the schema hash check isn't cancelled")
+	}
+}
+
 func (s *syncerSuite) TestIsIgnoreTxnCommitTS(c *check.C) {
 	c.Assert(isIgnoreTxnCommitTS(nil, 1), check.IsFalse)
 	c.Assert(isIgnoreTxnCommitTS([]int64{1, 3}, 1), check.IsTrue)
@@ -231,3 +425,38 @@ func getEmptyPrewriteValue(schemaVersion int64, tableID int64) (data []byte) {
 	}
 	return
 }
+
+func (s *syncerSuite) TestFlushCheckpoint(c *check.C) {
+	cp := &countSaveCheckpoint{}
+	dsyncer := newInterceptSyncer()
+	syncer := &Syncer{
+		cp:        cp,
+		dsyncer:   dsyncer,
+		flushReqs: make(chan chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	// not saved until flushed
+	WithCheckpointSyncInterval(1000)(syncer)
+
+	fakeBinlog := make(chan *pb.Binlog)
+	var lastTS int64
+	quit := make(chan struct{})
+	go func() {
+		syncer.handleSuccess(fakeBinlog, &lastTS)
+		close(quit)
+	}()
+
+	for i := 1; i <= 100; i++ {
+		err := dsyncer.Sync(&dsync.Item{Binlog: &pb.Binlog{CommitTs: int64(i)}})
+		c.Assert(err, check.IsNil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Assert(syncer.FlushCheckpoint(ctx), check.IsNil)
+	c.Assert(cp.saved, check.DeepEquals, []int64{100})
+
+	dsyncer.Close()
+	close(fakeBinlog)
+	<-quit
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncplg
+
+import (
+	"fmt"
+	"plugin"
+	"reflect"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
+	"github.com/pingcap/tidb-binlog/drainer/relay"
+	"github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ErrSymbolNotFound is returned when the plugin doesn't export the NewPlugin function.
+	ErrSymbolNotFound = errors.New("symbol not found in syncer plugin")
+	// ErrSymbolType is returned when the NewPlugin function or the factory it returns has a wrong type.
+	ErrSymbolType = errors.New("wrong type of symbol in syncer plugin")
+)
+
+// NewSyncerFromPlugin opens the syncer plugin in the .so file of path and creates a Syncer by
+// the FactoryInterface returned by its NewPlugin function.
+// errors.Cause of the error is ErrSymbolNotFound or ErrSymbolType if the plugin is invalid.
+func NewSyncerFromPlugin(
+	path string,
+	cfg *sync.DBConfig,
+	file string,
+	tableInfoGetter translator.TableInfoGetter,
+	worker int,
+	batchSize int,
+	queryHistogramVec *prometheus.HistogramVec,
+	sqlMode *string,
+	destDBType string,
+	relayer relay.Relayer,
+	info *loopbacksync.LoopBackSync,
+	enableDispatch bool,
+	enableCausility bool,
+) (sync.Syncer, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to open syncer plugin %s", path)
+	}
+
+	if err = validateSyncerPlugin(p.Lookup); err != nil {
+		return nil, errors.Annotatef(err, "invalid syncer plugin %s", path)
+	}
+	newSyncer, err := lookupNewSyncerFunc(p.Lookup)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid syncer plugin %s", path)
+	}
+
+	return newSyncer(cfg, file, tableInfoGetter, worker, batchSize, queryHistogramVec, sqlMode,
+		destDBType, relayer, info, enableDispatch, enableCausility)
+}
+
+// lookupNewSyncerFunc gets the NewSyncerFunc by the NewPlugin function looked up by lookup.
+func lookupNewSyncerFunc(lookup func(symName string) (plugin.Symbol, error)) (NewSyncerFunc, error) {
+	sym, err := lookup(NewPlugin)
+	if err != nil {
+		return nil, errors.Annotatef(ErrSymbolNotFound, "lookup %s: %v", NewPlugin, err)
+	}
+
+	newFactory, ok := sym.(func() interface{})
+	if !ok {
+		return nil, errors.Annotatef(ErrSymbolType, "%s is %T, not func() interface{}", NewPlugin, sym)
+	}
+
+	factory := newFactory()
+	plg, ok := factory.(FactoryInterface)
+	if !ok {
+		return nil, errors.Annotatef(ErrSymbolType, "%T returned by %s doesn't implement FactoryInterface", factory, NewPlugin)
+	}
+
+	return plg.NewSyncerPlugin, nil
+}
+
+// ValidateSyncerPlugin checks the signature of the NewSyncerPlugin method of the factory returned by the
+// NewPlugin function of the plugin in path, so the plugin compiled against a different version of drainer
+// is rejected at load time instead of panicking. errors.Cause of the error is ErrSymbolNotFound or ErrSymbolType
+// if the plugin is invalid, and the mismatched parameter and return types are listed in the error.
+func ValidateSyncerPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return errors.Annotatef(err, "failed to open syncer plugin %s", path)
+	}
+	return errors.Annotatef(validateSyncerPlugin(p.Lookup), "invalid syncer plugin %s", path)
+}
+
+func validateSyncerPlugin(lookup func(symName string) (plugin.Symbol, error)) error {
+	sym, err := lookup(NewPlugin)
+	if err != nil {
+		return errors.Annotatef(ErrSymbolNotFound, "lookup %s: %v", NewPlugin, err)
+	}
+
+	newFactory, ok := sym.(func() interface{})
+	if !ok {
+		return errors.Annotatef(ErrSymbolType, "%s is %T, not func() interface{}", NewPlugin, sym)
+	}
+	factory := newFactory()
+	if factory == nil {
+		return errors.Annotatef(ErrSymbolType, "%s returns nil", NewPlugin)
+	}
+
+	method := reflect.ValueOf(factory).MethodByName("NewSyncerPlugin")
+	if !method.IsValid() {
+		return errors.Annotatef(ErrSymbolType, "%T returned by %s doesn't have method NewSyncerPlugin", factory, NewPlugin)
+	}
+	if mismatches := signatureMismatches(method.Type(), reflect.TypeOf(NewSyncerFunc(nil))); len(mismatches) > 0 {
+		return errors.Annotatef(ErrSymbolType, "NewSyncerPlugin of %T mismatches: %s", factory, strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// signatureMismatches returns the differences of the parameter and return types of the function type got
+// from the expected one.
+func signatureMismatches(got, expected reflect.Type) []string {
+	var mismatches []string
+	if got.NumIn() != expected.NumIn() {
+		mismatches = append(mismatches, fmt.Sprintf("got %d parameters, expected %d", got.NumIn(), expected.NumIn()))
+	}
+	for i := 0; i < got.NumIn() && i < expected.NumIn(); i++ {
+		if got.In(i) != expected.In(i) {
+			mismatches = append(mismatches, fmt.Sprintf("parameter %d is %s, expected %s", i+1, got.In(i), expected.In(i)))
+		}
+	}
+	if got.IsVariadic() != expected.IsVariadic() {
+		mismatches = append(mismatches, fmt.Sprintf("variadic is %v, expected %v", got.IsVariadic(), expected.IsVariadic()))
+	}
+
+	if got.NumOut() != expected.NumOut() {
+		mismatches = append(mismatches, fmt.Sprintf("got %d return values, expected %d", got.NumOut(), expected.NumOut()))
+	}
+	for i := 0; i < got.NumOut() && i < expected.NumOut(); i++ {
+		if got.Out(i) != expected.Out(i) {
+			mismatches = append(mismatches, fmt.Sprintf("return value %d is %s, expected %s", i+1, got.Out(i), expected.Out(i)))
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncplg
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"plugin"
+	"strings"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
+	"github.com/pingcap/tidb-binlog/drainer/relay"
+	"github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// the demo plugin built in TestMain
+	demoPluginPath string
+	buildPluginErr error
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	dir, err := ioutil.TempDir("", "syncplg")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	demoPluginPath, buildPluginErr = buildDemoPlugin(dir)
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// buildDemoPlugin builds syncerdemo as a plugin in dir.
+func buildDemoPlugin(dir string) (string, error) {
+	if testing.Short() {
+		return "", errors.New("skip building plugin in short mode")
+	}
+
+	path := filepath.Join(dir, "syncerdemo.so")
+	cmd := exec.Command("go", "build", "-buildmode=plugin", "-o", path, ".")
+	cmd.Dir = "syncerdemo"
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", errors.Annotatef(err, "build demo plugin: %s", output)
+	}
+	return path, nil
+}
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&loaderSuite{})
+
+type loaderSuite struct{}
+
+func (s *loaderSuite) TestNewSyncerFromPlugin(c *C) {
+	if buildPluginErr != nil {
+		c.Skip(buildPluginErr.Error())
+	}
+
+	syncer, err := NewSyncerFromPlugin(demoPluginPath, &sync.DBConfig{}, "", nil, 1, 1, nil, nil, "plugin", nil, nil, false, false)
+	if err != nil && strings.Contains(err.Error(), "different version of package") {
+		// the plugin must be built with the same flags as the test, like -race and -cover
+		c.Skip(err.Error())
+	}
+	c.Assert(err, IsNil)
+	c.Assert(syncer, NotNil)
+	c.Assert(syncer.SetSafeMode(true), IsTrue)
+}
+
+func (s *loaderSuite) TestOpenFailed(c *C) {
+	_, err := NewSyncerFromPlugin(filepath.Join(c.MkDir(), "not-exist.so"), &sync.DBConfig{}, "", nil, 1, 1, nil, nil, "plugin", nil, nil, false, false)
+	c.Assert(err, ErrorMatches, "failed to open syncer plugin.*")
+}
+
+func (s *loaderSuite) TestSymbolNotFound(c *C) {
+	_, err := lookupNewSyncerFunc(func(string) (plugin.Symbol, error) {
+		return nil, errors.New("symbol not found")
+	})
+	c.Assert(errors.Cause(err), Equals, ErrSymbolNotFound)
+}
+
+type notFactory struct{}
+
+func (s *loaderSuite) TestSymbolType(c *C) {
+	_, err := lookupNewSyncerFunc(func(string) (plugin.Symbol, error) {
+		return func() {}, nil
+	})
+	c.Assert(errors.Cause(err), Equals, ErrSymbolType)
+
+	_, err = lookupNewSyncerFunc(func(string) (plugin.Symbol, error) {
+		return func() interface{} { return notFactory{} }, nil
+	})
+	c.Assert(errors.Cause(err), Equals, ErrSymbolType)
+	c.Assert(err, ErrorMatches, ".*notFactory.*doesn't implement FactoryInterface.*")
+}
+
+func (s *loaderSuite) TestValidateSyncerPlugin(c *C) {
+	if buildPluginErr != nil {
+		c.Skip(buildPluginErr.Error())
+	}
+
+	err := ValidateSyncerPlugin(demoPluginPath)
+	if err != nil && strings.Contains(err.Error(), "different version of package") {
+		c.Skip(err.Error())
+	}
+	c.Assert(err, IsNil)
+
+	c.Assert(ValidateSyncerPlugin(filepath.Join(c.MkDir(), "not-exist.so")), ErrorMatches, "failed to open syncer plugin.*")
+}
+
+type validFactory struct{}
+
+func (validFactory) NewSyncerPlugin(
+	cfg *sync.DBConfig,
+	file string,
+	tableInfoGetter translator.TableInfoGetter,
+	worker int,
+	batchSize int,
+	queryHistogramVec *prometheus.HistogramVec,
+	sqlMode *string,
+	destDBType string,
+	relayer relay.Relayer,
+	info *loopbacksync.LoopBackSync,
+	enableDispatch bool,
+	enableCausility bool,
+) (sync.Syncer, error) {
+	return nil, nil
+}
+
+// oldFactory is like the factory of a plugin built against an older version without the last parameters,
+// and worker is int64.
+type oldFactory struct{}
+
+func (oldFactory) NewSyncerPlugin(
+	cfg *sync.DBConfig,
+	file string,
+	tableInfoGetter translator.TableInfoGetter,
+	worker int64,
+	batchSize int,
+	queryHistogramVec *prometheus.HistogramVec,
+	sqlMode *string,
+	destDBType string,
+	relayer relay.Relayer,
+	info *loopbacksync.LoopBackSync,
+) sync.Syncer {
+	return nil
+}
+
+func factorySymbol(factory interface{}) func(string) (plugin.Symbol, error) {
+	return func(string) (plugin.Symbol, error) {
+		return func() interface{} { return factory }, nil
+	}
+}
+
+func (s *loaderSuite) TestValidateSignature(c *C) {
+	c.Assert(validateSyncerPlugin(factorySymbol(validFactory{})), IsNil)
+
+	err := validateSyncerPlugin(factorySymbol(oldFactory{}))
+	c.Assert(errors.Cause(err), Equals, ErrSymbolType)
+	c.Assert(err, ErrorMatches, ".*NewSyncerPlugin of syncplg.oldFactory mismatches: "+
+		"got 10 parameters, expected 12; "+
+		"parameter 4 is int64, expected int; "+
+		"got 1 return values, expected 2.*")
+
+	err = validateSyncerPlugin(factorySymbol(notFactory{}))
+	c.Assert(errors.Cause(err), Equals, ErrSymbolType)
+	c.Assert(err, ErrorMatches, ".*doesn't have method NewSyncerPlugin.*")
+
+	err = validateSyncerPlugin(factorySymbol(nil))
+	c.Assert(errors.Cause(err), Equals, ErrSymbolType)
+
+	err = validateSyncerPlugin(func(string) (plugin.Symbol, error) { return nil, errors.New("symbol not found") })
+	c.Assert(errors.Cause(err), Equals, ErrSymbolNotFound)
+}
@@ -1,7 +1,6 @@
 package syncplg
 
 import (
-	"errors"
 	"fmt"
 	"plugin"
 
@@ -59,18 +58,5 @@ func LoadPlugin(path, name string) (NewSyncerFunc, error) {
 		return nil, fmt.Errorf("faile to Open %s . err: %s", fp, err.Error())
 	}
 
-	sym, err := p.Lookup(NewPlugin)
-	if err != nil {
-		return nil, err
-	}
-	newFactory, ok := sym.(func() interface{})
-	if !ok {
-		return nil, errors.New("function type is incorrect")
-	}
-	fac := newFactory()
-	plg, ok := fac.(FactoryInterface)
-	if !ok {
-		return nil, errors.New("not implement FactoryInterface")
-	}
-	return plg.NewSyncerPlugin, nil
+	return lookupNewSyncerFunc(p.Lookup)
 }
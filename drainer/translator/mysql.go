@@ -104,6 +104,7 @@ func genMysqlDelete(schema string, table *model.TableInfo, row []byte) (names []
 // TiBinlogToTxn translate the format to loader.Txn
 func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBinlog *tipb.Binlog, pv *tipb.PrewriteValue, shouldSkip bool) (txn *loader.Txn, err error) {
 	txn = new(loader.Txn)
+	txn.CommitTS = tiBinlog.GetCommitTs()
 
 	if tiBinlog.DdlJobId > 0 {
 		txn.DDL = &loader.DDL{
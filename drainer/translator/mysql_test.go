@@ -41,6 +41,7 @@ func (t *testMysqlSuite) TestDDL(c *check.C) {
 	c.Assert(err, check.IsNil)
 
 	c.Assert(txn, check.DeepEquals, &loader.Txn{
+		CommitTS: t.TiBinlog.GetCommitTs(),
 		DDL: &loader.DDL{
 			Database:   t.Schema,
 			Table:      t.Table,
@@ -56,6 +57,7 @@ func (t *testMysqlSuite) testDML(c *check.C, tp loader.DMLType) {
 
 	c.Assert(txn.DMLs, check.HasLen, 1)
 	c.Assert(txn.DDL, check.IsNil)
+	c.Assert(txn.CommitTS, check.Equals, t.TiBinlog.GetCommitTs())
 
 	dml := txn.DMLs[0]
 	c.Assert(dml.Tp, check.Equals, tp)
@@ -86,6 +86,7 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 		ClusterID:       id,
 		InitialCommitTS: cfg.InitialCommitTS,
 		CheckPointFile:  path.Join(cfg.DataDir, "savepoint"),
+		DDLHistory:      cfg.SyncerCfg.To.Checkpoint.DDLHistory,
 	}
 
 	toCheckpoint := cfg.SyncerCfg.To.Checkpoint
@@ -104,6 +105,9 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 			Port:     toCheckpoint.Port,
 			TLS:      toCheckpoint.TLS,
 		}
+	case "sqlite":
+		checkpointCfg.CheckpointType = toCheckpoint.Type
+		checkpointCfg.CheckPointFile = path.Join(cfg.DataDir, "savepoint.db")
 	case "":
 		switch cfg.SyncerCfg.DestDBType {
 		case "mysql", "tidb", "plugin":
@@ -117,7 +121,7 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 			}
 		case "pb", "file":
 			checkpointCfg.CheckpointType = "file"
-		case "kafka":
+		case "kafka", "s3", "nats", "webhook":
 			checkpointCfg.CheckpointType = "file"
 		case "flash":
 			return nil, errors.New("the flash DestDBType is no longer supported")
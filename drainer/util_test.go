@@ -15,6 +15,8 @@ package drainer
 
 import (
 	. "github.com/pingcap/check"
+
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 )
 
 type taskGroupSuite struct{}
@@ -40,3 +42,30 @@ func (s *taskGroupSuite) TestShouldRecoverFromPanic(c *C) {
 	c.Assert(logHook.Entrys[1].Message, Matches, ".*Exit.*")
 }
 */
+
+type genCheckPointCfgSuite struct{}
+
+var _ = Suite(&genCheckPointCfgSuite{})
+
+func (s *genCheckPointCfgSuite) TestFileCheckpointForSinks(c *C) {
+	for _, tp := range []string{"pb", "file", "kafka", "s3", "nats", "webhook"} {
+		cfg := NewConfig()
+		cfg.DataDir = "/tmp/drainer"
+		cfg.SyncerCfg.DestDBType = tp
+		cfg.SyncerCfg.To = &dsync.DBConfig{}
+
+		checkpointCfg, err := GenCheckPointCfg(cfg, 1)
+		c.Assert(err, IsNil, Commentf("dest db type: %s", tp))
+		c.Assert(checkpointCfg.CheckpointType, Equals, "file", Commentf("dest db type: %s", tp))
+		c.Assert(checkpointCfg.CheckPointFile, Equals, "/tmp/drainer/savepoint")
+	}
+}
+
+func (s *genCheckPointCfgSuite) TestUnknownDestDBType(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.DestDBType = "unknown"
+	cfg.SyncerCfg.To = &dsync.DBConfig{}
+
+	_, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "unknown DestDBType: unknown")
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// the id of the last batch created
+var lastBatchID uint64
+
+// BatchMetadata is the lifecycle of a batch of DMLs executed together, the times are in strictly increasing
+// order. The zero time means the batch hasn't reached the point.
+type BatchMetadata struct {
+	// CreatedAt is when the first DML is added to the batch
+	CreatedAt time.Time
+	// QueuedAt is when the batch stops accepting DMLs and waits to be executed
+	QueuedAt time.Time
+	// DispatchedAt is when the DMLs start to be executed, after the OnDispatch hooks are called
+	DispatchedAt time.Time
+	// CommittedAt is when all the DMLs are executed successfully
+	CommittedAt time.Time
+	BatchID     uint64
+}
+
+// batchContext is a batch of DMLs with the metadata of it.
+type batchContext struct {
+	BatchMetadata
+	dmls []*DML
+}
+
+func newBatchContext() *batchContext {
+	return &batchContext{BatchMetadata: BatchMetadata{
+		CreatedAt: time.Now(),
+		BatchID:   atomic.AddUint64(&lastBatchID, 1),
+	}}
+}
+
+// timeAfter returns the current time, or the time right after prev if the clock doesn't advance,
+// so the times of a batch are always distinguishable.
+func timeAfter(prev time.Time) time.Time {
+	now := time.Now()
+	if !now.After(prev) {
+		now = prev.Add(time.Nanosecond)
+	}
+	return now
+}
+
+func (b *batchContext) queued() {
+	b.QueuedAt = timeAfter(b.CreatedAt)
+}
+
+func (b *batchContext) dispatched() {
+	b.DispatchedAt = timeAfter(b.QueuedAt)
+}
+
+func (b *batchContext) committed() {
+	b.CommittedAt = timeAfter(b.DispatchedAt)
+}
+
+// observe logs the lifecycle of the committed batch, and observes the durations of it by the histograms.
+// The queue duration is from CreatedAt to DispatchedAt, and the execute duration is from DispatchedAt
+// to CommittedAt.
+func (b *batchContext) observe(queueHistogram, executeHistogram prometheus.Histogram) {
+	queue, execute := b.DispatchedAt.Sub(b.CreatedAt), b.CommittedAt.Sub(b.DispatchedAt)
+	log.Debug("batch committed", zap.Uint64("batch id", b.BatchID), zap.Int("dmls", len(b.dmls)),
+		zap.Time("created at", b.CreatedAt), zap.Time("queued at", b.QueuedAt),
+		zap.Time("dispatched at", b.DispatchedAt), zap.Time("committed at", b.CommittedAt),
+		zap.Duration("queue duration", queue), zap.Duration("execute duration", execute))
+
+	if queueHistogram != nil {
+		queueHistogram.Observe(queue.Seconds())
+	}
+	if executeHistogram != nil {
+		executeHistogram.Observe(execute.Seconds())
+	}
+}
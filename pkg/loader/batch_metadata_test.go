@@ -0,0 +1,100 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+type batchMetadataSuite struct{}
+
+var _ = check.Suite(&batchMetadataSuite{})
+
+func histogramCount(c *check.C, histogram prometheus.Histogram) uint64 {
+	var metric io_prometheus_client.Metric
+	c.Assert(histogram.Write(&metric), check.IsNil)
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func (s *batchMetadataSuite) TestLifecycle(c *check.C) {
+	var batches []*batchContext
+	var dispatched []*Txn
+	queueHistogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "queue"})
+	executeHistogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "execute"})
+	var bm *batchManager
+	bm = &batchManager{
+		limit:          2,
+		enableDispatch: true,
+		hooks: &TxnLifecycleHooks{OnDispatch: func(txn *Txn, ts time.Time) {
+			dispatched = append(dispatched, txn)
+			// dispatched after the hooks are called
+			c.Assert(bm.batch.DispatchedAt.IsZero(), check.IsTrue)
+		}},
+		fExecDMLs: func(dmls []*DML) error {
+			c.Assert(bm.batch.dmls, check.DeepEquals, dmls)
+			c.Assert(bm.batch.CommittedAt.IsZero(), check.IsTrue)
+			batches = append(batches, bm.batch)
+			return nil
+		},
+		queueHistogram:   queueHistogram,
+		executeHistogram: executeHistogram,
+	}
+
+	for i := 0; i < 4; i++ {
+		c.Assert(bm.put(&Txn{DMLs: []*DML{newCaptureTestDML(InsertDMLType, i)}}), check.IsNil)
+	}
+	c.Assert(bm.batch, check.IsNil)
+	c.Assert(dispatched, check.HasLen, 4)
+	c.Assert(batches, check.HasLen, 2)
+
+	for _, batch := range batches {
+		c.Assert(batch.QueuedAt.After(batch.CreatedAt), check.IsTrue)
+		c.Assert(batch.DispatchedAt.After(batch.QueuedAt), check.IsTrue)
+		c.Assert(batch.CommittedAt.After(batch.DispatchedAt), check.IsTrue)
+		c.Assert(batch.dmls, check.HasLen, 2)
+	}
+	c.Assert(batches[1].BatchID > batches[0].BatchID, check.IsTrue)
+	c.Assert(batches[1].CreatedAt.After(batches[0].CommittedAt), check.IsTrue)
+	c.Assert(histogramCount(c, queueHistogram), check.Equals, uint64(2))
+	c.Assert(histogramCount(c, executeHistogram), check.Equals, uint64(2))
+}
+
+func (s *batchMetadataSuite) TestFailedBatch(c *check.C) {
+	executeHistogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "execute"})
+	bm := &batchManager{
+		limit:            1,
+		enableDispatch:   true,
+		fExecDMLs:        func(dmls []*DML) error { return errors.New("exec failed") },
+		executeHistogram: executeHistogram,
+	}
+
+	err := bm.put(&Txn{DMLs: []*DML{newCaptureTestDML(InsertDMLType, 1)}})
+	c.Assert(err, check.ErrorMatches, "exec failed")
+	c.Assert(bm.batch.DispatchedAt.After(bm.batch.QueuedAt), check.IsTrue)
+	c.Assert(bm.batch.CommittedAt.IsZero(), check.IsTrue)
+	c.Assert(histogramCount(c, executeHistogram), check.Equals, uint64(0))
+}
+
+func (s *batchMetadataSuite) TestTimeAfter(c *check.C) {
+	future := time.Now().Add(time.Hour)
+	c.Assert(timeAfter(future), check.Equals, future.Add(time.Nanosecond))
+
+	past := time.Now().Add(-time.Hour)
+	c.Assert(timeAfter(past).After(past.Add(time.Nanosecond)), check.IsTrue)
+}
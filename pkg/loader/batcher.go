@@ -0,0 +1,100 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+)
+
+// DMLBatcher groups the DMLs by table, and flushes the batch of a table as soon as it has batchSize DMLs
+// without waiting for the DMLs of other tables, so a hot table doesn't have to share the batch with the others.
+// The DMLs of the same table are flushed in the order they're added, the DMLs of different tables are not.
+// DMLBatcher is not safe for concurrent use.
+type DMLBatcher struct {
+	batchSize int
+	flushFn   func(dmls []*DML) error
+
+	// `schema`.`table` -> the pending DMLs of the table
+	batches map[string][]*DML
+	// the tables with pending DMLs, in the order of their first pending DML
+	tables  []string
+	pending int
+}
+
+// NewDMLBatcher returns a DMLBatcher calling flushFn with the DMLs of a table when there're batchSize of them.
+// The slice passed to flushFn is not reused by DMLBatcher.
+func NewDMLBatcher(batchSize int, flushFn func(dmls []*DML) error) *DMLBatcher {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	return &DMLBatcher{
+		batchSize: batchSize,
+		flushFn:   flushFn,
+		batches:   make(map[string][]*DML),
+	}
+}
+
+// Add adds the DMLs to the batches of their tables, and flushes the batches become full.
+func (b *DMLBatcher) Add(dmls ...*DML) error {
+	for _, dml := range dmls {
+		name := dml.TableName()
+		batch, ok := b.batches[name]
+		if !ok {
+			b.tables = append(b.tables, name)
+			batch = make([]*DML, 0, b.batchSize)
+		}
+		b.batches[name] = append(batch, dml)
+		b.pending++
+
+		if len(b.batches[name]) >= b.batchSize {
+			if err := b.flushTable(name); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+// Flush flushes the batches of all tables, even if they're not full.
+func (b *DMLBatcher) Flush() error {
+	for len(b.tables) > 0 {
+		if err := b.flushTable(b.tables[0]); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Pending returns the count of DMLs not flushed yet.
+func (b *DMLBatcher) Pending() int {
+	return b.pending
+}
+
+// flushTable calls flushFn with the batch of the table, the batch is kept if flushFn fails.
+func (b *DMLBatcher) flushTable(name string) error {
+	batch := b.batches[name]
+	if err := b.flushFn(batch); err != nil {
+		return errors.Trace(err)
+	}
+
+	delete(b.batches, name)
+	for i, table := range b.tables {
+		if table == name {
+			b.tables = append(b.tables[:i], b.tables[i+1:]...)
+			break
+		}
+	}
+	b.pending -= len(batch)
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type dmlBatcherSuite struct{}
+
+var _ = check.Suite(&dmlBatcherSuite{})
+
+func newBatcherDML(table string, id int) *DML {
+	return &DML{Database: "test", Table: table, Tp: InsertDMLType, Values: map[string]interface{}{"id": id}}
+}
+
+func (s *dmlBatcherSuite) TestFlushByTable(c *check.C) {
+	var flushed [][]*DML
+	batcher := NewDMLBatcher(2, func(dmls []*DML) error {
+		flushed = append(flushed, dmls)
+		return nil
+	})
+
+	hot1, cold1, hot2, hot3, cold2 := newBatcherDML("hot", 1), newBatcherDML("cold", 1), newBatcherDML("hot", 2),
+		newBatcherDML("hot", 3), newBatcherDML("cold", 2)
+
+	c.Assert(batcher.Add(hot1, cold1), check.IsNil)
+	c.Assert(flushed, check.HasLen, 0)
+	c.Assert(batcher.Pending(), check.Equals, 2)
+
+	// the hot table is flushed without waiting for the cold one
+	c.Assert(batcher.Add(hot2), check.IsNil)
+	c.Assert(flushed, check.DeepEquals, [][]*DML{{hot1, hot2}})
+	c.Assert(batcher.Pending(), check.Equals, 1)
+
+	c.Assert(batcher.Add(hot3, cold2), check.IsNil)
+	c.Assert(flushed, check.DeepEquals, [][]*DML{{hot1, hot2}, {cold1, cold2}})
+	c.Assert(batcher.Pending(), check.Equals, 1)
+
+	c.Assert(batcher.Flush(), check.IsNil)
+	c.Assert(flushed, check.DeepEquals, [][]*DML{{hot1, hot2}, {cold1, cold2}, {hot3}})
+	c.Assert(batcher.Pending(), check.Equals, 0)
+}
+
+func (s *dmlBatcherSuite) TestFlushInOrder(c *check.C) {
+	var tables []string
+	batcher := NewDMLBatcher(10, func(dmls []*DML) error {
+		tables = append(tables, dmls[0].Table)
+		return nil
+	})
+
+	for i, table := range []string{"t2", "t1", "t3", "t1"} {
+		c.Assert(batcher.Add(newBatcherDML(table, i)), check.IsNil)
+	}
+	c.Assert(batcher.Flush(), check.IsNil)
+	c.Assert(tables, check.DeepEquals, []string{"t2", "t1", "t3"})
+}
+
+func (s *dmlBatcherSuite) TestFlushFailed(c *check.C) {
+	fail := true
+	var flushed []*DML
+	batcher := NewDMLBatcher(2, func(dmls []*DML) error {
+		if fail {
+			return errors.New("connection refused")
+		}
+		flushed = append(flushed, dmls...)
+		return nil
+	})
+
+	dml1, dml2 := newBatcherDML("t1", 1), newBatcherDML("t1", 2)
+	c.Assert(batcher.Add(dml1, dml2), check.ErrorMatches, "connection refused")
+	// the batch is kept to be flushed again
+	c.Assert(batcher.Pending(), check.Equals, 2)
+
+	fail = false
+	c.Assert(batcher.Flush(), check.IsNil)
+	c.Assert(flushed, check.DeepEquals, []*DML{dml1, dml2})
+	c.Assert(batcher.Pending(), check.Equals, 0)
+}
+
+const (
+	benchBatchSize = 128
+	benchTables    = 10
+	benchDMLs      = 100000
+)
+
+// genHotTableWorkload generates the DMLs of benchTables tables, 90% of them are of the hot table `t0`.
+func genHotTableWorkload() []*DML {
+	dmls := make([]*DML, 0, benchDMLs)
+	for i := 0; i < benchDMLs; i++ {
+		table := "t0"
+		if i%10 == 9 {
+			table = fmt.Sprintf("t%d", (i/10)%(benchTables-1)+1)
+		}
+		dmls = append(dmls, newBatcherDML(table, i))
+	}
+	return dmls
+}
+
+// hotTableLatency records the count of DMLs added after each DML of the hot table until it's flushed.
+type hotTableLatency struct {
+	seqs  map[*DML]int
+	added int
+	waits []int
+}
+
+func newHotTableLatency(dmls []*DML) *hotTableLatency {
+	l := &hotTableLatency{seqs: make(map[*DML]int, len(dmls))}
+	for i, dml := range dmls {
+		l.seqs[dml] = i
+	}
+	return l
+}
+
+func (l *hotTableLatency) flushed(dmls []*DML) {
+	for _, dml := range dmls {
+		if dml.Table == "t0" {
+			l.waits = append(l.waits, l.added-l.seqs[dml])
+		}
+	}
+}
+
+func (l *hotTableLatency) report(b *testing.B) {
+	sort.Ints(l.waits)
+	b.ReportMetric(float64(l.waits[len(l.waits)*99/100]), "hot-p99-wait-dmls")
+}
+
+func BenchmarkDMLBatcherHotTable(b *testing.B) {
+	dmls := genHotTableWorkload()
+	var latency *hotTableLatency
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		latency = newHotTableLatency(dmls)
+		batcher := NewDMLBatcher(benchBatchSize, func(dmls []*DML) error {
+			latency.flushed(dmls)
+			return nil
+		})
+		for _, dml := range dmls {
+			latency.added++
+			if err := batcher.Add(dml); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := batcher.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	latency.report(b)
+}
+
+// BenchmarkBatchManagerHotTable batches the same workload as BenchmarkDMLBatcherHotTable like the loader does,
+// the DMLs of all tables are accumulated in one batch.
+func BenchmarkBatchManagerHotTable(b *testing.B) {
+	dmls := genHotTableWorkload()
+	var latency *hotTableLatency
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		latency = newHotTableLatency(dmls)
+		batch := &batchManager{
+			limit:          benchBatchSize,
+			enableDispatch: true,
+			fExecDMLs: func(dmls []*DML) error {
+				latency.flushed(dmls)
+				return nil
+			},
+		}
+		for _, dml := range dmls {
+			latency.added++
+			if err := batch.put(&Txn{DMLs: []*DML{dml}}); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := batch.execAccumulatedDMLs(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	latency.report(b)
+}
@@ -16,6 +16,7 @@ package loader
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 
@@ -55,6 +56,156 @@ func BenchmarkDeleteNoMerge(b *testing.B) {
 	benchmarkDelete(b, false)
 }
 
+func BenchmarkSameKeyUpdateGroupBy(b *testing.B) {
+	benchmarkSameKeyUpdate(b, true)
+}
+
+func BenchmarkSameKeyUpdateNoGroupBy(b *testing.B) {
+	benchmarkSameKeyUpdate(b, false)
+}
+
+func BenchmarkBulkDelete1000(b *testing.B) {
+	benchmarkBulkDelete(b, false)
+}
+
+func BenchmarkBulkDeleteUsingIN1000(b *testing.B) {
+	benchmarkBulkDelete(b, true)
+}
+
+// benchmarkBulkDelete deletes 1000 rows by primary key in one bulkDelete per op.
+func benchmarkBulkDelete(b *testing.B, usingIN bool) {
+	const n = 1000
+	db, err := getTestDB()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("drop table if exists test.test1"); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := db.Exec("create table test.test1(id int primary key, a1 int)"); err != nil {
+		b.Fatal(err)
+	}
+	info, err := getTableInfo(db, "test", "test1")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	insert := "insert into test.test1(id, a1) values " + holderString(n)
+	insert = strings.Replace(insert, "?", "(?,?)", -1)
+	var args []interface{}
+	var dmls []*DML
+	for i := 0; i < n; i++ {
+		args = append(args, i, i)
+		dmls = append(dmls, &DML{
+			Database: "test",
+			Table:    "test1",
+			Tp:       DeleteDMLType,
+			Values:   map[string]interface{}{"id": i, "a1": i},
+			info:     info,
+		})
+	}
+
+	e := newExecutor(db).withBulkDeleteUsingIN(usingIN)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if _, err := db.Exec(insert, args...); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		if err := e.bulkDelete(dmls); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSingleUpdate1000(b *testing.B) {
+	benchmarkSingleUpdate(b, false)
+}
+
+func BenchmarkSingleUpdateWithRowExistenceCheck1000(b *testing.B) {
+	benchmarkSingleUpdate(b, true)
+}
+
+// benchmarkSingleUpdate updates 1000 existing rows by primary key in one singleExec per op, to measure
+// the overhead of WithRowExistenceCheck.
+func benchmarkSingleUpdate(b *testing.B, check bool) {
+	const n = 1000
+	db, err := getTestDB()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("drop table if exists test.test1"); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := db.Exec("create table test.test1(id int primary key, a1 int)"); err != nil {
+		b.Fatal(err)
+	}
+	info, err := getTableInfo(db, "test", "test1")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	insert := "insert into test.test1(id, a1) values " + holderString(n)
+	insert = strings.Replace(insert, "?", "(?,?)", -1)
+	var args []interface{}
+	var dmls []*DML
+	for i := 0; i < n; i++ {
+		args = append(args, i, i)
+		dmls = append(dmls, &DML{
+			Database:  "test",
+			Table:     "test1",
+			Tp:        UpdateDMLType,
+			Values:    map[string]interface{}{"id": i, "a1": i + 1},
+			OldValues: map[string]interface{}{"id": i, "a1": i},
+			info:      info,
+		})
+	}
+	if _, err := db.Exec(insert, args...); err != nil {
+		b.Fatal(err)
+	}
+
+	e := newExecutor(db).withRowExistenceCheck(check)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := e.singleExec(dmls, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkSameKeyUpdate executes txns with 80% of the DMLs updating the same row,
+// the batch level merge is disabled to measure the merge of WithBatchGroupBy only.
+func benchmarkSameKeyUpdate(b *testing.B, groupBy bool) {
+	r, err := newRunner(false, WithBatchGroupBy(groupBy))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if err := dropTable(r.db, r.loader); err != nil {
+		b.Fatal(err)
+	}
+	if err := createTable(r.db, r.loader); err != nil {
+		b.Fatal(err)
+	}
+
+	if err := loadTable(r.db, r.loader, b.N); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	if err := updateSameKey(r.db, r.loader, b.N); err != nil {
+		b.Fatal(err)
+	}
+
+	r.close()
+}
+
 func benchmarkUpdate(b *testing.B, merge bool) {
 	r, err := newRunner(merge)
 	if err != nil {
@@ -132,13 +283,14 @@ type runner struct {
 	wg     sync.WaitGroup
 }
 
-func newRunner(merge bool) (r *runner, err error) {
+func newRunner(merge bool, opts ...Option) (r *runner, err error) {
 	db, err := getTestDB()
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	loader, err := NewLoader(db, WorkerCount(16), BatchSize(128))
+	opts = append([]Option{WorkerCount(16), BatchSize(128)}, opts...)
+	loader, err := NewLoader(db, opts...)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -241,6 +393,49 @@ func updateTable(db *sql.DB, loader Loader, n int) error {
 	return nil
 }
 
+// updateSameKey updates the row i 8 times and inserts 2 new rows in the i-th txn.
+func updateSameKey(db *sql.DB, loader Loader, n int) error {
+	var txns []*Txn
+	for i := 0; i < n; i++ {
+		txn := new(Txn)
+		for j := 0; j < 8; j++ {
+			dml := &DML{
+				Database: "test",
+				Table:    "test1",
+				Tp:       UpdateDMLType,
+				Values: map[string]interface{}{
+					"id": i,
+					"a1": i + j + 1,
+				},
+				OldValues: map[string]interface{}{
+					"id": i,
+					"a1": i + j,
+				},
+			}
+			txn.AppendDML(dml)
+		}
+		for j := 0; j < 2; j++ {
+			dml := &DML{
+				Database: "test",
+				Table:    "test1",
+				Tp:       InsertDMLType,
+				Values: map[string]interface{}{
+					"id": n + 2*i + j,
+					"a1": i,
+				},
+			}
+			txn.AppendDML(dml)
+		}
+		txns = append(txns, txn)
+	}
+
+	for _, txn := range txns {
+		loader.Input() <- txn
+	}
+
+	return nil
+}
+
 func deleteTable(db *sql.DB, loader Loader, n int) error {
 	var txns []*Txn
 	for i := 0; i < n; i++ {
@@ -0,0 +1,287 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// the max count of txns received by the caching loader but not sent to Successes yet
+const cachingLoaderQueueSize = 1024
+
+// cachingLoader skips the txns whose INSERT DMLs are all executed before, see NewCachingLoader.
+type cachingLoader struct {
+	inner     Loader
+	input     chan *Txn
+	successes chan *Txn
+	// the txns in the order of input, to be sent to successes in order
+	pending chan *pendingTxn
+	// closed when the inner loader quits
+	innerDone chan struct{}
+
+	cache *lruCache
+	// the generations of fingerprints, bumped to make the fingerprints computed before unreachable.
+	// only accessed by the goroutine reading input.
+	nextGen   uint64
+	ddlGen    uint64
+	tableGens map[string]uint64
+
+	hits   int64
+	misses int64
+}
+
+type pendingTxn struct {
+	txn *Txn
+	// the fingerprints of the INSERT DMLs of the txn to cache after it's executed
+	fingerprints []string
+	skipped      bool
+}
+
+var _ Loader = &cachingLoader{}
+
+// NewCachingLoader returns a Loader dropping the duplicate txns made of INSERT DMLs, like the ones replayed
+// by the retry storms of upstream. A txn is sent to Successes without being executed by inner if all the rows
+// inserted by it are inserted by the txns executed before with the same values, the fingerprints of which are
+// cached in an LRU cache of cacheSize. The fingerprints of a table are invalidated by the UPDATE and DELETE
+// DMLs of it, all of them are invalidated by DDLs. The order of txns sent to Successes is kept.
+func NewCachingLoader(inner Loader, cacheSize int) Loader {
+	return &cachingLoader{
+		inner:     inner,
+		input:     make(chan *Txn),
+		successes: make(chan *Txn),
+		pending:   make(chan *pendingTxn, cachingLoaderQueueSize),
+		innerDone: make(chan struct{}),
+		cache:     newLRUCache(cacheSize),
+		tableGens: make(map[string]uint64),
+	}
+}
+
+func (c *cachingLoader) SetSafeMode(safeMode bool) {
+	c.inner.SetSafeMode(safeMode)
+}
+
+func (c *cachingLoader) GetSafeMode() bool {
+	return c.inner.GetSafeMode()
+}
+
+func (c *cachingLoader) Input() chan<- *Txn {
+	return c.input
+}
+
+func (c *cachingLoader) Successes() <-chan *Txn {
+	return c.successes
+}
+
+// Close closes the Loader, no more Txn can be pushed into Input().
+func (c *cachingLoader) Close() {
+	close(c.input)
+}
+
+// Stats returns the statistics of the inner loader with the cache hits and misses.
+func (c *cachingLoader) Stats() LoaderStats {
+	stats := c.inner.Stats()
+	stats.CacheHits = atomic.LoadInt64(&c.hits)
+	stats.CacheMisses = atomic.LoadInt64(&c.misses)
+	return stats
+}
+
+func (c *cachingLoader) WorkerCount() int {
+	return c.inner.WorkerCount()
+}
+
+func (c *cachingLoader) SetWorkerCount(n int) error {
+	return c.inner.SetWorkerCount(n)
+}
+
+// Run runs the inner loader until it quits, the txns executed by it are sent to Successes in order with
+// the skipped ones.
+func (c *cachingLoader) Run() error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.dispatch()
+	}()
+	go c.readInput()
+
+	err := c.inner.Run()
+	close(c.innerDone)
+	wg.Wait()
+	close(c.successes)
+	return err
+}
+
+// readInput sends the txns not skipped to the inner loader, every txn is added to pending in order.
+func (c *cachingLoader) readInput() {
+	defer close(c.pending)
+	defer c.inner.Close()
+
+	for txn := range c.input {
+		p := c.newPendingTxn(txn)
+		if !p.skipped {
+			select {
+			case c.inner.Input() <- txn:
+			case <-c.innerDone:
+				return
+			}
+		}
+		select {
+		case c.pending <- p:
+		case <-c.innerDone:
+			return
+		}
+	}
+}
+
+// dispatch sends the pending txns to successes in order, it waits for the inner loader to execute
+// the ones not skipped.
+func (c *cachingLoader) dispatch() {
+	innerSuccesses := c.inner.Successes()
+	for p := range c.pending {
+		txn := p.txn
+		if !p.skipped {
+			var ok bool
+			txn, ok = <-innerSuccesses
+			if !ok {
+				return
+			}
+			for _, fp := range p.fingerprints {
+				c.cache.add(fp)
+			}
+		}
+		c.successes <- txn
+	}
+	// drain the inner loader, so it can quit
+	for txn := range innerSuccesses {
+		c.successes <- txn
+	}
+}
+
+// newPendingTxn returns the pendingTxn of txn, it's skipped if all the DMLs are INSERT and cached.
+func (c *cachingLoader) newPendingTxn(txn *Txn) *pendingTxn {
+	p := &pendingTxn{txn: txn}
+	if txn.DDL != nil {
+		c.ddlGen = c.newGeneration()
+		return p
+	}
+
+	allInserts := len(txn.DMLs) > 0
+	for _, dml := range txn.DMLs {
+		if dml.Tp != InsertDMLType {
+			allInserts = false
+			c.tableGens[dml.TableName()] = c.newGeneration()
+		}
+	}
+	if !allInserts {
+		return p
+	}
+
+	cached := true
+	for _, dml := range txn.DMLs {
+		fp := c.fingerprint(dml)
+		p.fingerprints = append(p.fingerprints, fp)
+		if cached && !c.cache.contains(fp) {
+			cached = false
+		}
+	}
+	if cached {
+		atomic.AddInt64(&c.hits, 1)
+		p.skipped = true
+	} else {
+		atomic.AddInt64(&c.misses, 1)
+	}
+	return p
+}
+
+func (c *cachingLoader) newGeneration() uint64 {
+	c.nextGen++
+	return c.nextGen
+}
+
+// fingerprint returns the hash of the table, values and the generations of the INSERT dml.
+func (c *cachingLoader) fingerprint(dml *DML) string {
+	table := dml.TableName()
+	columns := make([]string, 0, len(dml.Values))
+	for column := range dml.Values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	h := sha256.New()
+	var gens [16]byte
+	binary.BigEndian.PutUint64(gens[:8], c.ddlGen)
+	binary.BigEndian.PutUint64(gens[8:], c.tableGens[table])
+	h.Write(gens[:])
+	h.Write([]byte(table))
+	for _, column := range columns {
+		// the names and values are separated by the invalid UTF-8 byte
+		h.Write([]byte{0xff})
+		h.Write([]byte(column))
+		h.Write([]byte{0xff})
+		h.Write([]byte(valueString(dml.Values[column])))
+	}
+	return string(h.Sum(nil))
+}
+
+// lruCache is a set of strings evicting the least recently used one when it's full.
+type lruCache struct {
+	size int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) add(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return
+	}
+	if c.size <= 0 {
+		return
+	}
+	c.items[key] = c.ll.PushFront(key)
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(string))
+	}
+}
+
+func (c *lruCache) contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if ok {
+		c.ll.MoveToFront(e)
+	}
+	return ok
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type cachingLoaderSuite struct{}
+
+var _ = check.Suite(&cachingLoaderSuite{})
+
+// echoLoader records the txns and sends them to Successes.
+type echoLoader struct {
+	input     chan *Txn
+	successes chan *Txn
+	err       error
+
+	mu       sync.Mutex
+	executed []*Txn
+	safeMode bool
+}
+
+var _ Loader = &echoLoader{}
+
+func newEchoLoader() *echoLoader {
+	return &echoLoader{input: make(chan *Txn), successes: make(chan *Txn)}
+}
+
+func (l *echoLoader) Run() error {
+	defer close(l.successes)
+	for txn := range l.input {
+		if l.err != nil {
+			return l.err
+		}
+		l.mu.Lock()
+		l.executed = append(l.executed, txn)
+		l.mu.Unlock()
+		l.successes <- txn
+	}
+	return nil
+}
+
+func (l *echoLoader) executedTxns() []*Txn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*Txn(nil), l.executed...)
+}
+
+func (l *echoLoader) Close()                    { close(l.input) }
+func (l *echoLoader) Input() chan<- *Txn        { return l.input }
+func (l *echoLoader) Successes() <-chan *Txn    { return l.successes }
+func (l *echoLoader) Stats() LoaderStats        { return LoaderStats{TotalTxnsProcessed: 1} }
+func (l *echoLoader) SetSafeMode(safeMode bool) { l.safeMode = safeMode }
+func (l *echoLoader) GetSafeMode() bool         { return l.safeMode }
+func (l *echoLoader) WorkerCount() int          { return 1 }
+func (l *echoLoader) SetWorkerCount(int) error  { return nil }
+
+func newCachingTestTxn(tp DMLType, id int, name string, metadata int) *Txn {
+	return &Txn{
+		DMLs: []*DML{{Database: "test", Table: "users", Tp: tp,
+			Values: map[string]interface{}{"id": id, "name": name}}},
+		Metadata: metadata,
+	}
+}
+
+// runCachingLoader sends txns to a caching loader of inner one by one after the previous one succeeds,
+// and returns the metadata of the txns received from Successes in order.
+func runCachingLoader(c *check.C, inner Loader, txns ...*Txn) (Loader, []interface{}) {
+	ld := NewCachingLoader(inner, 16)
+	runErr := make(chan error, 1)
+	go func() { runErr <- ld.Run() }()
+
+	var metadata []interface{}
+	for _, txn := range txns {
+		ld.Input() <- txn
+		success := <-ld.Successes()
+		c.Assert(success, check.Equals, txn)
+		metadata = append(metadata, success.Metadata)
+	}
+	ld.Close()
+	c.Assert(<-runErr, check.IsNil)
+	_, ok := <-ld.Successes()
+	c.Assert(ok, check.IsFalse)
+	return ld, metadata
+}
+
+func (s *cachingLoaderSuite) TestKeepOrder(c *check.C) {
+	inner := newEchoLoader()
+	ld := NewCachingLoader(inner, 16)
+	runErr := make(chan error, 1)
+	go func() { runErr <- ld.Run() }()
+
+	ld.Input() <- newCachingTestTxn(InsertDMLType, 1, "a", 1)
+	c.Assert((<-ld.Successes()).Metadata, check.Equals, 1)
+
+	// the skipped txn is sent to Successes after the txns before it
+	go func() {
+		ld.Input() <- newCachingTestTxn(InsertDMLType, 2, "b", 2)
+		ld.Input() <- newCachingTestTxn(InsertDMLType, 1, "a", 3)
+		ld.Close()
+	}()
+	var metadata []interface{}
+	for txn := range ld.Successes() {
+		metadata = append(metadata, txn.Metadata)
+	}
+	c.Assert(<-runErr, check.IsNil)
+	c.Assert(metadata, check.DeepEquals, []interface{}{2, 3})
+	c.Assert(inner.executedTxns(), check.HasLen, 2)
+}
+
+func (s *cachingLoaderSuite) TestDeduplicateInsert(c *check.C) {
+	inner := newEchoLoader()
+	ld, metadata := runCachingLoader(c, inner,
+		newCachingTestTxn(InsertDMLType, 1, "a", 1),
+		newCachingTestTxn(InsertDMLType, 2, "b", 2),
+		// the duplicate inserts are skipped, but still sent to Successes in order
+		newCachingTestTxn(InsertDMLType, 1, "a", 3),
+		newCachingTestTxn(InsertDMLType, 2, "b", 4),
+		// the same primary key with different values is not skipped
+		newCachingTestTxn(InsertDMLType, 1, "c", 5),
+	)
+
+	c.Assert(metadata, check.DeepEquals, []interface{}{1, 2, 3, 4, 5})
+	var executed []interface{}
+	for _, txn := range inner.executedTxns() {
+		executed = append(executed, txn.Metadata)
+	}
+	c.Assert(executed, check.DeepEquals, []interface{}{1, 2, 5})
+
+	stats := ld.Stats()
+	c.Assert(stats.CacheHits, check.Equals, int64(2))
+	c.Assert(stats.CacheMisses, check.Equals, int64(3))
+	c.Assert(stats.TotalTxnsProcessed, check.Equals, int64(1))
+
+	ld.SetSafeMode(true)
+	c.Assert(inner.GetSafeMode(), check.IsTrue)
+	c.Assert(ld.GetSafeMode(), check.IsTrue)
+}
+
+func (s *cachingLoaderSuite) TestInvalidate(c *check.C) {
+	inner := newEchoLoader()
+	_, metadata := runCachingLoader(c, inner,
+		newCachingTestTxn(InsertDMLType, 1, "a", 1),
+		// the row inserted again after DELETE must not be skipped
+		newCachingTestTxn(DeleteDMLType, 1, "a", 2),
+		newCachingTestTxn(InsertDMLType, 1, "a", 3),
+		// nor after DDL
+		NewDDLTxn("test", "users", "TRUNCATE TABLE users"),
+		newCachingTestTxn(InsertDMLType, 1, "a", 5),
+		newCachingTestTxn(InsertDMLType, 1, "a", 6),
+	)
+
+	c.Assert(metadata, check.DeepEquals, []interface{}{1, 2, 3, nil, 5, 6})
+	c.Assert(inner.executedTxns(), check.HasLen, 5)
+}
+
+func (s *cachingLoaderSuite) TestInnerFailed(c *check.C) {
+	inner := newEchoLoader()
+	inner.err = errors.New("downstream is gone")
+	ld := NewCachingLoader(inner, 16)
+	runErr := make(chan error, 1)
+	go func() { runErr <- ld.Run() }()
+
+	ld.Input() <- newCachingTestTxn(InsertDMLType, 1, "a", 1)
+	c.Assert(<-runErr, check.ErrorMatches, "downstream is gone")
+	_, ok := <-ld.Successes()
+	c.Assert(ok, check.IsFalse)
+}
+
+func (s *cachingLoaderSuite) TestLRUCache(c *check.C) {
+	cache := newLRUCache(2)
+	cache.add("a")
+	cache.add("b")
+	c.Assert(cache.contains("a"), check.IsTrue)
+	// b is the least recently used one
+	cache.add("c")
+	c.Assert(cache.contains("b"), check.IsFalse)
+	c.Assert(cache.contains("a"), check.IsTrue)
+	c.Assert(cache.contains("c"), check.IsTrue)
+
+	cache = newLRUCache(0)
+	cache.add("a")
+	c.Assert(cache.contains("a"), check.IsFalse)
+}
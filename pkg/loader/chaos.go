@@ -0,0 +1,128 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+)
+
+// ErrChaosInjected is the error injected by the chaos middleware.
+var ErrChaosInjected = errors.New("chaos: injected failure")
+
+// ChaosConfig is the config of the faults injected by the chaos middleware.
+type ChaosConfig struct {
+	// FailureProbability is the probability in [0, 1] to fail an execution.
+	FailureProbability float64
+	// LatencyP50 and LatencyP99 are the percentiles of the delay injected before every execution.
+	LatencyP50 time.Duration
+	LatencyP99 time.Duration
+	// FailAfterN makes the first N executions never fail.
+	FailAfterN int
+	// Seed of the random source, a time based seed is used if it's 0.
+	Seed int64
+}
+
+// NewChaosMiddleware injects random errors or delays to the executions of DMLs by the inner loader,
+// which should be a Loader returned by NewLoader and not running yet. The DDLs are not affected.
+// It's only used to test the retry logic.
+func NewChaosMiddleware(inner Loader, cfg ChaosConfig) Loader {
+	ld, ok := inner.(*loaderImpl)
+	if !ok {
+		log.Warn("chaos middleware only works with the loader created by NewLoader, ignore it")
+		return inner
+	}
+
+	ld.chaos = newChaos(cfg)
+	return ld
+}
+
+type chaos struct {
+	cfg ChaosConfig
+
+	mu         sync.Mutex
+	rand       *rand.Rand
+	executions int
+	failures   int
+}
+
+func newChaos(cfg ChaosConfig) *chaos {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if cfg.LatencyP99 < cfg.LatencyP50 {
+		cfg.LatencyP99 = cfg.LatencyP50
+	}
+
+	return &chaos{
+		cfg:  cfg,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// inject sleeps for a random delay and returns ErrChaosInjected by the FailureProbability.
+func (c *chaos) inject() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	c.executions++
+	delay := c.delay()
+	fail := c.executions > c.cfg.FailAfterN && c.rand.Float64() < c.cfg.FailureProbability
+	if fail {
+		c.failures++
+	}
+	c.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if fail {
+		return ErrChaosInjected
+	}
+	return nil
+}
+
+// delay returns a random delay whose median is LatencyP50 and 99th percentile is LatencyP99,
+// it's uniformly distributed between the percentiles and at most 2 * LatencyP99.
+func (c *chaos) delay() time.Duration {
+	if c.cfg.LatencyP99 <= 0 {
+		return 0
+	}
+
+	p50, p99 := float64(c.cfg.LatencyP50), float64(c.cfg.LatencyP99)
+	u := c.rand.Float64()
+	switch {
+	case u < 0.5:
+		return time.Duration(p50 * u / 0.5)
+	case u < 0.99:
+		return time.Duration(p50 + (p99-p50)*(u-0.5)/0.49)
+	default:
+		return time.Duration(p99 * (1 + (u-0.99)/0.01))
+	}
+}
+
+// stats returns the count of executions and injected failures.
+func (c *chaos) stats() (executions int, failures int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.executions, c.failures
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+)
+
+type chaosSuite struct{}
+
+var _ = check.Suite(&chaosSuite{})
+
+func (s *chaosSuite) TestInject(c *check.C) {
+	var nilChaos *chaos
+	c.Assert(nilChaos.inject(), check.IsNil)
+
+	ch := newChaos(ChaosConfig{FailureProbability: 1, FailAfterN: 2})
+	c.Assert(ch.inject(), check.IsNil)
+	c.Assert(ch.inject(), check.IsNil)
+	c.Assert(ch.inject(), check.Equals, ErrChaosInjected)
+	c.Assert(ch.inject(), check.Equals, ErrChaosInjected)
+	executions, failures := ch.stats()
+	c.Assert(executions, check.Equals, 4)
+	c.Assert(failures, check.Equals, 2)
+
+	ch = newChaos(ChaosConfig{FailureProbability: 0})
+	for i := 0; i < 100; i++ {
+		c.Assert(ch.inject(), check.IsNil)
+	}
+}
+
+func (s *chaosSuite) TestDelay(c *check.C) {
+	p50, p99 := 10*time.Millisecond, 100*time.Millisecond
+	ch := newChaos(ChaosConfig{LatencyP50: p50, LatencyP99: p99, Seed: 1})
+
+	delays := make([]time.Duration, 10000)
+	for i := range delays {
+		delays[i] = ch.delay()
+		c.Assert(delays[i] <= 2*p99, check.IsTrue)
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+	median, pct99 := delays[len(delays)/2], delays[len(delays)*99/100]
+	c.Assert(median > p50*9/10 && median < p50*11/10, check.IsTrue, check.Commentf("median %v", median))
+	c.Assert(pct99 > p99*9/10 && pct99 < p99*11/10, check.IsTrue, check.Commentf("p99 %v", pct99))
+
+	c.Assert(newChaos(ChaosConfig{}).delay(), check.Equals, time.Duration(0))
+}
+
+func (s *chaosSuite) TestNewChaosMiddleware(c *check.C) {
+	// other loaders are returned as is
+	var other Loader = &struct{ Loader }{}
+	c.Assert(NewChaosMiddleware(other, ChaosConfig{FailureProbability: 1}), check.Equals, other)
+}
+
+func (s *chaosSuite) TestLoaderRetryWithChaos(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	ldi, err := NewLoader(db, EnableDispatch(false), WithWarmUp(false))
+	c.Assert(err, check.IsNil)
+	ld := ldi.(*loaderImpl)
+	ld.getTableInfoFromDB = func(db *sql.DB, schema string, table string) (*tableInfo, error) {
+		return &tableInfo{columns: []string{"id"}}, nil
+	}
+	// the first execution fails and the second succeeds with this seed
+	ldi = NewChaosMiddleware(ldi, ChaosConfig{FailureProbability: 0.5, Seed: 6})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO .*").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- ldi.Run()
+	}()
+
+	txn := &Txn{DMLs: []*DML{{Database: "test", Table: "test", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1}}}}
+	ldi.Input() <- txn
+	select {
+	case success := <-ldi.Successes():
+		c.Assert(success, check.Equals, txn)
+	case <-time.After(5 * time.Second):
+		c.Fatal("txn is not executed after retry")
+	}
+	ldi.Close()
+	c.Assert(<-runErr, check.IsNil)
+
+	executions, failures := ld.chaos.stats()
+	c.Assert(executions, check.Equals, 2)
+	c.Assert(failures, check.Equals, 1)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
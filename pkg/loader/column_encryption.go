@@ -0,0 +1,236 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"strconv"
+
+	"github.com/pingcap/errors"
+)
+
+// the type of the encrypted value is saved in the first byte of the plaintext, so it can be restored by DecryptDML.
+const (
+	encryptedBytes  byte = 'b'
+	encryptedString byte = 's'
+	encryptedInt    byte = 'i'
+	encryptedUint   byte = 'u'
+	encryptedFloat  byte = 'f'
+)
+
+// columnEncryptor encrypts the values of columns by AES-256-GCM, the ciphertext is the nonce followed by
+// the sealed value, and `schema.table.column` is authenticated as the additional data.
+type columnEncryptor struct {
+	aeads map[string]cipher.AEAD
+	// the error of creating the ciphers, returned by NewLoader
+	err error
+}
+
+func newColumnEncryptor(colKey map[string][]byte) (*columnEncryptor, error) {
+	aeads := make(map[string]cipher.AEAD, len(colKey))
+	for column, key := range colKey {
+		if len(key) != 32 {
+			return nil, errors.Errorf("the key of column %s must be 32 bytes for AES-256, got %d bytes", column, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Annotatef(err, "create cipher for column %s", column)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Annotatef(err, "create cipher for column %s", column)
+		}
+		aeads[column] = aead
+	}
+	return &columnEncryptor{aeads: aeads}, nil
+}
+
+func encryptionKey(dml *DML, column string) string {
+	return dml.Database + "." + dml.Table + "." + column
+}
+
+// encryptValue returns the encrypted v if the column of dml is encrypted, otherwise v itself.
+// NULL is not encrypted.
+func (c *columnEncryptor) encryptValue(dml *DML, column string, v interface{}) (interface{}, error) {
+	if c == nil || v == nil {
+		return v, nil
+	}
+	key := encryptionKey(dml, column)
+	aead, ok := c.aeads[key]
+	if !ok {
+		return v, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Annotatef(err, "generate nonce for column %s", key)
+	}
+	return aead.Seal(nonce, nonce, encodeEncryptedValue(v), []byte(key)), nil
+}
+
+// isEncrypted returns whether the column of dml is encrypted.
+func (c *columnEncryptor) isEncrypted(dml *DML, column string) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.aeads[encryptionKey(dml, column)]
+	return ok
+}
+
+// encryptDML returns a copy of dml with the values of encrypted columns encrypted, dml itself is returned
+// if none of its columns is encrypted. The values of DELETE and the OldValues are kept as is, and the encrypted
+// columns are left out of the WHERE clause, since the stored ciphertexts can't be matched by them.
+func (c *columnEncryptor) encryptDML(dml *DML) (*DML, error) {
+	if c == nil {
+		return dml, nil
+	}
+
+	var values map[string]interface{}
+	var encryptedColumns map[string]struct{}
+	for column, v := range dml.Values {
+		if _, ok := c.aeads[encryptionKey(dml, column)]; !ok {
+			continue
+		}
+		if encryptedColumns == nil {
+			encryptedColumns = make(map[string]struct{})
+		}
+		encryptedColumns[column] = struct{}{}
+		if v == nil || dml.Tp == DeleteDMLType {
+			continue
+		}
+		encrypted, err := c.encryptValue(dml, column, v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if values == nil {
+			values = make(map[string]interface{}, len(dml.Values))
+			for k, v := range dml.Values {
+				values[k] = v
+			}
+		}
+		values[column] = encrypted
+	}
+	if encryptedColumns == nil {
+		return dml, nil
+	}
+
+	encrypted := *dml
+	if values != nil {
+		encrypted.Values = values
+	}
+	encrypted.encryptedColumns = encryptedColumns
+	return &encrypted, nil
+}
+
+func encodeEncryptedValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return append([]byte{encryptedBytes}, v...)
+	case string:
+		return append([]byte{encryptedString}, v...)
+	case int:
+		return strconv.AppendInt([]byte{encryptedInt}, int64(v), 10)
+	case int8:
+		return strconv.AppendInt([]byte{encryptedInt}, int64(v), 10)
+	case int16:
+		return strconv.AppendInt([]byte{encryptedInt}, int64(v), 10)
+	case int32:
+		return strconv.AppendInt([]byte{encryptedInt}, int64(v), 10)
+	case int64:
+		return strconv.AppendInt([]byte{encryptedInt}, v, 10)
+	case uint:
+		return strconv.AppendUint([]byte{encryptedUint}, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint([]byte{encryptedUint}, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint([]byte{encryptedUint}, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint([]byte{encryptedUint}, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint([]byte{encryptedUint}, v, 10)
+	case float32:
+		return strconv.AppendFloat([]byte{encryptedFloat}, float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.AppendFloat([]byte{encryptedFloat}, v, 'g', -1, 64)
+	default:
+		return append([]byte{encryptedString}, valueString(v)...)
+	}
+}
+
+func decodeEncryptedValue(plaintext []byte) (interface{}, error) {
+	if len(plaintext) == 0 {
+		return nil, errors.New("empty plaintext")
+	}
+	payload := plaintext[1:]
+	switch plaintext[0] {
+	case encryptedBytes:
+		return payload, nil
+	case encryptedString:
+		return string(payload), nil
+	case encryptedInt:
+		v, err := strconv.ParseInt(string(payload), 10, 64)
+		return v, errors.Trace(err)
+	case encryptedUint:
+		v, err := strconv.ParseUint(string(payload), 10, 64)
+		return v, errors.Trace(err)
+	case encryptedFloat:
+		v, err := strconv.ParseFloat(string(payload), 64)
+		return v, errors.Trace(err)
+	default:
+		return nil, errors.Errorf("unknown type %q of encrypted value", plaintext[0])
+	}
+}
+
+// DecryptDML decrypts the Values of dml encrypted by the loader created with WithColumnEncryption(colKey) in place,
+// like the DMLs read back from downstream. The integers are restored as int64 or uint64, the floats as float64.
+func DecryptDML(dml *DML, colKey map[string][]byte) error {
+	c, err := newColumnEncryptor(colKey)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for column, v := range dml.Values {
+		key := encryptionKey(dml, column)
+		aead, ok := c.aeads[key]
+		if !ok || v == nil {
+			continue
+		}
+
+		var ciphertext []byte
+		switch v := v.(type) {
+		case []byte:
+			ciphertext = v
+		case string:
+			ciphertext = []byte(v)
+		default:
+			return errors.Errorf("the encrypted value of column %s is %T, not bytes", key, v)
+		}
+		if len(ciphertext) < aead.NonceSize() {
+			return errors.Errorf("the encrypted value of column %s is too short", key)
+		}
+
+		nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, sealed, []byte(key))
+		if err != nil {
+			return errors.Annotatef(err, "decrypt column %s", key)
+		}
+		if dml.Values[column], err = decodeEncryptedValue(plaintext); err != nil {
+			return errors.Annotatef(err, "decode column %s", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"reflect"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type columnEncryptionSuite struct{}
+
+var _ = Suite(&columnEncryptionSuite{})
+
+var testColumnKeys = map[string][]byte{
+	"db.users.name":  bytes.Repeat([]byte{1}, 32),
+	"db.users.age":   bytes.Repeat([]byte{2}, 32),
+	"db.users.photo": bytes.Repeat([]byte{3}, 32),
+}
+
+// decryptedArg matches the encrypted arg whose decrypted value equals to value.
+type decryptedArg struct {
+	column string
+	value  interface{}
+}
+
+func (a decryptedArg) Match(v driver.Value) bool {
+	dml := &DML{Database: "db", Table: "users", Values: map[string]interface{}{a.column: v}}
+	if err := DecryptDML(dml, testColumnKeys); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(dml.Values[a.column], a.value)
+}
+
+func (s *columnEncryptionSuite) newDML() *DML {
+	return &DML{
+		Database: "db",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values: map[string]interface{}{
+			"id":    1,
+			"name":  "tester",
+			"age":   int64(-20),
+			"photo": []byte{0, 1, 2},
+		},
+		info: &tableInfo{columns: []string{"id", "name", "age", "photo"}},
+	}
+}
+
+func (s *columnEncryptionSuite) TestRoundTrip(c *C) {
+	enc, err := newColumnEncryptor(testColumnKeys)
+	c.Assert(err, IsNil)
+
+	dml := s.newDML()
+	encrypted, err := enc.encryptDML(dml)
+	c.Assert(err, IsNil)
+
+	// the original DML is not changed, so it can be retried
+	c.Assert(dml.Values["name"], Equals, "tester")
+	c.Assert(encrypted.Values["id"], Equals, 1)
+	for _, column := range []string{"name", "age", "photo"} {
+		c.Assert(encrypted.Values[column], FitsTypeOf, []byte{})
+	}
+
+	c.Assert(DecryptDML(encrypted, testColumnKeys), IsNil)
+	c.Assert(encrypted.Values, DeepEquals, map[string]interface{}{
+		"id":    1,
+		"name":  "tester",
+		"age":   int64(-20),
+		"photo": []byte{0, 1, 2},
+	})
+
+	// unsigned integers and NULL
+	dml.Values = map[string]interface{}{"age": uint64(1 << 63), "name": nil}
+	encrypted, err = enc.encryptDML(dml)
+	c.Assert(err, IsNil)
+	c.Assert(encrypted.Values["name"], IsNil)
+	c.Assert(DecryptDML(encrypted, testColumnKeys), IsNil)
+	c.Assert(encrypted.Values, DeepEquals, map[string]interface{}{"age": uint64(1 << 63), "name": nil})
+}
+
+func (s *columnEncryptionSuite) TestNonDeterministic(c *C) {
+	enc, err := newColumnEncryptor(testColumnKeys)
+	c.Assert(err, IsNil)
+
+	dml := s.newDML()
+	v1, err := enc.encryptValue(dml, "name", "tester")
+	c.Assert(err, IsNil)
+	v2, err := enc.encryptValue(dml, "name", "tester")
+	c.Assert(err, IsNil)
+	c.Assert(v1, Not(DeepEquals), v2)
+}
+
+func (s *columnEncryptionSuite) TestDecryptFailed(c *C) {
+	enc, err := newColumnEncryptor(testColumnKeys)
+	c.Assert(err, IsNil)
+	encrypted, err := enc.encryptDML(s.newDML())
+	c.Assert(err, IsNil)
+
+	// the ciphertext of a column can't be decrypted as another one
+	encrypted.Values["age"] = encrypted.Values["name"]
+	c.Assert(DecryptDML(encrypted, testColumnKeys), ErrorMatches, ".*decrypt column db.users.age.*")
+
+	// wrong key
+	keys := map[string][]byte{"db.users.name": bytes.Repeat([]byte{9}, 32)}
+	encrypted, err = enc.encryptDML(s.newDML())
+	c.Assert(err, IsNil)
+	c.Assert(DecryptDML(encrypted, keys), ErrorMatches, ".*decrypt column db.users.name.*")
+}
+
+func (s *columnEncryptionSuite) TestInvalidKey(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, WithWarmUp(false), WithColumnEncryption(map[string][]byte{"db.users.name": []byte("short")}))
+	c.Assert(err, ErrorMatches, ".*must be 32 bytes.*")
+}
+
+func (s *columnEncryptionSuite) TestBulkReplace(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	enc, err := newColumnEncryptor(testColumnKeys)
+	c.Assert(err, IsNil)
+	e := newExecutor(db).withColumnEncryptor(enc)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`users`(`id`,`name`,`age`,`photo`) VALUES (?,?,?,?)")).
+		WithArgs(1, decryptedArg{"name", "tester"}, decryptedArg{"age", int64(-20)}, decryptedArg{"photo", []byte{0, 1, 2}}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c.Assert(e.bulkReplace([]*DML{s.newDML()}), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *columnEncryptionSuite) TestSingleExec(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	enc, err := newColumnEncryptor(testColumnKeys)
+	c.Assert(err, IsNil)
+	e := newExecutor(db).withColumnEncryptor(enc)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`users`(`age`,`id`,`name`,`photo`) VALUES(?,?,?,?)")).
+		WithArgs(decryptedArg{"age", int64(-20)}, 1, decryptedArg{"name", "tester"}, decryptedArg{"photo", []byte{0, 1, 2}}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c.Assert(e.singleExec([]*DML{s.newDML()}, true), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *columnEncryptionSuite) TestLocateRows(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	enc, err := newColumnEncryptor(testColumnKeys)
+	c.Assert(err, IsNil)
+	e := newExecutor(db).withColumnEncryptor(enc)
+
+	// the encrypted columns are left out of the WHERE clause since the stored values are encrypted with random nonces
+	del := s.newDML()
+	del.Tp = DeleteDMLType
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`users` WHERE `id` = ? LIMIT 1")).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.bulkDelete([]*DML{del}), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the unique key with encrypted columns isn't used
+	del.info = &tableInfo{
+		columns:    del.info.columns,
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"name"}}},
+	}
+	del.info.primaryKey = &del.info.uniqueKeys[0]
+	e.deleteUsingIN = true
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`users` WHERE `id` = ? LIMIT 1")).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.bulkDelete([]*DML{del}), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the values of DELETE aren't encrypted by singleExec
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`users` WHERE `id` = ? LIMIT 1")).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.singleExec([]*DML{del}, false), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	update := s.newDML()
+	update.Tp = UpdateDMLType
+	update.OldValues = map[string]interface{}{"id": 1, "name": "old", "age": int64(-20), "photo": []byte{0, 1, 2}}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `db`.`users` SET `age` = ?,`id` = ?,`name` = ?,`photo` = ? WHERE `id` = ? LIMIT 1")).
+		WithArgs(decryptedArg{"age", int64(-20)}, 1, decryptedArg{"name", "tester"}, decryptedArg{"photo", []byte{0, 1, 2}}, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.singleExec([]*DML{update}, false), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// MaskFunc returns the masked value of a column written to downstream instead of the original one,
+// it's never called with NULL.
+type MaskFunc func(v interface{}) interface{}
+
+// SHA256Mask returns a MaskFunc replacing the value by the hex encoded SHA-256 hash of it.
+func SHA256Mask() MaskFunc {
+	return func(v interface{}) interface{} {
+		sum := sha256.Sum256(maskInput(v))
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// MD5Mask returns a MaskFunc replacing the value by the hex encoded MD5 hash of it.
+func MD5Mask() MaskFunc {
+	return func(v interface{}) interface{} {
+		sum := md5.Sum(maskInput(v))
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// NullMask returns a MaskFunc replacing the value by NULL.
+func NullMask() MaskFunc {
+	return func(interface{}) interface{} {
+		return nil
+	}
+}
+
+// maskInput returns the bytes of v to be hashed, the other types are formatted like the values in SQL.
+func maskInput(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return []byte(valueString(v))
+	}
+}
+
+// columnMasker masks the values of columns by the MaskFunc of `schema.table.column`.
+type columnMasker struct {
+	masks map[string]MaskFunc
+}
+
+func newColumnMasker(mask map[string]MaskFunc) *columnMasker {
+	if len(mask) == 0 {
+		return nil
+	}
+	masks := make(map[string]MaskFunc, len(mask))
+	for column, fn := range mask {
+		masks[column] = fn
+	}
+	return &columnMasker{masks: masks}
+}
+
+// maskValue returns the masked v if the column of dml is masked, otherwise v itself. NULL is not masked.
+func (m *columnMasker) maskValue(dml *DML, column string, v interface{}) interface{} {
+	if m == nil || v == nil {
+		return v
+	}
+	fn, ok := m.masks[encryptionKey(dml, column)]
+	if !ok {
+		return v
+	}
+	return fn(v)
+}
+
+// maskDML returns a copy of dml with both the Values and OldValues of the masked columns masked,
+// so the rows written with the masked values can be located by the UPDATE and DELETE statements.
+// dml itself is returned if none of its columns is masked.
+func (m *columnMasker) maskDML(dml *DML) *DML {
+	if m == nil {
+		return dml
+	}
+
+	values, valuesMasked := m.maskValues(dml, dml.Values)
+	oldValues, oldValuesMasked := m.maskValues(dml, dml.OldValues)
+	if !valuesMasked && !oldValuesMasked {
+		return dml
+	}
+
+	masked := *dml
+	masked.Values = values
+	masked.OldValues = oldValues
+	return &masked
+}
+
+// maskValues returns a copy of values with the masked columns masked, values itself is returned
+// if none of its columns is masked.
+func (m *columnMasker) maskValues(dml *DML, values map[string]interface{}) (map[string]interface{}, bool) {
+	var masked map[string]interface{}
+	for column, v := range values {
+		if _, ok := m.masks[encryptionKey(dml, column)]; !ok || v == nil {
+			continue
+		}
+		if masked == nil {
+			masked = make(map[string]interface{}, len(values))
+			for k, v := range values {
+				masked[k] = v
+			}
+		}
+		masked[column] = m.maskValue(dml, column, v)
+	}
+	if masked == nil {
+		return values, false
+	}
+	return masked, true
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type columnMaskingSuite struct{}
+
+var _ = Suite(&columnMaskingSuite{})
+
+const (
+	// sha256("abc")
+	abcSHA256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	// md5("abc")
+	abcMD5 = "900150983cd24fb0d6963f7d28e17f72"
+)
+
+func (s *columnMaskingSuite) TestMaskFuncs(c *C) {
+	c.Assert(SHA256Mask()("abc"), Equals, abcSHA256)
+	c.Assert(SHA256Mask()([]byte("abc")), Equals, abcSHA256)
+	c.Assert(MD5Mask()("abc"), Equals, abcMD5)
+	c.Assert(MD5Mask()([]byte("abc")), Equals, abcMD5)
+	// the other types are hashed as they're formatted in SQL
+	c.Assert(SHA256Mask()(int64(123)), Equals, SHA256Mask()("123"))
+	c.Assert(MD5Mask()(uint8(7)), Equals, MD5Mask()("7"))
+	c.Assert(NullMask()("abc"), IsNil)
+}
+
+func (s *columnMaskingSuite) TestMaskDML(c *C) {
+	m := newColumnMasker(map[string]MaskFunc{
+		"db.users.email": SHA256Mask(),
+		"db.users.phone": NullMask(),
+	})
+	dml := &DML{
+		Database:  "db",
+		Table:     "users",
+		Tp:        UpdateDMLType,
+		Values:    map[string]interface{}{"id": 1, "email": "abc", "phone": "123"},
+		OldValues: map[string]interface{}{"id": 1, "email": "abc", "phone": nil},
+	}
+	masked := m.maskDML(dml)
+	c.Assert(masked.Values, DeepEquals, map[string]interface{}{"id": 1, "email": abcSHA256, "phone": nil})
+	c.Assert(masked.OldValues, DeepEquals, map[string]interface{}{"id": 1, "email": abcSHA256, "phone": nil})
+	// the original DML is not changed, so it can be retried
+	c.Assert(dml.Values["email"], Equals, "abc")
+
+	// not masked
+	other := &DML{Database: "db", Table: "orders", Values: map[string]interface{}{"email": "abc"}}
+	c.Assert(m.maskDML(other), Equals, other)
+	c.Assert(newColumnMasker(nil).maskDML(other), Equals, other)
+}
+
+func (s *columnMaskingSuite) newDML() *DML {
+	info := &tableInfo{
+		columns:    []string{"email", "name", "ssn"},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"email"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+	return &DML{
+		Database: "db",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"email": "abc", "name": "tester", "ssn": "123-45-6789"},
+		info:     info,
+	}
+}
+
+func (s *columnMaskingSuite) newExecutor(c *C) (*executor, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	m := newColumnMasker(map[string]MaskFunc{
+		"db.users.email": SHA256Mask(),
+		"db.users.ssn":   NullMask(),
+	})
+	return newExecutor(db).withColumnMasker(m), mock
+}
+
+func (s *columnMaskingSuite) TestBulkReplace(c *C) {
+	e, mock := s.newExecutor(c)
+	defer e.db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`users`(`email`,`name`,`ssn`) VALUES (?,?,?)")).
+		WithArgs(abcSHA256, "tester", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c.Assert(e.bulkReplace([]*DML{s.newDML()}), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *columnMaskingSuite) TestPrimaryKey(c *C) {
+	e, mock := s.newExecutor(c)
+	defer e.db.Close()
+
+	// the rows written with the masked primary key are located by the masked value
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`users` WHERE `email` = ? LIMIT 1")).
+		WithArgs(abcSHA256).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	del := s.newDML()
+	del.Tp = DeleteDMLType
+	c.Assert(e.bulkDelete([]*DML{del}), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	e.deleteUsingIN = true
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`users` WHERE `email` IN (?)")).
+		WithArgs(abcSHA256).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.bulkDelete([]*DML{del}), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	update := s.newDML()
+	update.Tp = UpdateDMLType
+	update.OldValues = map[string]interface{}{"email": "abc", "name": "old", "ssn": "123-45-6789"}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `db`.`users` SET `email` = ?,`name` = ?,`ssn` = ? WHERE `email` = ? LIMIT 1")).
+		WithArgs(abcSHA256, "tester", nil, abcSHA256).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.singleExec([]*DML{update}, false), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *columnMaskingSuite) TestLocateByAllColumns(c *C) {
+	e, mock := s.newExecutor(c)
+	defer e.db.Close()
+
+	// the WHERE values of the table without unique key are the same as the stored ones
+	dml := s.newDML()
+	dml.info.uniqueKeys, dml.info.primaryKey = nil, nil
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`users`(`email`,`name`,`ssn`) VALUES (?,?,?)")).
+		WithArgs(abcSHA256, "tester", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.bulkReplace([]*DML{dml}), IsNil)
+
+	dml.Tp = DeleteDMLType
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`users` WHERE `email` = ? AND `name` = ? AND `ssn` IS NULL LIMIT 1")).
+		WithArgs(abcSHA256, "tester").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.bulkDelete([]*DML{dml}), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sort"
+
+	"github.com/pingcap/errors"
+)
+
+// absentValue marks the column absent from the values of a DML, it's different from a NULL value.
+type absentValue struct{}
+
+// ColumnarBatch is a batch of DMLs of the same table and type in column-major order,
+// values[i][j] is the value of columns[i] in the j-th DML.
+type ColumnarBatch struct {
+	Database string
+	Table    string
+	Tp       DMLType
+
+	columns []string
+	values  [][]interface{}
+	// only set when Tp = UpdateDMLType
+	oldValues [][]interface{}
+	rows      int
+
+	info *tableInfo
+}
+
+// NewColumnarBatch converts the DMLs of the same table and type to a ColumnarBatch, the columns are the ones
+// present in any of the DMLs, in the order of the table if the table info is known.
+func NewColumnarBatch(dmls []*DML) (*ColumnarBatch, error) {
+	if len(dmls) == 0 {
+		return nil, errors.New("no DMLs to build the columnar batch")
+	}
+	first := dmls[0]
+	for _, dml := range dmls[1:] {
+		if dml.Database != first.Database || dml.Table != first.Table || dml.Tp != first.Tp {
+			return nil, errors.Errorf("the DMLs of the columnar batch must be of the same table and type, got %s and %s",
+				first, dml)
+		}
+	}
+
+	b := newColumnarBatch(dmls, batchColumns(dmls))
+	if first.Tp == UpdateDMLType {
+		b.oldValues = extractColumns(dmls, b.columns, func(dml *DML) map[string]interface{} { return dml.OldValues })
+	}
+	return b, nil
+}
+
+// newColumnarBatch extracts the values of the columns from the DMLs, which are of the same table and type.
+func newColumnarBatch(dmls []*DML, columns []string) *ColumnarBatch {
+	first := dmls[0]
+	return &ColumnarBatch{
+		Database: first.Database,
+		Table:    first.Table,
+		Tp:       first.Tp,
+		columns:  columns,
+		values:   extractColumns(dmls, columns, func(dml *DML) map[string]interface{} { return dml.Values }),
+		rows:     len(dmls),
+		info:     first.info,
+	}
+}
+
+func extractColumns(dmls []*DML, columns []string, rowValues func(*DML) map[string]interface{}) [][]interface{} {
+	values := make([][]interface{}, len(columns))
+	for i, name := range columns {
+		column := make([]interface{}, len(dmls))
+		for j, dml := range dmls {
+			v, ok := rowValues(dml)[name]
+			if !ok {
+				v = absentValue{}
+			}
+			column[j] = v
+		}
+		values[i] = column
+	}
+	return values
+}
+
+// batchColumns returns the columns present in any of the DMLs, the ones in the table info come first
+// in the order of the table, and the others are sorted by name.
+func batchColumns(dmls []*DML) []string {
+	present := make(map[string]struct{})
+	for _, dml := range dmls {
+		for name := range dml.Values {
+			present[name] = struct{}{}
+		}
+		for name := range dml.OldValues {
+			present[name] = struct{}{}
+		}
+	}
+
+	columns := make([]string, 0, len(present))
+	if info := dmls[0].info; info != nil {
+		for _, name := range info.columns {
+			if _, ok := present[name]; ok {
+				columns = append(columns, name)
+				delete(present, name)
+			}
+		}
+	}
+	others := make([]string, 0, len(present))
+	for name := range present {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	return append(columns, others...)
+}
+
+// Columns returns the names of the columns of the batch.
+func (b *ColumnarBatch) Columns() []string {
+	return b.columns
+}
+
+// Len returns the number of DMLs in the batch.
+func (b *ColumnarBatch) Len() int {
+	return b.rows
+}
+
+// ToDMLs converts the batch back to the DMLs in the row-major order.
+func (b *ColumnarBatch) ToDMLs() []*DML {
+	dmls := make([]*DML, b.rows)
+	for j := range dmls {
+		dml := &DML{
+			Database: b.Database,
+			Table:    b.Table,
+			Tp:       b.Tp,
+			Values:   rowOf(b.columns, b.values, j),
+			info:     b.info,
+		}
+		if b.oldValues != nil {
+			dml.OldValues = rowOf(b.columns, b.oldValues, j)
+		}
+		dmls[j] = dml
+	}
+	return dmls
+}
+
+func rowOf(columns []string, values [][]interface{}, row int) map[string]interface{} {
+	m := make(map[string]interface{}, len(columns))
+	for i, name := range columns {
+		v := values[i][row]
+		if _, absent := v.(absentValue); !absent {
+			m[name] = v
+		}
+	}
+	return m
+}
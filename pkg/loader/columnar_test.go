@@ -0,0 +1,134 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+)
+
+type columnarSuite struct{}
+
+var _ = check.Suite(&columnarSuite{})
+
+func (s *columnarSuite) TestRoundTrip(c *check.C) {
+	info := &tableInfo{columns: []string{"name", "id"}}
+	dmls := []*DML{
+		{Database: "test", Table: "users", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": "a"}, info: info},
+		// NULL is kept and the absent column is still absent
+		{Database: "test", Table: "users", Tp: InsertDMLType, Values: map[string]interface{}{"id": 2, "name": nil}, info: info},
+		{Database: "test", Table: "users", Tp: InsertDMLType, Values: map[string]interface{}{"id": 3, "age": 18}, info: info},
+	}
+
+	b, err := NewColumnarBatch(dmls)
+	c.Assert(err, check.IsNil)
+	c.Assert(b.Len(), check.Equals, 3)
+	// in the order of the table, the unknown ones at the end
+	c.Assert(b.Columns(), check.DeepEquals, []string{"name", "id", "age"})
+	c.Assert(b.values[1], check.DeepEquals, []interface{}{1, 2, 3})
+	c.Assert(b.ToDMLs(), check.DeepEquals, dmls)
+}
+
+func (s *columnarSuite) TestUpdate(c *check.C) {
+	dmls := []*DML{newCaptureTestDML(UpdateDMLType, 1), newCaptureTestDML(UpdateDMLType, 2)}
+	b, err := NewColumnarBatch(dmls)
+	c.Assert(err, check.IsNil)
+	c.Assert(b.oldValues, check.DeepEquals, [][]interface{}{{1, 2}, {"b", "b"}})
+	c.Assert(b.ToDMLs(), check.DeepEquals, dmls)
+}
+
+func (s *columnarSuite) TestInvalidBatch(c *check.C) {
+	_, err := NewColumnarBatch(nil)
+	c.Assert(err, check.ErrorMatches, "no DMLs.*")
+
+	_, err = NewColumnarBatch([]*DML{newCaptureTestDML(InsertDMLType, 1), newCaptureTestDML(DeleteDMLType, 2)})
+	c.Assert(err, check.ErrorMatches, ".*must be of the same table and type.*")
+
+	other := newCaptureTestDML(InsertDMLType, 2)
+	other.Table = "orders"
+	_, err = NewColumnarBatch([]*DML{newCaptureTestDML(InsertDMLType, 1), other})
+	c.Assert(err, check.ErrorMatches, ".*must be of the same table and type.*")
+}
+
+func (s *columnarSuite) TestBulkReplace(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	dmls := []*DML{newCaptureTestDML(InsertDMLType, 1), newCaptureTestDML(InsertDMLType, 2)}
+	delete(dmls[1].Values, "name")
+	filler := func(schema, table, column string) (interface{}, bool) {
+		return "unknown", true
+	}
+
+	// the args are still in the row-major order
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`users`(`id`,`name`) VALUES (?,?),(?,?)")).
+		WithArgs(1, "a", 2, "unknown").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	e := newExecutor(db).withColumnDefaultFiller(filler)
+	c.Assert(e.bulkReplace(dmls), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func newColumnarBenchDMLs(rows, columns int) ([]*DML, []string) {
+	names := make([]string, columns)
+	for i := range names {
+		names[i] = fmt.Sprintf("c%d", i)
+	}
+	info := &tableInfo{columns: names}
+	dmls := make([]*DML, rows)
+	for j := range dmls {
+		values := make(map[string]interface{}, columns)
+		for _, name := range names {
+			values[name] = j
+		}
+		dmls[j] = &DML{Database: "test", Table: "test1", Tp: InsertDMLType, Values: values, info: info}
+	}
+	return dmls, names
+}
+
+// BenchmarkRowMajorArgs10000 extracts the args of 10k rows by reading the values of every DML in turn.
+func BenchmarkRowMajorArgs10000(b *testing.B) {
+	dmls, columns := newColumnarBenchDMLs(10000, 8)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		args := make([]interface{}, 0, len(dmls)*len(columns))
+		for _, dml := range dmls {
+			for _, name := range columns {
+				args = append(args, dml.Values[name])
+			}
+		}
+	}
+}
+
+// BenchmarkColumnarArgs10000 extracts the args of 10k rows by a ColumnarBatch, as bulkReplace does.
+func BenchmarkColumnarArgs10000(b *testing.B) {
+	dmls, columns := newColumnarBenchDMLs(10000, 8)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch := newColumnarBatch(dmls, columns)
+		args := make([]interface{}, len(dmls)*len(columns))
+		for c, values := range batch.values {
+			for j, v := range values {
+				args[j*len(columns)+c] = v
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+)
+
+// the error code of "Deadlock found when trying to get lock; try restarting transaction"
+const errCodeDeadlock = 1213
+
+const deadlockSuggestion = "the deadlock is usually caused by the workers updating the rows of the same unique keys " +
+	"in different orders, try reducing worker-count, or check whether the unique keys of downstream table match the upstream ones"
+
+var (
+	// `TRANSACTION 1234` in the InnoDB deadlock info, `txnStartTS: 1234` and `waitForTxnStartTS: 1234` in the TiDB one
+	deadlockTxnRegexp = regexp.MustCompile(`(?i)(?:TRANSACTION|txn ?start ?ts)[\s:=]+(\d+)`)
+	// `MySQL thread id 12` in the InnoDB deadlock info
+	deadlockThreadRegexp = regexp.MustCompile(`(?i)thread id[\s:=]+(\d+)`)
+	// `RECORD LOCKS ... index PRIMARY of table `test`.`t` ... waiting` in the InnoDB deadlock info
+	deadlockWaitRegexp = regexp.MustCompile("(?i)index (\\S+) of table (`[^`]+`\\.`[^`]+`)[^\\n]*waiting")
+)
+
+// DeadlockReport is the information parsed from the deadlock error, the fields are empty if the
+// error message doesn't contain them, e.g. MySQL only returns the details by `SHOW ENGINE INNODB STATUS`.
+type DeadlockReport struct {
+	Message string
+	// the ids of the txns in the deadlock
+	TxnIDs []uint64
+	// the ids of the threads (connections) running the txns
+	ThreadIDs []uint64
+	// the locks waited by the txns, like "`test`.`t` index PRIMARY"
+	Waits      []string
+	Suggestion string
+}
+
+// DetectDeadlock returns the report of err if it's a deadlock error (1213), otherwise nil.
+func DetectDeadlock(err error) *DeadlockReport {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	if !ok || mysqlErr.Number != errCodeDeadlock {
+		return nil
+	}
+
+	msg := mysqlErr.Message
+	report := &DeadlockReport{
+		Message:    msg,
+		TxnIDs:     parseDeadlockIDs(deadlockTxnRegexp, msg),
+		ThreadIDs:  parseDeadlockIDs(deadlockThreadRegexp, msg),
+		Suggestion: deadlockSuggestion,
+	}
+	for _, match := range deadlockWaitRegexp.FindAllStringSubmatch(msg, -1) {
+		report.Waits = append(report.Waits, match[2]+" index "+match[1])
+	}
+	return report
+}
+
+// parseDeadlockIDs returns the distinct ids matched by re in the order they appear.
+func parseDeadlockIDs(re *regexp.Regexp, msg string) []uint64 {
+	var ids []uint64
+	seen := make(map[uint64]struct{})
+	for _, match := range re.FindAllStringSubmatch(msg, -1) {
+		id, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+type deadlockSuite struct{}
+
+var _ = check.Suite(&deadlockSuite{})
+
+const innodbDeadlockMessage = "Deadlock found when trying to get lock; try restarting transaction\n" +
+	"*** (1) TRANSACTION:\n" +
+	"TRANSACTION 2317, ACTIVE 5 sec starting index read\n" +
+	"MySQL thread id 12, OS thread handle 1403, query id 85 localhost root updating\n" +
+	"*** (1) WAITING FOR THIS LOCK TO BE GRANTED:\n" +
+	"RECORD LOCKS space id 58 page no 3 n bits 72 index PRIMARY of table `test`.`t` trx id 2317 lock_mode X locks rec but not gap waiting\n" +
+	"*** (2) TRANSACTION:\n" +
+	"TRANSACTION 2318, ACTIVE 3 sec starting index read\n" +
+	"MySQL thread id 13, OS thread handle 1404, query id 86 localhost root updating\n" +
+	"*** (2) WAITING FOR THIS LOCK TO BE GRANTED:\n" +
+	"RECORD LOCKS space id 58 page no 4 n bits 72 index uk_name of table `test`.`t` trx id 2318 lock_mode X locks rec but not gap waiting\n" +
+	"*** WE ROLL BACK TRANSACTION (2)"
+
+func (s *deadlockSuite) TestInnoDBMessage(c *check.C) {
+	err := errors.Annotate(&mysql.MySQLError{Number: 1213, Message: innodbDeadlockMessage}, "exec failed")
+	report := DetectDeadlock(err)
+	c.Assert(report, check.NotNil)
+	c.Assert(report.Message, check.Equals, innodbDeadlockMessage)
+	c.Assert(report.TxnIDs, check.DeepEquals, []uint64{2317, 2318})
+	c.Assert(report.ThreadIDs, check.DeepEquals, []uint64{12, 13})
+	c.Assert(report.Waits, check.DeepEquals, []string{"`test`.`t` index PRIMARY", "`test`.`t` index uk_name"})
+	c.Assert(report.Suggestion, check.Equals, deadlockSuggestion)
+}
+
+func (s *deadlockSuite) TestTiDBMessage(c *check.C) {
+	msg := "Deadlock found when trying to get lock; try restarting transaction, txnStartTS: 416617006447230978, waitForTxnStartTS: 416617005307690982"
+	report := DetectDeadlock(&mysql.MySQLError{Number: 1213, Message: msg})
+	c.Assert(report, check.NotNil)
+	c.Assert(report.TxnIDs, check.DeepEquals, []uint64{416617006447230978, 416617005307690982})
+	c.Assert(report.ThreadIDs, check.HasLen, 0)
+}
+
+func (s *deadlockSuite) TestPlainMessage(c *check.C) {
+	msg := "Deadlock found when trying to get lock; try restarting transaction"
+	report := DetectDeadlock(&mysql.MySQLError{Number: 1213, Message: msg})
+	c.Assert(report, check.NotNil)
+	c.Assert(report.Message, check.Equals, msg)
+	c.Assert(report.TxnIDs, check.HasLen, 0)
+	c.Assert(report.ThreadIDs, check.HasLen, 0)
+	c.Assert(report.Waits, check.HasLen, 0)
+}
+
+func (s *deadlockSuite) TestNotDeadlock(c *check.C) {
+	c.Assert(DetectDeadlock(nil), check.IsNil)
+	c.Assert(DetectDeadlock(errors.New("Deadlock found when trying to get lock")), check.IsNil)
+	c.Assert(DetectDeadlock(&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}), check.IsNil)
+}
+
+func (s *deadlockSuite) TestRetryDeadlock(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	info := &tableInfo{columns: []string{"id"}, uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}}}
+	info.primaryKey = &info.uniqueKeys[0]
+	dmls := []*DML{{Database: "test", Table: "t", Tp: DeleteDMLType, Values: map[string]interface{}{"id": 1}, info: info}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnError(&mysql.MySQLError{Number: 1213, Message: innodbDeadlockMessage})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	e := newExecutor(db).withDeadlockCounter(counter)
+	c.Assert(e.execTableBatchRetry(context.Background(), dmls, 2, time.Millisecond), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(counter.Write(&metric), check.IsNil)
+	c.Assert(metric.GetCounter().GetValue(), check.Equals, 1.0)
+}
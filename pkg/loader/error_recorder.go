@@ -0,0 +1,127 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync"
+	"time"
+)
+
+// the value shown instead of the values of encrypted columns
+const redactedValue = "<redacted>"
+
+// RecordedError is an error returned by the executor and the DMLs caused it.
+type RecordedError struct {
+	Time  time.Time     `json:"time"`
+	Error string        `json:"error"`
+	DMLs  []RecordedDML `json:"dmls"`
+}
+
+// RecordedDML is the snapshot of a DML taken when the error is recorded, the values of the masked columns
+// are masked and the values of the encrypted columns are redacted.
+type RecordedDML struct {
+	// the DML formatted by DML.String
+	DML       string                 `json:"dml"`
+	Values    map[string]interface{} `json:"values,omitempty"`
+	OldValues map[string]interface{} `json:"old-values,omitempty"`
+}
+
+// snapshotDML returns the RecordedDML of dml, it doesn't share anything mutable with dml.
+func snapshotDML(dml *DML, masker *columnMasker, encryptor *columnEncryptor) RecordedDML {
+	snapshot := *dml
+	snapshot.Values = snapshotValues(&snapshot, dml.Values, masker, encryptor)
+	snapshot.OldValues = snapshotValues(&snapshot, dml.OldValues, masker, encryptor)
+	return RecordedDML{
+		DML:       snapshot.String(),
+		Values:    snapshot.Values,
+		OldValues: snapshot.OldValues,
+	}
+}
+
+func snapshotValues(dml *DML, values map[string]interface{}, masker *columnMasker, encryptor *columnEncryptor) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	snapshot := make(map[string]interface{}, len(values))
+	for column, v := range values {
+		if v != nil && encryptor.isEncrypted(dml, column) {
+			v = redactedValue
+		} else {
+			v = masker.maskValue(dml, column, v)
+		}
+		if b, ok := v.([]byte); ok {
+			v = append([]byte(nil), b...)
+		}
+		snapshot[column] = v
+	}
+	return snapshot
+}
+
+// ErrorRecorder keeps the last errors of the executor in a ring buffer for post-mortem analysis,
+// so the details are not lost when the error causes a restart.
+type ErrorRecorder struct {
+	mu     sync.Mutex
+	errors []RecordedError
+	// next position to write in errors
+	next int
+	full bool
+}
+
+// NewErrorRecorder returns a ErrorRecorder keeping the last maxErrors errors.
+func NewErrorRecorder(maxErrors int) *ErrorRecorder {
+	if maxErrors <= 0 {
+		maxErrors = 1
+	}
+
+	return &ErrorRecorder{
+		errors: make([]RecordedError, maxErrors),
+	}
+}
+
+func (r *ErrorRecorder) record(err error, dmls []RecordedDML) {
+	if r == nil || err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errors[r.next] = RecordedError{
+		Time:  time.Now(),
+		Error: err.Error(),
+		DMLs:  dmls,
+	}
+	r.next++
+	if r.next == len(r.errors) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Errors returns the recorded errors from the oldest to the most recent.
+func (r *ErrorRecorder) Errors() []RecordedError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		errs := make([]RecordedError, r.next)
+		copy(errs, r.errors[:r.next])
+		return errs
+	}
+
+	errs := make([]RecordedError, 0, len(r.errors))
+	errs = append(errs, r.errors[r.next:]...)
+	errs = append(errs, r.errors[:r.next]...)
+	return errs
+}
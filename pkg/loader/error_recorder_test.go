@@ -0,0 +1,128 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type errorRecorderSuite struct{}
+
+var _ = Suite(&errorRecorderSuite{})
+
+func (s *errorRecorderSuite) TestRingBuffer(c *C) {
+	for _, n := range []int{0, 1, 3, 5, 6, 13} {
+		maxErrors := 5
+		r := NewErrorRecorder(maxErrors)
+		for i := 0; i < n; i++ {
+			dml := &DML{Database: "test", Table: "test", Tp: InsertDMLType}
+			r.record(errors.Errorf("error %d", i), []RecordedDML{snapshotDML(dml, nil, nil)})
+		}
+
+		expected := n
+		if expected > maxErrors {
+			expected = maxErrors
+		}
+		errs := r.Errors()
+		c.Assert(errs, HasLen, expected)
+		for i, recorded := range errs {
+			c.Assert(recorded.Error, Equals, fmt.Sprintf("error %d", n-expected+i))
+			c.Assert(recorded.DMLs, HasLen, 1)
+		}
+	}
+}
+
+func (s *errorRecorderSuite) TestIgnoreNil(c *C) {
+	r := NewErrorRecorder(2)
+	r.record(nil, nil)
+	c.Assert(r.Errors(), HasLen, 0)
+
+	// a nil recorder is a no-op
+	var nilRecorder *ErrorRecorder
+	nilRecorder.record(errors.New("test"), nil)
+}
+
+func (s *errorRecorderSuite) TestRecordExecutorErrors(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	r := NewErrorRecorder(10)
+	e := newExecutor(db).withErrorRecorder(r)
+
+	dmls := []*DML{{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"name": "tester"},
+		info:     &tableInfo{columns: []string{"name"}},
+	}}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO.*").WillReturnError(errors.New("duplicate entry"))
+	mock.ExpectRollback()
+
+	err = e.singleExecRetry(context.Background(), dmls, false, 1, time.Millisecond)
+	c.Assert(err, ErrorMatches, ".*duplicate entry.*")
+
+	errs := r.Errors()
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0].Error, Matches, ".*duplicate entry.*")
+	c.Assert(errs[0].DMLs, DeepEquals, []RecordedDML{{
+		DML:    "INSERT unicorn.users pk=(tester)",
+		Values: map[string]interface{}{"name": "tester"},
+	}})
+
+	// the recorded DMLs are snapshots
+	dmls[0].Values["name"] = "changed"
+	c.Assert(r.Errors()[0].DMLs[0].Values["name"], Equals, "tester")
+}
+
+func (s *errorRecorderSuite) TestMaskRecordedDMLs(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	encryptor, err := newColumnEncryptor(map[string][]byte{"test.users.phone": make([]byte, 32)})
+	c.Assert(err, IsNil)
+	masker := newColumnMasker(map[string]MaskFunc{"test.users.email": NullMask()})
+	r := NewErrorRecorder(10)
+	e := newExecutor(db).withErrorRecorder(r).withColumnEncryptor(encryptor).withColumnMasker(masker)
+
+	dmls := []*DML{{
+		Database:  "test",
+		Table:     "users",
+		Tp:        UpdateDMLType,
+		Values:    map[string]interface{}{"id": 1, "email": "a@example.com", "phone": "12345"},
+		OldValues: map[string]interface{}{"id": 1, "email": "b@example.com", "phone": "67890"},
+		info:      &tableInfo{columns: []string{"id", "email", "phone"}},
+	}}
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE.*").WillReturnError(errors.New("lock wait timeout"))
+	mock.ExpectRollback()
+
+	err = e.singleExecRetry(context.Background(), dmls, false, 1, time.Millisecond)
+	c.Assert(err, ErrorMatches, ".*lock wait timeout.*")
+
+	errs := r.Errors()
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0].DMLs, DeepEquals, []RecordedDML{{
+		DML:       "UPDATE test.users pk=(<nil>, 1, <redacted>)->(<nil>, 1, <redacted>)",
+		Values:    map[string]interface{}{"id": 1, "email": nil, "phone": redactedValue},
+		OldValues: map[string]interface{}{"id": 1, "email": nil, "phone": redactedValue},
+	}})
+}
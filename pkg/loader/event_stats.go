@@ -0,0 +1,125 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// TableStats is the count of DMLs executed for a table.
+type TableStats struct {
+	Inserts int64
+	Updates int64
+	Deletes int64
+	// Errors is the count of failed executions of the DMLs, the retried ones are included.
+	Errors int64
+}
+
+// EventStats tracks the count of DMLs executed by the loader for every table, pass it to WithEventStats.
+// It's safe to be used concurrently.
+type EventStats struct {
+	// held by Snapshot exclusively, so the counts of a batch of DMLs are added atomically
+	mu sync.RWMutex
+	// `schema.table` -> *TableStats, the fields are accessed atomically
+	tables sync.Map
+}
+
+// NewEventStats creates an EventStats.
+func NewEventStats() *EventStats {
+	return &EventStats{}
+}
+
+// Snapshot returns the counts of all the tables by `schema.table` at a point in time.
+func (s *EventStats) Snapshot() map[string]TableStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]TableStats)
+	s.tables.Range(func(key, value interface{}) bool {
+		stats := value.(*TableStats)
+		snapshot[key.(string)] = TableStats{
+			Inserts: atomic.LoadInt64(&stats.Inserts),
+			Updates: atomic.LoadInt64(&stats.Updates),
+			Deletes: atomic.LoadInt64(&stats.Deletes),
+			Errors:  atomic.LoadInt64(&stats.Errors),
+		}
+		return true
+	})
+	return snapshot
+}
+
+// add adds the counts of deltas by `schema.table` together.
+func (s *EventStats) add(deltas map[string]*TableStats) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for table, delta := range deltas {
+		value, ok := s.tables.Load(table)
+		if !ok {
+			value, _ = s.tables.LoadOrStore(table, new(TableStats))
+		}
+		stats := value.(*TableStats)
+		atomic.AddInt64(&stats.Inserts, delta.Inserts)
+		atomic.AddInt64(&stats.Updates, delta.Updates)
+		atomic.AddInt64(&stats.Deletes, delta.Deletes)
+		atomic.AddInt64(&stats.Errors, delta.Errors)
+	}
+}
+
+// recordEvents counts dmls as executed if err is nil, otherwise as an error of each table.
+func (e *executor) recordEvents(dmls []*DML, err error) {
+	if e.eventStats == nil && e.tableEventCounterVec == nil {
+		return
+	}
+
+	deltas := make(map[string]*TableStats)
+	for _, dml := range dmls {
+		table := dml.Database + "." + dml.Table
+		delta, ok := deltas[table]
+		if !ok {
+			delta = new(TableStats)
+			deltas[table] = delta
+			if err != nil {
+				delta.Errors = 1
+				e.countTableEvent(dml, "error")
+			}
+		}
+		if err != nil {
+			continue
+		}
+
+		switch dml.Tp {
+		case InsertDMLType:
+			delta.Inserts++
+			e.countTableEvent(dml, "insert")
+		case UpdateDMLType:
+			delta.Updates++
+			e.countTableEvent(dml, "update")
+		case DeleteDMLType:
+			delta.Deletes++
+			e.countTableEvent(dml, "delete")
+		}
+	}
+
+	if e.eventStats != nil {
+		e.eventStats.add(deltas)
+	}
+}
+
+func (e *executor) countTableEvent(dml *DML, eventType string) {
+	if e.tableEventCounterVec != nil {
+		e.tableEventCounterVec.WithLabelValues(dml.Database, dml.Table, eventType).Inc()
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+type eventStatsSuite struct{}
+
+var _ = check.Suite(&eventStatsSuite{})
+
+func (s *eventStatsSuite) TestRecordEvents(c *check.C) {
+	stats := NewEventStats()
+	counterVec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"schema", "table", "event_type"})
+	e := newCaptureExecutor().withEventStats(stats).withTableEventCounterVec(counterVec)
+
+	dmls := []*DML{
+		newCaptureTestDML(InsertDMLType, 1),
+		newCaptureTestDML(InsertDMLType, 2),
+		newCaptureTestDML(UpdateDMLType, 3),
+		newCaptureTestDML(DeleteDMLType, 4),
+	}
+	c.Assert(e.execTableBatchRetry(context.Background(), dmls, 1, time.Millisecond), check.IsNil)
+	c.Assert(e.singleExecRetry(context.Background(), dmls[:1], false, 1, time.Millisecond), check.IsNil)
+	c.Assert(stats.Snapshot(), check.DeepEquals, map[string]TableStats{
+		"test.users": {Inserts: 3, Updates: 1, Deletes: 1},
+	})
+
+	var metric io_prometheus_client.Metric
+	c.Assert(counterVec.WithLabelValues("test", "users", "insert").Write(&metric), check.IsNil)
+	c.Assert(metric.GetCounter().GetValue(), check.Equals, 3.0)
+}
+
+func (s *eventStatsSuite) TestRecordErrors(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	stats := NewEventStats()
+	e := newExecutor(db).withEventStats(stats)
+
+	// failed once and retried
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnError(errors.New("lost connection"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dmls := []*DML{newCaptureTestDML(DeleteDMLType, 1)}
+	c.Assert(e.execTableBatchRetry(context.Background(), dmls, 2, time.Millisecond), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	c.Assert(stats.Snapshot(), check.DeepEquals, map[string]TableStats{
+		"test.users": {Deletes: 1, Errors: 1},
+	})
+}
+
+func (s *eventStatsSuite) TestConcurrentUpdates(c *check.C) {
+	stats := NewEventStats()
+	const workers, batches = 8, 500
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < batches; j++ {
+				stats.add(map[string]*TableStats{
+					"test.t1": {Inserts: 1, Deletes: 2},
+					"test.t2": {Inserts: 1},
+				})
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		// the counts of a batch are never seen partially
+		snapshot := stats.Snapshot()
+		c.Assert(snapshot["test.t1"].Inserts, check.Equals, snapshot["test.t2"].Inserts)
+		c.Assert(snapshot["test.t1"].Deletes, check.Equals, 2*snapshot["test.t1"].Inserts)
+	}
+
+	c.Assert(stats.Snapshot(), check.DeepEquals, map[string]TableStats{
+		"test.t1": {Inserts: workers * batches, Deletes: 2 * workers * batches},
+		"test.t2": {Inserts: workers * batches},
+	})
+}
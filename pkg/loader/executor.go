@@ -16,8 +16,13 @@ package loader
 import (
 	"context"
 	gosql "database/sql"
+	"database/sql/driver"
 	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -37,15 +42,77 @@ var (
 	defaultBatchSize   = 128
 	defaultWorkerCount = 16
 	index              int64
+	// the wait time before the first retry to begin a txn when the connection is broken
+	connRetryInterval = 100 * time.Millisecond
+)
+
+// ErrTransactionTimeout is returned when a txn of DMLs is not committed in the timeout set by WithTransactionTimeout.
+var ErrTransactionTimeout = errors.New("transaction timeout")
+
+// ColumnDefaultFiller returns the value of the column absent from the DML, the column is left
+// as NULL if it returns false.
+type ColumnDefaultFiller func(schema, table, column string) (interface{}, bool)
+
+// ErrorPolicy decides what to do with the other workers when one worker fails
+type ErrorPolicy int
+
+// ErrorPolicy values.
+const (
+	// StopAll waits all workers quit and returns the errors
+	StopAll ErrorPolicy = iota
+	// StopFailing removes the failing workers and redistributes their DMLs to the healthy workers
+	StopFailing
+	// RetryWorker restarts the failing workers with the same DMLs
+	RetryWorker
 )
 
 type executor struct {
-	db                *gosql.DB
-	batchSize         int
-	workerCount       int
-	info              *loopbacksync.LoopBackSync
-	queryHistogramVec *prometheus.HistogramVec
-	refreshTableInfo  func(schema string, table string) (info *tableInfo, err error)
+	db                    *gosql.DB
+	batchSize             int
+	workerCount           int
+	errorPolicy           ErrorPolicy
+	info                  *loopbacksync.LoopBackSync
+	queryHistogramVec     *prometheus.HistogramVec
+	txnQueryHistogramVec  *prometheus.HistogramVec
+	workerErrorCounterVec *prometheus.CounterVec
+	warmUpHistogram       prometheus.Histogram
+	validationErrCounter  prometheus.Counter
+	txnTimeoutCounter     prometheus.Counter
+	reconnectCounter      prometheus.Counter
+	batchTimeoutCounter   prometheus.Counter
+	deadlockCounter       prometheus.Counter
+	schemaDriftCounter    prometheus.Counter
+	slowQueryCounter      prometheus.Counter
+	tableEventCounterVec  *prometheus.CounterVec
+	missingRowCounter     prometheus.Counter
+	noopUpdateCounter     prometheus.Counter
+	retryHistogram        prometheus.Histogram
+	chaos                 *chaos
+	errorRecorder         *ErrorRecorder
+	defaultFiller         ColumnDefaultFiller
+	knownSchemas          *sync.Map
+	pool                  *RoundRobinWorkerPool
+	schemaLocks           *schemaLocks
+	columnEncryptor       *columnEncryptor
+	columnMasker          *columnMasker
+	deleteUsingIN         bool
+	multiStatement        bool
+	rowExistenceCheck     bool
+	zeroValueFilter       bool
+	failFast              bool
+	txnIDLabel            bool
+	maxRetryDelay         time.Duration
+	txnTimeout            time.Duration
+	connRetryMaxWait      time.Duration
+	ctx                   context.Context
+	batchTimeout          time.Duration
+	refreshTableInfo      func(schema string, table string) (info *tableInfo, err error)
+	shadowTableSuffix     string
+	tableSizes            *TableSizeEstimator
+	getTableInfo          func(schema string, table string) (info *tableInfo, err error)
+	capture               *sqlCapture
+	slowQueries           *slowQueryDetector
+	eventStats            *EventStats
 }
 
 func newExecutor(db *gosql.DB) *executor {
@@ -53,6 +120,7 @@ func newExecutor(db *gosql.DB) *executor {
 		db:          db,
 		batchSize:   defaultBatchSize,
 		workerCount: defaultWorkerCount,
+		ctx:         context.Background(),
 	}
 
 	return exe
@@ -81,35 +149,380 @@ func (e *executor) withQueryHistogramVec(queryHistogramVec *prometheus.Histogram
 	return e
 }
 
+func (e *executor) withTxnQueryHistogramVec(txnQueryHistogramVec *prometheus.HistogramVec) *executor {
+	e.txnQueryHistogramVec = txnQueryHistogramVec
+	return e
+}
+
+// withTransactionIDLabel makes the txns observe the duration of queries into txnQueryHistogramVec too,
+// with the label txn_id telling the txns apart.
+func (e *executor) withTransactionIDLabel(enabled bool) *executor {
+	e.txnIDLabel = enabled
+	return e
+}
+
+func (e *executor) withWorkerErrorCounterVec(workerErrorCounterVec *prometheus.CounterVec) *executor {
+	e.workerErrorCounterVec = workerErrorCounterVec
+	return e
+}
+
+func (e *executor) withWarmUpHistogram(warmUpHistogram prometheus.Histogram) *executor {
+	e.warmUpHistogram = warmUpHistogram
+	return e
+}
+
+func (e *executor) withValidationErrCounter(validationErrCounter prometheus.Counter) *executor {
+	e.validationErrCounter = validationErrCounter
+	return e
+}
+
+func (e *executor) withTxnTimeoutCounter(txnTimeoutCounter prometheus.Counter) *executor {
+	e.txnTimeoutCounter = txnTimeoutCounter
+	return e
+}
+
+// withTransactionTimeout makes the txn rollback if it's not committed in d, 0 means no limit.
+func (e *executor) withTransactionTimeout(d time.Duration) *executor {
+	e.txnTimeout = d
+	return e
+}
+
+func (e *executor) withReconnectCounter(reconnectCounter prometheus.Counter) *executor {
+	e.reconnectCounter = reconnectCounter
+	return e
+}
+
+// withConnectionRetry makes begin retry for at most maxWait if it fails for the broken connection.
+func (e *executor) withConnectionRetry(maxWait time.Duration) *executor {
+	e.connRetryMaxWait = maxWait
+	return e
+}
+
+// withContext makes the retries of begin stop when ctx is done.
+func (e *executor) withContext(ctx context.Context) *executor {
+	e.ctx = ctx
+	return e
+}
+
+func (e *executor) withBatchTimeoutCounter(batchTimeoutCounter prometheus.Counter) *executor {
+	e.batchTimeoutCounter = batchTimeoutCounter
+	return e
+}
+
+func (e *executor) withDeadlockCounter(deadlockCounter prometheus.Counter) *executor {
+	e.deadlockCounter = deadlockCounter
+	return e
+}
+
+// reportSchemaDrift logs the differences between the table info of dml and the refreshed one.
+func (e *executor) reportSchemaDrift(dml *DML, info *tableInfo) {
+	if dml.info == info {
+		return
+	}
+	diff := TableInfoDiff(dml.info, info)
+	if len(diff) == 0 {
+		return
+	}
+	log.Warn("schema of downstream table drifts", zap.String("table", dml.TableName()), zap.Strings("diff", diff))
+	if e.schemaDriftCounter != nil {
+		e.schemaDriftCounter.Inc()
+	}
+}
+
+func (e *executor) withSchemaDriftCounter(schemaDriftCounter prometheus.Counter) *executor {
+	e.schemaDriftCounter = schemaDriftCounter
+	return e
+}
+
+func (e *executor) withBatchTimeout(d time.Duration) *executor {
+	e.batchTimeout = d
+	return e
+}
+
+func (e *executor) withChaos(c *chaos) *executor {
+	e.chaos = c
+	return e
+}
+
+func (e *executor) withErrorRecorder(recorder *ErrorRecorder) *executor {
+	e.errorRecorder = recorder
+	return e
+}
+
+// recordError records err with the snapshots of dmls into the ErrorRecorder if any, the snapshots are
+// taken before returning, so the DMLs can be changed later.
+func (e *executor) recordError(err error, dmls []*DML) {
+	if e.errorRecorder == nil || err == nil {
+		return
+	}
+	snapshots := make([]RecordedDML, 0, len(dmls))
+	for _, dml := range dmls {
+		snapshots = append(snapshots, snapshotDML(dml, e.columnMasker, e.columnEncryptor))
+	}
+	e.errorRecorder.record(err, snapshots)
+}
+
+func (e *executor) withColumnDefaultFiller(fn ColumnDefaultFiller) *executor {
+	e.defaultFiller = fn
+	return e
+}
+
+// withAutoCreateDatabase makes the executor create the missing databases of DMLs,
+// schemas caches the databases known to exist.
+func (e *executor) withAutoCreateDatabase(schemas *sync.Map) *executor {
+	e.knownSchemas = schemas
+	return e
+}
+
+// withWorkerPool makes the workers of splitExecDML run in pool instead of new goroutines.
+func (e *executor) withWorkerPool(pool *RoundRobinWorkerPool) *executor {
+	e.pool = pool
+	return e
+}
+
+// withBulkDeleteUsingIN makes bulkDelete delete the rows with primary key of a table by one
+// `DELETE ... WHERE pk IN (...)` statement instead of a statement per row.
+func (e *executor) withBulkDeleteUsingIN(enabled bool) *executor {
+	e.deleteUsingIN = enabled
+	return e
+}
+
+// withMultiStatement makes bulkDelete execute the DELETE statements as one multi-statement,
+// instead of one by one in the txn.
+func (e *executor) withMultiStatement(enabled bool) *executor {
+	e.multiStatement = enabled
+	return e
+}
+
+// withColumnEncryptor makes bulkReplace and singleExec encrypt the values of the columns encrypted by enc,
+// and bulkDelete and singleExec locate the rows without them.
+func (e *executor) withColumnEncryptor(enc *columnEncryptor) *executor {
+	e.columnEncryptor = enc
+	return e
+}
+
+// withTableSizeEstimator makes execTableBatchRetry execute the DMLs of the small tables one by one
+// in safe mode instead of batching them.
+func (e *executor) withTableSizeEstimator(est *TableSizeEstimator) *executor {
+	e.tableSizes = est
+	return e
+}
+
+// withSlowQueryDetector makes the executor log the slow queries found by d after executing every batch
+// of DMLs, d should be shared by all the executors of a loader so every slow query is reported once.
+func (e *executor) withSlowQueryDetector(d *slowQueryDetector) *executor {
+	e.slowQueries = d
+	return e
+}
+
+func (e *executor) withSlowQueryCounter(slowQueryCounter prometheus.Counter) *executor {
+	e.slowQueryCounter = slowQueryCounter
+	return e
+}
+
+// withRowExistenceCheck makes singleExec check whether the row of UPDATE exists in downstream before
+// executing it, the UPDATE of the missing row is executed as REPLACE instead of being a no-op.
+func (e *executor) withRowExistenceCheck(enabled bool) *executor {
+	e.rowExistenceCheck = enabled
+	return e
+}
+
+func (e *executor) withMissingRowCounter(missingRowCounter prometheus.Counter) *executor {
+	e.missingRowCounter = missingRowCounter
+	return e
+}
+
+// withZeroValueFilter makes singleExec leave the columns not changed out of the SET clause of UPDATE,
+// and skip the UPDATE changing no column.
+func (e *executor) withZeroValueFilter(enabled bool) *executor {
+	e.zeroValueFilter = enabled
+	return e
+}
+
+func (e *executor) withNoopUpdateCounter(noopUpdateCounter prometheus.Counter) *executor {
+	e.noopUpdateCounter = noopUpdateCounter
+	return e
+}
+
+func (e *executor) withRetryHistogram(retryHistogram prometheus.Histogram) *executor {
+	e.retryHistogram = retryHistogram
+	return e
+}
+
+// withEventStats makes the executor count the DMLs executed for every table in stats.
+func (e *executor) withEventStats(stats *EventStats) *executor {
+	e.eventStats = stats
+	return e
+}
+
+func (e *executor) withTableEventCounterVec(tableEventCounterVec *prometheus.CounterVec) *executor {
+	e.tableEventCounterVec = tableEventCounterVec
+	return e
+}
+
+// withColumnMasker makes bulkReplace, bulkDelete and singleExec mask the values of the columns masked by m.
+func (e *executor) withColumnMasker(m *columnMasker) *executor {
+	e.columnMasker = m
+	return e
+}
+
+// withSchemaLocks makes the DDLs executed by execParallelDDL wait for the in-flight DMLs of
+// the same schema, locks should be shared by all the executors of a loader.
+func (e *executor) withSchemaLocks(locks *schemaLocks) *executor {
+	e.schemaLocks = locks
+	return e
+}
+
+func (e *executor) withMaxRetryDelay(d time.Duration) *executor {
+	e.maxRetryDelay = d
+	return e
+}
+
+// withFailFast makes the executor execute the DMLs only once and return the error immediately, neither
+// retrying them nor redistributing or restarting the failed workers by the error policy.
+func (e *executor) withFailFast(enabled bool) *executor {
+	e.failFast = enabled
+	return e
+}
+
+// retry calls fn until it succeeds at most retryNum times with backoff, fn is called only once without
+// waiting in fail fast mode. The number of retries is observed by retryHistogram.
+func (e *executor) retry(ctx context.Context, retryNum int, backoff time.Duration, fn func(context.Context) error) error {
+	if e.failFast {
+		return fn(ctx)
+	}
+	stats, err := util.RetryContextWithMaxDelayAndStats(ctx, retryNum, backoff, 1, e.maxRetryDelay, fn)
+	if e.retryHistogram != nil {
+		e.retryHistogram.Observe(float64(stats.Retries()))
+	}
+	return err
+}
+
+func (e *executor) withErrorPolicy(policy ErrorPolicy) *executor {
+	e.errorPolicy = policy
+	return e
+}
+
+// warmUp opens workerCount connections concurrently by `SELECT 1`,
+// so the first batch doesn't need to wait for creating connections.
+func (e *executor) warmUp(ctx context.Context) error {
+	begin := time.Now()
+
+	// hold all the connections until the end, or the pool may reuse the released ones
+	conns := make([]*gosql.Conn, e.workerCount)
+	errg, ctx := errgroup.WithContext(ctx)
+	for i := range conns {
+		i := i
+		errg.Go(func() error {
+			conn, err := e.db.Conn(ctx)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			conns[i] = conn
+
+			var one int
+			return errors.Trace(conn.QueryRowContext(ctx, "SELECT 1").Scan(&one))
+		})
+	}
+	err := errg.Wait()
+
+	for _, conn := range conns {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+
+	if e.warmUpHistogram != nil {
+		e.warmUpHistogram.Observe(time.Since(begin).Seconds())
+	}
+	log.Info("warm up connections", zap.Int("count", e.workerCount), zap.Duration("take", time.Since(begin)), zap.Error(err))
+
+	return errors.Trace(err)
+}
+
 func (e *executor) execTableBatchRetry(ctx context.Context, dmls []*DML, retryNum int, backoff time.Duration) error {
-	err := util.RetryContext(ctx, retryNum, backoff, 1, func(context.Context) error {
-		return e.execTableBatch(ctx, dmls)
+	small := len(dmls) > 0 && e.tableSizes.IsSmallTable(dmls[0].Database, dmls[0].Table)
+	err := e.retry(ctx, retryNum, backoff, func(context.Context) error {
+		var err error
+		switch {
+		case e.shadowTableSuffix != "":
+			err = e.execTableBatchWithShadowTable(ctx, dmls, e.shadowTableSuffix)
+		case small:
+			err = e.singleExec(dmls, true)
+		default:
+			err = e.execTableBatchWithTimeout(ctx, dmls, e.batchTimeout)
+		}
+		e.recordEvents(dmls, err)
+		e.recordError(err, dmls)
+		if report := DetectDeadlock(err); report != nil {
+			e.reportDeadlock(report, dmls)
+		}
+		return err
 	})
+	if err == nil {
+		e.reportSlowQueries()
+	}
 	return errors.Trace(err)
 }
 
+// reportDeadlock logs the deadlock between workers which is retried silently otherwise.
+func (e *executor) reportDeadlock(report *DeadlockReport, dmls []*DML) {
+	if e.deadlockCounter != nil {
+		e.deadlockCounter.Inc()
+	}
+	log.Warn("deadlock found when executing dmls", zap.Int("dmls", len(dmls)), zap.String("message", report.Message),
+		zap.Uint64s("txn ids", report.TxnIDs), zap.Uint64s("thread ids", report.ThreadIDs),
+		zap.Strings("waits", report.Waits), zap.String("suggestion", report.Suggestion))
+}
+
 // a wrap of *sql.Tx with metrics
 type tx struct {
 	*gosql.Tx
 	queryHistogramVec *prometheus.HistogramVec
+	// the queries are observed into txnQueryHistogramVec with the label txn_id too if txnID is not empty.
+	txnQueryHistogramVec *prometheus.HistogramVec
+	txnID                string
+
+	// the deadline of the statements in the txn, it's done when the txn is timeout.
+	ctx               context.Context
+	cancel            context.CancelFunc
+	txnTimeoutCounter prometheus.Counter
+
+	// the statements are recorded instead of executed if it's not nil, Tx is nil in this case.
+	capture *sqlCapture
 }
 
 // wrap of sql.Tx.Exec()
 func (tx *tx) exec(query string, args ...interface{}) (gosql.Result, error) {
 	start := time.Now()
-	res, err := tx.Tx.Exec(query, args...)
-	if tx.queryHistogramVec != nil {
-		tx.queryHistogramVec.WithLabelValues("exec").Observe(time.Since(start).Seconds())
-	}
+	res, err := tx.Tx.ExecContext(tx.ctx, query, args...)
+	tx.observe("exec", start)
 
-	return res, err
+	return res, tx.checkTimeout(err)
+}
+
+// observe observes the duration of the query of type tp since start.
+func (tx *tx) observe(tp string, start time.Time) {
+	if tx.queryHistogramVec == nil {
+		return
+	}
+	duration := time.Since(start).Seconds()
+	tx.queryHistogramVec.WithLabelValues(tp).Observe(duration)
+	if tx.txnID != "" && tx.txnQueryHistogramVec != nil {
+		tx.txnQueryHistogramVec.WithLabelValues(tp, tx.txnID).Observe(duration)
+	}
 }
 
 func (tx *tx) autoRollbackExec(query string, args ...interface{}) (res gosql.Result, err error) {
+	if tx.capture != nil {
+		tx.capture.add(query)
+		return driver.RowsAffected(0), nil
+	}
+
 	res, err = tx.exec(query, args...)
 	if err != nil {
 		log.Error("Exec fail, will rollback", zap.String("query", query), zap.Reflect("args", args), zap.Error(err))
-		if rbErr := tx.Rollback(); rbErr != nil {
+		if rbErr := tx.rollback(); rbErr != nil {
 			log.Error("Auto rollback", zap.Error(rbErr))
 		}
 		err = errors.Trace(err)
@@ -117,31 +530,175 @@ func (tx *tx) autoRollbackExec(query string, args ...interface{}) (res gosql.Res
 	return
 }
 
+// autoRollbackExists returns whether the count returned by the query is not 0, the txn is rolled back
+// if it fails. The rows are assumed to exist in capture mode.
+func (tx *tx) autoRollbackExists(query string, args ...interface{}) (bool, error) {
+	if tx.capture != nil {
+		tx.capture.add(query)
+		return true, nil
+	}
+
+	start := time.Now()
+	var count int64
+	err := tx.Tx.QueryRowContext(tx.ctx, query, args...).Scan(&count)
+	tx.observe("select", start)
+	if err != nil {
+		err = tx.checkTimeout(err)
+		log.Error("Query fail, will rollback", zap.String("query", query), zap.Reflect("args", args), zap.Error(err))
+		if rbErr := tx.rollback(); rbErr != nil {
+			log.Error("Auto rollback", zap.Error(rbErr))
+		}
+		return false, errors.Trace(err)
+	}
+	return count > 0, nil
+}
+
 // wrap of sql.Tx.Commit()
 func (tx *tx) commit() error {
+	defer tx.cancel()
+
+	if tx.capture != nil {
+		return nil
+	}
+
+	if err := tx.ctx.Err(); err != nil {
+		if rbErr := tx.Tx.Rollback(); rbErr != nil {
+			log.Error("Auto rollback", zap.Error(rbErr))
+		}
+		return errors.Trace(tx.checkTimeout(err))
+	}
+
 	start := time.Now()
 	err := tx.Tx.Commit()
-	if tx.queryHistogramVec != nil {
-		tx.queryHistogramVec.WithLabelValues("commit").Observe(time.Since(start).Seconds())
+	tx.observe("commit", start)
+
+	return errors.Trace(tx.checkTimeout(err))
+}
+
+// wrap of sql.Tx.Rollback()
+func (tx *tx) rollback() error {
+	defer tx.cancel()
+
+	if tx.capture != nil {
+		return nil
 	}
 
-	return errors.Trace(err)
+	return errors.Trace(tx.Tx.Rollback())
+}
+
+// checkTimeout replaces the error caused by the timeout of txn with ErrTransactionTimeout.
+func (tx *tx) checkTimeout(err error) error {
+	if err == nil || tx.ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+
+	if tx.txnTimeoutCounter != nil {
+		tx.txnTimeoutCounter.Inc()
+	}
+	return errors.Annotate(ErrTransactionTimeout, err.Error())
 }
 
 func (e *executor) addIndex() int64 {
 	return atomic.AddInt64(&index, 1) % ((int64)(e.workerCount))
 }
 
-// return a wrap of sql.Tx
-func (e *executor) begin() (*tx, error) {
+// createDatabases creates the databases of dmls not known to exist. It's executed out of the txn
+// of DMLs because the DDL commits the txn implicitly.
+func (e *executor) createDatabases(dmls []*DML) error {
+	if e.knownSchemas == nil {
+		return nil
+	}
+
+	for _, dml := range dmls {
+		if _, ok := e.knownSchemas.Load(dml.Database); ok {
+			continue
+		}
+
+		sql := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteName(dml.Database))
+		if e.capture != nil {
+			e.capture.add(sql)
+		} else if _, err := e.db.Exec(sql); err != nil {
+			return errors.Annotatef(err, "failed to create database %s", dml.Database)
+		}
+		log.Info("create database if not exists", zap.String("database", dml.Database))
+		e.knownSchemas.Store(dml.Database, struct{}{})
+	}
+
+	return nil
+}
+
+// beginWithConnectionRetry begins a txn, it retries with exponential backoff until
+// connRetryMaxWait elapses if the connection to downstream is broken, the error of e.ctx is returned
+// if it's done while waiting.
+func (e *executor) beginWithConnectionRetry() (*gosql.Tx, error) {
 	sqlTx, err := e.db.Begin()
+	if err == nil || e.connRetryMaxWait <= 0 || !isConnectionError(err) {
+		return sqlTx, err
+	}
+
+	deadline := time.Now().Add(e.connRetryMaxWait)
+	interval := connRetryInterval
+	for attempt := 1; ; attempt++ {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, errors.Annotatef(err, "failed to reconnect in %s", e.connRetryMaxWait)
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+
+		log.Warn("begin txn failed for the broken connection, will retry",
+			zap.Int("attempt", attempt), zap.Duration("interval", interval), zap.Error(err))
+		select {
+		case <-e.ctx.Done():
+			return nil, errors.Annotatef(e.ctx.Err(), "stop reconnecting, last error: %v", err)
+		case <-time.After(interval):
+		}
+		interval *= 2
+
+		if e.reconnectCounter != nil {
+			e.reconnectCounter.Inc()
+		}
+		sqlTx, err = e.db.Begin()
+		if err == nil || !isConnectionError(err) {
+			return sqlTx, err
+		}
+	}
+}
+
+// return a wrap of sql.Tx to execute dmls
+func (e *executor) begin(dmls []*DML) (*tx, error) {
+	if err := e.chaos.inject(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// the ctx is not bound to the sql.Tx, so the txn is rolled back by us instead of
+	// database/sql in the background when it's timeout.
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if e.txnTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, e.txnTimeout)
+	}
+
+	if e.capture != nil {
+		return &tx{ctx: ctx, cancel: cancel, capture: e.capture}, nil
+	}
+
+	sqlTx, err := e.beginWithConnectionRetry()
 	if err != nil {
+		cancel()
 		return nil, errors.Trace(err)
 	}
 
 	var tx = &tx{
-		Tx:                sqlTx,
-		queryHistogramVec: e.queryHistogramVec,
+		Tx:                   sqlTx,
+		queryHistogramVec:    e.queryHistogramVec,
+		txnQueryHistogramVec: e.txnQueryHistogramVec,
+		ctx:                  ctx,
+		cancel:               cancel,
+		txnTimeoutCounter:    e.txnTimeoutCounter,
+	}
+	if e.txnIDLabel {
+		tx.txnID = txnIDLabel(dmls)
 	}
 
 	if e.info != nil && e.info.LoopbackControl {
@@ -149,62 +706,187 @@ func (e *executor) begin() (*tx, error) {
 
 		err = loopbacksync.UpdateMark(tx.Tx, e.addIndex(), e.info.ChannelID)
 		if err != nil {
-			rerr := tx.Rollback()
+			rerr := tx.rollback()
 			if rerr != nil {
 				log.Error("fail to rollback", zap.Error(rerr))
 			}
 			return nil, errors.Annotate(err, "failed to update mark data")
 		}
 
-		if tx.queryHistogramVec != nil {
-			tx.queryHistogramVec.WithLabelValues("update_mark_table").Observe(time.Since(start).Seconds())
-		}
+		tx.observe("update_mark_table", start)
 	}
 
 	return tx, nil
 }
 
+// txnIDLabel returns the low 16 bits of the CRC32 of dmls in hex to tell the txns apart in metrics,
+// the values of dmls can't be told from it, and the cardinality of the label is bounded.
+func txnIDLabel(dmls []*DML) string {
+	h := crc32.NewIEEE()
+	writeValues := func(values map[string]interface{}) {
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(h, "%s=%v,", name, values[name])
+		}
+	}
+	for _, dml := range dmls {
+		fmt.Fprintf(h, "%d %s:", dml.Tp, dml.TableName())
+		writeValues(dml.OldValues)
+		writeValues(dml.Values)
+		h.Write([]byte{'\n'})
+	}
+	return fmt.Sprintf("%04x", h.Sum32()&0xffff)
+}
+
 func (e *executor) bulkDelete(deletes []*DML) error {
 	if len(deletes) == 0 {
 		return nil
 	}
 
-	var sqls strings.Builder
-	argss := make([]interface{}, 0, len(deletes))
+	if e.columnMasker != nil {
+		masked := make([]*DML, 0, len(deletes))
+		for _, dml := range deletes {
+			masked = append(masked, e.columnMasker.maskDML(dml))
+		}
+		deletes = masked
+	}
+	if e.columnEncryptor != nil {
+		encrypted := make([]*DML, 0, len(deletes))
+		for _, dml := range deletes {
+			dml, err := e.columnEncryptor.encryptDML(dml)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			encrypted = append(encrypted, dml)
+		}
+		deletes = encrypted
+	}
+
+	var sqls []string
+	var argss [][]interface{}
 
-	for _, dml := range deletes {
-		sql, args := dml.sql()
-		sqls.WriteString(sql)
-		sqls.WriteByte(';')
-		argss = append(argss, args...)
+	if e.deleteUsingIN {
+		for _, dmls := range groupDeletesByPK(deletes) {
+			var sql string
+			var args []interface{}
+			if !hasPrimaryKeyValues(dmls[0]) {
+				sql, args = dmls[0].sql()
+			} else {
+				sql, args = deleteInSQL(dmls)
+			}
+			sqls = append(sqls, sql)
+			argss = append(argss, args)
+		}
+	} else {
+		for _, dml := range deletes {
+			sql, args := dml.sql()
+			sqls = append(sqls, sql)
+			argss = append(argss, args)
+		}
 	}
-	tx, err := e.begin()
-	if err != nil {
+	if err := e.createDatabases(deletes); err != nil {
 		return errors.Trace(err)
 	}
-	sql := sqls.String()
-	_, err = tx.autoRollbackExec(sql, argss...)
+
+	if e.multiStatement {
+		var builder strings.Builder
+		var args []interface{}
+		for i, sql := range sqls {
+			builder.WriteString(sql)
+			builder.WriteByte(';')
+			args = append(args, argss[i]...)
+		}
+		sqls, argss = []string{builder.String()}, [][]interface{}{args}
+	}
+
+	return errors.Trace(e.execInTxn(deletes, sqls, argss))
+}
+
+// execInTxn executes sqls of dmls with the args of the same index in a txn like pkgsql.BatchExecute, but
+// the txn is begun by e.begin, the txn is rolled back if any of them fails.
+func (e *executor) execInTxn(dmls []*DML, sqls []string, argss [][]interface{}) error {
+	tx, err := e.begin(dmls)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
-	err = tx.commit()
-	return errors.Trace(err)
+	for i, sql := range sqls {
+		if _, err = tx.autoRollbackExec(sql, argss[i]...); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Trace(tx.commit())
+}
+
+// groupDeletesByPK groups the deletes with non-null primary key values by table in the order of
+// first appearance, every delete without them is in a group of its own.
+func groupDeletesByPK(deletes []*DML) [][]*DML {
+	var groups [][]*DML
+	tableIdx := make(map[string]int)
+	for _, dml := range deletes {
+		if !hasPrimaryKeyValues(dml) {
+			groups = append(groups, []*DML{dml})
+			continue
+		}
+		name := dml.TableName()
+		if i, ok := tableIdx[name]; ok {
+			groups[i] = append(groups[i], dml)
+			continue
+		}
+		tableIdx[name] = len(groups)
+		groups = append(groups, []*DML{dml})
+	}
+	return groups
+}
+
+func hasPrimaryKeyValues(dml *DML) bool {
+	if dml.info == nil || dml.primaryKeys() == nil || dml.hasEncryptedColumn(dml.primaryKeys()) {
+		return false
+	}
+	for _, v := range dml.primaryKeyValues() {
+		if v == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *executor) validateDMLs(dmls []*DML) error {
+	for _, dml := range dmls {
+		if err := dml.Validate(); err != nil {
+			if e.validationErrCounter != nil {
+				e.validationErrCounter.Inc()
+			}
+			return errors.Trace(err)
+		}
+	}
+	return nil
 }
 
 func (e *executor) bulkReplace(inserts []*DML) error {
 	if len(inserts) == 0 {
 		return nil
 	}
+	if err := e.validateDMLs(inserts); err != nil {
+		return errors.Trace(err)
+	}
 
-	info := inserts[0].info
+	if err := e.createDatabases(inserts); err != nil {
+		return errors.Trace(err)
+	}
+	columns := inserts[0].info.columns
 
 	var builder strings.Builder
 
-	cols := "(" + buildColumnList(info.columns) + ")"
+	cols := "(" + buildColumnList(columns) + ")"
 	builder.WriteString("REPLACE INTO " + inserts[0].TableName() + cols + " VALUES ")
 
-	holder := fmt.Sprintf("(%s)", holderString(len(info.columns)))
+	holder := fmt.Sprintf("(%s)", holderString(len(columns)))
 	for i := 0; i < len(inserts); i++ {
 		if i > 0 {
 			builder.WriteByte(',')
@@ -212,23 +894,29 @@ func (e *executor) bulkReplace(inserts []*DML) error {
 		builder.WriteString(holder)
 	}
 
-	args := make([]interface{}, 0, len(inserts)*len(info.columns))
-	for _, insert := range inserts {
-		for _, name := range info.columns {
-			v := insert.Values[name]
-			args = append(args, v)
+	// the values are converted column by column, and placed at the row-major positions of args
+	batch := newColumnarBatch(inserts, columns)
+	args := make([]interface{}, len(inserts)*len(columns))
+	for i, name := range columns {
+		for j, v := range batch.values[i] {
+			insert := inserts[j]
+			if _, absent := v.(absentValue); absent {
+				v = nil
+				if e.defaultFiller != nil {
+					if fill, ok := e.defaultFiller(insert.Database, insert.Table, name); ok {
+						v = fill
+					}
+				}
+			}
+			v = e.columnMasker.maskValue(insert, name, v)
+			v, err := e.columnEncryptor.encryptValue(insert, name, v)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			args[j*len(columns)+i] = v
 		}
 	}
-	tx, err := e.begin()
-	if err != nil {
-		return errors.Trace(err)
-	}
-	_, err = tx.autoRollbackExec(builder.String(), args...)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	err = tx.commit()
-	return errors.Trace(err)
+	return errors.Trace(e.execInTxn(inserts, []string{builder.String()}, [][]interface{}{args}))
 }
 
 // we merge dmls by primary key, after merge by key, we
@@ -238,54 +926,229 @@ func (e *executor) bulkReplace(inserts []*DML) error {
 // or we can simply check if it update unique index column or not, and for update change to (delete + insert)
 // the final result should has no duplicate entry or the origin dmls is wrong.
 func (e *executor) execTableBatch(ctx context.Context, dmls []*DML) error {
+	_, err := e.execTableBatchPartially(ctx, dmls)
+	return errors.Trace(err)
+}
+
+// execTableBatchPartially is the same as execTableBatch, but it stops if ctx is done before executing
+// each type of the merged DMLs, and returns the merged DMLs executed before the error.
+func (e *executor) execTableBatchPartially(ctx context.Context, dmls []*DML) (executed []*DML, err error) {
 	if len(dmls) == 0 {
-		return nil
+		return nil, nil
 	}
+	defer e.schemaLocks.startDMLs(dmls)()
 
 	types, err := mergeByPrimaryKey(dmls)
 	if err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
 
 	log.Debug("merge dmls", zap.Reflect("dmls", dmls), zap.Reflect("merged", types))
 
 	if allDeletes, ok := types[DeleteDMLType]; ok {
 		if err := e.splitExecDML(ctx, allDeletes, e.bulkDelete); err != nil {
-			return errors.Trace(err)
+			return executed, errors.Trace(err)
 		}
+		executed = append(executed, allDeletes...)
 	}
 
 	if allInserts, ok := types[InsertDMLType]; ok {
+		if err := ctx.Err(); err != nil {
+			return executed, errors.Trace(err)
+		}
 		if err := e.splitExecDML(ctx, allInserts, e.bulkReplace); err != nil {
-			return errors.Trace(err)
+			return executed, errors.Trace(err)
 		}
+		executed = append(executed, allInserts...)
 	}
 
 	if allUpdates, ok := types[UpdateDMLType]; ok {
+		if err := ctx.Err(); err != nil {
+			return executed, errors.Trace(err)
+		}
 		if err := e.splitExecDML(ctx, allUpdates, e.bulkReplace); err != nil {
-			return errors.Trace(err)
+			return executed, errors.Trace(err)
 		}
+		executed = append(executed, allUpdates...)
 	}
 
-	return nil
+	return executed, nil
+}
+
+// execTableBatchWithTimeout executes dmls by execTableBatch in timeout, the DMLs executed before
+// timeout are logged for debugging. timeout <= 0 means no limit.
+func (e *executor) execTableBatchWithTimeout(ctx context.Context, dmls []*DML, timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.Trace(e.execTableBatch(ctx, dmls))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	executed, err := e.execTableBatchPartially(ctx, dmls)
+	if err != nil && errors.Cause(err) == context.DeadlineExceeded {
+		if e.batchTimeoutCounter != nil {
+			e.batchTimeoutCounter.Inc()
+		}
+		log.Warn("execute table batch timeout", zap.Duration("timeout", timeout),
+			zap.Int("dmls", len(dmls)), zap.Strings("executed", dmlStrings(executed)))
+	}
+	return errors.Trace(err)
 }
 
-// splitExecDML split dmls to size of e.batchSize and call exec concurrently
+func dmlStrings(dmls []*DML) []string {
+	strs := make([]string, 0, len(dmls))
+	for _, dml := range dmls {
+		strs = append(strs, dml.String())
+	}
+	return strs
+}
+
+// workerErrors holds the errors of all the failed workers. It's used instead of errors.Join since the
+// module still supports the Go versions before 1.20, Unwrap makes errors.Is and errors.As of Go 1.20
+// check every error like they do for errors.Join.
+type workerErrors []error
+
+// Unwrap returns the errors of the failed workers.
+func (es workerErrors) Unwrap() []error {
+	return es
+}
+
+func (es workerErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, err := range es {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type workerResult struct {
+	// the worker in [0, workerSlots()) running the dmls
+	worker int
+	dmls   []*DML
+	err    error
+}
+
+// workerSlots returns the number of workers running the DMLs, it's the size of the worker pool if any.
+func (e *executor) workerSlots() int {
+	if e.pool != nil {
+		return e.pool.Size()
+	}
+	if e.workerCount > 0 {
+		return e.workerCount
+	}
+	return 1
+}
+
+// runWorkers runs every group of dmls by the worker of the same index in workers,
+// one worker's failure doesn't stop the others.
+func (e *executor) runWorkers(workers []int, groups [][]*DML, exec func(dmls []*DML) error) (failed []workerResult) {
+	var wg sync.WaitGroup
+	resultCh := make(chan workerResult, len(groups))
+
+	for i, group := range groups {
+		worker, group := workers[i], group
+		run := func() {
+			defer wg.Done()
+			if err := exec(group); err != nil {
+				resultCh <- workerResult{worker: worker, dmls: group, err: errors.Trace(err)}
+			}
+		}
+
+		wg.Add(1)
+		if e.pool != nil {
+			e.pool.SubmitTo(worker, run)
+		} else {
+			go run()
+		}
+	}
+
+	wg.Wait()
+	close(resultCh)
+
+	for res := range resultCh {
+		log.Warn("worker failed to execute dmls", zap.Int("worker", res.worker), zap.Error(res.err))
+		if e.workerErrorCounterVec != nil {
+			e.workerErrorCounterVec.WithLabelValues(strconv.Itoa(res.worker)).Inc()
+		}
+		failed = append(failed, res)
+	}
+
+	return
+}
+
+// splitExecDML split dmls to size of e.batchSize and call exec concurrently,
+// the failed workers are handled according to e.errorPolicy.
 func (e *executor) splitExecDML(ctx context.Context, dmls []*DML, exec func(dmls []*DML) error) error {
-	errg, _ := errgroup.WithContext(ctx)
+	groups := splitDMLs(dmls, e.batchSize)
+	// the groups are assigned to the workers in turn, so the worker label of metrics is bounded
+	slots := e.workerSlots()
+	workers := make([]int, len(groups))
+	for i := range groups {
+		workers[i] = i % slots
+	}
 
-	for _, split := range splitDMLs(dmls, e.batchSize) {
-		split := split
-		errg.Go(func() error {
-			err := exec(split)
-			if err != nil {
-				return errors.Trace(err)
+	failed := e.runWorkers(workers, groups, exec)
+	if len(failed) == 0 {
+		return nil
+	}
+
+	policy := e.errorPolicy
+	if e.failFast {
+		policy = StopAll
+	}
+	switch policy {
+	case StopFailing:
+		isFailed := make(map[int]struct{}, len(failed))
+		for _, res := range failed {
+			isFailed[res.worker] = struct{}{}
+		}
+		var healthy []int
+		seen := make(map[int]struct{}, len(workers))
+		for _, worker := range workers {
+			// a worker may run several groups
+			if _, ok := seen[worker]; ok {
+				continue
 			}
-			return nil
-		})
+			seen[worker] = struct{}{}
+			if _, ok := isFailed[worker]; !ok {
+				healthy = append(healthy, worker)
+			}
+		}
+		if len(healthy) == 0 {
+			break
+		}
+
+		workers, groups = workers[:0], groups[:0]
+		for i, res := range failed {
+			worker := healthy[i%len(healthy)]
+			log.Info("redistribute dmls of failed worker", zap.Int("from", res.worker), zap.Int("to", worker))
+			workers = append(workers, worker)
+			groups = append(groups, res.dmls)
+		}
+		failed = e.runWorkers(workers, groups, exec)
+	case RetryWorker:
+		workers, groups = workers[:0], groups[:0]
+		for _, res := range failed {
+			log.Info("restart failed worker", zap.Int("worker", res.worker))
+			workers = append(workers, res.worker)
+			groups = append(groups, res.dmls)
+		}
+		failed = e.runWorkers(workers, groups, exec)
 	}
 
-	return errors.Trace(errg.Wait())
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0].err
+	}
+
+	errs := make(workerErrors, 0, len(failed))
+	for _, res := range failed {
+		errs = append(errs, res.err)
+	}
+	return errs
 }
 
 func tryRefreshTableErr(err error) bool {
@@ -303,12 +1166,23 @@ func tryRefreshTableErr(err error) bool {
 }
 
 func (e *executor) singleExecRetry(ctx context.Context, allDMLs []*DML, safeMode bool, retryNum int, backoff time.Duration) error {
+	if safeMode && log.GetLevel() <= zap.DebugLevel {
+		logSafeModeUpdates(allDMLs)
+	}
+
 	for _, dmls := range splitDMLs(allDMLs, e.batchSize) {
-		err := util.RetryContext(ctx, retryNum, backoff, 1, func(context.Context) error {
-			execErr := e.singleExec(dmls, safeMode)
+		err := e.retry(ctx, retryNum, backoff, func(context.Context) error {
+			var execErr error
+			if e.shadowTableSuffix != "" {
+				execErr = e.execTableBatchWithShadowTable(ctx, dmls, e.shadowTableSuffix)
+			} else {
+				execErr = e.singleExec(dmls, safeMode)
+			}
+			e.recordEvents(dmls, execErr)
 			if execErr == nil {
 				return nil
 			}
+			e.recordError(execErr, dmls)
 
 			if tryRefreshTableErr(execErr) && e.refreshTableInfo != nil {
 				log.Info("try refresh table info")
@@ -325,11 +1199,10 @@ func (e *executor) singleExecRetry(ctx context.Context, allDMLs []*DML, safeMode
 						}
 
 						name2info[name] = info
+						e.reportSchemaDrift(dml, info)
 					}
 
 					if len(dml.info.columns) != len(info.columns) {
-						log.Info("columns change", zap.Strings("old", dml.info.columns),
-							zap.Strings("new", info.columns))
 						removeOrphanCols(info, dml)
 					}
 					dml.info = info
@@ -340,18 +1213,63 @@ func (e *executor) singleExecRetry(ctx context.Context, allDMLs []*DML, safeMode
 		if err != nil {
 			return errors.Trace(err)
 		}
+		e.reportSlowQueries()
 	}
 
 	return nil
 }
 
+// logSafeModeUpdates logs the changed values of the UPDATEs executed as DELETE and REPLACE in safe mode.
+func logSafeModeUpdates(dmls []*DML) {
+	for _, dml := range dmls {
+		if dml.Tp == UpdateDMLType {
+			log.Debug("execute UPDATE in safe mode", zap.String("table", dml.TableName()),
+				zap.Stringer("diff", util.DiffValues(dml.OldValues, dml.Values)))
+		}
+	}
+}
+
 func (e *executor) singleExec(dmls []*DML, safeMode bool) error {
-	tx, err := e.begin()
+	defer e.schemaLocks.startDMLs(dmls)()
+	if err := e.validateDMLs(dmls); err != nil {
+		return errors.Trace(err)
+	}
+	if err := e.createDatabases(dmls); err != nil {
+		return errors.Trace(err)
+	}
+	if e.columnMasker != nil {
+		masked := make([]*DML, 0, len(dmls))
+		for _, dml := range dmls {
+			masked = append(masked, e.columnMasker.maskDML(dml))
+		}
+		dmls = masked
+	}
+	if e.columnEncryptor != nil {
+		encrypted := make([]*DML, 0, len(dmls))
+		for _, dml := range dmls {
+			dml, err := e.columnEncryptor.encryptDML(dml)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			encrypted = append(encrypted, dml)
+		}
+		dmls = encrypted
+	}
+
+	tx, err := e.begin(dmls)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
 	for _, dml := range dmls {
+		if e.zeroValueFilter && !safeMode && dml.Tp == UpdateDMLType && len(dml.changedColumns()) == 0 {
+			log.Debug("skip the UPDATE changing no column", zap.Stringer("dml", dml))
+			if e.noopUpdateCounter != nil {
+				e.noopUpdateCounter.Inc()
+			}
+			continue
+		}
+
 		if safeMode && dml.Tp == UpdateDMLType {
 			sql, args := dml.deleteSQL()
 			_, err := tx.autoRollbackExec(sql, args...)
@@ -370,6 +1288,16 @@ func (e *executor) singleExec(dmls []*DML, safeMode bool) error {
 			if err != nil {
 				return errors.Trace(err)
 			}
+		} else if e.rowExistenceCheck && dml.Tp == UpdateDMLType {
+			if err := e.updateOrReplace(tx, dml); err != nil {
+				return errors.Trace(err)
+			}
+		} else if dml.Tp == UpdateDMLType {
+			sql, args := e.updateSQL(dml)
+			_, err := tx.autoRollbackExec(sql, args...)
+			if err != nil {
+				return errors.Trace(err)
+			}
 		} else {
 			sql, args := dml.sql()
 			_, err := tx.autoRollbackExec(sql, args...)
@@ -382,3 +1310,180 @@ func (e *executor) singleExec(dmls []*DML, safeMode bool) error {
 	err = tx.commit()
 	return errors.Trace(err)
 }
+
+// updateOrReplace executes the UPDATE dml if the row of it exists in downstream, otherwise executes
+// it as REPLACE like in safe mode.
+func (e *executor) updateOrReplace(tx *tx, dml *DML) error {
+	sql, args := dml.existsSQL()
+	exists, err := tx.autoRollbackExists(sql, args...)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if exists {
+		sql, args = e.updateSQL(dml)
+	} else {
+		log.Warn("the row to update is missing in downstream, replace it", zap.Stringer("dml", dml))
+		if e.missingRowCounter != nil {
+			e.missingRowCounter.Inc()
+		}
+		sql, args = dml.replaceSQL()
+	}
+	_, err = tx.autoRollbackExec(sql, args...)
+	return errors.Trace(err)
+}
+
+// updateSQL returns the UPDATE of dml, only the changed columns are set if zeroValueFilter is enabled.
+func (e *executor) updateSQL(dml *DML) (sql string, args []interface{}) {
+	if e.zeroValueFilter {
+		return dml.updateColumnsSQL(dml.changedColumns())
+	}
+	return dml.updateSQL()
+}
+
+// execDDL executes ddl in a txn, after `use` the database of it if needed.
+func (e *executor) execDDL(ddl *DDL) error {
+	if e.capture != nil {
+		if len(ddl.Database) > 0 && !isCreateDatabaseDDL(ddl.SQL) {
+			e.capture.add(fmt.Sprintf("use %s;", quoteName(ddl.Database)))
+		}
+		e.capture.add(ddl.SQL)
+		return nil
+	}
+
+	tx, err := e.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if len(ddl.Database) > 0 && !isCreateDatabaseDDL(ddl.SQL) {
+		_, err = tx.Exec(fmt.Sprintf("use %s;", quoteName(ddl.Database)))
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Error("Rollback failed", zap.Error(rbErr))
+			}
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(ddl.SQL); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Error("Rollback failed", zap.String("sql", ddl.SQL), zap.Error(rbErr))
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Info("exec ddl success", zap.String("sql", ddl.SQL))
+	return nil
+}
+
+// execParallelDDL executes the DDLs of different schemas in parallel, the DDLs of the same schema
+// are executed in order. The DDLs of a schema wait for the in-flight DMLs of the schema to finish,
+// and the DMLs of the schema started later wait for the DDLs.
+func (e *executor) execParallelDDL(ctx context.Context, ddls []*DDL) error {
+	var schemas []string
+	bySchema := make(map[string][]*DDL)
+	for _, ddl := range ddls {
+		if ddl.ShouldSkip {
+			continue
+		}
+		if _, ok := bySchema[ddl.Database]; !ok {
+			schemas = append(schemas, ddl.Database)
+		}
+		bySchema[ddl.Database] = append(bySchema[ddl.Database], ddl)
+	}
+
+	errg, ctx := errgroup.WithContext(ctx)
+	for _, schema := range schemas {
+		schema, group := schema, bySchema[schema]
+		errg.Go(func() error {
+			defer e.schemaLocks.lockDDL(schema)()
+
+			for _, ddl := range group {
+				if err := ctx.Err(); err != nil {
+					return errors.Trace(err)
+				}
+				if err := e.execDDL(ddl); err != nil {
+					return errors.Annotatef(err, "exec ddl %s", ddl.SQL)
+				}
+			}
+			return nil
+		})
+	}
+
+	return errors.Trace(errg.Wait())
+}
+
+// schemaLocks tracks the in-flight DMLs of every schema, so a DDL of the schema can wait for them.
+// The nil *schemaLocks doesn't track anything.
+type schemaLocks struct {
+	mu    sync.Mutex
+	locks map[string]*schemaLock
+}
+
+type schemaLock struct {
+	// held by the DDLs of the schema, the DMLs must hold it to be added to dmls
+	ddl  sync.Mutex
+	dmls sync.WaitGroup
+}
+
+func (l *schemaLocks) get(schema string) *schemaLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.locks == nil {
+		l.locks = make(map[string]*schemaLock)
+	}
+	lock, ok := l.locks[schema]
+	if !ok {
+		lock = new(schemaLock)
+		l.locks[schema] = lock
+	}
+	return lock
+}
+
+// startDMLs marks the schemas of dmls having in-flight DMLs until the returned function is called,
+// it blocks while a DDL of the schemas is executing.
+func (l *schemaLocks) startDMLs(dmls []*DML) (done func()) {
+	if l == nil {
+		return func() {}
+	}
+
+	var started []*schemaLock
+	seen := make(map[string]struct{})
+	for _, dml := range dmls {
+		if _, ok := seen[dml.Database]; ok {
+			continue
+		}
+		seen[dml.Database] = struct{}{}
+
+		lock := l.get(dml.Database)
+		lock.ddl.Lock()
+		lock.dmls.Add(1)
+		lock.ddl.Unlock()
+		started = append(started, lock)
+	}
+
+	return func() {
+		for _, lock := range started {
+			lock.dmls.Done()
+		}
+	}
+}
+
+// lockDDL waits for the in-flight DMLs of schema and blocks the new ones until the returned
+// function is called.
+func (l *schemaLocks) lockDDL(schema string) (unlock func()) {
+	if l == nil {
+		return func() {}
+	}
+
+	lock := l.get(schema)
+	lock.ddl.Lock()
+	lock.dmls.Wait()
+	return lock.ddl.Unlock
+}
@@ -18,7 +18,9 @@ import (
 	"database/sql"
 	"fmt"
 	"regexp"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
@@ -26,6 +28,7 @@ import (
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
 type executorSuite struct{}
@@ -77,6 +80,233 @@ func (s *executorSuite) TestSplitExecDML(c *C) {
 	c.Assert(counter, Equals, int32(3))
 }
 
+type warmUpSuite struct{}
+
+var _ = Suite(&warmUpSuite{})
+
+func (s *warmUpSuite) TestWarmUp(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	workerCount := 4
+	db.SetMaxOpenConns(workerCount)
+	db.SetMaxIdleConns(workerCount)
+	for i := 0; i < workerCount; i++ {
+		mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	}
+
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "warmup_seconds"})
+	e := newExecutor(db).withWarmUpHistogram(histogram)
+	e.setWorkerCount(workerCount)
+	err = e.warmUp(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(db.Stats().OpenConnections, Equals, workerCount)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(histogram.Write(&metric), IsNil)
+	c.Assert(metric.GetHistogram().GetSampleCount(), Equals, uint64(1))
+}
+
+func (s *warmUpSuite) TestWarmUpFail(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT 1").WillReturnError(errors.New("connection refused"))
+
+	e := newExecutor(db)
+	e.setWorkerCount(1)
+	err = e.warmUp(context.Background())
+	c.Assert(err, ErrorMatches, ".*connection refused.*")
+}
+
+func (s *warmUpSuite) TestNewLoaderWarmUp(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	for i := 0; i < 4; i++ {
+		mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	}
+	_, err = NewLoader(db, WorkerCount(4))
+	c.Assert(err, IsNil)
+	c.Assert(db.Stats().OpenConnections, Equals, 4)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	db2, mock2, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db2.Close()
+
+	_, err = NewLoader(db2, WorkerCount(4), WithWarmUp(false))
+	c.Assert(err, IsNil)
+	c.Assert(db2.Stats().OpenConnections, Less, 4)
+	c.Assert(mock2.ExpectationsWereMet(), IsNil)
+}
+
+type validateDMLsSuite struct{}
+
+var _ = Suite(&validateDMLsSuite{})
+
+func (s *validateDMLsSuite) TestValidateBeforeExec(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "dml_validation_errors_total"})
+	e := newExecutor(db).withValidationErrCounter(counter)
+
+	invalid := &DML{Database: "db", Table: "tbl", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1}}
+	err = e.bulkReplace([]*DML{invalid})
+	c.Assert(errors.Cause(err), Equals, ErrNilTableInfo)
+	err = e.singleExec([]*DML{invalid}, false)
+	c.Assert(errors.Cause(err), Equals, ErrNilTableInfo)
+
+	// no SQL is executed
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(counter.Write(&metric), IsNil)
+	c.Assert(metric.GetCounter().GetValue(), Equals, 2.0)
+}
+
+type workerErrorPolicySuite struct{}
+
+var _ = Suite(&workerErrorPolicySuite{})
+
+func (s *workerErrorPolicySuite) newExecutor(c *C, policy ErrorPolicy) *executor {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	return newExecutor(db).withBatchSize(1).withErrorPolicy(policy)
+}
+
+func (s *workerErrorPolicySuite) genDMLs(n int) []*DML {
+	var dmls []*DML
+	for i := 0; i < n; i++ {
+		dmls = append(dmls, &DML{
+			Database: "unicorn",
+			Table:    "users",
+			Tp:       InsertDMLType,
+			Values: map[string]interface{}{
+				"name": fmt.Sprintf("tester%d", i),
+			},
+			info: &tableInfo{
+				columns: []string{"name"},
+			},
+		})
+	}
+	return dmls
+}
+
+// failingExec returns a exec func which fails the first `times` attempts of the DMLs of the specified names
+func failingExec(times int, names ...string) (exec func([]*DML) error, calls *int32) {
+	calls = new(int32)
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	exec = func(group []*DML) error {
+		atomic.AddInt32(calls, 1)
+		name := group[0].Values["name"].(string)
+		for _, n := range names {
+			if n != name {
+				continue
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[name]++
+			if attempts[name] <= times {
+				return errors.Errorf("fail %s", name)
+			}
+		}
+		return nil
+	}
+	return
+}
+
+func (s *workerErrorPolicySuite) TestStopAllCollectsAllErrors(c *C) {
+	e := s.newExecutor(c, StopAll)
+	counterVec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "worker_errors_total"}, []string{"worker"})
+	e = e.withWorkerErrorCounterVec(counterVec)
+
+	exec, calls := failingExec(1, "tester0", "tester2")
+	err := e.splitExecDML(context.Background(), s.genDMLs(4), exec)
+	c.Assert(err, NotNil)
+	c.Assert(err, FitsTypeOf, workerErrors{})
+	c.Assert(err.(workerErrors), HasLen, 2)
+	c.Assert(err, ErrorMatches, ".*fail tester[02]; .*fail tester[02]")
+	// the healthy workers are not stopped by the failing ones
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(4))
+
+	for worker, expected := range []float64{1, 0, 1, 0} {
+		var metric io_prometheus_client.Metric
+		err = counterVec.WithLabelValues(fmt.Sprintf("%d", worker)).Write(&metric)
+		c.Assert(err, IsNil)
+		c.Assert(metric.Counter.GetValue(), Equals, expected)
+	}
+}
+
+func (s *workerErrorPolicySuite) TestWorkerLabelBounded(c *C) {
+	e := s.newExecutor(c, StopAll)
+	e.setWorkerCount(2)
+	counterVec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "worker_errors_total"}, []string{"worker"})
+	e = e.withWorkerErrorCounterVec(counterVec)
+
+	// the 6 groups are run by 2 workers
+	names := []string{"tester0", "tester1", "tester2", "tester3", "tester4", "tester5"}
+	exec, _ := failingExec(1, names...)
+	err := e.splitExecDML(context.Background(), s.genDMLs(6), exec)
+	c.Assert(err, FitsTypeOf, workerErrors{})
+	c.Assert(err.(workerErrors).Unwrap(), HasLen, 6)
+
+	collected := make(chan prometheus.Metric, 10)
+	counterVec.Collect(collected)
+	close(collected)
+	c.Assert(collected, HasLen, 2)
+	for _, worker := range []string{"0", "1"} {
+		var metric io_prometheus_client.Metric
+		c.Assert(counterVec.WithLabelValues(worker).Write(&metric), IsNil)
+		c.Assert(metric.Counter.GetValue(), Equals, float64(3))
+	}
+}
+
+func (s *workerErrorPolicySuite) TestStopFailingRedistributes(c *C) {
+	e := s.newExecutor(c, StopFailing)
+
+	exec, calls := failingExec(1, "tester1")
+	err := e.splitExecDML(context.Background(), s.genDMLs(3), exec)
+	c.Assert(err, IsNil)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(4))
+
+	exec, calls = failingExec(2, "tester1")
+	err = e.splitExecDML(context.Background(), s.genDMLs(3), exec)
+	c.Assert(err, ErrorMatches, ".*fail tester1")
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(4))
+}
+
+func (s *workerErrorPolicySuite) TestStopFailingWithoutHealthyWorker(c *C) {
+	e := s.newExecutor(c, StopFailing)
+
+	exec, calls := failingExec(1, "tester0", "tester1")
+	err := e.splitExecDML(context.Background(), s.genDMLs(2), exec)
+	c.Assert(err, FitsTypeOf, workerErrors{})
+	c.Assert(err.(workerErrors), HasLen, 2)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(2))
+}
+
+func (s *workerErrorPolicySuite) TestRetryWorker(c *C) {
+	e := s.newExecutor(c, RetryWorker)
+
+	exec, calls := failingExec(1, "tester0", "tester2")
+	err := e.splitExecDML(context.Background(), s.genDMLs(3), exec)
+	c.Assert(err, IsNil)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(5))
+
+	exec, calls = failingExec(2, "tester0")
+	err = e.splitExecDML(context.Background(), s.genDMLs(3), exec)
+	c.Assert(err, ErrorMatches, ".*fail tester0")
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(4))
+}
+
 func (s *executorSuite) TestTryRefreshTableErr(c *C) {
 	tests := []struct {
 		err error
@@ -157,6 +387,109 @@ func (s *singleExecSuite) TestInsert(c *C) {
 	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
 }
 
+func (s *singleExecSuite) TestAutoCreateDatabase(c *C) {
+	newDML := func(db string) *DML {
+		return &DML{
+			Database: db,
+			Table:    "users",
+			Tp:       InsertDMLType,
+			Values: map[string]interface{}{
+				"name": "tester",
+			},
+			info: &tableInfo{
+				columns: []string{"name"},
+			},
+		}
+	}
+	insertSQL := "INSERT INTO `%s`.`users`(`name`) VALUES(?)"
+
+	s.dbMock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `unicorn`")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(insertSQL, "unicorn"))).
+		WithArgs("tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+	// the known database is not created again
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(insertSQL, "unicorn"))).
+		WithArgs("tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(insertSQL, "unicorn"))).
+		WithArgs("tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+	s.dbMock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `pegasus`")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(insertSQL, "pegasus"))).
+		WithArgs("tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	var schemas sync.Map
+	e := newExecutor(s.db).withAutoCreateDatabase(&schemas)
+	err := e.singleExec([]*DML{newDML("unicorn")}, false)
+	c.Assert(err, IsNil)
+	err = e.singleExec([]*DML{newDML("unicorn"), newDML("unicorn")}, false)
+	c.Assert(err, IsNil)
+	// the cache is shared by the executors
+	e = newExecutor(s.db).withAutoCreateDatabase(&schemas)
+	err = e.singleExec([]*DML{newDML("pegasus")}, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+
+	_, ok := schemas.Load("unicorn")
+	c.Assert(ok, IsTrue)
+}
+
+func (s *singleExecSuite) TestAutoCreateDatabaseFailed(c *C) {
+	dml := &DML{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values: map[string]interface{}{
+			"name": "tester",
+		},
+		info: &tableInfo{
+			columns: []string{"name"},
+		},
+	}
+	s.dbMock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `unicorn`")).
+		WillReturnError(errors.New("access denied"))
+
+	var schemas sync.Map
+	e := newExecutor(s.db).withAutoCreateDatabase(&schemas)
+	err := e.singleExec([]*DML{dml}, false)
+	c.Assert(err, ErrorMatches, ".*failed to create database unicorn.*access denied")
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+
+	_, ok := schemas.Load("unicorn")
+	c.Assert(ok, IsFalse)
+}
+
+func (s *singleExecSuite) TestMaxRetryDelay(c *C) {
+	dml := DML{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values: map[string]interface{}{
+			"name": "tester",
+		},
+		info: &tableInfo{
+			columns: []string{"name"},
+		},
+	}
+	s.dbMock.ExpectBegin().WillReturnError(errors.New("begin"))
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `unicorn`.`users`(`name`) VALUES(?)")).
+		WithArgs("tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	e := newExecutor(s.db).withMaxRetryDelay(10 * time.Millisecond)
+	start := time.Now()
+	err := e.singleExecRetry(context.Background(), []*DML{&dml}, false, 3, time.Hour)
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(start), Less, time.Second)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+}
+
 func (s *singleExecSuite) TestSafeUpdate(c *C) {
 	dml := DML{
 		Database: "unicorn",
@@ -232,9 +565,9 @@ func (s *bulkDelSuite) TestCanHandleEmptySlice(c *C) {
 	c.Assert(err, IsNil)
 }
 
-func (s *bulkDelSuite) TestDeleteInBulk(c *C) {
+func (s *bulkDelSuite) genUniqueKeyDeletes(n int) []*DML {
 	var dmls []*DML
-	for i := 0; i < 3; i++ {
+	for i := 0; i < n; i++ {
 		dml := DML{
 			Database: "unicorn",
 			Table:    "users",
@@ -251,22 +584,128 @@ func (s *bulkDelSuite) TestDeleteInBulk(c *C) {
 		}
 		dmls = append(dmls, &dml)
 	}
+	return dmls
+}
 
+func (s *bulkDelSuite) TestDeleteInBulk(c *C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, IsNil)
 
 	mock.ExpectBegin()
 	mock.ExpectExec("(DELETE FROM .*){3}").
 		WithArgs("tester_0", "tester_1", "tester_2").
-		WillReturnResult(sqlmock.NewResult(0, 0))
+		WillReturnResult(sqlmock.NewResult(0, 3))
 	mock.ExpectCommit()
 
-	e := newExecutor(db)
+	e := newExecutor(db).withMultiStatement(true)
+	err = e.bulkDelete(s.genUniqueKeyDeletes(3))
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *bulkDelSuite) TestMultiStatementMode(c *C) {
+	// deleted rows of each mode
+	deleted := make(map[bool]int64)
+	for _, multiStatement := range []bool{false, true} {
+		db, mock, err := sqlmock.New()
+		c.Assert(err, IsNil)
+
+		var affected int64
+		mock.ExpectBegin()
+		if multiStatement {
+			mock.ExpectExec("(DELETE FROM .*;){3}").
+				WithArgs("tester_0", "tester_1", "tester_2").
+				WillReturnResult(sqlmock.NewResult(0, 3))
+			affected = 3
+		} else {
+			for i := 0; i < 3; i++ {
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `unicorn`.`users` WHERE `name` = ? LIMIT 1")).
+					WithArgs(fmt.Sprintf("tester_%d", i)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				affected++
+			}
+		}
+		mock.ExpectCommit()
+
+		e := newExecutor(db).withMultiStatement(multiStatement)
+		err = e.bulkDelete(s.genUniqueKeyDeletes(3))
+		c.Assert(err, IsNil)
+		c.Assert(mock.ExpectationsWereMet(), IsNil, Commentf("multi-statement: %v", multiStatement))
+		deleted[multiStatement] = affected
+		db.Close()
+	}
+	c.Assert(deleted[false], Equals, deleted[true])
+}
+
+func (s *bulkDelSuite) TestCheckMultiStatement(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT VERSION()")).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("5.7.25-TiDB-v3.0.0"))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT 1;SELECT 1")).WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = NewLoader(db, WithWarmUp(false), WithMultiStatementMode(true))
+	c.Assert(err, IsNil)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT VERSION()")).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("5.7.25-log"))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT 1;SELECT 1")).WillReturnError(errors.New("syntax error"))
+	_, err = NewLoader(db, WithWarmUp(false), WithMultiStatementMode(true))
+	c.Assert(err, ErrorMatches, ".*multiStatements=true should be set.*")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT VERSION()")).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("4.0.30"))
+	_, err = NewLoader(db, WithWarmUp(false), WithMultiStatementMode(true))
+	c.Assert(err, ErrorMatches, ".*not supported by downstream 4.0.30.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *bulkDelSuite) genDeletes(table string, pk []string, values ...[]interface{}) []*DML {
+	info := &tableInfo{columns: append(pk, "v"), uniqueKeys: []indexInfo{{"PRIMARY", pk}}}
+	info.primaryKey = &info.uniqueKeys[0]
+	var dmls []*DML
+	for _, vals := range values {
+		dml := &DML{Database: "db", Table: table, Tp: DeleteDMLType, Values: map[string]interface{}{"v": 0}, info: info}
+		for i, name := range pk {
+			dml.Values[name] = vals[i]
+		}
+		dmls = append(dmls, dml)
+	}
+	return dmls
+}
+
+func (s *bulkDelSuite) TestDeleteUsingIN(c *C) {
+	dmls := s.genDeletes("t1", []string{"id"}, []interface{}{1}, []interface{}{2})
+	dmls = append(dmls, s.genDeletes("t2", []string{"a", "b"}, []interface{}{1, "x"}, []interface{}{2, "y"})...)
+	dmls = append(dmls, s.genDeletes("t1", []string{"id"}, []interface{}{3})...)
+	// the delete without primary key values is executed by itself
+	noPK := &DML{Database: "db", Table: "t3", Tp: DeleteDMLType, Values: map[string]interface{}{"v": 1}, info: &tableInfo{columns: []string{"v"}}}
+	dmls = append(dmls, noPK)
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`t1` WHERE `id` IN (?,?,?);"+
+		"DELETE FROM `db`.`t2` WHERE (`a`,`b`) IN ((?,?),(?,?));"+
+		"DELETE FROM `db`.`t3` WHERE `v` = ? LIMIT 1;")).
+		WithArgs(1, 2, 3, 1, "x", 2, "y", 1).
+		WillReturnResult(sqlmock.NewResult(0, 6))
+	mock.ExpectCommit()
+
+	e := newExecutor(db).withBulkDeleteUsingIN(true).withMultiStatement(true)
 	err = e.bulkDelete(dmls)
 	c.Assert(err, IsNil)
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
 
+func (s *bulkDelSuite) TestGroupDeletesByPK(c *C) {
+	dmls := s.genDeletes("t1", []string{"id"}, []interface{}{1}, []interface{}{nil}, []interface{}{2})
+	groups := groupDeletesByPK(dmls)
+	c.Assert(groups, DeepEquals, [][]*DML{{dmls[0], dmls[2]}, {dmls[1]}})
+}
+
 type bulkReplaceSuite struct{}
 
 var _ = Suite(&bulkReplaceSuite{})
@@ -313,3 +752,367 @@ func (s *bulkReplaceSuite) TestReplaceInBulk(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
+
+func (s *bulkReplaceSuite) TestColumnDefaultFiller(c *C) {
+	dml := &DML{
+		Database: "d",
+		Table:    "t",
+		Tp:       InsertDMLType,
+		Values: map[string]interface{}{
+			"id": 1,
+		},
+		info: &tableInfo{
+			columns: []string{"id", "name", "age", "note"},
+		},
+	}
+	var filled []string
+	filler := func(schema, table, column string) (interface{}, bool) {
+		c.Assert(schema, Equals, "d")
+		c.Assert(table, Equals, "t")
+		filled = append(filled, column)
+		switch column {
+		case "name":
+			return "unknown", true
+		case "age":
+			return 18, true
+		default:
+			return nil, false
+		}
+	}
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	mock.ExpectBegin()
+	sql := "REPLACE INTO `d`.`t`(`id`,`name`,`age`,`note`) VALUES (?,?,?,?)"
+	mock.ExpectExec(regexp.QuoteMeta(sql)).
+		WithArgs(1, "unknown", 18, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	e := newExecutor(db).withColumnDefaultFiller(filler)
+	err = e.bulkReplace([]*DML{dml})
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	// only called for the absent columns
+	c.Assert(filled, DeepEquals, []string{"name", "age", "note"})
+	c.Assert(dml.Values, HasLen, 1)
+}
+
+type txnTimeoutSuite struct{}
+
+var _ = Suite(&txnTimeoutSuite{})
+
+func (s *txnTimeoutSuite) TestTimeout(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	dml := &DML{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values: map[string]interface{}{
+			"name": "tester",
+		},
+		info: &tableInfo{
+			columns: []string{"name"},
+		},
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillDelayFor(2 * time.Second).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectRollback()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	e := newExecutor(db).withTransactionTimeout(500 * time.Millisecond).withTxnTimeoutCounter(counter)
+	start := time.Now()
+	err = e.singleExec([]*DML{dml}, false)
+	c.Assert(errors.Cause(err), Equals, ErrTransactionTimeout)
+	c.Assert(time.Since(start), Less, 2*time.Second)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(counter.Write(&metric), IsNil)
+	c.Assert(metric.GetCounter().GetValue(), Equals, 1.0)
+}
+
+func (s *txnTimeoutSuite) TestNotTimeout(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	dml := &DML{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values: map[string]interface{}{
+			"name": "tester",
+		},
+		info: &tableInfo{
+			columns: []string{"name"},
+		},
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillDelayFor(10 * time.Millisecond).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	e := newExecutor(db).withTransactionTimeout(500 * time.Millisecond)
+	err = e.singleExec([]*DML{dml}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+type batchTimeoutSuite struct{}
+
+var _ = Suite(&batchTimeoutSuite{})
+
+func (s *batchTimeoutSuite) genDMLs() []*DML {
+	info := &tableInfo{columns: []string{"id"}, uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}}}
+	info.primaryKey = &info.uniqueKeys[0]
+	return []*DML{
+		{Database: "d", Table: "t", Tp: DeleteDMLType, Values: map[string]interface{}{"id": 1}, info: info},
+		{Database: "d", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 2}, info: info},
+	}
+}
+
+func (s *batchTimeoutSuite) TestTimeout(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// the inserts are not executed after timeout
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillDelayFor(20 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	e := newExecutor(db).withBatchTimeoutCounter(counter)
+	err = e.execTableBatchWithTimeout(context.Background(), s.genDMLs(), time.Millisecond)
+	c.Assert(errors.Cause(err), Equals, context.DeadlineExceeded)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(counter.Write(&metric), IsNil)
+	c.Assert(metric.GetCounter().GetValue(), Equals, 1.0)
+}
+
+func (s *batchTimeoutSuite) TestNoTimeout(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillDelayFor(20 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	e := newExecutor(db)
+	err = e.execTableBatchWithTimeout(context.Background(), s.genDMLs(), 0)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+type connRetrySuite struct {
+	origInterval time.Duration
+}
+
+var _ = Suite(&connRetrySuite{})
+
+func (s *connRetrySuite) SetUpTest(c *C) {
+	s.origInterval = connRetryInterval
+	connRetryInterval = time.Millisecond
+}
+
+func (s *connRetrySuite) TearDownTest(c *C) {
+	connRetryInterval = s.origInterval
+}
+
+func (s *connRetrySuite) TestReconnect(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		mock.ExpectBegin().WillReturnError(mysql.ErrInvalidConn)
+	}
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	e := newExecutor(db).withConnectionRetry(time.Second).withReconnectCounter(counter)
+	tx, err := e.begin(nil)
+	c.Assert(err, IsNil)
+	c.Assert(tx.commit(), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(counter.Write(&metric), IsNil)
+	c.Assert(metric.GetCounter().GetValue(), Equals, 3.0)
+}
+
+func (s *connRetrySuite) TestReconnectTimeout(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	for i := 0; i < 100; i++ {
+		mock.ExpectBegin().WillReturnError(mysql.ErrInvalidConn)
+	}
+
+	start := time.Now()
+	e := newExecutor(db).withConnectionRetry(50 * time.Millisecond)
+	_, err = e.begin(nil)
+	c.Assert(errors.Cause(err), Equals, mysql.ErrInvalidConn)
+	c.Assert(err, ErrorMatches, ".*failed to reconnect in 50ms.*")
+	c.Assert(time.Since(start) >= 50*time.Millisecond, IsTrue)
+}
+
+func (s *connRetrySuite) TestReconnectCancelled(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectBegin().WillReturnError(mysql.ErrInvalidConn)
+
+	connRetryInterval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	e := newExecutor(db).withConnectionRetry(time.Hour).withContext(ctx)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err = e.begin(nil)
+	c.Assert(errors.Cause(err), Equals, context.Canceled)
+	c.Assert(err, ErrorMatches, ".*stop reconnecting, last error: invalid connection.*")
+	c.Assert(time.Since(start) < 5*time.Second, IsTrue)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *connRetrySuite) TestNoRetryForOtherErrors(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectBegin().WillReturnError(errors.New("access denied"))
+
+	e := newExecutor(db).withConnectionRetry(time.Second)
+	_, err = e.begin(nil)
+	c.Assert(err, ErrorMatches, "access denied")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+type parallelDDLSuite struct{}
+
+var _ = Suite(&parallelDDLSuite{})
+
+func (s *parallelDDLSuite) expectDDL(mock sqlmock.Sqlmock, ddl *DDL, delay time.Duration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("use %s;", quoteName(ddl.Database)))).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(ddl.SQL)).WillDelayFor(delay).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
+
+func (s *parallelDDLSuite) TestIndependentSchemas(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	const delay = 100 * time.Millisecond
+	var ddls []*DDL
+	for i := 0; i < 4; i++ {
+		ddl := &DDL{Database: fmt.Sprintf("db%d", i), Table: "t", SQL: fmt.Sprintf("ALTER TABLE t%d ADD COLUMN c INT", i)}
+		s.expectDDL(mock, ddl, delay)
+		ddls = append(ddls, ddl)
+	}
+
+	e := newExecutor(db).withSchemaLocks(&schemaLocks{})
+	start := time.Now()
+	c.Assert(e.execParallelDDL(context.Background(), ddls), IsNil)
+	c.Assert(time.Since(start) < 4*delay, IsTrue)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *parallelDDLSuite) TestWaitForDMLs(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ddl := &DDL{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN c INT"}
+	s.expectDDL(mock, ddl, 0)
+
+	locks := &schemaLocks{}
+	done := locks.startDMLs([]*DML{{Database: "test", Table: "t"}, {Database: "test", Table: "t2"}})
+
+	const wait = 50 * time.Millisecond
+	start := time.Now()
+	time.AfterFunc(wait, done)
+	e := newExecutor(db).withSchemaLocks(locks)
+	c.Assert(e.execParallelDDL(context.Background(), []*DDL{ddl}), IsNil)
+	c.Assert(time.Since(start) >= wait, IsTrue)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the DMLs of other schemas don't wait for the DDL
+	unlock := locks.lockDDL("test")
+	locks.startDMLs([]*DML{{Database: "other", Table: "t"}})()
+	unlock()
+}
+
+func (s *parallelDDLSuite) TestFailed(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ddls := []*DDL{
+		{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN c INT"},
+		{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN d INT"},
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("use .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE .*").WillReturnError(errors.New("duplicate column"))
+	mock.ExpectRollback()
+
+	e := newExecutor(db)
+	err = e.execParallelDDL(context.Background(), ddls)
+	c.Assert(err, ErrorMatches, "exec ddl ALTER TABLE t ADD COLUMN c INT: duplicate column")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *executorSuite) TestReportSchemaDrift(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	oldInfo := &tableInfo{columns: []string{"id", "name"}, columnTypes: map[string]string{"id": "int(11)", "name": "varchar(20)"}}
+	newInfo := &tableInfo{columns: []string{"id", "name", "age"}, columnTypes: map[string]string{"id": "int(11)", "name": "varchar(20)", "age": "int(11)"}}
+	dmls := []*DML{
+		{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": "a"}, info: oldInfo},
+		{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 2, "name": "b"}, info: oldInfo},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillReturnError(&mysql.MySQLError{Number: 1054, Message: "Unknown column"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	e := newExecutor(db).withSchemaDriftCounter(counter).withRefreshTableInfo(func(schema string, table string) (*tableInfo, error) {
+		return newInfo, nil
+	})
+	c.Assert(e.singleExecRetry(context.Background(), dmls, false, 2, time.Millisecond), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	c.Assert(dmls[0].info, check.Equals, newInfo)
+
+	// reported once for the table
+	var metric io_prometheus_client.Metric
+	c.Assert(counter.Write(&metric), check.IsNil)
+	c.Assert(metric.GetCounter().GetValue(), check.Equals, 1.0)
+}
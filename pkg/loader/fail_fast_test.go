@@ -0,0 +1,98 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type failFastSuite struct{}
+
+var _ = check.Suite(&failFastSuite{})
+
+func (s *failFastSuite) TestExecTableBatch(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	// the failed worker is not restarted either
+	e := newExecutor(db).withFailFast(true).withErrorPolicy(RetryWorker)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnError(errors.New("duplicate entry"))
+	mock.ExpectRollback()
+
+	dmls := []*DML{newCaptureTestDML(DeleteDMLType, 1)}
+	err = e.execTableBatchRetry(context.Background(), dmls, 3, time.Millisecond)
+	c.Assert(err, check.ErrorMatches, "duplicate entry")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *failFastSuite) TestSingleExec(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	e := newExecutor(db).withFailFast(true)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillReturnError(errors.New("duplicate entry"))
+	mock.ExpectRollback()
+
+	dmls := []*DML{newCaptureTestDML(InsertDMLType, 1)}
+	err = e.singleExecRetry(context.Background(), dmls, false, 3, time.Millisecond)
+	c.Assert(err, check.ErrorMatches, "duplicate entry")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *failFastSuite) TestRetryByDefault(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	e := newExecutor(db)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillReturnError(errors.New("lost connection"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dmls := []*DML{newCaptureTestDML(InsertDMLType, 1)}
+	c.Assert(e.singleExecRetry(context.Background(), dmls, false, 3, time.Millisecond), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *failFastSuite) TestLoaderOption(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	l, err := NewLoader(db, WithFailFast(true))
+	c.Assert(err, check.IsNil)
+	ld := l.(*loaderImpl)
+	c.Assert(ld.getExecutor().failFast, check.IsTrue)
+
+	// the DDL is not retried
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DROP TABLE").WillReturnError(errors.New("unknown table"))
+	mock.ExpectRollback()
+	err = ld.execDDL(&DDL{Database: "test", Table: "t", SQL: "DROP TABLE t"})
+	c.Assert(err, check.ErrorMatches, "exec ddl DROP TABLE t: unknown table")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
@@ -0,0 +1,279 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	schemaColsSQL = `
+SELECT table_name, column_name, extra, column_type FROM information_schema.columns
+WHERE table_schema = ? ORDER BY table_name, ordinal_position;`
+	schemaUniqKeysSQL = `
+SELECT table_name, non_unique, index_name, seq_in_index, column_name
+FROM information_schema.statistics
+WHERE table_schema = ?
+ORDER BY table_name, seq_in_index ASC;`
+	schemaShardingInfoSQL = `
+SELECT table_name, tidb_row_id_sharding_info FROM information_schema.tables
+WHERE table_schema = ?;`
+)
+
+// InfoSchemaCache caches the table info of the downstream. All tables of a schema are
+// pre-fetched together the first time any of them is requested, so the DMLs of other
+// tables in the same schema don't need to query the downstream again.
+type InfoSchemaCache struct {
+	db *gosql.DB
+
+	mu sync.RWMutex
+	// schema -> table -> info, the schema exists only if it's loaded.
+	schemas map[string]map[string]*tableInfo
+	// bumped when any table of the schema is evicted, a loading started before that is discarded.
+	generations map[string]uint64
+
+	group singleflight.Group
+	// only used to wait the async refreshing in unit test
+	wg sync.WaitGroup
+}
+
+// NewInfoSchemaCache returns a InfoSchemaCache fetching table info from db.
+func NewInfoSchemaCache(db *gosql.DB) *InfoSchemaCache {
+	return &InfoSchemaCache{
+		db:          db,
+		schemas:     make(map[string]map[string]*tableInfo),
+		generations: make(map[string]uint64),
+	}
+}
+
+// Refresh reloads all tables of the schema from the downstream.
+func (c *InfoSchemaCache) Refresh(schema string) error {
+	_, err, _ := c.group.Do(schema, func() (interface{}, error) {
+		return nil, c.load(schema)
+	})
+	return errors.Trace(err)
+}
+
+// RefreshAsync triggers reloading all tables of the schema in the background without blocking.
+func (c *InfoSchemaCache) RefreshAsync(schema string) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		if err := c.Refresh(schema); err != nil {
+			log.Warn("refresh table info of schema failed", zap.String("schema", schema), zap.Error(err))
+		}
+	}()
+}
+
+func (c *InfoSchemaCache) evict(schema string, table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[schema]++
+	if tables, ok := c.schemas[schema]; ok {
+		delete(tables, table)
+	}
+}
+
+// tableCount returns the count of cached tables of the schema.
+func (c *InfoSchemaCache) tableCount(schema string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.schemas[schema])
+}
+
+func (c *InfoSchemaCache) lookup(schema string, table string) (info *tableInfo, loaded bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	tables, loaded := c.schemas[schema]
+	return tables[table], loaded
+}
+
+// getTableInfo returns the cached table info, the schema is pre-fetched if it's not loaded yet.
+func (c *InfoSchemaCache) getTableInfo(schema string, table string) (*tableInfo, error) {
+	info, loaded := c.lookup(schema, table)
+	if info != nil {
+		return info, nil
+	}
+
+	if !loaded {
+		_, err, _ := c.group.Do(schema, func() (interface{}, error) {
+			if _, loaded := c.lookup(schema, table); loaded {
+				return nil, nil
+			}
+			return nil, c.load(schema)
+		})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if info, _ = c.lookup(schema, table); info != nil {
+			return info, nil
+		}
+	}
+
+	// the table is created or evicted after the schema is loaded
+	c.mu.RLock()
+	generation := c.generations[schema]
+	c.mu.RUnlock()
+
+	info, err := getTableInfo(c.db, schema, table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	c.mu.Lock()
+	if tables, ok := c.schemas[schema]; ok && c.generations[schema] == generation {
+		tables[table] = info
+	}
+	c.mu.Unlock()
+
+	return info, nil
+}
+
+func (c *InfoSchemaCache) load(schema string) error {
+	c.mu.RLock()
+	generation := c.generations[schema]
+	c.mu.RUnlock()
+
+	tables, err := loadSchemaTableInfos(c.db, schema)
+	if err != nil {
+		return errors.Annotatef(err, "schema `%s`", schema)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[schema] != generation {
+		log.Info("discard the stale table info of schema", zap.String("schema", schema))
+		return nil
+	}
+	c.schemas[schema] = tables
+
+	return nil
+}
+
+// loadSchemaTableInfos returns the info of all tables in the schema.
+func loadSchemaTableInfos(db *gosql.DB, schema string) (map[string]*tableInfo, error) {
+	tables := make(map[string]*tableInfo)
+
+	rows, err := db.Query(schemaColsSQL, schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, name, extra, tp string
+		if err = rows.Scan(&table, &name, &extra, &tp); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		info, ok := tables[table]
+		if !ok {
+			info = &tableInfo{columnTypes: make(map[string]string)}
+			tables[table] = info
+		}
+
+		isGenerated := strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED")
+		if isGenerated {
+			continue
+		}
+		info.columns = append(info.columns, name)
+		info.columnTypes[name] = tp
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	keyRows, err := db.Query(schemaUniqKeysSQL, schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer keyRows.Close()
+
+	for keyRows.Next() {
+		var (
+			table      string
+			nonUnique  int
+			keyName    string
+			seqInIndex int
+			columnName string
+		)
+		if err = keyRows.Scan(&table, &nonUnique, &keyName, &seqInIndex, &columnName); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		info, ok := tables[table]
+		if !ok || nonUnique == 1 {
+			continue
+		}
+		info.uniqueKeys = appendUniqKeyColumn(info.uniqueKeys, keyName, columnName)
+	}
+	if err = keyRows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for table, info := range tables {
+		// same as getTableInfo, a table without any non-generated columns is treated as not exist.
+		if len(info.columns) == 0 {
+			delete(tables, table)
+			continue
+		}
+		info.setPrimaryKey()
+	}
+
+	for table, bits := range loadSchemaShardRowIDBits(db, schema) {
+		if info, ok := tables[table]; ok && info.primaryKey == nil {
+			info.shardRowIDBits = bits
+		}
+	}
+
+	return tables, nil
+}
+
+// loadSchemaShardRowIDBits returns the SHARD_ROW_ID_BITS of the sharded tables in the schema,
+// it's empty if the downstream is not TiDB.
+func loadSchemaShardRowIDBits(db *gosql.DB, schema string) map[string]int {
+	rows, err := db.Query(schemaShardingInfoSQL, schema)
+	if err != nil {
+		// the column only exists in TiDB 4.0 and later
+		log.Debug("failed to get the sharding info of schema", zap.String("schema", schema), zap.Error(err))
+		return nil
+	}
+	defer rows.Close()
+
+	bits := make(map[string]int)
+	for rows.Next() {
+		var table string
+		var info gosql.NullString
+		if err = rows.Scan(&table, &info); err != nil {
+			log.Debug("failed to get the sharding info of schema", zap.String("schema", schema), zap.Error(err))
+			return nil
+		}
+		if n := parseShardRowIDBits(info.String); n > 0 {
+			bits[table] = n
+		}
+	}
+	return bits
+}
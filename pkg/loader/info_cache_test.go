@@ -0,0 +1,244 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+	"sync"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+type infoCacheSuite struct{}
+
+var _ = check.Suite(&infoCacheSuite{})
+
+func expectLoadSchema(mock sqlmock.Sqlmock, schema string, cols [][]string) {
+	colRows := sqlmock.NewRows([]string{"table_name", "column_name", "extra", "column_type"})
+	for _, col := range cols {
+		colRows.AddRow(col[0], col[1], col[2], "int(11)")
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(schemaColsSQL)).WithArgs(schema).WillReturnRows(colRows)
+
+	keyRows := sqlmock.NewRows([]string{"table_name", "non_unique", "index_name", "seq_in_index", "column_name"}).
+		AddRow("t1", 0, "PRIMARY", 1, "id").
+		AddRow("t2", 1, "idx_name", 1, "name").
+		AddRow("t2", 0, "uk_a_b", 1, "a").
+		AddRow("t2", 0, "uk_a_b", 2, "b")
+	mock.ExpectQuery(regexp.QuoteMeta(schemaUniqKeysSQL)).WithArgs(schema).WillReturnRows(keyRows)
+}
+
+var testSchemaCols = [][]string{
+	{"t1", "id", ""},
+	{"t1", "name", ""},
+	{"t2", "a", ""},
+	{"t2", "b", ""},
+	{"t2", "name", ""},
+	{"t2", "c", "VIRTUAL GENERATED"},
+	{"t3", "g", "STORED GENERATED"},
+}
+
+func (s *infoCacheSuite) TestColdCacheAndHit(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	cache := NewInfoSchemaCache(db)
+
+	expectLoadSchema(mock, "test", testSchemaCols)
+
+	info, err := cache.getTableInfo("test", "t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.columns, check.DeepEquals, []string{"id", "name"})
+	c.Assert(info.primaryKey, check.NotNil)
+	c.Assert(info.primaryKey.columns, check.DeepEquals, []string{"id"})
+
+	// t2 is pre-fetched with t1, no more query
+	info, err = cache.getTableInfo("test", "t2")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.columns, check.DeepEquals, []string{"a", "b", "name"})
+	c.Assert(info.primaryKey, check.IsNil)
+	c.Assert(info.uniqueKeys, check.DeepEquals, []indexInfo{{"uk_a_b", []string{"a", "b"}}})
+
+	info2, err := cache.getTableInfo("test", "t2")
+	c.Assert(err, check.IsNil)
+	c.Assert(info2, check.Equals, info)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// t3 has only generated columns, it's fetched alone and treated as not exist.
+	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "t3").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra", "column_type"}).AddRow("g", "STORED GENERATED", "int(11)"))
+	_, err = cache.getTableInfo("test", "t3")
+	c.Assert(errors.Cause(err), check.Equals, ErrTableNotExist)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *infoCacheSuite) TestEvict(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	cache := NewInfoSchemaCache(db)
+
+	expectLoadSchema(mock, "test", testSchemaCols)
+	_, err = cache.getTableInfo("test", "t1")
+	c.Assert(err, check.IsNil)
+
+	cache.evict("test", "t1")
+	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "t1").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra", "column_type"}).AddRow("id", "", "int(11)").AddRow("age", "", "int(11)"))
+	mock.ExpectQuery(regexp.QuoteMeta(uniqKeysSQL)).WithArgs("test", "t1").
+		WillReturnRows(sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"}).AddRow(0, "PRIMARY", 1, "id"))
+
+	info, err := cache.getTableInfo("test", "t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.columns, check.DeepEquals, []string{"id", "age"})
+
+	// the refetched info is cached
+	_, err = cache.getTableInfo("test", "t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *infoCacheSuite) TestRefreshAsync(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	cache := NewInfoSchemaCache(db)
+
+	expectLoadSchema(mock, "test", testSchemaCols)
+	_, err = cache.getTableInfo("test", "t1")
+	c.Assert(err, check.IsNil)
+
+	expectLoadSchema(mock, "test", [][]string{{"t1", "id", ""}, {"t1", "name", ""}, {"t1", "email", ""}})
+	cache.RefreshAsync("test")
+	cache.wg.Wait()
+
+	info, err := cache.getTableInfo("test", "t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.columns, check.DeepEquals, []string{"id", "name", "email"})
+
+	// t2 is dropped
+	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "t2").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra", "column_type"}))
+	_, err = cache.getTableInfo("test", "t2")
+	c.Assert(errors.Cause(err), check.Equals, ErrTableNotExist)
+
+	// the failure of async refreshing doesn't evict the cached info
+	mock.ExpectQuery(regexp.QuoteMeta(schemaColsSQL)).WithArgs("test").WillReturnError(errors.New("timeout"))
+	cache.RefreshAsync("test")
+	cache.wg.Wait()
+	info, err = cache.getTableInfo("test", "t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.columns, check.DeepEquals, []string{"id", "name", "email"})
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *infoCacheSuite) TestConcurrentAccess(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	cache := NewInfoSchemaCache(db)
+
+	// the schema is loaded only once
+	expectLoadSchema(mock, "test", testSchemaCols)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		table := "t1"
+		if i%2 == 0 {
+			table = "t2"
+		}
+		go func() {
+			defer wg.Done()
+			info, err := cache.getTableInfo("test", table)
+			c.Assert(err, check.IsNil)
+			c.Assert(info, check.NotNil)
+		}()
+	}
+	wg.Wait()
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *infoCacheSuite) TestLoaderUseInfoCache(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	ldi, err := NewLoader(db)
+	c.Assert(err, check.IsNil)
+	ld := ldi.(*loaderImpl)
+
+	expectLoadSchema(mock, "test", testSchemaCols)
+	info, err := ld.getTableInfo("test", "t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.columns, check.DeepEquals, []string{"id", "name"})
+	info, err = ld.getTableInfo("test", "t2")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.columns, check.DeepEquals, []string{"a", "b", "name"})
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *infoCacheSuite) TestPrefetchTableInfo(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	expectLoadSchema(mock, "test", testSchemaCols)
+	tables := prometheus.NewCounter(prometheus.CounterOpts{Name: "prefetch_tables"})
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "prefetch_duration"})
+	ldi, err := NewLoader(db, EnableDispatch(false), WithWarmUp(false), WithPrefetchTableInfo([]string{"test"}),
+		Metrics(&MetricsGroup{PrefetchTablesCounter: tables, PrefetchHistogram: duration}))
+	c.Assert(err, check.IsNil)
+	ld := ldi.(*loaderImpl)
+
+	// populated before any DML is processed
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	info, loaded := ld.infoCache.lookup("test", "t1")
+	c.Assert(loaded, check.IsTrue)
+	c.Assert(info.columns, check.DeepEquals, []string{"id", "name"})
+	c.Assert(ld.infoCache.tableCount("test"), check.Equals, 2)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(tables.Write(&metric), check.IsNil)
+	c.Assert(metric.GetCounter().GetValue(), check.Equals, float64(2))
+	c.Assert(duration.Write(&metric), check.IsNil)
+	c.Assert(metric.GetHistogram().GetSampleCount(), check.Equals, uint64(1))
+
+	// no more query of table info when executing DML
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var runErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		runErr = ld.Run()
+	}()
+	go func() {
+		defer wg.Done()
+		for range ld.Successes() {
+		}
+	}()
+	ld.Input() <- &Txn{DMLs: []*DML{{
+		Database: "test",
+		Table:    "t1",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"id": 1, "name": "pingcap"},
+	}}}
+	ld.Close()
+
+	wg.Wait()
+	c.Assert(runErr, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
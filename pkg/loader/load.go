@@ -18,16 +18,18 @@ import (
 	gosql "database/sql"
 	"fmt"
 	"math"
+	"os"
+	"os/signal"
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
-	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
@@ -43,6 +45,8 @@ const (
 	maxDDLRetryCount = 5
 
 	execLimitMultiple = 3
+
+	warmUpTimeout = 30 * time.Second
 )
 
 var (
@@ -50,6 +54,7 @@ var (
 	fNewBatchManager            = newBatchManager
 	fGetAppliedTS               = getAppliedTS
 	updateLastAppliedTSInterval = time.Minute
+	healthCheckInterval         = time.Minute
 )
 
 // Loader is used to load data to mysql
@@ -60,6 +65,12 @@ type Loader interface {
 	Successes() <-chan *Txn
 	Close()
 	Run() error
+	// Stats returns the statistics of the loader, it's safe to be called concurrently.
+	Stats() LoaderStats
+	// WorkerCount returns the number of workers executing the DMLs concurrently.
+	WorkerCount() int
+	// SetWorkerCount changes the number of workers of the running loader, n must be at least 1.
+	SetWorkerCount(n int) error
 }
 
 var _ Loader = &loaderImpl{}
@@ -73,6 +84,16 @@ type loaderImpl struct {
 	opts               options
 
 	tableInfos sync.Map
+	// the schemas known to exist in downstream, only used when autoCreateDatabase is enabled
+	knownSchemas sync.Map
+	// used to get table info from db if getTableInfoFromDB is not set
+	infoCache *InfoSchemaCache
+	// only set by NewChaosMiddleware in test
+	chaos *chaos
+	// the pool to run the workers of executors, only set when running
+	pool *RoundRobinWorkerPool
+	// makes the DDLs of a schema wait for the in-flight DMLs of the schema
+	schemaLocks schemaLocks
 
 	batchSize   int
 	workerCount int
@@ -80,10 +101,19 @@ type loaderImpl struct {
 
 	loopBackSyncInfo *loopbacksync.LoopBackSync
 
+	// workerCount is only changed by Run, workerCountMu guards it against the readers out of Run
+	workerCountMu sync.RWMutex
+	// the worker counts set by SetWorkerCount, Run applies them between the batches and acks by resized
+	resizeCh chan int
+	resized  chan struct{}
+
 	input      chan *Txn
 	successTxn chan *Txn
+	// the requests to flush the accumulated DMLs, nil if WithBatchFlushOnSignal is not set
+	flushReqs chan struct{}
 
 	metrics *MetricsGroup
+	stats   loaderStats
 
 	// change update -> delete + replace
 	// insert -> replace
@@ -97,6 +127,9 @@ type loaderImpl struct {
 	saveAppliedTS           bool
 	lastUpdateAppliedTSTime time.Time
 
+	// the max commit ts of input txns, only used when commitTSOrdering is enabled
+	lastSeenTS int64
+
 	// TODO: remove this ctx, context shouldn't stored in struct
 	// https://github.com/pingcap/tidb-binlog/pull/691#issuecomment-515387824
 	ctx    context.Context
@@ -105,11 +138,41 @@ type loaderImpl struct {
 
 // MetricsGroup contains metrics of Loader
 type MetricsGroup struct {
-	EventCounterVec   *prometheus.CounterVec
-	QueryHistogramVec *prometheus.HistogramVec
-	QueueSizeGauge    *prometheus.GaugeVec
+	EventCounterVec       *prometheus.CounterVec
+	QueryHistogramVec     *prometheus.HistogramVec
+	QueueSizeGauge        *prometheus.GaugeVec
+	WorkerErrorCounterVec *prometheus.CounterVec
+	OutOfOrderCounter     prometheus.Counter
+	WarmUpHistogram       prometheus.Histogram
+	ValidationErrCounter  prometheus.Counter
+	TxnTimeoutCounter     prometheus.Counter
+	ReconnectCounter      prometheus.Counter
+	PrefetchTablesCounter prometheus.Counter
+	PrefetchHistogram     prometheus.Histogram
+	BatchTimeoutCounter   prometheus.Counter
+	DeadlockCounter       prometheus.Counter
+	SchemaDriftCounter    prometheus.Counter
+	SlowQueryCounter      prometheus.Counter
+	TableEventCounterVec  *prometheus.CounterVec
+	MissingRowCounter     prometheus.Counter
+	NoopUpdateCounter     prometheus.Counter
+	RetryHistogram        prometheus.Histogram
+	TxnQueryHistogramVec  *prometheus.HistogramVec
+	BatchQueueHistogram   prometheus.Histogram
+	BatchExecuteHistogram prometheus.Histogram
 }
 
+// OutOfOrderPolicy decides what to do with the txn whose commit ts is less than the last one
+type OutOfOrderPolicy int
+
+// OutOfOrderPolicy values.
+const (
+	// OutOfOrderStrict stops the loader with an error
+	OutOfOrderStrict OutOfOrderPolicy = iota
+	// OutOfOrderWarn logs a warning and skips the txn
+	OutOfOrderWarn
+)
+
 // SyncMode represents the sync mode of DML.
 type SyncMode int
 
@@ -129,6 +192,57 @@ type options struct {
 	enableDispatch   bool
 	enableCausality  bool
 	merge            bool
+	errorPolicy      ErrorPolicy
+	errorRecorder    *ErrorRecorder
+	defaultFiller    ColumnDefaultFiller
+	commitTSOrdering bool
+	outOfOrderPolicy OutOfOrderPolicy
+	warmUp           bool
+	autoCreateDB     bool
+	maxRetryDelay    time.Duration
+	txnTimeout       time.Duration
+	connRetryMaxWait time.Duration
+	batchGroupBy     bool
+	prefetchSchemas  []string
+	batchTimeout     time.Duration
+	txnHooks         TxnLifecycleHooks
+	deleteUsingIN    bool
+	multiStatement   bool
+	columnEncryptor  *columnEncryptor
+	columnMasker     *columnMasker
+	flushOnSignal    bool
+	maxBatchWaitTime time.Duration
+	shadowSuffix     string
+	tableSizes       *TableSizeEstimator
+	slowQueries      *slowQueryDetector
+	eventStats       *EventStats
+	rowExistence     bool
+	failFast         bool
+	zeroValueFilter  bool
+	txnIDLabel       bool
+}
+
+// TxnLifecycleHooks are called at the lifecycle points of every txn with the time of the event,
+// they're called synchronously in the loader, so they should return quickly.
+type TxnLifecycleHooks struct {
+	// OnEnqueue is called when the txn is received from Input
+	OnEnqueue func(txn *Txn, ts time.Time)
+	// OnDispatch is called before the DMLs or DDL of the txn are executed
+	OnDispatch func(txn *Txn, ts time.Time)
+	// OnCommit is called when the txn is executed successfully, before it's sent to Successes
+	OnCommit func(txn *Txn, ts time.Time)
+	// OnError is called when the txn fails to be executed
+	OnError func(txn *Txn, ts time.Time)
+}
+
+func callTxnHook(hook func(txn *Txn, ts time.Time), txns ...*Txn) {
+	if hook == nil {
+		return
+	}
+	now := time.Now()
+	for _, txn := range txns {
+		hook(txn, now)
+	}
 }
 
 var defaultLoaderOptions = options{
@@ -141,6 +255,10 @@ var defaultLoaderOptions = options{
 	enableDispatch:   true,
 	enableCausality:  true,
 	merge:            false,
+	errorPolicy:      StopAll,
+	commitTSOrdering: false,
+	outOfOrderPolicy: OutOfOrderStrict,
+	warmUp:           true,
 }
 
 // A Option sets options such batch size, worker count etc.
@@ -170,6 +288,242 @@ func EnableCausality(b bool) Option {
 	}
 }
 
+// WithWorkerErrorPolicy set how to handle the other workers when one worker fails to execute DMLs.
+func WithWorkerErrorPolicy(p ErrorPolicy) Option {
+	return func(o *options) {
+		o.errorPolicy = p
+	}
+}
+
+// WithErrorRecorder set the recorder to capture the errors of executing DMLs.
+func WithErrorRecorder(r *ErrorRecorder) Option {
+	return func(o *options) {
+		o.errorRecorder = r
+	}
+}
+
+// WithColumnDefaultFiller set the function to supply the values of the columns absent from the DMLs,
+// which are written as NULL otherwise when replacing rows.
+func WithColumnDefaultFiller(fn ColumnDefaultFiller) Option {
+	return func(o *options) {
+		o.defaultFiller = fn
+	}
+}
+
+// WithAutoCreateDatabase makes the loader create the database of DMLs if it doesn't exist in downstream,
+// in case the DDL creating it hasn't been replicated yet.
+func WithAutoCreateDatabase(enabled bool) Option {
+	return func(o *options) {
+		o.autoCreateDB = enabled
+	}
+}
+
+// WithMaxRetryDelay set the max wait time before retrying to execute DMLs, 0 means no limit.
+func WithMaxRetryDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.maxRetryDelay = d
+	}
+}
+
+// WithTransactionTimeout set the max time of a txn executing DMLs, it's rolled back and
+// fails with ErrTransactionTimeout if not committed in time. 0 means no limit.
+func WithTransactionTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.txnTimeout = d
+	}
+}
+
+// WithBatchTimeout set the max time to execute a batch of DMLs of a table, the batch fails with
+// context.DeadlineExceeded and is retried if it's not finished in time. 0 means no limit.
+func WithBatchTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.batchTimeout = d
+	}
+}
+
+// WithConnectionRetry makes the loader retry to begin a txn for at most maxWait if the connection
+// to downstream is broken, instead of failing at once. 0 means no retry.
+func WithConnectionRetry(maxWait time.Duration) Option {
+	return func(o *options) {
+		o.connRetryMaxWait = maxWait
+	}
+}
+
+// WithBatchGroupBy set whether to merge the DMLs of the same row in a txn by primary key before
+// batching it, the DMLs of the tables without primary key are kept as is.
+func WithBatchGroupBy(enabled bool) Option {
+	return func(o *options) {
+		o.batchGroupBy = enabled
+	}
+}
+
+// WithPrefetchTableInfo makes the loader fetch the info of all tables in schemas when it's created,
+// instead of fetching them lazily when the first DML of the schema is executed.
+func WithPrefetchTableInfo(schemas []string) Option {
+	return func(o *options) {
+		o.prefetchSchemas = schemas
+	}
+}
+
+// WithObservabilityHooks sets the hooks called at the lifecycle points of every txn, like tracing.
+func WithObservabilityHooks(h TxnLifecycleHooks) Option {
+	return func(o *options) {
+		o.txnHooks = h
+	}
+}
+
+// WithBulkDeleteUsingIN set whether to delete the rows with primary key of a table by one
+// `DELETE ... WHERE pk IN (...)` statement instead of a statement per row.
+func WithBulkDeleteUsingIN(enabled bool) Option {
+	return func(o *options) {
+		o.deleteUsingIN = enabled
+	}
+}
+
+// WithMaxBatchWaitTime set the max time the first DML of a batch waits for the batch to be full,
+// the batch is executed when it's full or d elapses. 0 means no limit, the batch is still executed
+// when there are no more input txns.
+func WithMaxBatchWaitTime(d time.Duration) Option {
+	return func(o *options) {
+		o.maxBatchWaitTime = d
+	}
+}
+
+// WithBatchFlushOnSignal makes the loader execute the accumulated DMLs at once when the process
+// receives SIGUSR1, so operators can force a flush without restarting.
+func WithBatchFlushOnSignal() Option {
+	return func(o *options) {
+		o.flushOnSignal = true
+	}
+}
+
+// WithMultiStatementMode set whether to execute the DELETE statements of a batch as one multi-statement,
+// the db must be opened with `multiStatements=true` in the DSN like CreateDB does. They're executed one
+// by one in the txn by default.
+func WithMultiStatementMode(enabled bool) Option {
+	return func(o *options) {
+		o.multiStatement = enabled
+	}
+}
+
+// WithColumnEncryption makes the loader encrypt the values of columns by AES-256-GCM before writing them,
+// colKey maps `schema.table.column` to the 32 bytes key of it. The encrypted columns should be binary,
+// they're left out of the WHERE clause of UPDATE and DELETE, so the rows should be located by the other
+// columns. Use DecryptDML to decrypt the values.
+func WithColumnEncryption(colKey map[string][]byte) Option {
+	return func(o *options) {
+		enc, err := newColumnEncryptor(colKey)
+		if err != nil {
+			enc = &columnEncryptor{err: err}
+		}
+		o.columnEncryptor = enc
+	}
+}
+
+// WithShadowTableSuffix makes the loader apply every DML to the table named `table + suffix` too in the same txn
+// if it exists, so the shadow table of an online schema change keeps in step with the original table.
+// The DMLs are executed in safe mode when it's enabled.
+func WithShadowTableSuffix(suffix string) Option {
+	return func(o *options) {
+		o.shadowSuffix = suffix
+	}
+}
+
+// WithTableSizeCache makes the loader execute the DMLs of the tables with less than smallTableThreshold rows
+// one by one instead of batching them, like the config tables with a few rows. The row count of a table is
+// estimated by querying information_schema.tables in db, and cached for 5 minutes.
+func WithTableSizeCache(db *gosql.DB, smallTableThreshold int64) Option {
+	return func(o *options) {
+		o.tableSizes = NewTableSizeEstimator(db, smallTableThreshold)
+	}
+}
+
+// WithPerformanceSchema makes the loader query performance_schema.events_statements_history of db after executing
+// every batch of DMLs, and log the statements taking longer than threshold with their digests and latencies.
+// The performance schema must be enabled in db, every slow query of db is reported once.
+func WithPerformanceSchema(db *gosql.DB, threshold time.Duration) Option {
+	return func(o *options) {
+		o.slowQueries = newSlowQueryDetector(db, threshold)
+	}
+}
+
+// WithFailFast makes the loader execute every DML and DDL only once, it quits with the first error instead of
+// retrying. It's useful for the tests and one-shot migrations where retrying may apply the changes twice.
+func WithFailFast(enabled bool) Option {
+	return func(o *options) {
+		o.failFast = enabled
+	}
+}
+
+// WithRowExistenceCheck makes the loader check whether the row exists in downstream before executing
+// an UPDATE out of safe mode, the UPDATE of the missing row is executed as REPLACE to avoid the divergence
+// of data. It costs a query for every UPDATE, the batched UPDATEs are not checked because they're executed
+// as REPLACE anyway.
+func WithRowExistenceCheck(enabled bool) Option {
+	return func(o *options) {
+		o.rowExistence = enabled
+	}
+}
+
+// WithZeroValueFilter makes the loader leave the columns whose values are not changed out of the SET clause
+// of UPDATE, and skip the UPDATE changing no column, like the explicit zero values same as the defaults.
+// Only the UPDATEs executed one by one out of safe mode are filtered.
+func WithZeroValueFilter(enabled bool) Option {
+	return func(o *options) {
+		o.zeroValueFilter = enabled
+	}
+}
+
+// WithTransactionIDLabel makes the loader observe the duration of queries into TxnQueryHistogramVec of the metrics
+// too, with the label txn_id of every txn to debug the slow ones. The txn_id is the low 16 bits of the CRC32 of
+// the DMLs in the txn, which tells the txns apart without exposing the values.
+func WithTransactionIDLabel(enabled bool) Option {
+	return func(o *options) {
+		o.txnIDLabel = enabled
+	}
+}
+
+// WithEventStats makes the loader count the DMLs executed for every table in stats, the counts can be
+// read by stats.Snapshot() while the loader is running.
+func WithEventStats(stats *EventStats) Option {
+	return func(o *options) {
+		o.eventStats = stats
+	}
+}
+
+// WithColumnMaskingMap makes the loader write the values of columns masked by the MaskFunc instead of the original
+// ones, like the hashes of PII columns. mask maps `schema.table.column` to the MaskFunc of it, NULL is not masked.
+// The old values of UPDATE and DELETE are masked too to locate the rows, so the masks of the columns in primary
+// key or unique keys must be deterministic like SHA256Mask and MD5Mask.
+func WithColumnMaskingMap(mask map[string]MaskFunc) Option {
+	return func(o *options) {
+		o.columnMasker = newColumnMasker(mask)
+	}
+}
+
+// WithCommitTSOrdering makes the loader check the commit ts of input txns is not decreasing,
+// txns with zero CommitTS are not checked.
+func WithCommitTSOrdering() Option {
+	return func(o *options) {
+		o.commitTSOrdering = true
+	}
+}
+
+// WithOutOfOrderPolicy set the policy for the out of order txns when commit ts ordering is checked.
+func WithOutOfOrderPolicy(p OutOfOrderPolicy) Option {
+	return func(o *options) {
+		o.outOfOrderPolicy = p
+	}
+}
+
+// WithWarmUp set whether to open the connections of all workers when creating the loader,
+// default value is True.
+func WithWarmUp(enabled bool) Option {
+	return func(o *options) {
+		o.warmUp = enabled
+	}
+}
+
 // WorkerCount set worker count of loader
 func WorkerCount(n int) Option {
 	return func(o *options) {
@@ -220,8 +574,18 @@ func NewLoader(db *gosql.DB, opt ...Option) (Loader, error) {
 		o(&opts)
 	}
 
+	if opts.columnEncryptor != nil && opts.columnEncryptor.err != nil {
+		return nil, errors.Annotate(opts.columnEncryptor.err, "invalid column encryption keys")
+	}
+
 	log.Info("new loader", zap.String("opts", fmt.Sprintf("%+v", opts)))
 
+	if opts.multiStatement {
+		if err := checkMultiStatement(db); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	if !opts.enableDispatch {
 		// limit the worker count and set batch size for a unlimited
 		// value making the executor execute the input txn one by one and will not split the txn.
@@ -232,29 +596,70 @@ func NewLoader(db *gosql.DB, opt ...Option) (Loader, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	s := &loaderImpl{
-		db:                 db,
-		getTableInfoFromDB: getTableInfo,
-		opts:               opts,
-		workerCount:        opts.workerCount,
-		batchSize:          opts.batchSize,
-		metrics:            opts.metrics,
-		syncMode:           opts.syncMode,
-		loopBackSyncInfo:   opts.loopBackSyncInfo,
-		input:              make(chan *Txn),
-		successTxn:         make(chan *Txn),
-		merge:              opts.merge,
-		saveAppliedTS:      opts.saveAppliedTS,
+		db:               db,
+		infoCache:        NewInfoSchemaCache(db),
+		opts:             opts,
+		workerCount:      opts.workerCount,
+		batchSize:        opts.batchSize,
+		metrics:          opts.metrics,
+		syncMode:         opts.syncMode,
+		loopBackSyncInfo: opts.loopBackSyncInfo,
+		resizeCh:         make(chan int),
+		resized:          make(chan struct{}),
+		input:            make(chan *Txn),
+		successTxn:       make(chan *Txn),
+		merge:            opts.merge,
+		saveAppliedTS:    opts.saveAppliedTS,
 
 		ctx:    ctx,
 		cancel: cancel,
 	}
 
+	if opts.flushOnSignal {
+		s.flushReqs = make(chan struct{}, 1)
+	}
+
 	db.SetMaxOpenConns(opts.workerCount)
 	db.SetMaxIdleConns(opts.workerCount)
 
+	if opts.warmUp {
+		ctx, cancel := context.WithTimeout(s.ctx, warmUpTimeout)
+		// it's fine to fail here, the connections will be opened lazily.
+		if err := s.getExecutor().warmUp(ctx); err != nil {
+			log.Warn("failed to warm up connections", zap.Error(err))
+		}
+		cancel()
+	}
+
+	if len(opts.prefetchSchemas) > 0 {
+		s.prefetchTableInfo(opts.prefetchSchemas)
+	}
+
 	return s, nil
 }
 
+// prefetchTableInfo loads the info of all tables in schemas into the infoCache,
+// it's fine to fail here, the table info will be fetched again lazily.
+func (s *loaderImpl) prefetchTableInfo(schemas []string) {
+	begin := time.Now()
+	tables := 0
+	for _, schema := range schemas {
+		if err := s.infoCache.Refresh(schema); err != nil {
+			log.Warn("failed to prefetch table info", zap.String("schema", schema), zap.Error(err))
+			continue
+		}
+		tables += s.infoCache.tableCount(schema)
+	}
+
+	log.Info("prefetch table info", zap.Strings("schemas", schemas), zap.Int("tables", tables), zap.Duration("take", time.Since(begin)))
+	if s.metrics != nil && s.metrics.PrefetchTablesCounter != nil {
+		s.metrics.PrefetchTablesCounter.Add(float64(tables))
+	}
+	if s.metrics != nil && s.metrics.PrefetchHistogram != nil {
+		s.metrics.PrefetchHistogram.Observe(time.Since(begin).Seconds())
+	}
+}
+
 func (s *loaderImpl) metricsInputTxn(txn *Txn) {
 	if s.metrics == nil || s.metrics.EventCounterVec == nil {
 		return
@@ -288,12 +693,60 @@ func (s *loaderImpl) GetSafeMode() bool {
 	return v != 0
 }
 
+// WorkerCount returns the number of workers executing the DMLs concurrently.
+func (s *loaderImpl) WorkerCount() int {
+	s.workerCountMu.RLock()
+	defer s.workerCountMu.RUnlock()
+	return s.workerCount
+}
+
+// SetWorkerCount changes the number of workers of the running loader, the workers are started or stopped
+// between the batches when all of them are idle. It blocks until the count is applied by Run or the loader
+// is closed.
+func (s *loaderImpl) SetWorkerCount(n int) error {
+	if n < 1 {
+		return errors.Errorf("the worker count must be at least 1, got %d", n)
+	}
+	if !s.opts.enableDispatch {
+		return errors.New("the worker count can't be changed when dispatch is disabled")
+	}
+	// the rows of the mark table are initialized for every worker
+	if s.loopBackSyncInfo != nil && s.loopBackSyncInfo.LoopbackControl {
+		return errors.New("the worker count can't be changed when loopback control is enabled")
+	}
+
+	select {
+	case s.resizeCh <- n:
+	case <-s.ctx.Done():
+		return errors.New("loader is closed")
+	}
+	<-s.resized
+	return nil
+}
+
+// resize changes the worker count to n, it's only called by Run when no batch is executing.
+func (s *loaderImpl) resize(batch *batchManager, n int) {
+	s.workerCountMu.Lock()
+	old := s.workerCount
+	s.workerCount = n
+	s.workerCountMu.Unlock()
+
+	s.pool.Resize(n)
+	s.db.SetMaxOpenConns(n)
+	s.db.SetMaxIdleConns(n)
+	batch.limit = s.batchSize * n * execLimitMultiple
+	log.Info("worker count of loader changed", zap.Int("from", old), zap.Int("to", n))
+	s.resized <- struct{}{}
+}
+
 func (s *loaderImpl) markSuccess(txns ...*Txn) {
 	if s.saveAppliedTS && len(txns) > 0 && time.Since(s.lastUpdateAppliedTSTime) > updateLastAppliedTSInterval {
 		txns[len(txns)-1].AppliedTS = fGetAppliedTS(s.db)
 		s.lastUpdateAppliedTSTime = time.Now()
 	}
 	for _, txn := range txns {
+		s.stats.addSuccess(txn)
+		callTxnHook(s.opts.txnHooks.OnCommit, txn)
 		s.successTxn <- txn
 	}
 	log.Debug("markSuccess txns", zap.Int("txns len", len(txns)))
@@ -317,6 +770,12 @@ func (s *loaderImpl) Close() {
 }
 
 func (s *loaderImpl) refreshTableInfo(schema string, table string) (info *tableInfo, err error) {
+	return s.loadTableInfo(schema, table, true)
+}
+
+// loadTableInfo gets the table info from db and stores it, the info pre-fetched by
+// infoCache is used unless forceRefresh is set.
+func (s *loaderImpl) loadTableInfo(schema string, table string, forceRefresh bool) (info *tableInfo, err error) {
 	log.Info("refresh table info", zap.String("schema", schema), zap.String("table", table))
 
 	if len(schema) == 0 {
@@ -327,7 +786,16 @@ func (s *loaderImpl) refreshTableInfo(schema string, table string) (info *tableI
 		return nil, nil
 	}
 
-	info, err = s.getTableInfoFromDB(s.db, schema, table)
+	if s.getTableInfoFromDB != nil {
+		info, err = s.getTableInfoFromDB(s.db, schema, table)
+	} else {
+		if forceRefresh {
+			s.infoCache.evict(schema, table)
+			// other tables of the schema may be changed too, refresh them without blocking this one.
+			s.infoCache.RefreshAsync(schema)
+		}
+		info, err = s.infoCache.getTableInfo(schema, table)
+	}
 	if err != nil {
 		return info, errors.Trace(err)
 	}
@@ -343,6 +811,9 @@ func (s *loaderImpl) refreshTableInfo(schema string, table string) (info *tableI
 
 func (s *loaderImpl) evictTableInfo(schema string, table string) {
 	s.tableInfos.Delete(quoteSchema(schema, table))
+	if s.infoCache != nil {
+		s.infoCache.evict(schema, table)
+	}
 }
 
 func (s *loaderImpl) getTableInfo(schema string, table string) (info *tableInfo, err error) {
@@ -352,7 +823,7 @@ func (s *loaderImpl) getTableInfo(schema string, table string) (info *tableInfo,
 		return
 	}
 
-	return s.refreshTableInfo(schema, table)
+	return s.loadTableInfo(schema, table, false)
 }
 
 func needRefreshTableInfo(sql string) bool {
@@ -393,40 +864,18 @@ func (s *loaderImpl) execDDL(ddl *DDL) error {
 		return nil
 	}
 
-	err := util.RetryContext(s.ctx, maxDDLRetryCount, execDDLRetryWait, 1, func(context.Context) error {
-		tx, err := s.db.Begin()
-		if err != nil {
-			return err
-		}
-
-		if len(ddl.Database) > 0 && !isCreateDatabaseDDL(ddl.SQL) {
-			_, err = tx.Exec(fmt.Sprintf("use %s;", quoteName(ddl.Database)))
-			if err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil {
-					log.Error("Rollback failed", zap.Error(rbErr))
-				}
-				return err
-			}
-		}
-
-		if _, err = tx.Exec(ddl.SQL); err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil {
-				log.Error("Rollback failed", zap.String("sql", ddl.SQL), zap.Error(rbErr))
-			}
-			return err
-		}
-
-		if err = tx.Commit(); err != nil {
-			return err
-		}
-
-		log.Info("exec ddl success", zap.String("sql", ddl.SQL))
-		return nil
+	// share the schemaLocks with the DML executors, so the DDL waits for the in-flight DMLs of its schema
+	executor := newExecutor(s.db).withFailFast(s.opts.failFast).withSchemaLocks(&s.schemaLocks)
+	err := executor.retry(s.ctx, maxDDLRetryCount, execDDLRetryWait, func(ctx context.Context) error {
+		return executor.execParallelDDL(ctx, []*DDL{ddl})
 	})
 
 	if err != nil && isSetTiFlashReplica(ddl.SQL) {
 		return nil
 	}
+	if err != nil {
+		s.stats.addError()
+	}
 
 	return errors.Trace(err)
 }
@@ -442,6 +891,9 @@ func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML) error {
 		dmls := dmls
 
 		errg.Go(func() error {
+			s.stats.workerStarted()
+			defer s.stats.workerStopped()
+
 			err := executor.singleExecRetry(s.ctx, dmls, s.GetSafeMode(), maxDMLRetryCount, time.Second)
 			return err
 		})
@@ -459,7 +911,7 @@ func (s *loaderImpl) singleExec(executor *executor, dmls []*DML) error {
 
 	for _, dml := range dmls {
 		keys := getKeys(dml)
-		log.Debug("get keys", zap.Reflect("dml", dml), zap.Strings("keys", keys))
+		log.Debug("get keys", zap.Stringer("dml", dml), zap.Strings("keys", keys))
 		key := keys[0]
 
 		if s.opts.enableCausality {
@@ -538,6 +990,9 @@ func (s *loaderImpl) execDMLs(dmls []*DML) error {
 		// https://golang.org/doc/faq#closures_and_goroutines
 		dmls := dmls
 		errg.Go(func() error {
+			s.stats.workerStarted()
+			defer s.stats.workerStopped()
+
 			err := executor.execTableBatchRetry(s.ctx, dmls, maxDMLRetryCount, time.Second)
 			return err
 		})
@@ -549,15 +1004,33 @@ func (s *loaderImpl) execDMLs(dmls []*DML) error {
 	})
 
 	err := errg.Wait()
+	if err != nil {
+		s.stats.addError()
+	}
 
 	return errors.Trace(err)
 }
 
 func (s *loaderImpl) initMarkTable() error {
-	if err := loopbacksync.CreateMarkTable(s.db); err != nil {
-		return errors.Trace(err)
+	s.loopBackSyncInfo.RecordID = int64(s.workerCount)
+	return errors.Trace(loopbacksync.InitMarkTableIfNeeded(s.db, s.loopBackSyncInfo))
+}
+
+// runMarkTableHealthCheck checks the mark table periodically until ctx is done.
+func (s *loaderImpl) runMarkTableHealthCheck(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := loopbacksync.MarkTableHealthCheck(s.db, s.loopBackSyncInfo); err != nil {
+				log.Error("mark table is inconsistent", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
 	}
-	return loopbacksync.InitMarkTableData(s.db, s.workerCount, s.loopBackSyncInfo.ChannelID)
 }
 
 // Run will quit when meet any error, or all the txn are drained
@@ -566,6 +1039,10 @@ func (s *loaderImpl) Run() error {
 		log.S().Info(s.opts)
 		log.Info("Run()... in Loader quit")
 		close(s.successTxn)
+		// no one receives from resizeCh after Run quits, e.g. when it fails
+		if s.cancel != nil {
+			s.cancel()
+		}
 	}()
 
 	if s.loopBackSyncInfo != nil && s.loopBackSyncInfo.LoopbackControl {
@@ -578,16 +1055,47 @@ func (s *loaderImpl) Run() error {
 				log.Error("fail to clean mark table data", zap.Error(err))
 			}
 		}()
+
+		ctx, cancel := context.WithCancel(s.ctx)
+		defer cancel()
+		go s.runMarkTableHealthCheck(ctx)
 	}
 
+	s.pool = NewRoundRobinWorkerPool(s.workerCount)
+	defer s.pool.Close()
+
 	txnManager := newTxnManager(100*1024 /* limit dml number */, s.input)
 	defer txnManager.Close()
+	s.stats.txnManager.Store(txnManager)
 
 	batch := fNewBatchManager(s)
 	input := txnManager.run()
 
+	if s.flushReqs != nil {
+		stop := s.flushOnSignal()
+		defer stop()
+	}
+
+	batchWait := &batchWaitTimer{maxWait: s.opts.maxBatchWaitTime}
+	defer batchWait.update(0)
+
 	for {
+		batchWait.update(len(batch.dmls))
+
 		select {
+		case <-s.flushReqs:
+			if err := batch.flush(); err != nil {
+				return errors.Trace(err)
+			}
+
+		case <-batchWait.C:
+			if err := batch.execAccumulatedDMLs(); err != nil {
+				return errors.Trace(err)
+			}
+
+		case n := <-s.resizeCh:
+			s.resize(batch, n)
+
 		case txn, ok := <-input:
 			if !ok {
 				log.Info("Loader closed, quit running")
@@ -597,9 +1105,7 @@ func (s *loaderImpl) Run() error {
 				return nil
 			}
 
-			s.metricsInputTxn(txn)
-			txnManager.pop(txn)
-			if err := batch.put(txn); err != nil {
+			if err := s.handleInputTxn(txnManager, batch, txn); err != nil {
 				return errors.Trace(err)
 			}
 
@@ -614,20 +1120,168 @@ func (s *loaderImpl) Run() error {
 			}
 
 			// get first
-			txn, ok := <-input
+			var txn *Txn
+			var ok bool
+			select {
+			case txn, ok = <-input:
+			case n := <-s.resizeCh:
+				s.resize(batch, n)
+				continue
+			}
 			if !ok {
 				return nil
 			}
 
-			s.metricsInputTxn(txn)
-			txnManager.pop(txn)
-			if err := batch.put(txn); err != nil {
+			if err := s.handleInputTxn(txnManager, batch, txn); err != nil {
 				return errors.Trace(err)
 			}
 		}
 	}
 }
 
+// batchWaitTimer fires maxWait after the first DML enters the batch, it never fires if maxWait is 0.
+type batchWaitTimer struct {
+	maxWait time.Duration
+	timer   *time.Timer
+	C       <-chan time.Time
+}
+
+// update starts the timer if the batch becomes not empty, and stops it if the batch is executed.
+func (t *batchWaitTimer) update(pending int) {
+	if pending == 0 {
+		if t.timer != nil {
+			t.timer.Stop()
+			t.timer = nil
+			t.C = nil
+		}
+		return
+	}
+	if t.timer == nil && t.maxWait > 0 {
+		t.timer = time.NewTimer(t.maxWait)
+		t.C = t.timer.C
+	}
+}
+
+// flushOnSignal requests to flush the accumulated DMLs when SIGUSR1 is received until stop is called.
+func (s *loaderImpl) flushOnSignal() (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				log.Info("receive signal to flush the accumulated DMLs")
+				select {
+				case s.flushReqs <- struct{}{}:
+				default:
+					// a flush is pending already
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+func (s *loaderImpl) handleInputTxn(manager *txnManager, batch *batchManager, txn *Txn) error {
+	s.metricsInputTxn(txn)
+	manager.pop(txn)
+	callTxnHook(s.opts.txnHooks.OnEnqueue, txn)
+
+	skip, err := s.checkCommitTSOrder(txn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if skip {
+		// execute the previous txns first to keep the order of successes
+		if err := batch.execAccumulatedDMLs(); err != nil {
+			return errors.Trace(err)
+		}
+		s.markSuccess(txn)
+		return nil
+	}
+
+	if s.opts.batchGroupBy && !txn.isDDL() {
+		if err := s.groupTxnDMLs(txn); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Trace(batch.put(txn))
+}
+
+// groupTxnDMLs merges the DMLs of the same row in txn by primary key,
+// the merged DMLs of each table are ordered as deletes, inserts and updates.
+func (s *loaderImpl) groupTxnDMLs(txn *Txn) error {
+	if len(txn.DMLs) < 2 {
+		return nil
+	}
+
+	var tables []string
+	byTable := make(map[string][]*DML)
+	for _, dml := range txn.DMLs {
+		if err := s.setDMLInfo(dml); err != nil {
+			return errors.Trace(err)
+		}
+		name := dml.TableName()
+		if _, ok := byTable[name]; !ok {
+			tables = append(tables, name)
+		}
+		byTable[name] = append(byTable[name], dml)
+	}
+
+	dmls := make([]*DML, 0, len(txn.DMLs))
+	for _, name := range tables {
+		tblDMLs := byTable[name]
+		if len(tblDMLs) == 1 || len(tblDMLs[0].primaryKeys()) == 0 {
+			dmls = append(dmls, tblDMLs...)
+			continue
+		}
+
+		types, err := mergeByPrimaryKey(tblDMLs)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		dmls = append(dmls, types[DeleteDMLType]...)
+		dmls = append(dmls, types[InsertDMLType]...)
+		dmls = append(dmls, types[UpdateDMLType]...)
+	}
+
+	txn.DMLs = dmls
+	return nil
+}
+
+// checkCommitTSOrder checks the commit ts of txn is not less than the last one,
+// it returns whether the txn should be skipped according to the OutOfOrderPolicy.
+func (s *loaderImpl) checkCommitTSOrder(txn *Txn) (skip bool, err error) {
+	if !s.opts.commitTSOrdering || txn.CommitTS == 0 {
+		return false, nil
+	}
+
+	if txn.CommitTS >= s.lastSeenTS {
+		s.lastSeenTS = txn.CommitTS
+		return false, nil
+	}
+
+	if s.metrics != nil && s.metrics.OutOfOrderCounter != nil {
+		s.metrics.OutOfOrderCounter.Inc()
+	}
+
+	if s.opts.outOfOrderPolicy == OutOfOrderWarn {
+		log.Warn("skip out of order txn", zap.Int64("commit ts", txn.CommitTS), zap.Int64("last seen ts", s.lastSeenTS))
+		return true, nil
+	}
+
+	return false, errors.Errorf("out of order txn, commit ts %d is less than the last seen ts %d", txn.CommitTS, s.lastSeenTS)
+}
+
 // groupDMLs group DMLs by table in batchByTbls and
 // collects DMLs that can't be executed in bulk in singleDMLs.
 // NOTE: DML.info are assumed to be already set.
@@ -683,27 +1337,94 @@ func filterGeneratedCols(dml *DML) {
 }
 
 func (s *loaderImpl) getExecutor() *executor {
-	e := newExecutor(s.db).withBatchSize(s.batchSize)
+	e := newExecutor(s.db).withBatchSize(s.batchSize).withErrorPolicy(s.opts.errorPolicy).
+		withErrorRecorder(s.opts.errorRecorder).withChaos(s.chaos).withColumnDefaultFiller(s.opts.defaultFiller).
+		withMaxRetryDelay(s.opts.maxRetryDelay).withTransactionTimeout(s.opts.txnTimeout).
+		withConnectionRetry(s.opts.connRetryMaxWait).withContext(s.ctx).withBatchTimeout(s.opts.batchTimeout).
+		withBulkDeleteUsingIN(s.opts.deleteUsingIN).withSchemaLocks(&s.schemaLocks).
+		withMultiStatement(s.opts.multiStatement).withColumnEncryptor(s.opts.columnEncryptor).
+		withTableSizeEstimator(s.opts.tableSizes).withColumnMasker(s.opts.columnMasker).
+		withSlowQueryDetector(s.opts.slowQueries).withEventStats(s.opts.eventStats).
+		withRowExistenceCheck(s.opts.rowExistence).withFailFast(s.opts.failFast).
+		withZeroValueFilter(s.opts.zeroValueFilter).withTransactionIDLabel(s.opts.txnIDLabel)
 	if s.syncMode == SyncPartialColumn {
 		e = e.withRefreshTableInfo(s.refreshTableInfo)
 	}
+	if s.opts.autoCreateDB {
+		e = e.withAutoCreateDatabase(&s.knownSchemas)
+	}
+	if s.pool != nil {
+		e = e.withWorkerPool(s.pool)
+	}
+	if s.opts.shadowSuffix != "" {
+		e = e.withShadowTable(s.opts.shadowSuffix, s.getTableInfo)
+	}
 	e.setSyncInfo(s.loopBackSyncInfo)
 	e.setWorkerCount(s.workerCount)
 	if s.metrics != nil && s.metrics.QueryHistogramVec != nil {
 		e = e.withQueryHistogramVec(s.metrics.QueryHistogramVec)
 	}
+	if s.metrics != nil && s.metrics.WorkerErrorCounterVec != nil {
+		e = e.withWorkerErrorCounterVec(s.metrics.WorkerErrorCounterVec)
+	}
+	if s.metrics != nil && s.metrics.WarmUpHistogram != nil {
+		e = e.withWarmUpHistogram(s.metrics.WarmUpHistogram)
+	}
+	if s.metrics != nil && s.metrics.ValidationErrCounter != nil {
+		e = e.withValidationErrCounter(s.metrics.ValidationErrCounter)
+	}
+	if s.metrics != nil && s.metrics.TxnTimeoutCounter != nil {
+		e = e.withTxnTimeoutCounter(s.metrics.TxnTimeoutCounter)
+	}
+	if s.metrics != nil && s.metrics.ReconnectCounter != nil {
+		e = e.withReconnectCounter(s.metrics.ReconnectCounter)
+	}
+	if s.metrics != nil && s.metrics.BatchTimeoutCounter != nil {
+		e = e.withBatchTimeoutCounter(s.metrics.BatchTimeoutCounter)
+	}
+	if s.metrics != nil && s.metrics.DeadlockCounter != nil {
+		e = e.withDeadlockCounter(s.metrics.DeadlockCounter)
+	}
+	if s.metrics != nil && s.metrics.SchemaDriftCounter != nil {
+		e = e.withSchemaDriftCounter(s.metrics.SchemaDriftCounter)
+	}
+	if s.metrics != nil && s.metrics.SlowQueryCounter != nil {
+		e = e.withSlowQueryCounter(s.metrics.SlowQueryCounter)
+	}
+	if s.metrics != nil && s.metrics.TableEventCounterVec != nil {
+		e = e.withTableEventCounterVec(s.metrics.TableEventCounterVec)
+	}
+	if s.metrics != nil && s.metrics.MissingRowCounter != nil {
+		e = e.withMissingRowCounter(s.metrics.MissingRowCounter)
+	}
+	if s.metrics != nil && s.metrics.NoopUpdateCounter != nil {
+		e = e.withNoopUpdateCounter(s.metrics.NoopUpdateCounter)
+	}
+	if s.metrics != nil && s.metrics.RetryHistogram != nil {
+		e = e.withRetryHistogram(s.metrics.RetryHistogram)
+	}
+	if s.metrics != nil && s.metrics.TxnQueryHistogramVec != nil {
+		e = e.withTxnQueryHistogramVec(s.metrics.TxnQueryHistogramVec)
+	}
 	return e
 }
 
 func newBatchManager(s *loaderImpl) *batchManager {
+	var queueHistogram, executeHistogram prometheus.Histogram
+	if s.metrics != nil {
+		queueHistogram, executeHistogram = s.metrics.BatchQueueHistogram, s.metrics.BatchExecuteHistogram
+	}
 	return &batchManager{
 		limit:                s.batchSize * s.workerCount * execLimitMultiple,
 		enableDispatch:       s.opts.enableDispatch,
+		hooks:                &s.opts.txnHooks,
 		fExecDMLs:            s.execDMLs,
 		fDMLsSuccessCallback: s.markSuccess,
 		fExecDDL:             s.execDDL,
 		fDDLSuccessCallback: func(txn *Txn) {
 			s.markSuccess(txn)
+			// the database may be dropped, check it again before the next DML.
+			s.knownSchemas.Delete(txn.DDL.Database)
 			if txn.DDL.ShouldSkip {
 				s.evictTableInfo(txn.DDL.Database, txn.DDL.Table)
 				return
@@ -713,6 +1434,8 @@ func newBatchManager(s *loaderImpl) *batchManager {
 				s.evictTableInfo(txn.DDL.Database, txn.DDL.Table)
 			}
 		},
+		queueHistogram:   queueHistogram,
+		executeHistogram: executeHistogram,
 	}
 }
 
@@ -721,10 +1444,16 @@ type batchManager struct {
 	dmls                 []*DML
 	enableDispatch       bool
 	limit                int
+	hooks                *TxnLifecycleHooks
 	fExecDMLs            func([]*DML) error
 	fDMLsSuccessCallback func(...*Txn)
 	fExecDDL             func(*DDL) error
 	fDDLSuccessCallback  func(*Txn)
+
+	// the metadata of the accumulated DMLs, nil if there're none
+	batch            *batchContext
+	queueHistogram   prometheus.Histogram
+	executeHistogram prometheus.Histogram
 }
 
 func (b *batchManager) execAccumulatedDMLs() (err error) {
@@ -732,21 +1461,51 @@ func (b *batchManager) execAccumulatedDMLs() (err error) {
 		return nil
 	}
 
+	batch := b.batch
+	if batch == nil {
+		batch = newBatchContext()
+	}
+	batch.dmls = b.dmls
+	batch.queued()
+
+	if b.hooks != nil {
+		callTxnHook(b.hooks.OnDispatch, b.txns...)
+	}
+	batch.dispatched()
 	if err := b.fExecDMLs(b.dmls); err != nil {
+		if b.hooks != nil {
+			callTxnHook(b.hooks.OnError, b.txns...)
+		}
+		log.Debug("batch failed", zap.Uint64("batch id", batch.BatchID), zap.Error(err))
 		return errors.Trace(err)
 	}
+	batch.committed()
+	batch.observe(b.queueHistogram, b.executeHistogram)
 
 	if b.fDMLsSuccessCallback != nil {
 		b.fDMLsSuccessCallback(b.txns...)
 	}
 	b.txns = b.txns[:0]
 	b.dmls = b.dmls[:0]
+	b.batch = nil
 	return nil
 }
 
+// flush executes the accumulated DMLs at once, without waiting for the batch to be full.
+func (b *batchManager) flush() error {
+	log.Info("flush the accumulated DMLs", zap.Int("dmls", len(b.dmls)), zap.Int("txns", len(b.txns)))
+	return errors.Trace(b.execAccumulatedDMLs())
+}
+
 func (b *batchManager) execDDL(txn *Txn) error {
+	if b.hooks != nil {
+		callTxnHook(b.hooks.OnDispatch, txn)
+	}
 	if err := b.fExecDDL(txn.DDL); err != nil {
 		if !pkgsql.IgnoreDDLError(err) {
+			if b.hooks != nil {
+				callTxnHook(b.hooks.OnError, txn)
+			}
 			return errors.Trace(err)
 		}
 		log.Warn("ignore ddl", zap.Error(err), zap.String("ddl", txn.DDL.SQL))
@@ -778,6 +1537,9 @@ func (b *batchManager) put(txn *Txn) error {
 		}
 		return nil
 	}
+	if b.batch == nil {
+		b.batch = newBatchContext()
+	}
 	b.dmls = append(b.dmls, txn.DMLs...)
 	b.txns = append(b.txns, txn)
 
@@ -797,8 +1559,10 @@ type txnManager struct {
 	shutdown     chan struct{}
 	cachedSize   int
 	maxCacheSize int
-	cond         *sync.Cond
-	isClosed     int32
+	// the count of txns in cacheChan, accessed atomically
+	cachedTxns int64
+	cond       *sync.Cond
+	isClosed   int32
 }
 
 func newTxnManager(maxCacheSize int, input chan *Txn) *txnManager {
@@ -849,6 +1613,7 @@ func (t *txnManager) run() chan *Txn {
 
 			select {
 			case ret <- txn:
+				atomic.AddInt64(&t.cachedTxns, 1)
 				t.cond.L.Lock()
 				t.cachedSize += txnSize
 				t.cond.L.Unlock()
@@ -861,12 +1626,17 @@ func (t *txnManager) run() chan *Txn {
 }
 
 func (t *txnManager) pop(txn *Txn) {
+	atomic.AddInt64(&t.cachedTxns, -1)
 	t.cond.L.Lock()
 	t.cachedSize -= len(txn.DMLs)
 	t.cond.Signal()
 	t.cond.L.Unlock()
 }
 
+func (t *txnManager) cachedTxnCount() int {
+	return int(atomic.LoadInt64(&t.cachedTxns))
+}
+
 func (t *txnManager) Close() {
 	if !atomic.CompareAndSwapInt32(&t.isClosed, 0, 1) {
 		return
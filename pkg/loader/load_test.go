@@ -16,8 +16,11 @@ package loader
 import (
 	"context"
 	"database/sql"
+	"os"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
@@ -25,7 +28,9 @@ import (
 	"github.com/pingcap/check"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
 	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
 type LoadSuite struct {
@@ -246,6 +251,52 @@ func (cs *LoadSuite) TestSetDMLInfo(c *check.C) {
 	c.Assert(dml.info, check.Equals, &info)
 }
 
+func (cs *LoadSuite) TestGroupTxnDMLs(c *check.C) {
+	pkInfo := &tableInfo{columns: []string{"id", "a1"}, uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}}}
+	pkInfo.primaryKey = &pkInfo.uniqueKeys[0]
+	noPKInfo := &tableInfo{columns: []string{"id", "a1"}}
+	ld := loaderImpl{getTableInfoFromDB: func(db *sql.DB, schema string, table string) (*tableInfo, error) {
+		if table == "pk" {
+			return pkInfo, nil
+		}
+		return noPKInfo, nil
+	}}
+
+	update := func(table string, id, old, new int) *DML {
+		return &DML{
+			Database:  "test",
+			Table:     table,
+			Tp:        UpdateDMLType,
+			Values:    map[string]interface{}{"id": id, "a1": new},
+			OldValues: map[string]interface{}{"id": id, "a1": old},
+		}
+	}
+	txn := &Txn{DMLs: []*DML{
+		update("pk", 1, 1, 2),
+		update("nopk", 1, 1, 2),
+		update("pk", 1, 2, 3),
+		{Database: "test", Table: "pk", Tp: InsertDMLType, Values: map[string]interface{}{"id": 2, "a1": 1}},
+		update("nopk", 1, 2, 3),
+		{Database: "test", Table: "pk", Tp: DeleteDMLType, Values: map[string]interface{}{"id": 3, "a1": 1}},
+		update("pk", 1, 3, 4),
+	}}
+	noPKDMLs := []*DML{txn.DMLs[1], txn.DMLs[4]}
+
+	err := ld.groupTxnDMLs(txn)
+	c.Assert(err, check.IsNil)
+	c.Assert(txn.DMLs, check.HasLen, 5)
+
+	c.Assert(txn.DMLs[0].Tp, check.Equals, DeleteDMLType)
+	c.Assert(txn.DMLs[0].Values["id"], check.Equals, 3)
+	c.Assert(txn.DMLs[1].Tp, check.Equals, InsertDMLType)
+	c.Assert(txn.DMLs[1].Values["id"], check.Equals, 2)
+	c.Assert(txn.DMLs[2].Tp, check.Equals, UpdateDMLType)
+	c.Assert(txn.DMLs[2].Values, check.DeepEquals, map[string]interface{}{"id": 1, "a1": 4})
+	c.Assert(txn.DMLs[2].OldValues, check.DeepEquals, map[string]interface{}{"id": 1, "a1": 1})
+	// DMLs of the table without primary key are kept as is
+	c.Assert(txn.DMLs[3:], check.DeepEquals, noPKDMLs)
+}
+
 func (cs *LoadSuite) TestFilterGeneratedCols(c *check.C) {
 	dml := DML{
 		Values: map[string]interface{}{
@@ -264,6 +315,40 @@ func (cs *LoadSuite) TestFilterGeneratedCols(c *check.C) {
 	})
 }
 
+func (cs *LoadSuite) TestMarkTableHealthCheck(c *check.C) {
+	origInterval := healthCheckInterval
+	healthCheckInterval = 10 * time.Millisecond
+	defer func() {
+		healthCheckInterval = origInterval
+	}()
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	info := loopbacksync.NewLoopBackSyncInfo(1, true, false)
+	info.RecordID = 2
+	loader := &loaderImpl{db: db, loopBackSyncInfo: info}
+
+	checked := make(chan struct{})
+	mock.ExpectQuery("SELECT COUNT").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(2))
+	mock.ExpectQuery("SELECT COUNT").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mock.ExpectQuery("SELECT id").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		loader.runMarkTableHealthCheck(ctx)
+		close(checked)
+	}()
+	// checked at least twice
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	<-checked
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
 type groupDMLsSuite struct{}
 
 var _ = check.Suite(&groupDMLsSuite{})
@@ -391,6 +476,29 @@ func (s *execDDLSuite) TestShouldUseDatabase(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *execDDLSuite) TestWaitForInflightDMLs(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	loader := &loaderImpl{db: db, ctx: context.Background()}
+	// the DMLs of the schema executed by the DML executors of loader
+	done := loader.schemaLocks.startDMLs([]*DML{{Database: "test", Table: "t"}})
+
+	const wait = 50 * time.Millisecond
+	start := time.Now()
+	time.AfterFunc(wait, done)
+	err = loader.execDDL(&DDL{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN c INT"})
+	c.Assert(err, check.IsNil)
+	c.Assert(time.Since(start) >= wait, check.IsTrue)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
 type batchManagerSuite struct{}
 
 var _ = check.Suite(&batchManagerSuite{})
@@ -716,6 +824,412 @@ func (s *runSuite) TestShouldFlushWhenInputIsEmpty(c *check.C) {
 	assertExecuted(7)
 }
 
+func (s *runSuite) TestMaxBatchWaitTime(c *check.C) {
+	const batchSize = 10
+	executed := make(chan []*DML, batchSize)
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit:          batchSize,
+			enableDispatch: true,
+			fExecDMLs: func(dmls []*DML) error {
+				executed <- append([]*DML(nil), dmls...)
+				return nil
+			},
+			fDMLsSuccessCallback: func(txns ...*Txn) {},
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	opts := defaultLoaderOptions
+	WithMaxBatchWaitTime(50 * time.Millisecond)(&opts)
+	loader := &loaderImpl{
+		opts:       opts,
+		input:      make(chan *Txn),
+		successTxn: make(chan *Txn, batchSize),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Check(loader.Run(), check.IsNil)
+	}()
+
+	for i := 0; i < batchSize/2; i++ {
+		loader.input <- &Txn{DMLs: []*DML{{Tp: InsertDMLType}}}
+	}
+
+	var committed int
+	timeout := time.After(500 * time.Millisecond)
+	for committed < batchSize/2 {
+		select {
+		case dmls := <-executed:
+			committed += len(dmls)
+		case <-timeout:
+			c.Fatalf("only %d of %d DMLs are committed", committed, batchSize/2)
+		}
+	}
+	c.Assert(committed, check.Equals, batchSize/2)
+
+	close(loader.input)
+	<-done
+}
+
+func (s *runSuite) TestBatchWaitTimer(c *check.C) {
+	// never fires if the max wait time is not set
+	t := &batchWaitTimer{}
+	t.update(1)
+	c.Assert(t.C, check.IsNil)
+
+	t = &batchWaitTimer{maxWait: 10 * time.Millisecond}
+	t.update(0)
+	c.Assert(t.C, check.IsNil)
+
+	begin := time.Now()
+	t.update(1)
+	timer := t.C
+	// it's not restarted by the following DMLs
+	t.update(2)
+	c.Assert(t.C, check.Equals, timer)
+	select {
+	case <-t.C:
+		c.Assert(time.Since(begin) >= 10*time.Millisecond, check.IsTrue)
+	case <-time.After(time.Second):
+		c.Fatal("the timer doesn't fire")
+	}
+
+	// stopped after the batch is executed
+	t.update(0)
+	c.Assert(t.C, check.IsNil)
+	t.update(1)
+	c.Assert(t.C, check.NotNil)
+	c.Assert(t.C, check.Not(check.Equals), timer)
+	t.update(0)
+}
+
+func (s *runSuite) TestFlushOnSignal(c *check.C) {
+	loader := &loaderImpl{flushReqs: make(chan struct{}, 1)}
+	stop := loader.flushOnSignal()
+	defer stop()
+
+	c.Assert(syscall.Kill(os.Getpid(), syscall.SIGUSR1), check.IsNil)
+	select {
+	case <-loader.flushReqs:
+	case <-time.After(100 * time.Millisecond):
+		c.Fatal("no flush is requested after SIGUSR1")
+	}
+}
+
+func (s *runSuite) TestFlushPendingBatch(c *check.C) {
+	executed := make(chan []*DML, 2)
+	pending := []*DML{{Tp: InsertDMLType}, {Tp: UpdateDMLType}}
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			txns:           []*Txn{{DMLs: pending}},
+			dmls:           pending,
+			limit:          1024,
+			enableDispatch: true,
+			fExecDMLs: func(dmls []*DML) error {
+				executed <- append([]*DML(nil), dmls...)
+				return nil
+			},
+			fDMLsSuccessCallback: func(txns ...*Txn) {},
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	loader := &loaderImpl{
+		input:      make(chan *Txn),
+		successTxn: make(chan *Txn, 10),
+		flushReqs:  make(chan struct{}, 1),
+	}
+	// as if SIGUSR1 is received
+	loader.flushReqs <- struct{}{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Check(loader.Run(), check.IsNil)
+	}()
+
+	select {
+	case dmls := <-executed:
+		c.Assert(dmls, check.DeepEquals, pending)
+	case <-time.After(100 * time.Millisecond):
+		c.Fatal("the pending batch is not committed in time")
+	}
+
+	close(loader.input)
+	<-done
+	c.Assert(executed, check.HasLen, 0)
+}
+
+func (s *runSuite) runWithCommitTSOrdering(c *check.C, policy OutOfOrderPolicy, commitTSs []int64) (executed []*Txn, successes []*Txn, counter prometheus.Counter, err error) {
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit:          1024,
+			enableDispatch: false,
+			fExecDMLs: func(dmls []*DML) error {
+				return nil
+			},
+			fDMLsSuccessCallback: func(txns ...*Txn) {
+				executed = append(executed, txns...)
+				s.markSuccess(txns...)
+			},
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	counter = prometheus.NewCounter(prometheus.CounterOpts{Name: "out_of_order_total"})
+	opts := defaultLoaderOptions
+	WithCommitTSOrdering()(&opts)
+	WithOutOfOrderPolicy(policy)(&opts)
+	loader := &loaderImpl{
+		opts:       opts,
+		metrics:    &MetricsGroup{OutOfOrderCounter: counter},
+		input:      make(chan *Txn, len(commitTSs)),
+		successTxn: make(chan *Txn, len(commitTSs)),
+	}
+	for _, ts := range commitTSs {
+		loader.input <- &Txn{CommitTS: ts, DMLs: []*DML{{Tp: InsertDMLType}}}
+	}
+	close(loader.input)
+
+	err = loader.Run()
+	for txn := range loader.successTxn {
+		successes = append(successes, txn)
+	}
+	return
+}
+
+func counterValue(c *check.C, counter prometheus.Counter) float64 {
+	var metric io_prometheus_client.Metric
+	c.Assert(counter.Write(&metric), check.IsNil)
+	return metric.GetCounter().GetValue()
+}
+
+func (s *runSuite) TestCommitTSOrderingStrict(c *check.C) {
+	executed, _, counter, err := s.runWithCommitTSOrdering(c, OutOfOrderStrict, []int64{10, 0, 20, 20, 15, 30})
+	c.Assert(err, check.ErrorMatches, ".*commit ts 15 is less than the last seen ts 20.*")
+	c.Assert(executed, check.HasLen, 4)
+	c.Assert(counterValue(c, counter), check.Equals, 1.0)
+}
+
+func (s *runSuite) TestCommitTSOrderingWarn(c *check.C) {
+	executed, successes, counter, err := s.runWithCommitTSOrdering(c, OutOfOrderWarn, []int64{10, 20, 15, 5, 30})
+	c.Assert(err, check.IsNil)
+	c.Assert(counterValue(c, counter), check.Equals, 2.0)
+
+	var executedTSs, successTSs []int64
+	for _, txn := range executed {
+		executedTSs = append(executedTSs, txn.CommitTS)
+	}
+	for _, txn := range successes {
+		successTSs = append(successTSs, txn.CommitTS)
+	}
+	c.Assert(executedTSs, check.DeepEquals, []int64{10, 20, 30})
+	// the skipped txns are still reported in order
+	c.Assert(successTSs, check.DeepEquals, []int64{10, 20, 15, 5, 30})
+}
+
+func (s *runSuite) runWithHooks(c *check.C, execErr error) (events []string, err error) {
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		bm := newBatchManager(s)
+		bm.fExecDMLs = func(dmls []*DML) error {
+			events = append(events, "exec")
+			return execErr
+		}
+		return bm
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	record := func(event string) func(*Txn, time.Time) {
+		return func(txn *Txn, ts time.Time) {
+			c.Assert(ts.IsZero(), check.IsFalse)
+			events = append(events, event)
+		}
+	}
+	opts := defaultLoaderOptions
+	WithObservabilityHooks(TxnLifecycleHooks{
+		OnEnqueue:  record("enqueue"),
+		OnDispatch: record("dispatch"),
+		OnCommit:   record("commit"),
+		OnError:    record("error"),
+	})(&opts)
+	loader := &loaderImpl{
+		opts:       opts,
+		batchSize:  opts.batchSize,
+		input:      make(chan *Txn, 1),
+		successTxn: make(chan *Txn, 1),
+	}
+	loader.input <- &Txn{DMLs: []*DML{{Tp: InsertDMLType}}}
+	close(loader.input)
+
+	err = loader.Run()
+	return
+}
+
+func (s *runSuite) TestObservabilityHooks(c *check.C) {
+	events, err := s.runWithHooks(c, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(events, check.DeepEquals, []string{"enqueue", "dispatch", "exec", "commit"})
+
+	events, err = s.runWithHooks(c, errors.New("exec failed"))
+	c.Assert(err, check.ErrorMatches, "exec failed")
+	c.Assert(events, check.DeepEquals, []string{"enqueue", "dispatch", "exec", "error"})
+}
+
+func (s *runSuite) TestStats(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	origWait := execDDLRetryWait
+	execDDLRetryWait = time.Millisecond
+	defer func() { execDDLRetryWait = origWait }()
+
+	ld, err := NewLoader(db, WorkerCount(1), BatchSize(10))
+	c.Assert(err, check.IsNil)
+	loader := ld.(*loaderImpl)
+	loader.getTableInfoFromDB = func(*sql.DB, string, string) (*tableInfo, error) {
+		return &tableInfo{columns: []string{"id"}}, nil
+	}
+	c.Assert(ld.Stats(), check.DeepEquals, LoaderStats{})
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- ld.Run()
+	}()
+
+	for i, n := range []int{2, 1, 3} {
+		txn := &Txn{CommitTS: int64(i+1) * 10}
+		mock.ExpectBegin()
+		for j := 0; j < n; j++ {
+			txn.AppendDML(&DML{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": j}})
+			mock.ExpectExec("INSERT INTO `test`.`t`").WillDelayFor(50 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+
+		ld.Input() <- txn
+		// the only worker is busy executing the txn
+		for start := time.Now(); ld.Stats().WorkersActive != 1; time.Sleep(time.Millisecond) {
+			c.Assert(time.Since(start) < time.Second, check.IsTrue)
+		}
+		select {
+		case success := <-ld.Successes():
+			c.Assert(success, check.Equals, txn)
+		case <-time.After(time.Second):
+			c.Fatal("can't get success txn from loader")
+		}
+	}
+
+	stats := ld.Stats()
+	c.Assert(stats, check.DeepEquals, LoaderStats{
+		TotalTxnsProcessed: 3,
+		TotalDMLsProcessed: 6,
+		LastCommittedTS:    30,
+	})
+
+	// the DDL fails as it's not expected by the mock
+	ld.Input() <- NewDDLTxn("test", "t", "DROP TABLE `t`")
+	c.Assert(<-runErr, check.NotNil)
+	c.Assert(ld.Stats().TotalErrors, check.Equals, int64(1))
+	c.Assert(ld.Stats().TotalTxnsProcessed, check.Equals, int64(3))
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *runSuite) TestSetWorkerCount(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, WorkerCount(16))
+	c.Assert(err, check.IsNil)
+	c.Assert(ld.WorkerCount(), check.Equals, 16)
+	c.Assert(ld.SetWorkerCount(0), check.ErrorMatches, ".*must be at least 1.*")
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- ld.Run()
+	}()
+
+	c.Assert(ld.SetWorkerCount(4), check.IsNil)
+	c.Assert(ld.WorkerCount(), check.Equals, 4)
+	pool := ld.(*loaderImpl).pool
+	c.Assert(pool.Size(), check.Equals, 4)
+
+	// only 4 goroutines are active, so at most 4 of the tasks run at the same time
+	var running int64
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		pool.Submit(func() {
+			defer wg.Done()
+			atomic.AddInt64(&running, 1)
+			<-release
+			atomic.AddInt64(&running, -1)
+		})
+	}
+	for start := time.Now(); atomic.LoadInt64(&running) != 4; time.Sleep(time.Millisecond) {
+		c.Assert(time.Since(start) < time.Second, check.IsTrue)
+	}
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(atomic.LoadInt64(&running), check.Equals, int64(4))
+	close(release)
+	wg.Wait()
+
+	ld.Close()
+	c.Assert(<-runErr, check.IsNil)
+	c.Assert(ld.SetWorkerCount(8), check.ErrorMatches, "loader is closed")
+}
+
+func (s *runSuite) TestSetWorkerCountAfterRunFailed(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	origWait := execDDLRetryWait
+	execDDLRetryWait = time.Millisecond
+	defer func() { execDDLRetryWait = origWait }()
+
+	ld, err := NewLoader(db, WorkerCount(2))
+	c.Assert(err, check.IsNil)
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- ld.Run()
+	}()
+
+	// the DDL fails as it's not expected by the mock
+	ld.Input() <- NewDDLTxn("test", "t", "DROP TABLE `t`")
+	c.Assert(<-runErr, check.NotNil)
+
+	setErr := make(chan error, 1)
+	go func() {
+		setErr <- ld.SetWorkerCount(4)
+	}()
+	select {
+	case err := <-setErr:
+		c.Assert(err, check.ErrorMatches, "loader is closed")
+	case <-time.After(time.Second):
+		c.Fatal("SetWorkerCount is blocked after Run failed")
+	}
+}
+
+func (s *runSuite) TestSetWorkerCountNotSupported(c *check.C) {
+	ld := &loaderImpl{opts: options{enableDispatch: false}}
+	c.Assert(ld.SetWorkerCount(2), check.ErrorMatches, ".*dispatch is disabled.*")
+
+	ld = &loaderImpl{
+		opts:             options{enableDispatch: true},
+		loopBackSyncInfo: &loopbacksync.LoopBackSync{LoopbackControl: true},
+	}
+	c.Assert(ld.SetWorkerCount(2), check.ErrorMatches, ".*loopback control is enabled.*")
+}
+
 type markSuccessesSuite struct{}
 
 var _ = check.Suite(&markSuccessesSuite{})
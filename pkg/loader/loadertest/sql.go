@@ -0,0 +1,31 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loadertest provides the helpers for the tests of the SQL generated by the loader.
+package loadertest
+
+import (
+	"testing"
+
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+// AssertSQLEqual fails t if expected and actual are different after normalized by loader.NormalizeSQL.
+func AssertSQLEqual(t *testing.T, expected, actual string) {
+	t.Helper()
+	normalizedExpected, normalizedActual := loader.NormalizeSQL(expected), loader.NormalizeSQL(actual)
+	if normalizedExpected != normalizedActual {
+		t.Errorf("SQL not equal:\nexpected: %s\nactual:   %s\nnormalized expected: %s\nnormalized actual:   %s",
+			expected, actual, normalizedExpected, normalizedActual)
+	}
+}
@@ -154,3 +154,36 @@ func logDMLs(dmls []*DML, c *check.C) {
 		c.Logf("tp: %v, values: %v, OldValues: %v", dml.Tp, dml.Values, dml.OldValues)
 	}
 }
+
+func (m *modelSuite) TestMergeByShardRowID(c *check.C) {
+	info := &tableInfo{columns: []string{"name", "age"}, shardRowIDBits: 4}
+	newDML := func(tp DMLType, rowID int64, name string, age int) *DML {
+		return &DML{Database: "test", Table: "users", Tp: tp, info: info,
+			Values: map[string]interface{}{tidbRowIDColumn: rowID, "name": name, "age": age}}
+	}
+
+	insert1 := newDML(InsertDMLType, 1, "a", 18)
+	update1 := newDML(UpdateDMLType, 1, "a", 19)
+	update1.OldValues = insert1.Values
+	insert2 := newDML(InsertDMLType, 2, "b", 20)
+	delete2 := newDML(DeleteDMLType, 2, "b", 20)
+	update3 := newDML(UpdateDMLType, 3, "c", 22)
+	update3.OldValues = map[string]interface{}{tidbRowIDColumn: int64(3), "name": "c", "age": 21}
+
+	res, err := mergeByPrimaryKey([]*DML{insert1, update1, insert2, delete2, update3})
+	c.Assert(err, check.IsNil)
+
+	// insert + update -> insert
+	c.Assert(res[InsertDMLType], check.HasLen, 1)
+	c.Assert(res[InsertDMLType][0].Values, check.DeepEquals, update1.Values)
+	// insert + delete -> delete
+	c.Assert(res[DeleteDMLType], check.HasLen, 1)
+	c.Assert(res[DeleteDMLType][0].Values[tidbRowIDColumn], check.Equals, int64(2))
+	c.Assert(res[UpdateDMLType], check.HasLen, 1)
+	c.Assert(res[UpdateDMLType][0].Values[tidbRowIDColumn], check.Equals, int64(3))
+
+	// the DMLs without the row id can't be merged
+	_, err = mergeByPrimaryKey([]*DML{{Database: "test", Table: "users", Tp: InsertDMLType, info: info,
+		Values: map[string]interface{}{"name": "a", "age": 18}}})
+	c.Assert(err, check.ErrorMatches, ".*no pk")
+}
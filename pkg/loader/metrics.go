@@ -0,0 +1,227 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// PipelineMetrics contains all the metrics of Loader, pass &m.MetricsGroup to Metrics to use them.
+// The fields can be replaced before MustRegister to share the metrics with the caller,
+// or set to nil to disable them.
+type PipelineMetrics struct {
+	MetricsGroup
+}
+
+// NewPipelineMetrics creates all the metrics of Loader in the namespace and subsystem.
+func NewPipelineMetrics(namespace, subsystem string) *PipelineMetrics {
+	return &PipelineMetrics{MetricsGroup{
+		EventCounterVec: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "event",
+				Help:      "the count of sql event(dml, ddl).",
+			}, []string{"type"}),
+		QueryHistogramVec: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "query_duration_time",
+				Help:      "Bucketed histogram of processing time (s) of a query to sync data to downstream.",
+				Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 18),
+			}, []string{"type"}),
+		QueueSizeGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "queue_size",
+				Help:      "the size of queue",
+			}, []string{"name"}),
+		WorkerErrorCounterVec: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "worker_errors_total",
+				Help:      "Total count of errors of each loader worker.",
+			}, []string{"worker"}),
+		OutOfOrderCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "out_of_order_total",
+				Help:      "Total count of txns whose commit ts is less than the previous one.",
+			}),
+		WarmUpHistogram: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "warmup_seconds",
+				Help:      "Bucketed histogram of time (s) to warm up the connections of loader.",
+				Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+			}),
+		ValidationErrCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "dml_validation_errors_total",
+				Help:      "Total count of DMLs inconsistent with the table info.",
+			}),
+		TxnTimeoutCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "transaction_timeout_total",
+				Help:      "Total count of txns rolled back for timeout.",
+			}),
+		ReconnectCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "reconnect_attempts_total",
+				Help:      "Total count of attempts to begin txn again after the connection is broken.",
+			}),
+		PrefetchTablesCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "prefetch_tables_total",
+				Help:      "Total count of tables whose info is pre-fetched when creating loader.",
+			}),
+		PrefetchHistogram: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "prefetch_duration_seconds",
+				Help:      "Bucketed histogram of time (s) to pre-fetch the table info of loader.",
+				Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+			}),
+		BatchTimeoutCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "batch_timeout_total",
+				Help:      "Total count of the batches of DMLs not executed in time.",
+			}),
+		DeadlockCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "deadlocks_total",
+				Help:      "Total count of the deadlocks found when executing DMLs.",
+			}),
+		SchemaDriftCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "schema_drift_events_total",
+				Help:      "Total count of the column changes of downstream tables found when refreshing the table info.",
+			}),
+		SlowQueryCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "slow_queries_total",
+				Help:      "Total count of the slow queries found in the performance schema of downstream.",
+			}),
+		TableEventCounterVec: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "table_events_total",
+				Help:      "Total count of the DMLs executed and the failed executions of every table.",
+			}, []string{"schema", "table", "event_type"}),
+		MissingRowCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "missing_row_upserts_total",
+				Help:      "Total count of the UPDATEs executed as REPLACE for the rows missing in downstream.",
+			}),
+		NoopUpdateCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "noop_updates_total",
+				Help:      "Total count of the UPDATEs skipped because they change no column.",
+			}),
+		RetryHistogram: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "retry_attempts",
+				Help:      "Bucketed histogram of the number of retries to execute a group of DMLs.",
+				Buckets:   append([]float64{0}, prometheus.ExponentialBuckets(1, 2, 8)...),
+			}),
+		TxnQueryHistogramVec: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "txn_query_duration_time",
+				Help:      "Bucketed histogram of processing time (s) of a query in every txn, only observed if WithTransactionIDLabel is set.",
+				Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 18),
+			}, []string{"type", "txn_id"}),
+		BatchQueueHistogram: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "batch_queue_duration_seconds",
+				Help:      "Bucketed histogram of time (s) from the batch of DMLs is created to it's executed.",
+				Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18),
+			}),
+		BatchExecuteHistogram: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "batch_execute_duration_seconds",
+				Help:      "Bucketed histogram of time (s) to execute the batch of DMLs.",
+				Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18),
+			}),
+	}}
+}
+
+// MustRegister registers all the non-nil metrics to r, it panics if any of them fails.
+func (m *PipelineMetrics) MustRegister(r prometheus.Registerer) {
+	r.MustRegister(m.collectors()...)
+}
+
+func (m *PipelineMetrics) collectors() []prometheus.Collector {
+	var cs []prometheus.Collector
+	add := func(c prometheus.Collector, isNil bool) {
+		if !isNil {
+			cs = append(cs, c)
+		}
+	}
+	add(m.EventCounterVec, m.EventCounterVec == nil)
+	add(m.QueryHistogramVec, m.QueryHistogramVec == nil)
+	add(m.QueueSizeGauge, m.QueueSizeGauge == nil)
+	add(m.WorkerErrorCounterVec, m.WorkerErrorCounterVec == nil)
+	add(m.OutOfOrderCounter, m.OutOfOrderCounter == nil)
+	add(m.WarmUpHistogram, m.WarmUpHistogram == nil)
+	add(m.ValidationErrCounter, m.ValidationErrCounter == nil)
+	add(m.TxnTimeoutCounter, m.TxnTimeoutCounter == nil)
+	add(m.ReconnectCounter, m.ReconnectCounter == nil)
+	add(m.PrefetchTablesCounter, m.PrefetchTablesCounter == nil)
+	add(m.PrefetchHistogram, m.PrefetchHistogram == nil)
+	add(m.BatchTimeoutCounter, m.BatchTimeoutCounter == nil)
+	add(m.DeadlockCounter, m.DeadlockCounter == nil)
+	add(m.SchemaDriftCounter, m.SchemaDriftCounter == nil)
+	add(m.SlowQueryCounter, m.SlowQueryCounter == nil)
+	add(m.TableEventCounterVec, m.TableEventCounterVec == nil)
+	add(m.MissingRowCounter, m.MissingRowCounter == nil)
+	add(m.NoopUpdateCounter, m.NoopUpdateCounter == nil)
+	add(m.RetryHistogram, m.RetryHistogram == nil)
+	add(m.TxnQueryHistogramVec, m.TxnQueryHistogramVec == nil)
+	add(m.BatchQueueHistogram, m.BatchQueueHistogram == nil)
+	add(m.BatchExecuteHistogram, m.BatchExecuteHistogram == nil)
+	return cs
+}
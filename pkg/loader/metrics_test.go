@@ -0,0 +1,57 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type pipelineMetricsSuite struct{}
+
+var _ = check.Suite(&pipelineMetricsSuite{})
+
+func (s *pipelineMetricsSuite) TestMustRegister(c *check.C) {
+	m := NewPipelineMetrics("binlog", "test")
+	m.QueueSizeGauge.WithLabelValues("worker_0").Set(1)
+
+	registry := prometheus.NewRegistry()
+	m.MustRegister(registry)
+	families, err := registry.Gather()
+	c.Assert(err, check.IsNil)
+	names := make(map[string]struct{})
+	for _, family := range families {
+		names[family.GetName()] = struct{}{}
+	}
+	// the vectors without any labels are not gathered
+	c.Assert(names, check.HasLen, 17)
+	c.Assert(names, check.HasKey, "binlog_test_out_of_order_total")
+	c.Assert(names, check.HasKey, "binlog_test_queue_size")
+	c.Assert(names, check.Not(check.HasKey), "binlog_test_event")
+
+	// the metrics can't be registered twice
+	c.Assert(func() { m.MustRegister(registry) }, check.PanicMatches, "duplicate metrics collector registration attempted")
+}
+
+func (s *pipelineMetricsSuite) TestCollectors(c *check.C) {
+	m := NewPipelineMetrics("binlog", "test")
+	all := len(m.collectors())
+	c.Assert(all, check.Equals, 22)
+
+	// the nil metrics are not registered
+	m.EventCounterVec = nil
+	m.BatchTimeoutCounter = nil
+	c.Assert(m.collectors(), check.HasLen, all-2)
+	m.MustRegister(prometheus.NewRegistry())
+}
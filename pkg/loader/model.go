@@ -14,15 +14,31 @@
 package loader
 
 import (
+	"context"
+	gosql "database/sql"
+	"encoding/hex"
 	"fmt"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrNilTableInfo means the table info of the DML is not set.
+	ErrNilTableInfo = errors.New("table info is nil")
+	// ErrMissingPrimaryKey means the DML doesn't contain the value of a primary key column.
+	ErrMissingPrimaryKey = errors.New("missing primary key column")
+	// ErrColumnCountMismatch means the DML contains more columns than the table.
+	ErrColumnCountMismatch = errors.New("column count mismatch")
+)
+
 // DMLType represents the dml type
 type DMLType int
 
@@ -45,6 +61,9 @@ type DML struct {
 	Values    map[string]interface{}
 
 	info *tableInfo
+	// the columns encrypted by the loader, the stored values can't be located by the ones of the DML
+	// since they're encrypted with random nonces, so they're never used in the WHERE clause.
+	encryptedColumns map[string]struct{}
 }
 
 // DDL holds the ddl info
@@ -64,6 +83,9 @@ type Txn struct {
 
 	AppliedTS int64
 
+	// CommitTS is the commit ts of the txn in upstream, 0 means unknown
+	CommitTS int64
+
 	// This field is used to hold arbitrary data you wish to include so it
 	// will be available when receiving on the Successes channel
 	Metadata interface{}
@@ -98,12 +120,51 @@ func (t *Txn) isDDL() bool {
 	return t.DDL != nil
 }
 
+// GetSQL returns the SQL of the DDL, or the SQL of every DML with placeholders for the values.
+// The unique keys are used in WHERE only if the table info of DMLs is set by loader.
+func (t *Txn) GetSQL() []string {
+	if t.isDDL() {
+		return []string{t.DDL.SQL}
+	}
+
+	sqls := make([]string, 0, len(t.DMLs))
+	for _, dml := range t.DMLs {
+		sql, _ := dml.sql()
+		sqls = append(sqls, sql)
+	}
+	return sqls
+}
+
+// shardRowIDKey is the primary key of the tables identified by `_tidb_rowid`
+var shardRowIDKey = []string{tidbRowIDColumn}
+
 func (dml *DML) primaryKeys() []string {
-	if dml.info.primaryKey == nil {
-		return nil
+	if dml.info.primaryKey != nil {
+		return dml.info.primaryKey.columns
 	}
 
-	return dml.info.primaryKey.columns
+	// the rows of the table with SHARD_ROW_ID_BITS and without primary key are identified by the hidden row id
+	if dml.info.shardRowIDBits > 0 {
+		if _, ok := dml.Values[tidbRowIDColumn]; ok {
+			return shardRowIDKey
+		}
+	}
+
+	return nil
+}
+
+// ExtractPrimaryKey returns the primary key columns and the values of them in the DML, `_tidb_rowid` is used
+// as the primary key of the table with SHARD_ROW_ID_BITS and without primary key if it's in the values.
+// It returns nil if the primary key is unknown.
+func (dml *DML) ExtractPrimaryKey() (columns []string, values []interface{}) {
+	if dml.info == nil {
+		return nil, nil
+	}
+	columns = dml.primaryKeys()
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	return columns, dml.primaryKeyValues()
 }
 
 func (dml *DML) primaryKeyValues() []interface{} {
@@ -139,9 +200,76 @@ func (dml *DML) updateKey() bool {
 	return false
 }
 
+// String formats the DML as `{type} {schema}.{table} pk={pk_values}` for logging,
+// both the old and new values of primary key are shown for UPDATE like `pk=(1)->(2)`.
+// All the values are shown if the primary key is unknown.
 func (dml *DML) String() string {
-	return fmt.Sprintf("{db: %s, table: %s,tp: %v values: %d old_values: %d}",
-		dml.Database, dml.Table, dml.Tp, len(dml.Values), len(dml.OldValues))
+	names := dml.keyNamesForString()
+	pk := formatValuesForString(names, dml.Values)
+	if dml.Tp == UpdateDMLType {
+		pk = formatValuesForString(names, dml.OldValues) + "->" + pk
+	}
+
+	return fmt.Sprintf("%s %s.%s pk=%s", dmlTypeName(dml.Tp), dml.Database, dml.Table, pk)
+}
+
+// keyNamesForString returns the primary key columns, or all the columns in order if it's unknown.
+func (dml *DML) keyNamesForString() []string {
+	if dml.info != nil {
+		if names := dml.primaryKeys(); len(names) > 0 {
+			return names
+		}
+	}
+
+	names := make([]string, 0, len(dml.Values))
+	for name := range dml.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatValuesForString(names []string, values map[string]interface{}) string {
+	builder := new(strings.Builder)
+	builder.WriteByte('(')
+	for i, name := range names {
+		if i != 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(truncateForString(values[name]))
+	}
+	builder.WriteByte(')')
+
+	return builder.String()
+}
+
+// maxValueLenForString is the max count of characters of a value in DML.String
+const maxValueLenForString = 64
+
+func truncateForString(v interface{}) string {
+	var str string
+	if b, ok := v.([]byte); ok {
+		str = string(b)
+	} else {
+		str = fmt.Sprintf("%v", v)
+	}
+
+	if utf8.RuneCountInString(str) > maxValueLenForString {
+		str = string([]rune(str)[:maxValueLenForString]) + "..."
+	}
+	return str
+}
+
+func dmlTypeName(tp DMLType) string {
+	switch tp {
+	case InsertDMLType:
+		return "INSERT"
+	case UpdateDMLType:
+		return "UPDATE"
+	case DeleteDMLType:
+		return "DELETE"
+	}
+	return "UNKNOWN"
 }
 
 func (dml *DML) oldPrimaryKeyValues() []interface{} {
@@ -165,12 +293,104 @@ func (dml *DML) TableName() string {
 	return quoteSchema(dml.Database, dml.Table)
 }
 
+// ToRow returns the values of the DML in their string forms, so plugins can access them without
+// type assertions. NULL is returned as "NULL", binary values as hex strings.
+func (dml *DML) ToRow() map[string]string {
+	row := make(map[string]string, len(dml.Values))
+	for name, value := range dml.Values {
+		row[name] = valueString(value)
+	}
+	return row
+}
+
+// ApplyFilter returns a copy of the DML with the Values and OldValues transformed by fn, like anonymizing
+// the PII before writing to the downstream, the DML itself is not changed. The column is dropped if fn
+// returns nil for it. fn is not called for the NULL values, they're kept as is.
+func (dml *DML) ApplyFilter(fn func(col string, val interface{}) interface{}) *DML {
+	filtered := *dml
+	filtered.Values = filterValues(dml.Values, fn)
+	filtered.OldValues = filterValues(dml.OldValues, fn)
+	return &filtered
+}
+
+func filterValues(values map[string]interface{}, fn func(col string, val interface{}) interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+
+	filtered := make(map[string]interface{}, len(values))
+	for col, val := range values {
+		if val == nil {
+			filtered[col] = nil
+			continue
+		}
+		if v := fn(col, val); v != nil {
+			filtered[col] = v
+		}
+	}
+	return filtered
+}
+
+// valueString returns the string form of the column value as MySQL shows it.
+// The values of DECIMAL, DATE, TIME, JSON, ENUM and SET columns are already strings in the DMLs
+// from binlog, so only the go types of the values are considered.
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return v
+	case []byte:
+		return hex.EncodeToString(v)
+	case time.Time:
+		// the fraction is omitted if it's zero
+		return v.Format("2006-01-02 15:04:05.999999")
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
 func (dml *DML) updateSQL() (sql string, args []interface{}) {
+	return dml.updateColumnsSQL(dml.columnNames())
+}
+
+// updateColumnsSQL returns the UPDATE setting only the columns of names, the WHERE clause is the same
+// as updateSQL.
+func (dml *DML) updateColumnsSQL(names []string) (sql string, args []interface{}) {
 	builder := new(strings.Builder)
 
 	fmt.Fprintf(builder, "UPDATE %s SET ", dml.TableName())
 
-	for _, name := range dml.columnNames() {
+	for _, name := range names {
 		if len(args) > 0 {
 			builder.WriteByte(',')
 		}
@@ -220,7 +440,14 @@ func (dml *DML) whereValues(names []string) (values []interface{}) {
 
 func (dml *DML) whereSlice() (colNames []string, args []interface{}) {
 	// Try to use unique key values when available
-	for _, index := range dml.info.uniqueKeys {
+	var uniqueKeys []indexInfo
+	if dml.info != nil {
+		uniqueKeys = dml.info.uniqueKeys
+	}
+	for _, index := range uniqueKeys {
+		if dml.hasEncryptedColumn(index.columns) {
+			continue
+		}
 		values := dml.whereValues(index.columns)
 		notAnyNil := true
 		for i := 0; i < len(values); i++ {
@@ -236,9 +463,27 @@ func (dml *DML) whereSlice() (colNames []string, args []interface{}) {
 
 	// Fallback to use all columns
 	names := dml.columnNames()
+	if len(dml.encryptedColumns) > 0 {
+		located := names[:0]
+		for _, name := range names {
+			if !dml.hasEncryptedColumn([]string{name}) {
+				located = append(located, name)
+			}
+		}
+		names = located
+	}
 	return names, dml.whereValues(names)
 }
 
+func (dml *DML) hasEncryptedColumn(names []string) bool {
+	for _, name := range names {
+		if _, ok := dml.encryptedColumns[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (dml *DML) deleteSQL() (sql string, args []interface{}) {
 	builder := new(strings.Builder)
 
@@ -250,6 +495,65 @@ func (dml *DML) deleteSQL() (sql string, args []interface{}) {
 	return
 }
 
+// existsSQL returns a statement counting the rows located by the where clause of dml.
+func (dml *DML) existsSQL() (sql string, args []interface{}) {
+	builder := new(strings.Builder)
+
+	fmt.Fprintf(builder, "SELECT COUNT(*) FROM %s WHERE ", dml.TableName())
+	args = dml.buildWhere(builder)
+
+	sql = builder.String()
+	return
+}
+
+// deleteInSQL returns a statement deleting the rows of dmls by primary key like
+// `DELETE FROM t WHERE (a,b) IN ((?,?),(?,?))`, the parentheses are omitted for the single column primary key.
+// All the dmls must be deletes of the same table with primary key.
+func deleteInSQL(dmls []*DML) (sql string, args []interface{}) {
+	names := dmls[0].primaryKeys()
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, quoteName(name))
+	}
+	holder := holderString(len(names))
+	if len(names) > 1 {
+		holder = "(" + holder + ")"
+	}
+
+	builder := new(strings.Builder)
+	fmt.Fprintf(builder, "DELETE FROM %s WHERE ", dmls[0].TableName())
+	if len(names) > 1 {
+		fmt.Fprintf(builder, "(%s) IN (", strings.Join(quoted, ","))
+	} else {
+		fmt.Fprintf(builder, "%s IN (", quoted[0])
+	}
+	args = make([]interface{}, 0, len(dmls)*len(names))
+	for i, dml := range dmls {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(holder)
+		args = append(args, dml.primaryKeyValues()...)
+	}
+	builder.WriteByte(')')
+
+	sql = builder.String()
+	return
+}
+
+// changedColumns returns the sorted names of the columns whose values are changed by the UPDATE dml.
+func (dml *DML) changedColumns() []string {
+	names := dml.columnNames()
+	changed := names[:0]
+	for _, name := range names {
+		old, ok := dml.OldValues[name]
+		if !ok || !reflect.DeepEqual(old, dml.Values[name]) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
 func (dml *DML) columnNames() []string {
 	names := make([]string, 0, len(dml.Values))
 
@@ -287,11 +591,87 @@ func (dml *DML) sql() (sql string, args []interface{}) {
 		return dml.deleteSQL()
 	}
 
-	log.Debug("get sql for dml", zap.Reflect("dml", dml), zap.String("sql", sql), zap.Reflect("args", args))
+	log.Debug("get sql for dml", zap.Stringer("dml", dml), zap.String("sql", sql), zap.Reflect("args", args))
 
 	return
 }
 
+// Validate checks the DML is consistent with its table info, so a malformed DML is
+// reported before the SQL is generated.
+func (dml *DML) Validate() error {
+	if dml.info == nil {
+		return errors.Annotatef(ErrNilTableInfo, "table %s", dml.TableName())
+	}
+
+	if err := dml.validateValues(dml.Values); err != nil {
+		return errors.Trace(err)
+	}
+	if dml.Tp == UpdateDMLType {
+		if err := dml.validateValues(dml.OldValues); err != nil {
+			return errors.Annotate(err, "old values")
+		}
+	}
+
+	return nil
+}
+
+func (dml *DML) validateValues(values map[string]interface{}) error {
+	// the values may be less than columns in partial column mode, but never more than columns.
+	count := len(values)
+	if _, ok := values[tidbRowIDColumn]; ok && dml.info.shardRowIDBits > 0 {
+		// the hidden row id is not in the columns
+		count--
+	}
+	if count > len(dml.info.columns) {
+		return errors.Annotatef(ErrColumnCountMismatch, "table %s has %d columns, but got %d values",
+			dml.TableName(), len(dml.info.columns), len(values))
+	}
+
+	for _, name := range dml.primaryKeys() {
+		if _, ok := values[name]; !ok {
+			return errors.Annotatef(ErrMissingPrimaryKey, "column %s of table %s", name, dml.TableName())
+		}
+	}
+
+	return nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (gosql.Result, error)
+}
+
+// ApplyTo executes the dml directly to db outside the batch pipeline,
+// it's convenient for plugins and test code to apply a single DML.
+func (dml *DML) ApplyTo(ctx context.Context, db *gosql.DB) error {
+	return dml.apply(ctx, db)
+}
+
+// ApplyTx executes the dml in the transaction tx.
+func (dml *DML) ApplyTx(ctx context.Context, tx *gosql.Tx) error {
+	return dml.apply(ctx, tx)
+}
+
+func (dml *DML) apply(ctx context.Context, e execer) error {
+	var (
+		sql  string
+		args []interface{}
+	)
+	switch dml.Tp {
+	case InsertDMLType:
+		sql, args = dml.replaceSQL()
+	case UpdateDMLType, DeleteDMLType:
+		sql, args = dml.sql()
+	default:
+		return errors.Errorf("unknown dml type %d of %s", dml.Tp, dml.TableName())
+	}
+
+	if _, err := e.ExecContext(ctx, sql, args...); err != nil {
+		return errors.Annotatef(err, "exec failed, sql: %s, args: %v", sql, args)
+	}
+
+	return nil
+}
+
 func formatKey(values []interface{}) string {
 	builder := new(strings.Builder)
 	for i, v := range values {
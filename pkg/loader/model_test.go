@@ -14,11 +14,15 @@
 package loader
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
 
 	"github.com/pingcap/check"
@@ -168,6 +172,36 @@ func (s *getKeysSuite) TestShouldCollectNewOldUniqKeyVals(c *check.C) {
 	c.Assert(keys, check.DeepEquals, expected)
 }
 
+func (s *getKeysSuite) TestExtractPrimaryKey(c *check.C) {
+	info := &tableInfo{columns: []string{"id", "name"}, uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}}}
+	info.primaryKey = &info.uniqueKeys[0]
+	dml := &DML{Tp: InsertDMLType, info: info, Values: map[string]interface{}{"id": 1, "name": "a"}}
+	names, values := dml.ExtractPrimaryKey()
+	c.Assert(names, check.DeepEquals, []string{"id"})
+	c.Assert(values, check.DeepEquals, []interface{}{1})
+
+	// use the row id of the table with SHARD_ROW_ID_BITS
+	info = &tableInfo{columns: []string{"name"}, shardRowIDBits: 4}
+	dml = &DML{Tp: UpdateDMLType, info: info, Values: map[string]interface{}{tidbRowIDColumn: int64(2), "name": "b"},
+		OldValues: map[string]interface{}{tidbRowIDColumn: int64(2), "name": "a"}}
+	names, values = dml.ExtractPrimaryKey()
+	c.Assert(names, check.DeepEquals, []string{tidbRowIDColumn})
+	c.Assert(values, check.DeepEquals, []interface{}{int64(2)})
+	c.Assert(dml.Validate(), check.IsNil)
+
+	// the row id is unknown
+	dml = &DML{Tp: DeleteDMLType, info: info, Values: map[string]interface{}{"name": "a"}}
+	names, values = dml.ExtractPrimaryKey()
+	c.Assert(names, check.IsNil)
+	c.Assert(values, check.IsNil)
+
+	// not sharded
+	info = &tableInfo{columns: []string{"name"}}
+	dml = &DML{Tp: DeleteDMLType, info: info, Values: map[string]interface{}{tidbRowIDColumn: int64(2), "name": "a"}}
+	names, _ = dml.ExtractPrimaryKey()
+	c.Assert(names, check.IsNil)
+}
+
 type SQLSuite struct{}
 
 var _ = check.Suite(&SQLSuite{})
@@ -186,7 +220,7 @@ func (s *SQLSuite) TestInsertSQL(c *check.C) {
 		},
 	}
 	sql, args := dml.sql()
-	c.Assert(sql, check.Equals, "INSERT INTO `test`.`hello`(`age`,`name`) VALUES(?,?)")
+	c.Assert(sql, sqlEquals, "INSERT INTO `test`.`hello`(`age`,`name`) VALUES(?,?)")
 	c.Assert(args, check.HasLen, 2)
 	c.Assert(args[0], check.Equals, 42)
 	c.Assert(args[1], check.Equals, "pc")
@@ -207,7 +241,7 @@ func (s *SQLSuite) TestDeleteSQL(c *check.C) {
 	}
 	sql, args := dml.sql()
 	c.Assert(
-		sql, check.Equals,
+		sql, sqlEquals,
 		"DELETE FROM `test`.`hello` WHERE `age` = ? AND `name` = ? LIMIT 1")
 	c.Assert(args, check.HasLen, 2)
 	c.Assert(args[0], check.Equals, 10)
@@ -231,7 +265,7 @@ func (s *SQLSuite) TestUpdateSQL(c *check.C) {
 	}
 	sql, args := dml.sql()
 	c.Assert(
-		sql, check.Equals,
+		sql, sqlEquals,
 		"UPDATE `db`.`tbl` SET `name` = ? WHERE `name` = ? LIMIT 1")
 	c.Assert(args, check.HasLen, 2)
 	c.Assert(args[0], check.Equals, "pc")
@@ -254,7 +288,7 @@ func (s *SQLSuite) TestUpdateMarkSQL(c *check.C) {
 	e.info = info
 
 	// begin will update the mark table if LoopbackControl is true.
-	tx, err := e.begin()
+	tx, err := e.begin(nil)
 	c.Assert(err, check.IsNil)
 
 	err = tx.commit()
@@ -262,3 +296,331 @@ func (s *SQLSuite) TestUpdateMarkSQL(c *check.C) {
 
 	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
 }
+
+type applySuite struct{}
+
+var _ = check.Suite(&applySuite{})
+
+func (s *applySuite) TestApplyTo(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	insert := getDML(true, InsertDMLType)
+	insert.Values = map[string]interface{}{"id": 1, "a1": "a"}
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`test`(`a1`,`id`) VALUES(?,?)")).
+		WithArgs("a", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	c.Assert(insert.ApplyTo(context.Background(), db), check.IsNil)
+
+	update := getDML(true, UpdateDMLType)
+	update.Values = map[string]interface{}{"id": 1, "a1": "b"}
+	update.OldValues = map[string]interface{}{"id": 1, "a1": "a"}
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `test`.`test` SET `a1` = ?,`id` = ? WHERE `id` = ? LIMIT 1")).
+		WithArgs("b", 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(update.ApplyTo(context.Background(), db), check.IsNil)
+
+	del := getDML(true, DeleteDMLType)
+	del.Values = map[string]interface{}{"id": 1, "a1": "b"}
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test`.`test` WHERE `id` = ? LIMIT 1")).
+		WithArgs(1).WillReturnError(errors.New("delete fail"))
+	c.Assert(del.ApplyTo(context.Background(), db), check.ErrorMatches, ".*delete fail.*")
+
+	unknown := getDML(true, UnknownDMLType)
+	c.Assert(unknown.ApplyTo(context.Background(), db), check.ErrorMatches, "unknown dml type.*")
+
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *applySuite) TestApplyWithoutTableInfo(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	dml := &DML{
+		Database: "test",
+		Table:    "test",
+		Tp:       DeleteDMLType,
+		Values:   map[string]interface{}{"id": 1, "a1": "a"},
+	}
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test`.`test` WHERE `a1` = ? AND `id` = ? LIMIT 1")).
+		WithArgs("a", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(dml.ApplyTo(context.Background(), db), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *applySuite) TestApplyTx(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`test`(`a1`,`id`) VALUES(?,?)")).
+		WithArgs("a", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test`.`test` WHERE `id` = ? LIMIT 1")).
+		WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	c.Assert(err, check.IsNil)
+
+	insert := getDML(true, InsertDMLType)
+	insert.Values = map[string]interface{}{"id": 1, "a1": "a"}
+	c.Assert(insert.ApplyTx(context.Background(), tx), check.IsNil)
+
+	del := getDML(true, DeleteDMLType)
+	del.Values = map[string]interface{}{"id": 2, "a1": "b"}
+	c.Assert(del.ApplyTx(context.Background(), tx), check.IsNil)
+
+	c.Assert(tx.Commit(), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+type validateSuite struct{}
+
+var _ = check.Suite(&validateSuite{})
+
+func (s *validateSuite) newDML(tp DMLType) *DML {
+	info := &tableInfo{
+		columns:    []string{"id", "name"},
+		uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+	}
+	info.setPrimaryKey()
+	return &DML{
+		Database:  "db",
+		Table:     "tbl",
+		Tp:        tp,
+		Values:    map[string]interface{}{"id": 1, "name": "pingcap"},
+		OldValues: map[string]interface{}{"id": 1, "name": "tidb"},
+		info:      info,
+	}
+}
+
+func (s *validateSuite) TestValid(c *check.C) {
+	for _, tp := range []DMLType{InsertDMLType, UpdateDMLType, DeleteDMLType} {
+		c.Assert(s.newDML(tp).Validate(), check.IsNil)
+	}
+
+	// less values than columns is valid in partial column mode
+	dml := s.newDML(InsertDMLType)
+	delete(dml.Values, "name")
+	c.Assert(dml.Validate(), check.IsNil)
+}
+
+func (s *validateSuite) TestNilTableInfo(c *check.C) {
+	dml := s.newDML(InsertDMLType)
+	dml.info = nil
+	c.Assert(errors.Cause(dml.Validate()), check.Equals, ErrNilTableInfo)
+}
+
+func (s *validateSuite) TestMissingPrimaryKey(c *check.C) {
+	dml := s.newDML(InsertDMLType)
+	delete(dml.Values, "id")
+	err := dml.Validate()
+	c.Assert(errors.Cause(err), check.Equals, ErrMissingPrimaryKey)
+	c.Assert(err, check.ErrorMatches, "column id of table `db`.`tbl`.*")
+
+	dml = s.newDML(UpdateDMLType)
+	delete(dml.OldValues, "id")
+	err = dml.Validate()
+	c.Assert(errors.Cause(err), check.Equals, ErrMissingPrimaryKey)
+	c.Assert(err, check.ErrorMatches, "old values.*")
+
+	// old values are not used by insert
+	dml = s.newDML(InsertDMLType)
+	delete(dml.OldValues, "id")
+	c.Assert(dml.Validate(), check.IsNil)
+}
+
+func (s *validateSuite) TestColumnCountMismatch(c *check.C) {
+	dml := s.newDML(DeleteDMLType)
+	dml.Values["age"] = 10
+	c.Assert(errors.Cause(dml.Validate()), check.Equals, ErrColumnCountMismatch)
+}
+
+type stringSuite struct{}
+
+var _ = check.Suite(&stringSuite{})
+
+func (s *stringSuite) newDML(tp DMLType) *DML {
+	info := &tableInfo{
+		columns:    []string{"id", "name", "note"},
+		uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id", "name"}}},
+	}
+	info.setPrimaryKey()
+	return &DML{
+		Database: "db",
+		Table:    "tbl",
+		Tp:       tp,
+		Values:   map[string]interface{}{"id": 1, "name": []byte("pingcap"), "note": "hello"},
+		info:     info,
+	}
+}
+
+func (s *stringSuite) TestInsert(c *check.C) {
+	dml := s.newDML(InsertDMLType)
+	c.Assert(dml.String(), check.Equals, "INSERT db.tbl pk=(1, pingcap)")
+}
+
+func (s *stringSuite) TestDelete(c *check.C) {
+	dml := s.newDML(DeleteDMLType)
+	c.Assert(dml.String(), check.Equals, "DELETE db.tbl pk=(1, pingcap)")
+}
+
+func (s *stringSuite) TestUpdate(c *check.C) {
+	dml := s.newDML(UpdateDMLType)
+	dml.OldValues = map[string]interface{}{"id": 1, "name": []byte("pingcap"), "note": "world"}
+	c.Assert(dml.String(), check.Equals, "UPDATE db.tbl pk=(1, pingcap)->(1, pingcap)")
+}
+
+func (s *stringSuite) TestUpdatePrimaryKey(c *check.C) {
+	dml := s.newDML(UpdateDMLType)
+	dml.OldValues = map[string]interface{}{"id": 2, "name": []byte("tidb"), "note": "hello"}
+	c.Assert(dml.String(), check.Equals, "UPDATE db.tbl pk=(2, tidb)->(1, pingcap)")
+}
+
+func (s *stringSuite) TestWithoutPrimaryKey(c *check.C) {
+	dml := s.newDML(InsertDMLType)
+	dml.info = nil
+	c.Assert(dml.String(), check.Equals, "INSERT db.tbl pk=(1, pingcap, hello)")
+}
+
+func (s *stringSuite) TestTruncate(c *check.C) {
+	dml := s.newDML(InsertDMLType)
+	dml.Values["name"] = strings.Repeat("a", 63) + "中文"
+	c.Assert(dml.String(), check.Equals, "INSERT db.tbl pk=(1, "+strings.Repeat("a", 63)+"中...)")
+}
+
+type txnSuite struct{}
+
+var _ = check.Suite(&txnSuite{})
+
+func (s *txnSuite) TestGetSQLOfDMLs(c *check.C) {
+	txn := new(Txn)
+	for _, tp := range []DMLType{InsertDMLType, UpdateDMLType, DeleteDMLType} {
+		txn.AppendDML(&DML{
+			Database:  "db",
+			Table:     "tbl",
+			Tp:        tp,
+			Values:    map[string]interface{}{"id": 1},
+			OldValues: map[string]interface{}{"id": 2},
+		})
+	}
+
+	sqls := txn.GetSQL()
+	c.Assert(sqls, check.HasLen, len(txn.DMLs))
+	c.Assert(sqls, sqlEquals, []string{
+		"INSERT INTO `db`.`tbl`(`id`) VALUES(?)",
+		"UPDATE `db`.`tbl` SET `id` = ? WHERE `id` = ? LIMIT 1",
+		"DELETE FROM `db`.`tbl` WHERE `id` = ? LIMIT 1",
+	})
+}
+
+func (s *txnSuite) TestGetSQLOfDDL(c *check.C) {
+	txn := NewDDLTxn("db", "tbl", "DROP TABLE `db`.`tbl`")
+	c.Assert(txn.GetSQL(), sqlEquals, []string{"DROP TABLE `db`.`tbl`"})
+}
+
+type toRowSuite struct{}
+
+var _ = check.Suite(&toRowSuite{})
+
+func (s *toRowSuite) TestTypes(c *check.C) {
+	tests := []struct {
+		tp       string
+		value    interface{}
+		expected string
+	}{
+		{"NULL", nil, "NULL"},
+		{"TINYINT", int64(-8), "-8"},
+		{"INT", int32(42), "42"},
+		{"BIGINT", int64(-9223372036854775808), "-9223372036854775808"},
+		{"BIGINT UNSIGNED", uint64(18446744073709551615), "18446744073709551615"},
+		{"BIT", uint64(5), "5"},
+		{"BOOL", true, "1"},
+		{"FLOAT", float32(1.1), "1.1"},
+		{"DOUBLE", float64(3.14159), "3.14159"},
+		{"DOUBLE", float64(1e20), "1e+20"},
+		{"DECIMAL", "12.50", "12.50"},
+		{"VARCHAR", "hello", "hello"},
+		{"BLOB", []byte{0xde, 0xad, 0xbe, 0xef}, "deadbeef"},
+		{"DATETIME", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), "2006-01-02 15:04:05"},
+		{"DATETIME(6)", time.Date(2006, 1, 2, 15, 4, 5, 123000000, time.UTC), "2006-01-02 15:04:05.123"},
+		{"DATE", "2006-01-02", "2006-01-02"},
+		{"TIME", "15:04:05", "15:04:05"},
+		{"JSON", `{"a": 1}`, `{"a": 1}`},
+		{"ENUM", "male", "male"},
+		{"SET", "a,b", "a,b"},
+	}
+
+	for _, t := range tests {
+		dml := &DML{Tp: InsertDMLType, Values: map[string]interface{}{"c": t.value}}
+		c.Assert(dml.ToRow(), check.DeepEquals, map[string]string{"c": t.expected}, check.Commentf("type %s", t.tp))
+	}
+}
+
+func (s *toRowSuite) TestAllColumns(c *check.C) {
+	dml := &DML{
+		Tp:     UpdateDMLType,
+		Values: map[string]interface{}{"id": int64(1), "name": "pingcap", "data": nil},
+		// the old values are not included
+		OldValues: map[string]interface{}{"id": int64(1), "name": "tidb", "data": []byte("x")},
+	}
+	c.Assert(dml.ToRow(), check.DeepEquals, map[string]string{"id": "1", "name": "pingcap", "data": "NULL"})
+}
+
+type applyFilterSuite struct{}
+
+var _ = check.Suite(&applyFilterSuite{})
+
+func (s *applyFilterSuite) newDML() *DML {
+	return &DML{
+		Database:  "test",
+		Table:     "users",
+		Tp:        UpdateDMLType,
+		Values:    map[string]interface{}{"id": int64(1), "email": "new@pingcap.com", "age": int64(20), "note": nil},
+		OldValues: map[string]interface{}{"id": int64(1), "email": "old@pingcap.com", "age": int64(19), "note": nil},
+		info:      &tableInfo{columns: []string{"id", "email", "age", "note"}},
+	}
+}
+
+func (s *applyFilterSuite) TestIdentity(c *check.C) {
+	dml := s.newDML()
+	filtered := dml.ApplyFilter(func(col string, val interface{}) interface{} { return val })
+
+	c.Assert(filtered, check.Not(check.Equals), dml)
+	c.Assert(filtered, check.DeepEquals, dml)
+	// the maps are copied
+	filtered.Values["id"] = int64(2)
+	c.Assert(dml.Values["id"], check.Equals, int64(1))
+}
+
+func (s *applyFilterSuite) TestDropColumn(c *check.C) {
+	dml := s.newDML()
+	filtered := dml.ApplyFilter(func(col string, val interface{}) interface{} {
+		if col == "email" {
+			return nil
+		}
+		return val
+	})
+
+	c.Assert(filtered.Values, check.DeepEquals, map[string]interface{}{"id": int64(1), "age": int64(20), "note": nil})
+	c.Assert(filtered.OldValues, check.DeepEquals, map[string]interface{}{"id": int64(1), "age": int64(19), "note": nil})
+	// the original DML is unchanged
+	c.Assert(dml, check.DeepEquals, s.newDML())
+}
+
+func (s *applyFilterSuite) TestChangeType(c *check.C) {
+	dml := s.newDML()
+	dml.Tp = InsertDMLType
+	dml.OldValues = nil
+	filtered := dml.ApplyFilter(func(col string, val interface{}) interface{} {
+		if v, ok := val.(int64); ok {
+			return strconv.FormatInt(v, 10)
+		}
+		return val
+	})
+
+	c.Assert(filtered.Values, check.DeepEquals, map[string]interface{}{"id": "1", "email": "new@pingcap.com", "age": "20", "note": nil})
+	c.Assert(filtered.OldValues, check.IsNil)
+	c.Assert(dml.Values["age"], check.Equals, int64(20))
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+type retryHistogramSuite struct{}
+
+var _ = check.Suite(&retryHistogramSuite{})
+
+func (s *retryHistogramSuite) TestObserveRetries(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	histogram := NewPipelineMetrics("binlog", "test").RetryHistogram
+	e := newExecutor(db).withRetryHistogram(histogram)
+	exec := func(failures int, retryNum int) error {
+		for i := 0; i < failures; i++ {
+			mock.ExpectBegin()
+			mock.ExpectExec("DELETE FROM").WillReturnError(errors.New("lost connection"))
+			mock.ExpectRollback()
+		}
+		if failures < retryNum {
+			mock.ExpectBegin()
+			mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+		dmls := []*DML{newCaptureTestDML(DeleteDMLType, 1)}
+		return e.execTableBatchRetry(context.Background(), dmls, retryNum, time.Millisecond)
+	}
+
+	// no retry
+	c.Assert(exec(0, 3), check.IsNil)
+	// one retry
+	c.Assert(exec(1, 3), check.IsNil)
+	// all the retries fail
+	c.Assert(exec(3, 3), check.ErrorMatches, "lost connection")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(histogram.Write(&metric), check.IsNil)
+	c.Assert(metric.GetHistogram().GetSampleCount(), check.Equals, uint64(3))
+	c.Assert(metric.GetHistogram().GetSampleSum(), check.Equals, 3.0)
+	counts := make(map[float64]uint64)
+	for _, bucket := range metric.GetHistogram().GetBucket() {
+		counts[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+	}
+	c.Assert(counts[0], check.Equals, uint64(1))
+	c.Assert(counts[1], check.Equals, uint64(2))
+	c.Assert(counts[2], check.Equals, uint64(3))
+	c.Assert(counts[128], check.Equals, uint64(3))
+}
+
+func (s *retryHistogramSuite) TestFailFast(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	histogram := NewPipelineMetrics("binlog", "test").RetryHistogram
+	e := newExecutor(db).withRetryHistogram(histogram).withFailFast(true)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnError(errors.New("lost connection"))
+	mock.ExpectRollback()
+
+	err = e.execTableBatchRetry(context.Background(), []*DML{newCaptureTestDML(DeleteDMLType, 1)}, 3, time.Millisecond)
+	c.Assert(err, check.ErrorMatches, "lost connection")
+	// not retried at all
+	c.Assert(histogramCount(c, histogram), check.Equals, uint64(0))
+}
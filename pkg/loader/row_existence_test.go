@@ -0,0 +1,101 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type rowExistenceSuite struct{}
+
+var _ = check.Suite(&rowExistenceSuite{})
+
+const (
+	existsTestSQL  = "SELECT COUNT(*) FROM `test`.`users` WHERE `id` = ?"
+	updateTestSQL  = "UPDATE `test`.`users` SET `id` = ?,`name` = ? WHERE `id` = ? LIMIT 1"
+	replaceTestSQL = "REPLACE INTO `test`.`users`(`id`,`name`) VALUES(?,?)"
+)
+
+func (s *rowExistenceSuite) newExecutor(c *check.C) (*executor, sqlmock.Sqlmock, prometheus.Counter) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	return newExecutor(db).withRowExistenceCheck(true).withMissingRowCounter(counter), mock, counter
+}
+
+func (s *rowExistenceSuite) TestExistingRow(c *check.C) {
+	e, mock, counter := s.newExecutor(c)
+	defer e.db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(existsTestSQL)).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(updateTestSQL)).WithArgs(1, "a", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c.Assert(e.singleExec([]*DML{newCaptureTestDML(UpdateDMLType, 1)}, false), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	c.Assert(counterValue(c, counter), check.Equals, 0.0)
+}
+
+func (s *rowExistenceSuite) TestMissingRow(c *check.C) {
+	e, mock, counter := s.newExecutor(c)
+	defer e.db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(existsTestSQL)).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(replaceTestSQL)).WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	// the other types are not checked
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1")).WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dmls := []*DML{newCaptureTestDML(UpdateDMLType, 1), newCaptureTestDML(DeleteDMLType, 2)}
+	c.Assert(e.singleExec(dmls, false), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	c.Assert(counterValue(c, counter), check.Equals, 1.0)
+}
+
+func (s *rowExistenceSuite) TestCheckFailed(c *check.C) {
+	e, mock, _ := s.newExecutor(c)
+	defer e.db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(existsTestSQL)).WillReturnError(errors.New("lost connection"))
+	mock.ExpectRollback()
+
+	err := e.singleExec([]*DML{newCaptureTestDML(UpdateDMLType, 1)}, false)
+	c.Assert(err, check.ErrorMatches, "lost connection")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *rowExistenceSuite) TestDisabled(c *check.C) {
+	e := newCaptureExecutor()
+	c.Assert(e.singleExec([]*DML{newCaptureTestDML(UpdateDMLType, 1)}, false), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{updateTestSQL})
+
+	// not checked in safe mode
+	e = newCaptureExecutor().withRowExistenceCheck(true)
+	c.Assert(e.singleExec([]*DML{newCaptureTestDML(UpdateDMLType, 1)}, true), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{
+		"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1",
+		replaceTestSQL,
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// withShadowTable makes the executor apply every DML to the table named `table + suffix` too if it exists,
+// getTableInfo should return ErrTableNotExist if the shadow table doesn't exist.
+func (e *executor) withShadowTable(suffix string, getTableInfo func(schema string, table string) (*tableInfo, error)) *executor {
+	e.shadowTableSuffix = suffix
+	e.getTableInfo = getTableInfo
+	return e
+}
+
+// execTableBatchWithShadowTable executes dmls and the same DMLs against `table + shadowSuffix` in one txn,
+// so the shadow table built for an online schema change keeps in step with the original table.
+// The DMLs are executed one by one in safe mode, the tables without shadow table are executed as usual.
+func (e *executor) execTableBatchWithShadowTable(ctx context.Context, dmls []*DML, shadowSuffix string) error {
+	if len(dmls) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	shadows, err := e.shadowDMLs(dmls, shadowSuffix)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	all := make([]*DML, 0, len(dmls)+len(shadows))
+	all = append(all, dmls...)
+	all = append(all, shadows...)
+	return errors.Trace(e.singleExec(all, true))
+}
+
+// shadowDMLs returns the DMLs against the shadow tables of dmls, the DMLs of the tables without
+// shadow table are skipped.
+func (e *executor) shadowDMLs(dmls []*DML, shadowSuffix string) ([]*DML, error) {
+	// the shadow table name -> the info of it, nil if it doesn't exist
+	infos := make(map[string]*tableInfo)
+	shadows := make([]*DML, 0, len(dmls))
+	for _, dml := range dmls {
+		table := dml.Table + shadowSuffix
+		name := quoteSchema(dml.Database, table)
+		info, ok := infos[name]
+		if !ok {
+			var err error
+			info, err = e.getTableInfo(dml.Database, table)
+			if errors.Cause(err) == ErrTableNotExist {
+				info = nil
+			} else if err != nil {
+				return nil, errors.Annotatef(err, "get table info of shadow table %s", name)
+			}
+			infos[name] = info
+			if info != nil {
+				log.Debug("apply dmls to shadow table", zap.String("table", dml.TableName()), zap.String("shadow", name))
+			}
+		}
+		if info == nil {
+			continue
+		}
+
+		shadows = append(shadows, &DML{
+			Database:  dml.Database,
+			Table:     table,
+			Tp:        dml.Tp,
+			Values:    shadowValues(info, dml.Values),
+			OldValues: shadowValues(info, dml.OldValues),
+			info:      info,
+		})
+	}
+	return shadows, nil
+}
+
+// shadowValues returns the values of the columns in the shadow table, the columns dropped
+// in the shadow table are removed.
+func shadowValues(info *tableInfo, values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	vals := make(map[string]interface{}, len(values))
+	for _, col := range info.columns {
+		if v, ok := values[col]; ok {
+			vals[col] = v
+		}
+	}
+	return vals
+}
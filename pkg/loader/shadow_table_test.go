@@ -0,0 +1,116 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type shadowTableSuite struct{}
+
+var _ = check.Suite(&shadowTableSuite{})
+
+func newShadowTestDMLs() []*DML {
+	info := &tableInfo{
+		columns:    []string{"id", "name", "age"},
+		uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+	}
+	return []*DML{
+		{Database: "test", Table: "users", Tp: InsertDMLType, info: info,
+			Values: map[string]interface{}{"id": 1, "name": "a", "age": 18}},
+		{Database: "test", Table: "users", Tp: DeleteDMLType, info: info,
+			Values: map[string]interface{}{"id": 2, "name": "b", "age": 20}},
+	}
+}
+
+func (s *shadowTableSuite) TestApplyToShadowTable(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	// the shadow table drops the column `age`
+	shadowInfo := &tableInfo{
+		columns:    []string{"id", "name"},
+		uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+	}
+	var lookups []string
+	e := newExecutor(db).withShadowTable("_new", func(schema string, table string) (*tableInfo, error) {
+		lookups = append(lookups, table)
+		return shadowInfo, nil
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO `test`.`users`").WithArgs(18, 1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `test`.`users`").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("REPLACE INTO `test`.`users_new`").WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `test`.`users_new`").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dmls := newShadowTestDMLs()
+	c.Assert(e.execTableBatchWithShadowTable(context.Background(), dmls, "_new"), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	// looked up once for the table
+	c.Assert(lookups, check.DeepEquals, []string{"users_new"})
+	// the original DMLs are not changed
+	c.Assert(dmls[0].Values, check.HasLen, 3)
+}
+
+func (s *shadowTableSuite) TestSkipAbsentShadowTable(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	e := newExecutor(db).withShadowTable("_new", func(schema string, table string) (*tableInfo, error) {
+		return nil, errors.Annotatef(ErrTableNotExist, "table %s", table)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO `test`.`users`").WithArgs(18, 1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `test`.`users`").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c.Assert(e.execTableBatchRetry(context.Background(), newShadowTestDMLs(), 1, time.Millisecond), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *shadowTableSuite) TestGetShadowTableInfoFailed(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	e := newExecutor(db).withShadowTable("_new", func(schema string, table string) (*tableInfo, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	err = e.execTableBatchWithShadowTable(context.Background(), newShadowTestDMLs(), "_new")
+	c.Assert(err, check.ErrorMatches, ".*connection refused")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *shadowTableSuite) TestLoaderOption(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	l, err := NewLoader(db, WithShadowTableSuffix("_gho"))
+	c.Assert(err, check.IsNil)
+	e := l.(*loaderImpl).getExecutor()
+	c.Assert(e.shadowTableSuffix, check.Equals, "_gho")
+	c.Assert(e.getTableInfo, check.NotNil)
+}
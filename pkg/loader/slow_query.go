@@ -0,0 +1,113 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// the timers of performance schema are in picoseconds, TIMER_END increases since the server starts.
+const slowQuerySQL = `
+SELECT THREAD_ID, DIGEST, SQL_TEXT, TIMER_WAIT, TIMER_END FROM performance_schema.events_statements_history
+WHERE TIMER_WAIT > ? AND TIMER_END > ? ORDER BY TIMER_END;`
+
+const picosecondsPerNanosecond = 1000
+
+// slowQuery is a statement of events_statements_history taking longer than the threshold.
+type slowQuery struct {
+	threadID uint64
+	digest   string
+	sql      string
+	latency  time.Duration
+}
+
+// slowQueryDetector finds the slow queries in the performance schema of downstream, every slow query is
+// reported once.
+type slowQueryDetector struct {
+	db        *gosql.DB
+	threshold time.Duration
+
+	mu sync.Mutex
+	// the max TIMER_END of the statements checked
+	lastTimerEnd uint64
+}
+
+func newSlowQueryDetector(db *gosql.DB, threshold time.Duration) *slowQueryDetector {
+	return &slowQueryDetector{db: db, threshold: threshold}
+}
+
+// detect returns the slow queries finished since the last call.
+func (d *slowQueryDetector) detect() ([]slowQuery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	threshold := uint64(d.threshold.Nanoseconds()) * picosecondsPerNanosecond
+	rows, err := d.db.Query(slowQuerySQL, threshold, d.lastTimerEnd)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var queries []slowQuery
+	lastTimerEnd := d.lastTimerEnd
+	for rows.Next() {
+		var (
+			q                   slowQuery
+			digest, sql         gosql.NullString
+			timerWait, timerEnd uint64
+		)
+		if err := rows.Scan(&q.threadID, &digest, &sql, &timerWait, &timerEnd); err != nil {
+			return nil, errors.Trace(err)
+		}
+		q.digest, q.sql = digest.String, sql.String
+		q.latency = time.Duration(timerWait / picosecondsPerNanosecond)
+		queries = append(queries, q)
+		if timerEnd > lastTimerEnd {
+			lastTimerEnd = timerEnd
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	d.lastTimerEnd = lastTimerEnd
+	return queries, nil
+}
+
+// reportSlowQueries logs the slow queries found by the detector of e, the failure to query the performance
+// schema doesn't fail the DMLs.
+func (e *executor) reportSlowQueries() {
+	if e.slowQueries == nil {
+		return
+	}
+
+	queries, err := e.slowQueries.detect()
+	if err != nil {
+		log.Warn("failed to query the slow queries from performance schema", zap.Error(err))
+		return
+	}
+	for _, q := range queries {
+		log.Warn("slow query found in performance schema", zap.String("digest", q.digest),
+			zap.Duration("latency", q.latency), zap.Uint64("thread id", q.threadID), zap.String("sql", q.sql))
+	}
+	if e.slowQueryCounter != nil {
+		e.slowQueryCounter.Add(float64(len(queries)))
+	}
+}
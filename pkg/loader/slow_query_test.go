@@ -0,0 +1,103 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+type slowQuerySuite struct{}
+
+var _ = check.Suite(&slowQuerySuite{})
+
+var slowQueryColumns = []string{"THREAD_ID", "DIGEST", "SQL_TEXT", "TIMER_WAIT", "TIMER_END"}
+
+func (s *slowQuerySuite) TestDetect(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	d := newSlowQueryDetector(db, 100*time.Millisecond)
+	// 100ms is 1e11 picoseconds
+	mock.ExpectQuery(regexp.QuoteMeta(slowQuerySQL)).WithArgs(uint64(1e11), uint64(0)).
+		WillReturnRows(sqlmock.NewRows(slowQueryColumns).
+			AddRow(42, "d1", "REPLACE INTO `test`.`t`(`id`) VALUES (?)", uint64(2e11), uint64(5e12)).
+			AddRow(43, nil, nil, uint64(3e11), uint64(6e12)))
+	queries, err := d.detect()
+	c.Assert(err, check.IsNil)
+	c.Assert(queries, check.DeepEquals, []slowQuery{
+		{threadID: 42, digest: "d1", sql: "REPLACE INTO `test`.`t`(`id`) VALUES (?)", latency: 200 * time.Millisecond},
+		{threadID: 43, latency: 300 * time.Millisecond},
+	})
+
+	// only the statements finished later are checked
+	mock.ExpectQuery(regexp.QuoteMeta(slowQuerySQL)).WithArgs(uint64(1e11), uint64(6e12)).
+		WillReturnRows(sqlmock.NewRows(slowQueryColumns))
+	queries, err = d.detect()
+	c.Assert(err, check.IsNil)
+	c.Assert(queries, check.HasLen, 0)
+
+	mock.ExpectQuery(regexp.QuoteMeta(slowQuerySQL)).WillReturnError(errors.New("performance_schema is disabled"))
+	_, err = d.detect()
+	c.Assert(err, check.ErrorMatches, "performance_schema is disabled")
+	c.Assert(d.lastTimerEnd, check.Equals, uint64(6e12))
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *slowQuerySuite) TestReportAfterBatch(c *check.C) {
+	psDB, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer psDB.Close()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	e := newCaptureExecutor().withSlowQueryDetector(newSlowQueryDetector(psDB, time.Second)).
+		withSlowQueryCounter(counter)
+
+	mock.ExpectQuery(regexp.QuoteMeta(slowQuerySQL)).
+		WillReturnRows(sqlmock.NewRows(slowQueryColumns).
+			AddRow(1, "d1", "DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1", uint64(2e12), uint64(1e13)).
+			AddRow(2, "d2", "REPLACE INTO `test`.`users`(`id`,`name`) VALUES (?,?)", uint64(3e12), uint64(2e13)))
+	dmls := []*DML{newCaptureTestDML(InsertDMLType, 1), newCaptureTestDML(DeleteDMLType, 2)}
+	c.Assert(e.execTableBatchRetry(context.Background(), dmls, 1, time.Millisecond), check.IsNil)
+
+	// the failure of the performance schema doesn't fail the DMLs
+	mock.ExpectQuery(regexp.QuoteMeta(slowQuerySQL)).WillReturnError(errors.New("access denied"))
+	c.Assert(e.singleExecRetry(context.Background(), dmls, true, 1, time.Millisecond), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(counter.Write(&metric), check.IsNil)
+	c.Assert(metric.GetCounter().GetValue(), check.Equals, 2.0)
+}
+
+func (s *slowQuerySuite) TestLoaderOption(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	l, err := NewLoader(db, WithPerformanceSchema(db, time.Second))
+	c.Assert(err, check.IsNil)
+	ld := l.(*loaderImpl)
+	// all the executors share the detector
+	c.Assert(ld.getExecutor().slowQueries, check.NotNil)
+	c.Assert(ld.getExecutor().slowQueries, check.Equals, ld.getExecutor().slowQueries)
+}
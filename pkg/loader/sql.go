@@ -0,0 +1,149 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// GenSQL returns the query with the placeholders `?` replaced by the quoted args, it's used to
+// log the executed SQL. The query is returned as is if interpolate is false.
+// The strings are quoted with the backslash escapes, the []byte are written as hex literals
+// and the time.Time are formatted in loc, UTC is used if loc is nil.
+// Note the `?` in the string literals or comments of query is also taken as a placeholder.
+func GenSQL(query string, args []interface{}, interpolate bool, loc *time.Location) (string, error) {
+	if !interpolate {
+		return query, nil
+	}
+	if strings.Count(query, "?") != len(args) {
+		return "", errors.Errorf("the count of placeholders in %s doesn't match the count of args %d", query, len(args))
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	builder := new(strings.Builder)
+	builder.Grow(len(query))
+	argIdx := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			builder.WriteByte(query[i])
+			continue
+		}
+
+		if err := writeSQLValue(builder, args[argIdx], loc); err != nil {
+			return "", errors.Annotatef(err, "arg %d of %s", argIdx, query)
+		}
+		argIdx++
+	}
+
+	return builder.String(), nil
+}
+
+func writeSQLValue(builder *strings.Builder, arg interface{}, loc *time.Location) error {
+	switch v := arg.(type) {
+	case nil:
+		builder.WriteString("NULL")
+	case int:
+		builder.WriteString(strconv.FormatInt(int64(v), 10))
+	case int8:
+		builder.WriteString(strconv.FormatInt(int64(v), 10))
+	case int16:
+		builder.WriteString(strconv.FormatInt(int64(v), 10))
+	case int32:
+		builder.WriteString(strconv.FormatInt(int64(v), 10))
+	case int64:
+		builder.WriteString(strconv.FormatInt(v, 10))
+	case uint:
+		builder.WriteString(strconv.FormatUint(uint64(v), 10))
+	case uint8:
+		builder.WriteString(strconv.FormatUint(uint64(v), 10))
+	case uint16:
+		builder.WriteString(strconv.FormatUint(uint64(v), 10))
+	case uint32:
+		builder.WriteString(strconv.FormatUint(uint64(v), 10))
+	case uint64:
+		builder.WriteString(strconv.FormatUint(v, 10))
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return errors.Errorf("invalid float value %v", v)
+		}
+		builder.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.Errorf("invalid float value %v", v)
+		}
+		builder.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		if v {
+			builder.WriteString("1")
+		} else {
+			builder.WriteString("0")
+		}
+	case string:
+		writeQuotedString(builder, v)
+	case []byte:
+		if v == nil {
+			builder.WriteString("NULL")
+		} else {
+			builder.WriteString("X'")
+			builder.WriteString(hex.EncodeToString(v))
+			builder.WriteByte('\'')
+		}
+	case time.Time:
+		if v.IsZero() {
+			builder.WriteString("'0000-00-00 00:00:00'")
+		} else {
+			builder.WriteByte('\'')
+			builder.WriteString(v.In(loc).Format("2006-01-02 15:04:05.999999"))
+			builder.WriteByte('\'')
+		}
+	default:
+		return errors.Errorf("unsupported type %T", arg)
+	}
+
+	return nil
+}
+
+// writeQuotedString writes s as a string literal with the same escapes as the mysql driver.
+func writeQuotedString(builder *strings.Builder, s string) {
+	builder.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0:
+			builder.WriteString(`\0`)
+		case '\n':
+			builder.WriteString(`\n`)
+		case '\r':
+			builder.WriteString(`\r`)
+		case '\x1a':
+			builder.WriteString(`\Z`)
+		case '\'':
+			builder.WriteString(`\'`)
+		case '"':
+			builder.WriteString(`\"`)
+		case '\\':
+			builder.WriteString(`\\`)
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	builder.WriteByte('\'')
+}
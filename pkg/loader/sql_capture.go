@@ -0,0 +1,51 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import "sync"
+
+// sqlCapture records the statements of the executor instead of executing them.
+type sqlCapture struct {
+	mu   sync.Mutex
+	sqls []string
+}
+
+func (c *sqlCapture) add(sql string) {
+	c.mu.Lock()
+	c.sqls = append(c.sqls, sql)
+	c.mu.Unlock()
+}
+
+func (c *sqlCapture) captured() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sqls := make([]string, len(c.sqls))
+	copy(sqls, c.sqls)
+	return sqls
+}
+
+// EnableCapture makes the executor record the statements in order instead of executing them,
+// so the SQL of DMLs and DDLs can be checked without a database. The txns are always committed.
+func (e *executor) EnableCapture() {
+	e.capture = &sqlCapture{}
+}
+
+// CapturedSQL returns the statements recorded since EnableCapture, it's nil if capture is not enabled.
+func (e *executor) CapturedSQL() []string {
+	if e.capture == nil {
+		return nil
+	}
+	return e.capture.captured()
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+type sqlCaptureSuite struct{}
+
+var _ = check.Suite(&sqlCaptureSuite{})
+
+func newCaptureExecutor() *executor {
+	// no database is needed in capture mode
+	e := newExecutor(nil)
+	e.EnableCapture()
+	return e
+}
+
+func newCaptureTestDML(tp DMLType, id int) *DML {
+	info := &tableInfo{columns: []string{"id", "name"}, uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}}}
+	info.primaryKey = &info.uniqueKeys[0]
+	dml := &DML{Database: "test", Table: "users", Tp: tp, info: info,
+		Values: map[string]interface{}{"id": id, "name": "a"}}
+	if tp == UpdateDMLType {
+		dml.OldValues = map[string]interface{}{"id": id, "name": "b"}
+	}
+	return dml
+}
+
+func (s *sqlCaptureSuite) TestDisabled(c *check.C) {
+	e := newExecutor(nil)
+	c.Assert(e.CapturedSQL(), check.IsNil)
+}
+
+func (s *sqlCaptureSuite) TestBulkReplace(c *check.C) {
+	e := newCaptureExecutor().withAutoCreateDatabase(new(sync.Map))
+
+	c.Assert(e.bulkReplace([]*DML{newCaptureTestDML(InsertDMLType, 1)}), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{
+		"CREATE DATABASE IF NOT EXISTS `test`",
+		"REPLACE INTO `test`.`users`(`id`,`name`) VALUES (?,?)",
+	})
+}
+
+func (s *sqlCaptureSuite) TestBulkDelete(c *check.C) {
+	deletes := []*DML{newCaptureTestDML(DeleteDMLType, 1), newCaptureTestDML(DeleteDMLType, 2)}
+
+	e := newCaptureExecutor()
+	c.Assert(e.bulkDelete(deletes), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{
+		"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1",
+		"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1",
+	})
+
+	e = newCaptureExecutor().withBulkDeleteUsingIN(true)
+	c.Assert(e.bulkDelete(deletes), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{"DELETE FROM `test`.`users` WHERE `id` IN (?,?)"})
+
+	e = newCaptureExecutor().withMultiStatement(true)
+	c.Assert(e.bulkDelete(deletes), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{
+		"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1;DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1;",
+	})
+}
+
+func (s *sqlCaptureSuite) TestSingleExec(c *check.C) {
+	dmls := []*DML{
+		newCaptureTestDML(InsertDMLType, 1),
+		newCaptureTestDML(UpdateDMLType, 2),
+		newCaptureTestDML(DeleteDMLType, 3),
+	}
+
+	e := newCaptureExecutor()
+	c.Assert(e.singleExec(dmls, false), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{
+		"INSERT INTO `test`.`users`(`id`,`name`) VALUES(?,?)",
+		"UPDATE `test`.`users` SET `id` = ?,`name` = ? WHERE `id` = ? LIMIT 1",
+		"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1",
+	})
+
+	e = newCaptureExecutor()
+	c.Assert(e.singleExec(dmls, true), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{
+		"REPLACE INTO `test`.`users`(`id`,`name`) VALUES(?,?)",
+		"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1",
+		"REPLACE INTO `test`.`users`(`id`,`name`) VALUES(?,?)",
+		"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1",
+	})
+}
+
+func (s *sqlCaptureSuite) TestExecTableBatch(c *check.C) {
+	e := newCaptureExecutor()
+	dmls := []*DML{newCaptureTestDML(InsertDMLType, 1), newCaptureTestDML(DeleteDMLType, 2)}
+
+	c.Assert(e.execTableBatchRetry(context.Background(), dmls, 1, time.Millisecond), check.IsNil)
+	// the deletes are executed before the inserts
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{
+		"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1",
+		"REPLACE INTO `test`.`users`(`id`,`name`) VALUES (?,?)",
+	})
+}
+
+func (s *sqlCaptureSuite) TestExecDDL(c *check.C) {
+	e := newCaptureExecutor()
+	ddls := []*DDL{
+		{Database: "test", SQL: "CREATE DATABASE test"},
+		{Database: "test", Table: "users", SQL: "CREATE TABLE users(id INT PRIMARY KEY)"},
+		{Database: "test", Table: "skipped", SQL: "DROP TABLE skipped", ShouldSkip: true},
+	}
+
+	c.Assert(e.execParallelDDL(context.Background(), ddls), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{
+		"CREATE DATABASE test",
+		"use `test`;",
+		"CREATE TABLE users(id INT PRIMARY KEY)",
+	})
+}
@@ -0,0 +1,224 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sort"
+	"strings"
+)
+
+// the keywords lowercased by NormalizeSQL, the other unquoted words are kept as they are
+var sqlKeywords = map[string]struct{}{
+	"add": {}, "alter": {}, "and": {}, "as": {}, "asc": {}, "begin": {}, "between": {}, "by": {},
+	"column": {}, "commit": {}, "count": {}, "create": {}, "database": {}, "default": {}, "delete": {},
+	"desc": {}, "distinct": {}, "drop": {}, "exists": {}, "from": {}, "group": {}, "having": {}, "if": {},
+	"in": {}, "index": {}, "insert": {}, "into": {}, "is": {}, "join": {}, "key": {}, "like": {}, "limit": {},
+	"not": {}, "null": {}, "on": {}, "or": {}, "order": {}, "primary": {}, "replace": {}, "rollback": {},
+	"select": {}, "set": {}, "table": {}, "unique": {}, "update": {}, "use": {}, "values": {}, "where": {},
+}
+
+// NormalizeSQL normalizes sql for comparison: the comments are stripped, the whitespaces between the
+// tokens are reduced to one space or none around `(`, `)`, `,`, `.` and `;`, the keywords are lowercased,
+// and the items of `IN (...)` lists are sorted. The quoted strings and identifiers are kept as they are.
+func NormalizeSQL(sql string) string {
+	tokens := tokenizeSQL(sql)
+	for i, token := range tokens {
+		if _, ok := sqlKeywords[strings.ToLower(token)]; ok {
+			tokens[i] = strings.ToLower(token)
+		}
+	}
+	return joinSQLTokens(sortInLists(tokens))
+}
+
+func isSQLWordChar(ch byte) bool {
+	return ch == '_' || ch == '$' || ch == '@' || ch >= '0' && ch <= '9' ||
+		ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= 0x80
+}
+
+func isSQLCompareChar(ch byte) bool {
+	return ch == '<' || ch == '>' || ch == '=' || ch == '!'
+}
+
+// tokenizeSQL splits sql into the words, quoted strings, comparison operators and the other single
+// characters, the whitespaces and comments are dropped.
+func tokenizeSQL(sql string) []string {
+	scanned := scanSQLTokens(sql)
+	tokens := make([]string, 0, len(scanned))
+	for _, token := range scanned {
+		tokens = append(tokens, token.text)
+	}
+	return tokens
+}
+
+// sqlToken is a token returned by scanSQLTokens, sql[start:end] is its text.
+type sqlToken struct {
+	start, end int
+	text       string
+}
+
+// isIdent returns whether the token is the identifier name, quoted by backticks or not.
+func (t sqlToken) isIdent(name string) bool {
+	if strings.HasPrefix(t.text, "`") {
+		quoted := strings.TrimSuffix(t.text[1:], "`")
+		return strings.EqualFold(strings.Replace(quoted, "``", "`", -1), name)
+	}
+	return t.isWord(name)
+}
+
+// isWord returns whether the token is the unquoted word, case-insensitively.
+func (t sqlToken) isWord(word string) bool {
+	return len(t.text) > 0 && isSQLWordChar(t.text[0]) && strings.EqualFold(t.text, word)
+}
+
+// scanSQLTokens is like tokenizeSQL but returns the positions of tokens too, it's used to rewrite
+// parts of sql while keeping the rest of the text, including the comments, as is.
+func scanSQLTokens(sql string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+		start := i
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+			continue
+		case ch == '#' || strings.HasPrefix(sql[i:], "-- ") || sql[i:] == "--" || strings.HasPrefix(sql[i:], "--\n"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+			continue
+		case strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(sql)
+			}
+			continue
+		case ch == '\'' || ch == '"' || ch == '`':
+			i = quotedEnd(sql, i)
+		case isSQLWordChar(ch):
+			for i < len(sql) && isSQLWordChar(sql[i]) {
+				i++
+			}
+		case isSQLCompareChar(ch):
+			for i < len(sql) && isSQLCompareChar(sql[i]) {
+				i++
+			}
+		default:
+			i++
+		}
+		tokens = append(tokens, sqlToken{start: start, end: i, text: sql[start:i]})
+	}
+	return tokens
+}
+
+// quotedEnd returns the end of the quoted string starting at sql[start], the quote is escaped by doubling it
+// or a backslash except in the identifiers.
+func quotedEnd(sql string, start int) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\\' && quote != '`':
+			i++
+		case sql[i] == quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+func joinSQLTokens(tokens []string) string {
+	var builder strings.Builder
+	for i, token := range tokens {
+		if i > 0 && !sqlNoSpaceBefore(token) && !sqlNoSpaceAfter(tokens[i-1]) {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(token)
+	}
+	return builder.String()
+}
+
+func sqlNoSpaceBefore(token string) bool {
+	return token == "(" || token == ")" || token == "," || token == "." || token == ";"
+}
+
+func sqlNoSpaceAfter(token string) bool {
+	return token == "(" || token == "," || token == "."
+}
+
+// sortInLists sorts the items of the `in (...)` lists, the subqueries are not sorted.
+func sortInLists(tokens []string) []string {
+	result := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		result = append(result, tokens[i])
+		if tokens[i] != "in" || i+1 >= len(tokens) || tokens[i+1] != "(" {
+			continue
+		}
+		end := closingParen(tokens, i+1)
+		if end < 0 || (i+2 < len(tokens) && tokens[i+2] == "select") {
+			continue
+		}
+
+		var items []string
+		itemStart, depth := i+2, 0
+		for j := i + 2; j < end; j++ {
+			switch tokens[j] {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			case ",":
+				if depth == 0 {
+					items = append(items, joinSQLTokens(sortInLists(tokens[itemStart:j])))
+					itemStart = j + 1
+				}
+			}
+		}
+		items = append(items, joinSQLTokens(sortInLists(tokens[itemStart:end])))
+		sort.Strings(items)
+
+		result = append(result, "(")
+		for j, item := range items {
+			if j > 0 {
+				result = append(result, ",")
+			}
+			result = append(result, item)
+		}
+		result = append(result, ")")
+		i = end
+	}
+	return result
+}
+
+// closingParen returns the index of the `)` matching tokens[open], or -1 if it's not closed.
+func closingParen(tokens []string, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
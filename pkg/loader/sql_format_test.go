@@ -0,0 +1,113 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/check"
+)
+
+// sqlEquals checks whether the obtained SQL equals the expected one after normalized by NormalizeSQL,
+// both of them can be a string or a []string.
+var sqlEquals check.Checker = &sqlEqualsChecker{
+	&check.CheckerInfo{Name: "sqlEquals", Params: []string{"obtained", "expected"}},
+}
+
+type sqlEqualsChecker struct {
+	*check.CheckerInfo
+}
+
+func (checker *sqlEqualsChecker) Check(params []interface{}, names []string) (result bool, error string) {
+	normalize := func(v interface{}) ([]string, bool) {
+		switch sqls := v.(type) {
+		case string:
+			return []string{NormalizeSQL(sqls)}, true
+		case []string:
+			normalized := make([]string, len(sqls))
+			for i, sql := range sqls {
+				normalized[i] = NormalizeSQL(sql)
+			}
+			return normalized, true
+		default:
+			return nil, false
+		}
+	}
+	obtained, ok := normalize(params[0])
+	if !ok {
+		return false, "obtained value must be a string or []string"
+	}
+	expected, ok := normalize(params[1])
+	if !ok {
+		return false, "expected value must be a string or []string"
+	}
+	return check.DeepEquals.Check([]interface{}{obtained, expected}, names)
+}
+
+type sqlFormatSuite struct{}
+
+var _ = check.Suite(&sqlFormatSuite{})
+
+func (s *sqlFormatSuite) TestNormalizeSQL(c *check.C) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT  *\n\tFROM `db`.`t`  WHERE `id` = ?", "select * from `db`.`t` where `id` = ?"},
+		{"REPLACE INTO `db`.`t`(`a`, `b`) VALUES (?, ?),(?,?)", "replace into `db`.`t`(`a`,`b`) values(?,?),(?,?)"},
+		{"UPDATE t SET a=?,b = ? WHERE c>=? LIMIT 1;", "update t set a = ?,b = ? where c >= ? limit 1;"},
+		// the unquoted words other than keywords are kept
+		{"DELETE FROM Orders WHERE OrderID = 1", "delete from Orders where OrderID = 1"},
+		// IN lists are sorted, and the tuples in them too
+		{"DELETE FROM t WHERE id IN (3, 1, 2)", "delete from t where id in(1,2,3)"},
+		{"DELETE FROM t WHERE (a,b) IN ((2,1),(1, 2))", "delete from t where(a,b) in((1,2),(2,1))"},
+		{"SELECT * FROM t WHERE a IN (SELECT b FROM u WHERE c IN (2, 1))", "select * from t where a in(select b from u where c in(1,2))"},
+		// comments are stripped
+		{"SELECT 1 -- the first one\n, 2 # the second one\n/* the last one */, 3", "select 1,2,3"},
+		{"SELECT 1 /* not closed", "select 1"},
+	}
+	for _, t := range tests {
+		c.Assert(NormalizeSQL(t.sql), check.Equals, t.expected, check.Commentf("sql: %s", t.sql))
+	}
+}
+
+func (s *sqlFormatSuite) TestQuotedStrings(c *check.C) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		// the quoted strings are kept as they are
+		{"SELECT 'A  B', \"SELECT\", `Order  By`", "select 'A  B',\"SELECT\",`Order  By`"},
+		// escaped quotes
+		{`SELECT 'it''s', 'it\'s', "say ""hi""", 'a\\'`, `select 'it''s','it\'s',"say ""hi""",'a\\'`},
+		{"SELECT `a``b`  FROM t", "select `a``b` from t"},
+		// the comments in strings are not stripped
+		{"SELECT '-- not a comment', '/* nor this */', '#'", "select '-- not a comment','/* nor this */','#'"},
+		// the strings in IN lists are sorted by the quoted text
+		{"SELECT * FROM t WHERE a IN ('b,c', 'a')", "select * from t where a in('a','b,c')"},
+		{"SELECT 'not closed", "select 'not closed"},
+	}
+	for _, t := range tests {
+		c.Assert(NormalizeSQL(t.sql), check.Equals, t.expected, check.Commentf("sql: %s", t.sql))
+	}
+}
+
+func (s *sqlFormatSuite) TestSQLEqualsChecker(c *check.C) {
+	c.Assert("SELECT 1", sqlEquals, "select  1")
+	c.Assert([]string{"USE `db`", "DROP TABLE t"}, sqlEquals, []string{"use `db`", "drop table t"})
+	c.Assert("SELECT 1", check.Not(sqlEquals), "SELECT 2")
+	c.Assert([]string{"SELECT 1"}, check.Not(sqlEquals), []string{"SELECT 1", "SELECT 2"})
+
+	result, errStr := sqlEquals.Check([]interface{}{1, "SELECT 1"}, []string{"obtained", "expected"})
+	c.Assert(result, check.IsFalse)
+	c.Assert(errStr, check.Matches, "obtained value must be .*")
+}
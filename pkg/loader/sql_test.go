@@ -0,0 +1,146 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/tidb/types"
+)
+
+type genSQLSuite struct{}
+
+var _ = check.Suite(&genSQLSuite{})
+
+func (s *genSQLSuite) TestGenSQL(c *check.C) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 600000000, time.UTC)
+
+	tests := []struct {
+		arg      interface{}
+		expected string
+	}{
+		{nil, "NULL"},
+		{int64(-1), "-1"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{float32(0.1), "0.1"},
+		{1.5e20, "1.5e+20"},
+		{true, "1"},
+		{"it's a \"test\"\\\n", `'it\'s a \"test\"\\\n'`},
+		{[]byte{0, 0xff, '\''}, "X'00ff27'"},
+		{[]byte(nil), "NULL"},
+		{ts, "'2020-01-02 11:04:05.6'"},
+		{time.Time{}, "'0000-00-00 00:00:00'"},
+	}
+	for _, t := range tests {
+		sql, err := GenSQL("SELECT ?", []interface{}{t.arg}, true, loc)
+		c.Assert(err, check.IsNil)
+		c.Assert(sql, sqlEquals, "SELECT "+t.expected, check.Commentf("arg: %#v", t.arg))
+	}
+
+	sql, err := GenSQL("SELECT ?", []interface{}{ts}, true, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sql, sqlEquals, "SELECT '2020-01-02 03:04:05.6'")
+}
+
+func (s *genSQLSuite) TestNotInterpolate(c *check.C) {
+	sql, err := GenSQL("SELECT ?", []interface{}{1}, false, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sql, sqlEquals, "SELECT ?")
+}
+
+func (s *genSQLSuite) TestInvalidArgs(c *check.C) {
+	_, err := GenSQL("SELECT ?, ?", []interface{}{1}, true, nil)
+	c.Assert(err, check.ErrorMatches, ".*doesn't match the count of args 1.*")
+
+	_, err = GenSQL("SELECT ?", []interface{}{struct{}{}}, true, nil)
+	c.Assert(err, check.ErrorMatches, ".*unsupported type struct.*")
+
+	_, err = GenSQL("SELECT ?", []interface{}{math.NaN()}, true, nil)
+	c.Assert(err, check.ErrorMatches, ".*invalid float value NaN.*")
+}
+
+// TestFuzz checks the SQL generated with random args is always parseable,
+// and the strings, binaries and integers are parsed as the args.
+func (s *genSQLSuite) TestFuzz(c *check.C) {
+	seed := time.Now().UnixNano()
+	c.Logf("seed: %d", seed)
+	r := rand.New(rand.NewSource(seed))
+	p := parser.New()
+
+	for i := 0; i < 1000; i++ {
+		args := make([]interface{}, 1+r.Intn(5))
+		for j := range args {
+			args[j] = randSQLArg(r)
+		}
+
+		query := "INSERT INTO t VALUES (" + holderString(len(args)) + ")"
+		sql, err := GenSQL(query, args, true, time.UTC)
+		c.Assert(err, check.IsNil)
+
+		stmt, err := p.ParseOneStmt(sql, "", "")
+		c.Assert(err, check.IsNil, check.Commentf("sql: %s", sql))
+		values := stmt.(*ast.InsertStmt).Lists[0]
+		c.Assert(values, check.HasLen, len(args))
+
+		for j, arg := range args {
+			var got interface{}
+			if v, ok := values[j].(ast.ValueExpr); ok {
+				got = v.GetValue()
+			}
+			comment := check.Commentf("sql: %s, arg: %#v", sql, arg)
+			switch v := arg.(type) {
+			case string:
+				c.Assert(got, check.Equals, v, comment)
+			case []byte:
+				c.Assert([]byte(got.(types.BinaryLiteral)), check.DeepEquals, v, comment)
+			case int64:
+				if v >= 0 {
+					c.Assert(got, check.Equals, v, comment)
+				}
+			}
+		}
+	}
+}
+
+var fuzzRunes = []rune("\x00\n\r\x1a'\"\\?%_` azAZ09中文\U0001F600")
+
+func randSQLArg(r *rand.Rand) interface{} {
+	switch r.Intn(6) {
+	case 0:
+		return nil
+	case 1:
+		return r.Int63() - r.Int63()
+	case 2:
+		return r.NormFloat64() * math.Pow(10, float64(r.Intn(40)-20))
+	case 3:
+		b := make([]byte, r.Intn(16))
+		r.Read(b)
+		return b
+	case 4:
+		return time.Unix(r.Int63n(1<<32), r.Int63n(int64(time.Second)))
+	default:
+		var builder strings.Builder
+		for n := r.Intn(32); n > 0; n-- {
+			builder.WriteRune(fuzzRunes[r.Intn(len(fuzzRunes))])
+		}
+		return builder.String()
+	}
+}
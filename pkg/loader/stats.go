@@ -0,0 +1,88 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync/atomic"
+)
+
+// LoaderStats is a snapshot of the statistics of Loader, it can be used to monitor
+// the loader without prometheus.
+type LoaderStats struct {
+	// InputQueueDepth is the count of txns received from Input() but not executed yet.
+	InputQueueDepth int
+	// SuccessQueueDepth is the count of txns waiting to be received from Successes().
+	SuccessQueueDepth int
+	// WorkersActive is the count of workers executing DMLs.
+	WorkersActive int64
+	// TotalTxnsProcessed and TotalDMLsProcessed are the count of txns and DMLs executed successfully.
+	TotalTxnsProcessed int64
+	TotalDMLsProcessed int64
+	// TotalErrors is the count of DML batches and DDLs failed to execute after retrying.
+	TotalErrors int64
+	// LastCommittedTS is the commit ts of the last txn executed successfully, 0 if it's unknown.
+	LastCommittedTS int64
+	// CacheHits and CacheMisses are the count of txns made of INSERT DMLs skipped or not by the loader
+	// returned by NewCachingLoader, they're 0 for the other loaders.
+	CacheHits   int64
+	CacheMisses int64
+}
+
+// loaderStats holds the counters of LoaderStats, all fields are accessed atomically.
+type loaderStats struct {
+	// the *txnManager of the running loader
+	txnManager      atomic.Value
+	workersActive   int64
+	txns            int64
+	dmls            int64
+	errors          int64
+	lastCommittedTS int64
+}
+
+func (s *loaderStats) workerStarted() {
+	atomic.AddInt64(&s.workersActive, 1)
+}
+
+func (s *loaderStats) workerStopped() {
+	atomic.AddInt64(&s.workersActive, -1)
+}
+
+func (s *loaderStats) addError() {
+	atomic.AddInt64(&s.errors, 1)
+}
+
+func (s *loaderStats) addSuccess(txn *Txn) {
+	atomic.AddInt64(&s.txns, 1)
+	atomic.AddInt64(&s.dmls, int64(len(txn.DMLs)))
+	if txn.CommitTS > 0 {
+		atomic.StoreInt64(&s.lastCommittedTS, txn.CommitTS)
+	}
+}
+
+// Stats returns the statistics of the loader, it's safe to be called concurrently.
+func (s *loaderImpl) Stats() LoaderStats {
+	stats := LoaderStats{
+		SuccessQueueDepth:  len(s.successTxn),
+		WorkersActive:      atomic.LoadInt64(&s.stats.workersActive),
+		TotalTxnsProcessed: atomic.LoadInt64(&s.stats.txns),
+		TotalDMLsProcessed: atomic.LoadInt64(&s.stats.dmls),
+		TotalErrors:        atomic.LoadInt64(&s.stats.errors),
+		LastCommittedTS:    atomic.LoadInt64(&s.stats.lastCommittedTS),
+	}
+	if manager, ok := s.stats.txnManager.Load().(*txnManager); ok {
+		stats.InputQueueDepth = manager.cachedTxnCount()
+	}
+
+	return stats
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+)
+
+// StripAutoIncrementOption removes the `AUTO_INCREMENT [=] N` table options from the CREATE TABLE and
+// ALTER TABLE statements, the sql is returned as is if there is no such option. The options are found
+// by the parser, and only their text, with the separating comma, is removed, so the string literals and
+// comments are kept.
+func StripAutoIncrementOption(sql string) (string, error) {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return "", errors.Annotatef(err, "parse ddl %s", sql)
+	}
+
+	var options []*ast.TableOption
+	switch s := stmt.(type) {
+	case *ast.CreateTableStmt:
+		options = s.Options
+	case *ast.AlterTableStmt:
+		for _, spec := range s.Specs {
+			if spec.Tp == ast.AlterTableOption {
+				options = append(options, spec.Options...)
+			}
+		}
+	default:
+		return sql, nil
+	}
+
+	count := 0
+	for _, option := range options {
+		if option.Tp == ast.TableOptionAutoIncrement {
+			count++
+		}
+	}
+	if count == 0 {
+		return sql, nil
+	}
+
+	tokens := scanSQLTokens(sql)
+	var found [][2]int
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		// the AUTO_INCREMENT column attributes are never followed by a number
+		if depth != 0 || !tokens[i].isWord("AUTO_INCREMENT") {
+			continue
+		}
+		end := i + 1
+		if end < len(tokens) && tokens[end].text == "=" {
+			end++
+		}
+		if end < len(tokens) && isDigits(tokens[end].text) {
+			found = append(found, [2]int{i, end})
+			i = end
+		}
+	}
+	// the options in the comments for MySQL like `/*!40101 AUTO_INCREMENT=5 */` are parsed but not scanned
+	if len(found) != count {
+		return "", errors.Errorf("can't locate the AUTO_INCREMENT table options in ddl %s", sql)
+	}
+
+	// remove the options from the last one so the positions of the previous ones don't change
+	for j := len(found) - 1; j >= 0; j-- {
+		first, last := found[j][0], found[j][1]
+		start, end := tokens[first].start, tokens[last].end
+		switch {
+		case first > 0 && tokens[first-1].text == ",":
+			start = trimSpaceBefore(sql, tokens[first-1].start)
+		case last+1 < len(tokens) && tokens[last+1].text == ",":
+			end = skipSpaceAfter(sql, tokens[last+1].end)
+		case skipSpaceAfter(sql, end) < len(sql):
+			end = skipSpaceAfter(sql, end)
+		default:
+			start = trimSpaceBefore(sql, start)
+		}
+		sql = sql[:start] + sql[end:]
+	}
+	return sql, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+func isSQLSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+// trimSpaceBefore returns the start of the whitespaces ending at sql[end].
+func trimSpaceBefore(sql string, end int) int {
+	for end > 0 && isSQLSpace(sql[end-1]) {
+		end--
+	}
+	return end
+}
+
+// skipSpaceAfter returns the end of the whitespaces starting at sql[start].
+func skipSpaceAfter(sql string, start int) int {
+	for start < len(sql) && isSQLSpace(sql[start]) {
+		start++
+	}
+	return start
+}
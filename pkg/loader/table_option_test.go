@@ -0,0 +1,67 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/check"
+)
+
+type tableOptionSuite struct{}
+
+var _ = check.Suite(&tableOptionSuite{})
+
+func (s *tableOptionSuite) TestStripAutoIncrementOption(c *check.C) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB AUTO_INCREMENT=100 DEFAULT CHARSET=utf8",
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB DEFAULT CHARSET=utf8",
+		},
+		{
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB, auto_increment = 100",
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB",
+		},
+		{
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) AUTO_INCREMENT 100, ENGINE=InnoDB",
+			"CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY) ENGINE=InnoDB",
+		},
+		{"ALTER TABLE t AUTO_INCREMENT=1", "ALTER TABLE t"},
+		{"ALTER TABLE t ADD COLUMN c INT, AUTO_INCREMENT=1", "ALTER TABLE t ADD COLUMN c INT"},
+		{"ALTER TABLE t ADD COLUMN c INT AUTO_INCREMENT", "ALTER TABLE t ADD COLUMN c INT AUTO_INCREMENT"},
+		// the string literals and comments are kept
+		{"ALTER TABLE t COMMENT 'AUTO_INCREMENT=5'", "ALTER TABLE t COMMENT 'AUTO_INCREMENT=5'"},
+		{
+			"CREATE TABLE t (id INT) AUTO_INCREMENT=5 COMMENT='AUTO_INCREMENT=5'",
+			"CREATE TABLE t (id INT) COMMENT='AUTO_INCREMENT=5'",
+		},
+		{
+			"CREATE TABLE t (id INT) /*T! SHARD_ROW_ID_BITS=4 */ AUTO_INCREMENT=5 -- AUTO_INCREMENT=5\n",
+			"CREATE TABLE t (id INT) /*T! SHARD_ROW_ID_BITS=4 */ -- AUTO_INCREMENT=5\n",
+		},
+		{"DROP TABLE t", "DROP TABLE t"},
+	}
+
+	for _, t := range tests {
+		sql, err := StripAutoIncrementOption(t.sql)
+		c.Assert(err, check.IsNil, check.Commentf("sql: %s", t.sql))
+		c.Assert(sql, check.Equals, t.expected, check.Commentf("sql: %s", t.sql))
+	}
+
+	_, err := StripAutoIncrementOption("CREATE TABLE t (id INT) /*!40101 AUTO_INCREMENT=5 */")
+	c.Assert(err, check.ErrorMatches, "can't locate the AUTO_INCREMENT table options.*")
+	_, err = StripAutoIncrementOption("CREATE TABLE t (")
+	c.Assert(err, check.ErrorMatches, "parse ddl.*")
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const tableRowsSQL = `
+SELECT table_rows FROM information_schema.tables
+WHERE table_schema = ? AND table_name = ?;`
+
+// the time to cache the estimated row count of a table
+var tableSizeCacheTTL = 5 * time.Minute
+
+// TableSizeEstimator estimates whether a table is small by the TABLE_ROWS of information_schema.tables,
+// the DMLs of small tables are executed one by one because batching them costs more than it saves.
+// The row count of a table is queried the first time it's needed, and cached for 5 minutes.
+type TableSizeEstimator struct {
+	db        *gosql.DB
+	threshold int64
+
+	mu sync.Mutex
+	// `schema`.`table` -> the cached row count
+	tables map[string]tableSize
+}
+
+type tableSize struct {
+	// -1 if it's unknown
+	rows   int64
+	expire time.Time
+}
+
+// NewTableSizeEstimator returns a TableSizeEstimator treating the tables with less than smallTableThreshold
+// rows in db as small tables.
+func NewTableSizeEstimator(db *gosql.DB, smallTableThreshold int64) *TableSizeEstimator {
+	return &TableSizeEstimator{
+		db:        db,
+		threshold: smallTableThreshold,
+		tables:    make(map[string]tableSize),
+	}
+}
+
+// IsSmallTable returns whether the table has less rows than the threshold, it's false if the row count
+// can't be estimated.
+func (t *TableSizeEstimator) IsSmallTable(schema string, table string) bool {
+	if t == nil {
+		return false
+	}
+
+	name := quoteSchema(schema, table)
+	now := time.Now()
+	t.mu.Lock()
+	size, ok := t.tables[name]
+	t.mu.Unlock()
+
+	if !ok || now.After(size.expire) {
+		rows, err := t.queryTableRows(schema, table)
+		if err != nil {
+			log.Warn("failed to estimate the table size", zap.String("table", name), zap.Error(err))
+			rows = -1
+		}
+		size = tableSize{rows: rows, expire: now.Add(tableSizeCacheTTL)}
+
+		t.mu.Lock()
+		t.tables[name] = size
+		t.mu.Unlock()
+	}
+
+	return size.rows >= 0 && size.rows < t.threshold
+}
+
+func (t *TableSizeEstimator) queryTableRows(schema string, table string) (int64, error) {
+	var rows gosql.NullInt64
+	err := t.db.QueryRow(tableRowsSQL, schema, table).Scan(&rows)
+	if err == gosql.ErrNoRows {
+		return 0, errors.Annotatef(ErrTableNotExist, "table %s", quoteSchema(schema, table))
+	}
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	// TABLE_ROWS is NULL for views
+	if !rows.Valid {
+		return -1, nil
+	}
+	return rows.Int64, nil
+}
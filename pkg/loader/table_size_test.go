@@ -0,0 +1,107 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type tableSizeSuite struct{}
+
+var _ = check.Suite(&tableSizeSuite{})
+
+func expectTableRows(mock sqlmock.Sqlmock, table string, rows interface{}) {
+	mock.ExpectQuery(regexp.QuoteMeta(tableRowsSQL)).WithArgs("test", table).
+		WillReturnRows(sqlmock.NewRows([]string{"table_rows"}).AddRow(rows))
+}
+
+func (s *tableSizeSuite) TestIsSmallTable(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	est := NewTableSizeEstimator(db, 100)
+	expectTableRows(mock, "config", 10)
+	expectTableRows(mock, "orders", 100000)
+	expectTableRows(mock, "view", nil)
+	mock.ExpectQuery(regexp.QuoteMeta(tableRowsSQL)).WithArgs("test", "broken").WillReturnError(errors.New("timeout"))
+	mock.ExpectQuery(regexp.QuoteMeta(tableRowsSQL)).WithArgs("test", "absent").
+		WillReturnRows(sqlmock.NewRows([]string{"table_rows"}))
+
+	c.Assert(est.IsSmallTable("test", "config"), check.IsTrue)
+	c.Assert(est.IsSmallTable("test", "orders"), check.IsFalse)
+	c.Assert(est.IsSmallTable("test", "view"), check.IsFalse)
+	c.Assert(est.IsSmallTable("test", "broken"), check.IsFalse)
+	c.Assert(est.IsSmallTable("test", "absent"), check.IsFalse)
+
+	// cached without querying again
+	c.Assert(est.IsSmallTable("test", "config"), check.IsTrue)
+	c.Assert(est.IsSmallTable("test", "broken"), check.IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// queried again after expiration
+	size := est.tables[quoteSchema("test", "config")]
+	size.expire = time.Now().Add(-time.Second)
+	est.tables[quoteSchema("test", "config")] = size
+	expectTableRows(mock, "config", 1000)
+	c.Assert(est.IsSmallTable("test", "config"), check.IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	var nilEst *TableSizeEstimator
+	c.Assert(nilEst.IsSmallTable("test", "config"), check.IsFalse)
+}
+
+func newTableSizeTestDMLs(table string) []*DML {
+	info := &tableInfo{columns: []string{"id", "name"}, uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}}}
+	info.primaryKey = &info.uniqueKeys[0]
+	return []*DML{
+		{Database: "test", Table: table, Tp: InsertDMLType, info: info, Values: map[string]interface{}{"id": 1, "name": "a"}},
+		{Database: "test", Table: table, Tp: InsertDMLType, info: info, Values: map[string]interface{}{"id": 2, "name": "b"}},
+	}
+}
+
+func (s *tableSizeSuite) TestSmallTableSkipsBatch(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	e := newExecutor(db).withTableSizeEstimator(NewTableSizeEstimator(db, 100))
+
+	// the DMLs of the small table are executed one by one
+	expectTableRows(mock, "config", 10)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`config`(`id`,`name`) VALUES(?,?)")).
+		WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`config`(`id`,`name`) VALUES(?,?)")).
+		WithArgs(2, "b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.execTableBatchRetry(context.Background(), newTableSizeTestDMLs("config"), 1, time.Millisecond), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the DMLs of the large table are batched, the order of the rows in a batch is not fixed
+	// so only one DML is used here
+	expectTableRows(mock, "orders", 100000)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`orders`(`id`,`name`) VALUES (?,?)")).
+		WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.execTableBatchRetry(context.Background(), newTableSizeTestDMLs("orders")[:1], 1, time.Millisecond), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
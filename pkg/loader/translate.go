@@ -21,6 +21,7 @@ import (
 // SecondaryBinlogToTxn translate the Binlog format into Txn
 func SecondaryBinlogToTxn(binlog *pb.Binlog) (*Txn, error) {
 	txn := new(Txn)
+	txn.CommitTS = binlog.GetCommitTs()
 	var err error
 	switch binlog.Type {
 	case pb.BinlogType_DDL:
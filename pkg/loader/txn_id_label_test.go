@@ -0,0 +1,108 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type txnIDLabelSuite struct{}
+
+var _ = check.Suite(&txnIDLabelSuite{})
+
+// txnIDLabels returns the count of observations of every txn_id of the queries of type tp in vec.
+func txnIDLabels(c *check.C, vec *prometheus.HistogramVec, tp string) map[string]uint64 {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(vec)
+	families, err := registry.Gather()
+	c.Assert(err, check.IsNil)
+
+	labels := make(map[string]uint64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			var id string
+			var isType bool
+			for _, pair := range metric.GetLabel() {
+				switch pair.GetName() {
+				case "txn_id":
+					id = pair.GetValue()
+				case "type":
+					isType = pair.GetValue() == tp
+				}
+			}
+			if isType {
+				labels[id] = metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return labels
+}
+
+func (s *txnIDLabelSuite) TestLabel(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	m := NewPipelineMetrics("binlog", "test")
+	e := newExecutor(db).withQueryHistogramVec(m.QueryHistogramVec).
+		withTxnQueryHistogramVec(m.TxnQueryHistogramVec).withTransactionIDLabel(true)
+	txn1 := []*DML{newCaptureTestDML(DeleteDMLType, 1), newCaptureTestDML(DeleteDMLType, 2)}
+	txn2 := []*DML{newCaptureTestDML(DeleteDMLType, 3)}
+	for _, dmls := range [][]*DML{txn1, txn2} {
+		mock.ExpectBegin()
+		for range dmls {
+			mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+		c.Assert(e.bulkDelete(dmls), check.IsNil)
+	}
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	id1, id2 := txnIDLabel(txn1), txnIDLabel(txn2)
+	c.Assert(id1, check.Matches, "[0-9a-f]{4}")
+	c.Assert(id1, check.Not(check.Equals), id2)
+	c.Assert(txnIDLabels(c, m.TxnQueryHistogramVec, "exec"), check.DeepEquals, map[string]uint64{id1: 2, id2: 1})
+	c.Assert(txnIDLabels(c, m.TxnQueryHistogramVec, "commit"), check.DeepEquals, map[string]uint64{id1: 1, id2: 1})
+	// the queries are still observed without the label
+	c.Assert(txnIDLabels(c, m.QueryHistogramVec, "exec"), check.DeepEquals, map[string]uint64{"": 3})
+}
+
+func (s *txnIDLabelSuite) TestDisabled(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	m := NewPipelineMetrics("binlog", "test")
+	e := newExecutor(db).withQueryHistogramVec(m.QueryHistogramVec).withTxnQueryHistogramVec(m.TxnQueryHistogramVec)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(e.bulkDelete([]*DML{newCaptureTestDML(DeleteDMLType, 1)}), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	c.Assert(txnIDLabels(c, m.TxnQueryHistogramVec, "exec"), check.HasLen, 0)
+}
+
+func (s *txnIDLabelSuite) TestTxnIDOfValues(c *check.C) {
+	// the same DMLs have the same id
+	c.Assert(txnIDLabel([]*DML{newCaptureTestDML(UpdateDMLType, 1)}), check.Equals,
+		txnIDLabel([]*DML{newCaptureTestDML(UpdateDMLType, 1)}))
+
+	// the values out of the primary key are taken into account
+	changed := newCaptureTestDML(UpdateDMLType, 1)
+	changed.Values["name"] = "c"
+	c.Assert(txnIDLabel([]*DML{changed}), check.Not(check.Equals), txnIDLabel([]*DML{newCaptureTestDML(UpdateDMLType, 1)}))
+}
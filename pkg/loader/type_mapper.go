@@ -0,0 +1,148 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/types"
+)
+
+// defaultColumnTypeMap maps the upstream TiDB type to the type accepted by the downstream for each dest db type.
+// The arguments and attributes of the upstream type are kept unless the downstream type has its own arguments.
+var defaultColumnTypeMap = map[string]map[string]string{
+	"mysql": {
+		"INT":       "INT",
+		"BIGINT":    "BIGINT",
+		"DECIMAL":   "DECIMAL",
+		"TEXT":      "TEXT",
+		"TINYBLOB":  "BLOB(255)",
+		"BLOB":      "BLOB",
+		"DATETIME":  "DATETIME",
+		"TIMESTAMP": "TIMESTAMP",
+		"ENUM":      "ENUM",
+		"SET":       "SET",
+		"JSON":      "JSON",
+	},
+}
+
+// MapColumnType returns the type of destDBType for the upstream TiDB type like `int(11) unsigned`,
+// the type is returned as is if there is no mapping for it.
+func MapColumnType(tidbType string, destDBType string) string {
+	tidbType = strings.TrimSpace(tidbType)
+	mapping, ok := defaultColumnTypeMap[destDBType]
+	if !ok {
+		return tidbType
+	}
+
+	end := strings.IndexAny(tidbType, "( ")
+	if end < 0 {
+		end = len(tidbType)
+	}
+	destType, ok := mapping[strings.ToUpper(tidbType[:end])]
+	if !ok {
+		return tidbType
+	}
+
+	suffix := tidbType[end:]
+	if strings.Contains(destType, "(") && strings.HasPrefix(suffix, "(") {
+		// use the arguments of the downstream type
+		if i := strings.Index(suffix, ")"); i >= 0 {
+			suffix = suffix[i+1:]
+		}
+	}
+
+	return destType + suffix
+}
+
+// MapDDLColumnTypes maps the column types in CREATE TABLE and ALTER TABLE statements by MapColumnType,
+// the sql is returned as is if no column type is changed. Only the type names of the mapped columns are
+// replaced, the rest of the sql text, including the comments for TiDB like `/*T![clustered_index] CLUSTERED */`,
+// is kept.
+func MapDDLColumnTypes(sql string, destDBType string) (string, error) {
+	if _, ok := defaultColumnTypeMap[destDBType]; !ok {
+		return sql, nil
+	}
+
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return "", errors.Annotatef(err, "parse ddl %s", sql)
+	}
+
+	var cols []*ast.ColumnDef
+	switch s := stmt.(type) {
+	case *ast.CreateTableStmt:
+		cols = s.Cols
+	case *ast.AlterTableStmt:
+		for _, spec := range s.Specs {
+			cols = append(cols, spec.NewColumns...)
+		}
+	default:
+		return sql, nil
+	}
+
+	tokens := scanSQLTokens(sql)
+	var b strings.Builder
+	// the end of the sql text written to b, and the next token to locate the column definitions from
+	written, next := 0, 0
+	for _, col := range cols {
+		tidbType := types.TypeToStr(col.Tp.Tp, col.Tp.Charset)
+		destType := MapColumnType(tidbType, destDBType)
+		if strings.EqualFold(destType, tidbType) {
+			continue
+		}
+
+		i := findColumnType(tokens, next, col.Name.Name.O, tidbType)
+		if i < 0 {
+			return "", errors.Errorf("can't locate the type of column %s in ddl %s", col.Name.Name.O, sql)
+		}
+		start, end := tokens[i].start, tokens[i].end
+		next = i + 1
+		if strings.Contains(destType, "(") && next < len(tokens) && tokens[next].text == "(" {
+			// use the arguments of the downstream type
+			for next < len(tokens) && tokens[next].text != ")" {
+				next++
+			}
+			if next == len(tokens) {
+				return "", errors.Errorf("unclosed arguments of column %s in ddl %s", col.Name.Name.O, sql)
+			}
+			end = tokens[next].end
+			next++
+		}
+
+		b.WriteString(sql[written:start])
+		b.WriteString(destType)
+		written = end
+	}
+	if written == 0 {
+		return sql, nil
+	}
+
+	b.WriteString(sql[written:])
+	return b.String(), nil
+}
+
+// findColumnType returns the index of the type name tp following the column name in tokens[from:],
+// or -1 if it's not found.
+func findColumnType(tokens []sqlToken, from int, column string, tp string) int {
+	for i := from; i+1 < len(tokens); i++ {
+		if tokens[i].isIdent(column) && tokens[i+1].isWord(tp) {
+			return i + 1
+		}
+	}
+	return -1
+}
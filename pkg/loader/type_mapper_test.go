@@ -0,0 +1,116 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/check"
+)
+
+type typeMapperSuite struct{}
+
+var _ = check.Suite(&typeMapperSuite{})
+
+func (s *typeMapperSuite) TestMapColumnType(c *check.C) {
+	tests := []struct {
+		tidbType string
+		expected string
+	}{
+		{"int(11)", "INT(11)"},
+		{"int(10) unsigned", "INT(10) unsigned"},
+		{"bigint(20)", "BIGINT(20)"},
+		{"decimal(10,2)", "DECIMAL(10,2)"},
+		{"text", "TEXT"},
+		{"tinyblob", "BLOB(255)"},
+		{"blob", "BLOB"},
+		{"datetime(3)", "DATETIME(3)"},
+		{"timestamp", "TIMESTAMP"},
+		{"enum('a','b')", "ENUM('a','b')"},
+		{"set('a','b')", "SET('a','b')"},
+		{"json", "JSON"},
+		// unknown types are returned as is
+		{"varchar(24)", "varchar(24)"},
+		{" geometry ", "geometry"},
+	}
+	for _, t := range tests {
+		c.Assert(MapColumnType(t.tidbType, "mysql"), check.Equals, t.expected, check.Commentf("type %s", t.tidbType))
+	}
+
+	// no mapping for tidb
+	c.Assert(MapColumnType("tinyblob", "tidb"), check.Equals, "tinyblob")
+}
+
+func (s *typeMapperSuite) TestMapDDLColumnTypes(c *check.C) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"create table t(id int primary key, b tinyblob)",
+			"create table t(id int primary key, b BLOB(255))",
+		},
+		{
+			"alter table t add column b tinyblob not null",
+			"alter table t add column b BLOB(255) not null",
+		},
+		{
+			"alter table t change column b `B` TinyBlob, modify c tinyblob",
+			"alter table t change column b `B` BLOB(255), modify c BLOB(255)",
+		},
+		// the same names in comments and strings are not changed
+		{
+			"create table t(id int comment 'b tinyblob', /* b tinyblob */ b tinyblob)",
+			"create table t(id int comment 'b tinyblob', /* b tinyblob */ b BLOB(255))",
+		},
+		// unchanged
+		{"create table t(id int, b blob)", "create table t(id int, b blob)"},
+		{"drop table t", "drop table t"},
+	}
+	for _, t := range tests {
+		sql, err := MapDDLColumnTypes(t.sql, "mysql")
+		c.Assert(err, check.IsNil)
+		c.Assert(sql, check.Equals, t.expected)
+	}
+
+	sql, err := MapDDLColumnTypes("create table t(b tinyblob)", "tidb")
+	c.Assert(err, check.IsNil)
+	c.Assert(sql, check.Equals, "create table t(b tinyblob)")
+
+	_, err = MapDDLColumnTypes("create tabl t", "mysql")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *typeMapperSuite) TestMapDDLColumnTypesKeepComments(c *check.C) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"CREATE TABLE t (id int primary key, b tinyblob) /*!90000 SHARD_ROW_ID_BITS=4 */",
+			"CREATE TABLE t (id int primary key, b BLOB(255)) /*!90000 SHARD_ROW_ID_BITS=4 */",
+		},
+		{
+			"CREATE TABLE t (id bigint primary key /*T![clustered_index] CLUSTERED */, b tinyblob)",
+			"CREATE TABLE t (id bigint primary key /*T![clustered_index] CLUSTERED */, b BLOB(255))",
+		},
+		{
+			"CREATE TABLE t (id bigint /*T![auto_rand] AUTO_RANDOM(5) */ primary key) /*T![clustered_index] CLUSTERED */",
+			"CREATE TABLE t (id bigint /*T![auto_rand] AUTO_RANDOM(5) */ primary key) /*T![clustered_index] CLUSTERED */",
+		},
+	}
+	for _, t := range tests {
+		sql, err := MapDDLColumnTypes(t.sql, "mysql")
+		c.Assert(err, check.IsNil, check.Commentf("sql: %s", t.sql))
+		c.Assert(sql, check.Equals, t.expected)
+	}
+}
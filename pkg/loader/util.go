@@ -16,8 +16,10 @@ package loader
 import (
 	"crypto/tls"
 	gosql "database/sql"
+	"database/sql/driver"
 	"fmt"
 	"hash/crc32"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
@@ -25,8 +27,10 @@ import (
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/pingcap/tidb/errno"
+	"go.uber.org/zap"
 )
 
 var (
@@ -36,20 +40,31 @@ var (
 
 const (
 	colsSQL = `
-SELECT column_name, extra FROM information_schema.columns
+SELECT column_name, extra, column_type FROM information_schema.columns
 WHERE table_schema = ? AND table_name = ?;`
 	uniqKeysSQL = `
 SELECT non_unique, index_name, seq_in_index, column_name 
 FROM information_schema.statistics
 WHERE table_schema = ? AND table_name = ?
 ORDER BY seq_in_index ASC;`
+	shardingInfoSQL = `
+SELECT tidb_row_id_sharding_info FROM information_schema.tables
+WHERE table_schema = ? AND table_name = ?;`
 )
 
+// tidbRowIDColumn is the hidden column of the row id in TiDB, it's the handle of the tables without
+// integer primary key.
+const tidbRowIDColumn = "_tidb_rowid"
+
 type tableInfo struct {
-	columns    []string
-	primaryKey *indexInfo
+	columns []string
+	// column name -> column type like `varchar(20)`, only used to report the schema drift
+	columnTypes map[string]string
+	primaryKey  *indexInfo
 	// include primary key if have
 	uniqueKeys []indexInfo
+	// the SHARD_ROW_ID_BITS of the table without primary key, the rows are identified by `_tidb_rowid` if it's set.
+	shardRowIDBits int
 }
 
 type indexInfo struct {
@@ -62,7 +77,7 @@ type indexInfo struct {
 func getTableInfo(db *gosql.DB, schema string, table string) (info *tableInfo, err error) {
 	info = new(tableInfo)
 
-	if info.columns, err = getColsOfTbl(db, schema, table); err != nil {
+	if info.columns, info.columnTypes, err = getColsOfTbl(db, schema, table); err != nil {
 		return nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table)
 	}
 
@@ -70,8 +85,17 @@ func getTableInfo(db *gosql.DB, schema string, table string) (info *tableInfo, e
 		return nil, errors.Trace(err)
 	}
 
-	// put primary key at first place
-	// and set primaryKey
+	info.setPrimaryKey()
+
+	if info.primaryKey == nil {
+		info.shardRowIDBits = getShardRowIDBits(db, schema, table)
+	}
+
+	return
+}
+
+// setPrimaryKey puts primary key at first place of uniqueKeys and set primaryKey
+func (info *tableInfo) setPrimaryKey() {
 	for i := 0; i < len(info.uniqueKeys); i++ {
 		if info.uniqueKeys[i].name == "PRIMARY" {
 			info.uniqueKeys[i], info.uniqueKeys[0] = info.uniqueKeys[0], info.uniqueKeys[i]
@@ -79,12 +103,21 @@ func getTableInfo(db *gosql.DB, schema string, table string) (info *tableInfo, e
 			break
 		}
 	}
-
-	return
 }
 
 var customID int64
 
+// isConnectionError returns whether err is caused by a broken or unavailable connection.
+func isConnectionError(err error) bool {
+	err = errors.Cause(err)
+	if err == driver.ErrBadConn || err == mysql.ErrInvalidConn {
+		return true
+	}
+
+	_, ok := err.(net.Error)
+	return ok
+}
+
 func isUnknownSystemVariableErr(err error) bool {
 	code, ok := sql.GetSQLErrCode(err)
 	if !ok {
@@ -155,6 +188,28 @@ func CreateDBWithSQLMode(user string, password string, host string, port int, tl
 	return createDBWitSessions(dsn)
 }
 
+// checkMultiStatement returns an error if db can't execute multi-statements, i.e. the server is older than
+// MySQL 4.1 or the DSN doesn't set `multiStatements=true`.
+func checkMultiStatement(db *gosql.DB) error {
+	var version string
+	if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		return errors.Annotate(err, "failed to get the version of downstream")
+	}
+
+	var major, minor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &major, &minor); err != nil {
+		return errors.Annotatef(err, "failed to parse the version %s", version)
+	}
+	if major < 4 || (major == 4 && minor < 1) {
+		return errors.Errorf("multi-statement is not supported by downstream %s", version)
+	}
+
+	if _, err := db.Exec("SELECT 1;SELECT 1"); err != nil {
+		return errors.Annotatef(err, "multi-statement is not enabled, multiStatements=true should be set in the DSN")
+	}
+	return nil
+}
+
 // CreateDB return sql.DB
 func CreateDB(user string, password string, host string, port int, tls *tls.Config) (db *gosql.DB, err error) {
 	return CreateDBWithSQLMode(user, password, host, port, tls, nil)
@@ -212,40 +267,101 @@ func buildColumnList(names []string) string {
 	return b.String()
 }
 
-// getColsOfTbl returns a slice of the names of all columns,
+// getColsOfTbl returns a slice of the names of all columns and their types,
 // generated columns are excluded.
 // https://dev.mysql.com/doc/mysql-infoschema-excerpt/5.7/en/columns-table.html
-func getColsOfTbl(db *gosql.DB, schema, table string) ([]string, error) {
+func getColsOfTbl(db *gosql.DB, schema, table string) ([]string, map[string]string, error) {
 	rows, err := db.Query(colsSQL, schema, table)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return nil, nil, errors.Trace(err)
 	}
 	defer rows.Close()
 
 	cols := make([]string, 0, 1)
+	types := make(map[string]string)
 	for rows.Next() {
-		var name, extra string
-		err = rows.Scan(&name, &extra)
+		var name, extra, tp string
+		err = rows.Scan(&name, &extra, &tp)
 		if err != nil {
-			return nil, errors.Trace(err)
+			return nil, nil, errors.Trace(err)
 		}
 		isGenerated := strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED")
 		if isGenerated {
 			continue
 		}
 		cols = append(cols, name)
+		types[name] = tp
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, errors.Trace(err)
+		return nil, nil, errors.Trace(err)
 	}
 
 	// if no any columns returns, means the table not exist.
 	if len(cols) == 0 {
-		return nil, ErrTableNotExist
+		return nil, nil, ErrTableNotExist
 	}
 
-	return cols, nil
+	return cols, types, nil
+}
+
+// TableInfoDiff returns the human-readable differences of the columns from old to new,
+// like the added, dropped and type-changed columns. The type change is reported only if
+// the types of both are known.
+func TableInfoDiff(old, new *tableInfo) []string {
+	if old == nil || new == nil {
+		return nil
+	}
+
+	var diff []string
+	oldCols := make(map[string]struct{}, len(old.columns))
+	for _, col := range old.columns {
+		oldCols[col] = struct{}{}
+	}
+	newCols := make(map[string]struct{}, len(new.columns))
+	for _, col := range new.columns {
+		newCols[col] = struct{}{}
+		if _, ok := oldCols[col]; !ok {
+			if tp := new.columnTypes[col]; len(tp) > 0 {
+				diff = append(diff, fmt.Sprintf("add column `%s` %s", col, tp))
+			} else {
+				diff = append(diff, fmt.Sprintf("add column `%s`", col))
+			}
+			continue
+		}
+		oldTp, newTp := old.columnTypes[col], new.columnTypes[col]
+		if len(oldTp) > 0 && len(newTp) > 0 && oldTp != newTp {
+			diff = append(diff, fmt.Sprintf("change column `%s` type from %s to %s", col, oldTp, newTp))
+		}
+	}
+	for _, col := range old.columns {
+		if _, ok := newCols[col]; !ok {
+			diff = append(diff, fmt.Sprintf("drop column `%s`", col))
+		}
+	}
+	return diff
+}
+
+// getShardRowIDBits returns the SHARD_ROW_ID_BITS of the table, it's 0 if the table is not sharded or
+// the downstream is not TiDB.
+func getShardRowIDBits(db *gosql.DB, schema, table string) int {
+	var info gosql.NullString
+	if err := db.QueryRow(shardingInfoSQL, schema, table).Scan(&info); err != nil {
+		// the column only exists in TiDB 4.0 and later
+		log.Debug("failed to get the sharding info of table", zap.String("schema", schema),
+			zap.String("table", table), zap.Error(err))
+		return 0
+	}
+	return parseShardRowIDBits(info.String)
+}
+
+// parseShardRowIDBits parses the SHARD_ROW_ID_BITS from TIDB_ROW_ID_SHARDING_INFO like `SHARD_BITS=4`.
+func parseShardRowIDBits(info string) int {
+	bits, err := strconv.Atoi(strings.TrimPrefix(info, "SHARD_BITS="))
+	if err != nil || !strings.HasPrefix(info, "SHARD_BITS=") {
+		return 0
+	}
+	return bits
 }
 
 // https://dev.mysql.com/doc/mysql-infoschema-excerpt/5.7/en/statistics-table.html
@@ -275,18 +391,7 @@ func getUniqKeys(db *gosql.DB, schema, table string) (uniqueKeys []indexInfo, er
 			continue
 		}
 
-		var i int
-		// Search for indexInfo with the current keyName
-		for i = 0; i < len(uniqueKeys); i++ {
-			if uniqueKeys[i].name == keyName {
-				uniqueKeys[i].columns = append(uniqueKeys[i].columns, columnName)
-				break
-			}
-		}
-		// If we don't find the indexInfo with the loop above, create a new one
-		if i == len(uniqueKeys) {
-			uniqueKeys = append(uniqueKeys, indexInfo{keyName, []string{columnName}})
-		}
+		uniqueKeys = appendUniqKeyColumn(uniqueKeys, keyName, columnName)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -295,3 +400,19 @@ func getUniqKeys(db *gosql.DB, schema, table string) (uniqueKeys []indexInfo, er
 
 	return
 }
+
+func appendUniqKeyColumn(uniqueKeys []indexInfo, keyName string, columnName string) []indexInfo {
+	var i int
+	// Search for indexInfo with the current keyName
+	for i = 0; i < len(uniqueKeys); i++ {
+		if uniqueKeys[i].name == keyName {
+			uniqueKeys[i].columns = append(uniqueKeys[i].columns, columnName)
+			break
+		}
+	}
+	// If we don't find the indexInfo with the loop above, create a new one
+	if i == len(uniqueKeys) {
+		uniqueKeys = append(uniqueKeys, indexInfo{keyName, []string{columnName}})
+	}
+	return uniqueKeys
+}
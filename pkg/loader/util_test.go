@@ -38,7 +38,7 @@ func (cs *UtilSuite) TestGetTableInfoTableNotExist(c *check.C) {
 	defer db.Close()
 
 	// return empty rows
-	columnRows := sqlmock.NewRows([]string{"Field", "Extra"})
+	columnRows := sqlmock.NewRows([]string{"Field", "Extra", "Type"})
 	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "test1").WillReturnRows(columnRows)
 
 	_, err = getTableInfo(db, "test", "test1")
@@ -55,12 +55,12 @@ func (cs *UtilSuite) TestGetTableInfo(c *check.C) {
 	// (id, a1, a2, a3, a4)
 	// primary key: id
 	// unique key: (a1) (a2,a3)
-	columnRows := sqlmock.NewRows([]string{"Field", "Extra"}).
-		AddRow("id", "").
-		AddRow("a1", "").
-		AddRow("a2", "").
-		AddRow("a3", "VIRTUAL GENERATED").
-		AddRow("a4", "")
+	columnRows := sqlmock.NewRows([]string{"Field", "Extra", "Type"}).
+		AddRow("id", "", "int(11)").
+		AddRow("a1", "", "varchar(20)").
+		AddRow("a2", "", "int(11)").
+		AddRow("a3", "VIRTUAL GENERATED", "int(11)").
+		AddRow("a4", "", "int(11)")
 	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "test1").WillReturnRows(columnRows)
 
 	indexRows := sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"}).
@@ -77,10 +77,71 @@ func (cs *UtilSuite) TestGetTableInfo(c *check.C) {
 	c.Assert(info, check.NotNil)
 
 	c.Assert(info, check.DeepEquals, &tableInfo{
-		columns:    []string{"id", "a1", "a2", "a4"}, // generated column a3 is ignored
-		primaryKey: &indexInfo{"PRIMARY", []string{"id"}},
+		columns:     []string{"id", "a1", "a2", "a4"}, // generated column a3 is ignored
+		columnTypes: map[string]string{"id": "int(11)", "a1": "varchar(20)", "a2": "int(11)", "a4": "int(11)"},
+		primaryKey:  &indexInfo{"PRIMARY", []string{"id"}},
 		uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}},
 			{"dex1", []string{"a1"}},
 			{"dex2", []string{"a2", "a3"}},
 		}})
 }
+
+func (cs *UtilSuite) TestGetTableInfoWithShardRowID(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	columnRows := sqlmock.NewRows([]string{"Field", "Extra", "Type"}).AddRow("name", "", "varchar(20)")
+	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "test1").WillReturnRows(columnRows)
+	indexRows := sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"})
+	mock.ExpectQuery(regexp.QuoteMeta(uniqKeysSQL)).WithArgs("test", "test1").WillReturnRows(indexRows)
+	shardingRows := sqlmock.NewRows([]string{"tidb_row_id_sharding_info"}).AddRow("SHARD_BITS=4")
+	mock.ExpectQuery(regexp.QuoteMeta(shardingInfoSQL)).WithArgs("test", "test1").WillReturnRows(shardingRows)
+
+	info, err := getTableInfo(db, "test", "test1")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.shardRowIDBits, check.Equals, 4)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (cs *UtilSuite) TestParseShardRowIDBits(c *check.C) {
+	c.Assert(parseShardRowIDBits("SHARD_BITS=4"), check.Equals, 4)
+	c.Assert(parseShardRowIDBits("NOT_SHARDED"), check.Equals, 0)
+	c.Assert(parseShardRowIDBits("NOT_SHARDED(PK_IS_HANDLE)"), check.Equals, 0)
+	c.Assert(parseShardRowIDBits("PK_AUTO_RANDOM_BITS=5"), check.Equals, 0)
+	c.Assert(parseShardRowIDBits(""), check.Equals, 0)
+}
+
+func (cs *UtilSuite) TestTableInfoDiff(c *check.C) {
+	old := &tableInfo{
+		columns:     []string{"id", "name", "age"},
+		columnTypes: map[string]string{"id": "int(11)", "name": "varchar(20)", "age": "int(11)"},
+	}
+
+	// add column
+	added := &tableInfo{
+		columns:     []string{"id", "name", "age", "email"},
+		columnTypes: map[string]string{"id": "int(11)", "name": "varchar(20)", "age": "int(11)", "email": "varchar(64)"},
+	}
+	c.Assert(TableInfoDiff(old, added), check.DeepEquals, []string{"add column `email` varchar(64)"})
+
+	// drop column
+	dropped := &tableInfo{
+		columns:     []string{"id", "name"},
+		columnTypes: map[string]string{"id": "int(11)", "name": "varchar(20)"},
+	}
+	c.Assert(TableInfoDiff(old, dropped), check.DeepEquals, []string{"drop column `age`"})
+
+	// change column type
+	changed := &tableInfo{
+		columns:     []string{"id", "name", "age"},
+		columnTypes: map[string]string{"id": "bigint(20)", "name": "varchar(20)", "age": "int(11)"},
+	}
+	c.Assert(TableInfoDiff(old, changed), check.DeepEquals, []string{"change column `id` type from int(11) to bigint(20)"})
+
+	c.Assert(TableInfoDiff(old, old), check.HasLen, 0)
+	// the type change is unknown without the types
+	c.Assert(TableInfoDiff(&tableInfo{columns: []string{"id", "name", "age"}}, changed), check.HasLen, 0)
+	c.Assert(TableInfoDiff(&tableInfo{columns: []string{"id"}}, &tableInfo{columns: []string{"name"}}), check.DeepEquals,
+		[]string{"add column `name`", "drop column `id`"})
+}
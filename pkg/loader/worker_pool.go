@@ -0,0 +1,95 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// the count of tasks can be queued for every goroutine of RoundRobinWorkerPool
+const workerPoolQueueSize = 16
+
+// RoundRobinWorkerPool runs the tasks in a fixed number of goroutines instead of creating
+// a goroutine for every task, the tasks are assigned to the goroutines in turn.
+type RoundRobinWorkerPool struct {
+	tasks []chan func()
+	// exited[i] is closed when the goroutine of tasks[i] exits
+	exited []chan struct{}
+	next   uint64
+	wg     sync.WaitGroup
+}
+
+// NewRoundRobinWorkerPool starts a pool of size goroutines, Close must be called to stop them.
+func NewRoundRobinWorkerPool(size int) *RoundRobinWorkerPool {
+	p := &RoundRobinWorkerPool{}
+	p.Resize(size)
+	return p
+}
+
+func (p *RoundRobinWorkerPool) start() {
+	tasks, exited := make(chan func(), workerPoolQueueSize), make(chan struct{})
+	p.tasks = append(p.tasks, tasks)
+	p.exited = append(p.exited, exited)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(exited)
+		for task := range tasks {
+			task()
+		}
+	}()
+}
+
+// Resize starts new goroutines or stops the extra ones to make the pool have size goroutines, the stopped
+// ones exit after the tasks queued to them are done. It must not be called concurrently with Submit.
+func (p *RoundRobinWorkerPool) Resize(size int) {
+	if size <= 0 {
+		size = 1
+	}
+	for len(p.tasks) < size {
+		p.start()
+	}
+	for i := size; i < len(p.tasks); i++ {
+		close(p.tasks[i])
+		<-p.exited[i]
+	}
+	p.tasks, p.exited = p.tasks[:size], p.exited[:size]
+}
+
+// Size returns the number of goroutines of the pool.
+func (p *RoundRobinWorkerPool) Size() int {
+	return len(p.tasks)
+}
+
+// Submit queues the task to the next goroutine, it blocks if the queue of the goroutine is full.
+// It must not be called after Close.
+func (p *RoundRobinWorkerPool) Submit(task func()) {
+	i := (atomic.AddUint64(&p.next, 1) - 1) % uint64(len(p.tasks))
+	p.tasks[i] <- task
+}
+
+// SubmitTo queues the task to the goroutine of index worker % Size(), it blocks if the queue of the
+// goroutine is full. It must not be called after Close.
+func (p *RoundRobinWorkerPool) SubmitTo(worker int, task func()) {
+	p.tasks[worker%len(p.tasks)] <- task
+}
+
+// Close stops the goroutines after the submitted tasks are done.
+func (p *RoundRobinWorkerPool) Close() {
+	for _, tasks := range p.tasks {
+		close(tasks)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type workerPoolSuite struct{}
+
+var _ = check.Suite(&workerPoolSuite{})
+
+func (s *workerPoolSuite) TestRunAllTasks(c *check.C) {
+	pool := NewRoundRobinWorkerPool(4)
+
+	var count int64
+	for i := 0; i < 100; i++ {
+		pool.Submit(func() {
+			atomic.AddInt64(&count, 1)
+		})
+	}
+	pool.Close()
+	c.Assert(atomic.LoadInt64(&count), check.Equals, int64(100))
+}
+
+func (s *workerPoolSuite) TestRoundRobin(c *check.C) {
+	pool := NewRoundRobinWorkerPool(2)
+	defer pool.Close()
+
+	// the first worker is blocked, the next task must be taken by the second one
+	block := make(chan struct{})
+	pool.Submit(func() { <-block })
+	done := make(chan struct{})
+	pool.Submit(func() { close(done) })
+	<-done
+	close(block)
+}
+
+func (s *workerPoolSuite) TestSubmitTo(c *check.C) {
+	pool := NewRoundRobinWorkerPool(2)
+	defer pool.Close()
+
+	// the tasks submitted to the blocked worker wait for it, the other worker is not blocked
+	block := make(chan struct{})
+	pool.SubmitTo(0, func() { <-block })
+	var queued int64
+	pool.SubmitTo(2, func() { atomic.AddInt64(&queued, 1) })
+	done := make(chan struct{})
+	pool.SubmitTo(1, func() { close(done) })
+	<-done
+	c.Assert(atomic.LoadInt64(&queued), check.Equals, int64(0))
+	close(block)
+}
+
+func (s *workerPoolSuite) TestResize(c *check.C) {
+	pool := NewRoundRobinWorkerPool(2)
+
+	// the first worker is blocked, the others tasks are queued to both workers in turn
+	var count int64
+	block := make(chan struct{})
+	pool.Submit(func() { <-block })
+	for i := 0; i < 9; i++ {
+		pool.Submit(func() {
+			atomic.AddInt64(&count, 1)
+		})
+	}
+	// the tasks queued to the stopped worker are done before it exits
+	pool.Resize(1)
+	c.Assert(pool.Size(), check.Equals, 1)
+	c.Assert(atomic.LoadInt64(&count), check.Equals, int64(5))
+	close(block)
+
+	pool.Resize(3)
+	c.Assert(pool.Size(), check.Equals, 3)
+	pool.Resize(0)
+	c.Assert(pool.Size(), check.Equals, 1)
+	pool.Submit(func() {
+		atomic.AddInt64(&count, 1)
+	})
+	pool.Close()
+	c.Assert(atomic.LoadInt64(&count), check.Equals, int64(10))
+}
+
+func (s *workerPoolSuite) TestSplitExecDMLInPool(c *check.C) {
+	pool := NewRoundRobinWorkerPool(2)
+	defer pool.Close()
+
+	e := newExecutor(nil).withBatchSize(1).withWorkerPool(pool).withErrorPolicy(RetryWorker)
+	dmls := make([]*DML, 5)
+	for i := range dmls {
+		dmls[i] = &DML{Tp: InsertDMLType, Values: map[string]interface{}{"id": i}}
+	}
+
+	var mu sync.Mutex
+	executed := make(map[*DML]int)
+	err := e.splitExecDML(context.Background(), dmls, func(group []*DML) error {
+		mu.Lock()
+		defer mu.Unlock()
+		executed[group[0]]++
+		if group[0] == dmls[3] && executed[group[0]] == 1 {
+			return errors.New("fail once")
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(executed, check.HasLen, 5)
+	c.Assert(executed[dmls[3]], check.Equals, 2)
+}
+
+// benchmarkRunWorkers runs b.N batches of 16 groups with workerCount=16.
+func benchmarkRunWorkers(b *testing.B, pool *RoundRobinWorkerPool) {
+	const workerCount = 16
+	e := newExecutor(nil).withWorkerPool(pool)
+	e.setWorkerCount(workerCount)
+	workers := make([]int, workerCount)
+	groups := make([][]*DML, workerCount)
+	for i := range groups {
+		workers[i] = i
+		groups[i] = []*DML{{Tp: InsertDMLType}}
+	}
+	exec := func([]*DML) error { return nil }
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.runWorkers(workers, groups, exec)
+	}
+}
+
+func BenchmarkRunWorkersGoroutinePerTask(b *testing.B) {
+	benchmarkRunWorkers(b, nil)
+}
+
+func BenchmarkRunWorkersPool(b *testing.B) {
+	pool := NewRoundRobinWorkerPool(16)
+	defer pool.Close()
+	benchmarkRunWorkers(b, pool)
+}
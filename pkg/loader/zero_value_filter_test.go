@@ -0,0 +1,90 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type zeroValueFilterSuite struct{}
+
+var _ = check.Suite(&zeroValueFilterSuite{})
+
+func (s *zeroValueFilterSuite) TestFullMatch(c *check.C) {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	e := newCaptureExecutor().withZeroValueFilter(true).withNoopUpdateCounter(counter)
+
+	noop := newCaptureTestDML(UpdateDMLType, 1)
+	noop.OldValues["name"] = "a"
+	dmls := []*DML{noop, newCaptureTestDML(DeleteDMLType, 2)}
+	c.Assert(e.singleExec(dmls, false), check.IsNil)
+	// the UPDATE is skipped entirely
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1"})
+	c.Assert(counterValue(c, counter), check.Equals, 1.0)
+}
+
+func (s *zeroValueFilterSuite) TestPartialMatch(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	dml := newCaptureTestDML(UpdateDMLType, 1)
+	dml.Values["age"] = 0
+	dml.OldValues["age"] = 0
+	dml.info.columns = append(dml.info.columns, "age")
+
+	// the unchanged `age` and `id` are left out of SET
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `test`.`users` SET `name` = ? WHERE `id` = ? LIMIT 1")).
+		WithArgs("a", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	e := newExecutor(db).withZeroValueFilter(true).withNoopUpdateCounter(counter)
+	c.Assert(e.singleExec([]*DML{dml}, false), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	c.Assert(counterValue(c, counter), check.Equals, 0.0)
+}
+
+func (s *zeroValueFilterSuite) TestNotFiltered(c *check.C) {
+	noop := newCaptureTestDML(UpdateDMLType, 1)
+	noop.OldValues["name"] = "a"
+
+	// disabled by default
+	e := newCaptureExecutor()
+	c.Assert(e.singleExec([]*DML{noop}, false), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{"UPDATE `test`.`users` SET `id` = ?,`name` = ? WHERE `id` = ? LIMIT 1"})
+
+	// the UPDATEs are executed as DELETE and REPLACE in safe mode
+	e = newCaptureExecutor().withZeroValueFilter(true)
+	c.Assert(e.singleExec([]*DML{noop}, true), check.IsNil)
+	c.Assert(e.CapturedSQL(), sqlEquals, []string{
+		"DELETE FROM `test`.`users` WHERE `id` = ? LIMIT 1",
+		"REPLACE INTO `test`.`users`(`id`,`name`) VALUES(?,?)",
+	})
+}
+
+func (s *zeroValueFilterSuite) TestChangedColumns(c *check.C) {
+	dml := &DML{
+		Tp:        UpdateDMLType,
+		Values:    map[string]interface{}{"a": []byte("x"), "b": 1, "c": nil, "d": int64(2), "e": 3},
+		OldValues: map[string]interface{}{"a": []byte("x"), "b": 2, "c": nil, "d": 2},
+	}
+	// the values of different types are changed, and so are the columns missing in OldValues
+	c.Assert(dml.changedColumns(), check.DeepEquals, []string{"b", "d", "e"})
+}
@@ -0,0 +1,276 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtest
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"go.uber.org/zap"
+)
+
+const (
+	schemaPrefix = "loadtest_"
+	tablePrefix  = "t_"
+)
+
+// LoadTestConfig is the config of a load test.
+type LoadTestConfig struct {
+	// Schemas and Tables are the count of schemas and the count of tables in each schema.
+	Schemas int
+	Tables  int
+	// Rows is the count of distinct primary keys in each table the DMLs are generated on.
+	Rows int
+	// InsertRatio, UpdateRatio and DeleteRatio are the weights of the DML types,
+	// only inserts are generated if all of them are 0.
+	InsertRatio float64
+	UpdateRatio float64
+	DeleteRatio float64
+	// DMLsPerTxn is the count of DMLs in each txn.
+	DMLsPerTxn int
+	// Duration of feeding txns to the loader, 0 means no limit.
+	Duration time.Duration
+	// Txns stops the load test after the count of txns are fed, 0 means no limit.
+	Txns int
+
+	WorkerCount int
+	BatchSize   int
+	Seed        int64
+}
+
+// LoadTestResult is the result of a load test.
+type LoadTestResult struct {
+	Txns      int
+	Succeeded int
+	Elapsed   time.Duration
+	// Throughput is the count of succeeded txns per second.
+	Throughput float64
+	// latency between feeding a txn to the loader and receiving it from Successes().
+	LatencyP50 time.Duration
+	LatencyP95 time.Duration
+	LatencyP99 time.Duration
+	// ErrorRate is the ratio of txns fed but not succeeded.
+	ErrorRate float64
+}
+
+func (cfg *LoadTestConfig) adjust() {
+	if cfg.Schemas <= 0 {
+		cfg.Schemas = 1
+	}
+	if cfg.Tables <= 0 {
+		cfg.Tables = 1
+	}
+	if cfg.Rows <= 0 {
+		cfg.Rows = 1000
+	}
+	if cfg.DMLsPerTxn <= 0 {
+		cfg.DMLsPerTxn = 1
+	}
+	if cfg.InsertRatio+cfg.UpdateRatio+cfg.DeleteRatio <= 0 {
+		cfg.InsertRatio = 1
+	}
+	if cfg.WorkerCount <= 0 {
+		cfg.WorkerCount = 16
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 20
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+}
+
+// RunLoadTest creates the tables, feeds synthetic txns to a loader writing to db until the Duration
+// passes, Txns are fed or ctx is done, and returns the statistics of the succeeded txns.
+// The loader runs in safe mode so any mix of DMLs can be applied. The load test stops at the
+// first error of the loader, the result is returned together with the error in that case.
+func RunLoadTest(ctx context.Context, cfg LoadTestConfig, db *gosql.DB) (*LoadTestResult, error) {
+	cfg.adjust()
+
+	if err := createTables(ctx, db, &cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	ld, err := loader.NewLoader(db, loader.WorkerCount(cfg.WorkerCount), loader.BatchSize(cfg.BatchSize))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ld.SetSafeMode(true)
+
+	runErr := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		runErr <- ld.Run()
+		close(done)
+	}()
+
+	latencies := make(chan []time.Duration, 1)
+	go func() {
+		var ls []time.Duration
+		for txn := range ld.Successes() {
+			ls = append(ls, time.Since(txn.Metadata.(time.Time)))
+		}
+		latencies <- ls
+	}()
+
+	gen := newTxnGenerator(&cfg)
+	start := time.Now()
+	var timeout <-chan time.Time
+	if cfg.Duration > 0 {
+		timer := time.NewTimer(cfg.Duration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	result := new(LoadTestResult)
+feed:
+	for cfg.Txns <= 0 || result.Txns < cfg.Txns {
+		txn := gen.next()
+		txn.Metadata = time.Now()
+		select {
+		case ld.Input() <- txn:
+			result.Txns++
+		case <-timeout:
+			break feed
+		case <-ctx.Done():
+			break feed
+		case <-done:
+			break feed
+		}
+	}
+	ld.Close()
+
+	err = <-runErr
+	ls := <-latencies
+	result.fill(ls, time.Since(start))
+
+	log.Info("load test finished", zap.Reflect("result", result), zap.Error(err))
+
+	return result, errors.Trace(err)
+}
+
+func (r *LoadTestResult) fill(latencies []time.Duration, elapsed time.Duration) {
+	r.Succeeded = len(latencies)
+	r.Elapsed = elapsed
+	if elapsed > 0 {
+		r.Throughput = float64(r.Succeeded) / elapsed.Seconds()
+	}
+	if r.Txns > 0 {
+		r.ErrorRate = float64(r.Txns-r.Succeeded) / float64(r.Txns)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	r.LatencyP50 = percentile(latencies, 0.5)
+	r.LatencyP95 = percentile(latencies, 0.95)
+	r.LatencyP99 = percentile(latencies, 0.99)
+}
+
+// percentile returns the p-th percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func createTables(ctx context.Context, db *gosql.DB, cfg *LoadTestConfig) error {
+	for i := 0; i < cfg.Schemas; i++ {
+		schema := schemaName(i)
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", schema)); err != nil {
+			return errors.Annotatef(err, "create schema %s", schema)
+		}
+		for j := 0; j < cfg.Tables; j++ {
+			sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s` (id BIGINT PRIMARY KEY, val VARCHAR(64))", schema, tableName(j))
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return errors.Annotatef(err, "create table %s.%s", schema, tableName(j))
+			}
+		}
+	}
+	return nil
+}
+
+func schemaName(i int) string {
+	return fmt.Sprintf("%s%d", schemaPrefix, i)
+}
+
+func tableName(i int) string {
+	return fmt.Sprintf("%s%d", tablePrefix, i)
+}
+
+type txnGenerator struct {
+	cfg  *LoadTestConfig
+	rand *rand.Rand
+}
+
+func newTxnGenerator(cfg *LoadTestConfig) *txnGenerator {
+	return &txnGenerator{
+		cfg:  cfg,
+		rand: rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+func (g *txnGenerator) next() *loader.Txn {
+	txn := new(loader.Txn)
+	for i := 0; i < g.cfg.DMLsPerTxn; i++ {
+		txn.AppendDML(g.nextDML())
+	}
+	return txn
+}
+
+func (g *txnGenerator) nextDML() *loader.DML {
+	dml := &loader.DML{
+		Database: schemaName(g.rand.Intn(g.cfg.Schemas)),
+		Table:    tableName(g.rand.Intn(g.cfg.Tables)),
+		Tp:       g.nextType(),
+	}
+
+	id := g.rand.Int63n(int64(g.cfg.Rows))
+	dml.Values = map[string]interface{}{"id": id, "val": g.randVal()}
+	if dml.Tp == loader.UpdateDMLType {
+		dml.OldValues = map[string]interface{}{"id": id, "val": g.randVal()}
+	}
+
+	return dml
+}
+
+func (g *txnGenerator) nextType() loader.DMLType {
+	total := g.cfg.InsertRatio + g.cfg.UpdateRatio + g.cfg.DeleteRatio
+	r := g.rand.Float64() * total
+	switch {
+	case r < g.cfg.InsertRatio:
+		return loader.InsertDMLType
+	case r < g.cfg.InsertRatio+g.cfg.UpdateRatio:
+		return loader.UpdateDMLType
+	default:
+		return loader.DeleteDMLType
+	}
+}
+
+func (g *txnGenerator) randVal() string {
+	return fmt.Sprintf("val-%d", g.rand.Int63())
+}
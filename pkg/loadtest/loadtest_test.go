@@ -0,0 +1,118 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&loadTestSuite{})
+
+type loadTestSuite struct{}
+
+func (s *loadTestSuite) TestRunLoadTest(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	cfg := LoadTestConfig{
+		Rows:        10,
+		InsertRatio: 0.6,
+		UpdateRatio: 0.2,
+		DeleteRatio: 0.2,
+		Duration:    5 * time.Second,
+		Txns:        50,
+		WorkerCount: 2,
+		BatchSize:   4,
+		Seed:        1,
+	}
+
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `loadtest_0`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `loadtest_0`.`t_0`").WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 0; i < cfg.WorkerCount; i++ {
+		mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	}
+	mock.ExpectQuery("SELECT table_name, column_name, extra, column_type FROM information_schema.columns").
+		WithArgs("loadtest_0").
+		WillReturnRows(sqlmock.NewRows([]string{"table_name", "column_name", "extra", "column_type"}).
+			AddRow("t_0", "id", "", "int(11)").AddRow("t_0", "val", "", "varchar(64)"))
+	mock.ExpectQuery("SELECT table_name, non_unique, index_name, seq_in_index, column_name").
+		WithArgs("loadtest_0").
+		WillReturnRows(sqlmock.NewRows([]string{"table_name", "non_unique", "index_name", "seq_in_index", "column_name"}).
+			AddRow("t_0", 0, "PRIMARY", 1, "id"))
+	// every DML may be executed in its own txn, and an update is executed as delete and replace in safe mode
+	for i := 0; i < 2*cfg.Txns; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec("(REPLACE INTO|DELETE FROM) `loadtest_0`.`t_0`").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	result, err := RunLoadTest(context.Background(), cfg, db)
+	c.Assert(err, IsNil)
+	c.Assert(result.Txns, Equals, cfg.Txns)
+	c.Assert(result.Succeeded, Equals, cfg.Txns)
+	c.Assert(result.ErrorRate, Equals, 0.0)
+	c.Assert(result.Throughput > 0, IsTrue)
+	c.Assert(result.LatencyP50 <= result.LatencyP95, IsTrue)
+	c.Assert(result.LatencyP95 <= result.LatencyP99, IsTrue)
+}
+
+func (s *loadTestSuite) TestTxnGenerator(c *C) {
+	cfg := LoadTestConfig{
+		Schemas:     2,
+		Tables:      3,
+		Rows:        5,
+		UpdateRatio: 1,
+		DMLsPerTxn:  4,
+		Seed:        1,
+	}
+	cfg.adjust()
+	c.Assert(cfg.InsertRatio, Equals, 0.0)
+
+	gen := newTxnGenerator(&cfg)
+	for i := 0; i < 10; i++ {
+		txn := gen.next()
+		c.Assert(txn.DMLs, HasLen, cfg.DMLsPerTxn)
+		for _, dml := range txn.DMLs {
+			c.Assert(dml.Tp, Equals, loader.UpdateDMLType)
+			c.Assert(dml.Database, Matches, "loadtest_[01]")
+			c.Assert(dml.Table, Matches, "t_[012]")
+			c.Assert(dml.Values["id"].(int64) < 5, IsTrue)
+			c.Assert(dml.OldValues["id"], Equals, dml.Values["id"])
+		}
+	}
+}
+
+func (s *loadTestSuite) TestPercentile(c *C) {
+	c.Assert(percentile(nil, 0.5), Equals, time.Duration(0))
+
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	c.Assert(percentile(sorted, 0.5), Equals, time.Duration(50))
+	c.Assert(percentile(sorted, 0.95), Equals, time.Duration(95))
+	c.Assert(percentile(sorted, 0.99), Equals, time.Duration(99))
+}
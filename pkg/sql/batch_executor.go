@@ -0,0 +1,71 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// BatchExecute executes sqls with the args of the same index in a transaction, the transaction
+// is rolled back if any of them fails or ctx is done. argsSets can be nil if none of sqls has args.
+func BatchExecute(ctx context.Context, db *sql.DB, sqls []string, argsSets [][]interface{}) error {
+	return BatchExecuteWithCallback(ctx, db, sqls, argsSets, nil)
+}
+
+// BatchExecuteWithCallback is like BatchExecute, and calls onRow with the result of every sql if it's not nil.
+func BatchExecuteWithCallback(ctx context.Context, db *sql.DB, sqls []string, argsSets [][]interface{}, onRow func(sql.Result)) error {
+	if argsSets != nil && len(argsSets) != len(sqls) {
+		return errors.Errorf("got %d sets of args for %d sqls", len(argsSets), len(sqls))
+	}
+	if len(sqls) == 0 {
+		return nil
+	}
+
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("exec begin failed", zap.Strings("sqls", sqls), zap.Error(err))
+		return errors.Trace(err)
+	}
+
+	for i, query := range sqls {
+		var args []interface{}
+		if argsSets != nil {
+			args = argsSets[i]
+		}
+
+		res, err := txn.ExecContext(ctx, query, args...)
+		if err != nil {
+			log.Error("exec failed", zap.String("sql", query), zap.Reflect("args", args), zap.Error(err))
+			if rerr := txn.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
+				log.Error("Rollback failed", zap.Error(rerr))
+			}
+			return errors.Trace(err)
+		}
+		if onRow != nil {
+			onRow(res)
+		}
+	}
+
+	if err = txn.Commit(); err != nil {
+		log.Error("commit failed", zap.Strings("sqls", sqls), zap.Error(err))
+		return errors.Trace(err)
+	}
+
+	return nil
+}
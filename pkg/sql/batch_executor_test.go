@@ -0,0 +1,105 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type batchExecuteSuite struct {
+	db   *sql.DB
+	mock sqlmock.Sqlmock
+}
+
+var _ = Suite(&batchExecuteSuite{})
+
+func (s *batchExecuteSuite) SetUpTest(c *C) {
+	var err error
+	s.db, s.mock, err = sqlmock.New()
+	c.Assert(err, IsNil)
+}
+
+func (s *batchExecuteSuite) TearDownTest(c *C) {
+	c.Assert(s.mock.ExpectationsWereMet(), IsNil)
+	s.db.Close()
+}
+
+func (s *batchExecuteSuite) TestSuccess(c *C) {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("DELETE FROM t").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec("REPLACE INTO t").WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mock.ExpectCommit()
+
+	var affected []int64
+	err := BatchExecuteWithCallback(context.Background(), s.db,
+		[]string{"DELETE FROM t WHERE id = ?", "REPLACE INTO t VALUES(?,?)"},
+		[][]interface{}{{1}, {1, "a"}},
+		func(res sql.Result) {
+			rows, err := res.RowsAffected()
+			c.Assert(err, IsNil)
+			affected = append(affected, rows)
+		})
+	c.Assert(err, IsNil)
+	c.Assert(affected, DeepEquals, []int64{1, 2})
+}
+
+func (s *batchExecuteSuite) TestWithoutArgs(c *C) {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("DELETE FROM t").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+	c.Assert(BatchExecute(context.Background(), s.db, []string{"DELETE FROM t"}, nil), IsNil)
+
+	// nothing to execute
+	c.Assert(BatchExecute(context.Background(), s.db, nil, nil), IsNil)
+
+	err := BatchExecute(context.Background(), s.db, []string{"DELETE FROM t"}, [][]interface{}{{1}, {2}})
+	c.Assert(err, ErrorMatches, "got 2 sets of args for 1 sqls")
+}
+
+func (s *batchExecuteSuite) TestStatementFailure(c *C) {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("DELETE FROM t").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec("REPLACE INTO t").WillReturnError(errors.New("replace fail"))
+	s.mock.ExpectRollback()
+
+	called := 0
+	err := BatchExecuteWithCallback(context.Background(), s.db,
+		[]string{"DELETE FROM t WHERE id = ?", "REPLACE INTO t VALUES(?,?)", "DELETE FROM u"},
+		[][]interface{}{{1}, {1, "a"}, {}},
+		func(sql.Result) { called++ })
+	c.Assert(err, ErrorMatches, "replace fail")
+	c.Assert(called, Equals, 1)
+}
+
+func (s *batchExecuteSuite) TestContextCancellation(c *C) {
+	// canceled before begin
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := BatchExecute(ctx, s.db, []string{"DELETE FROM t"}, nil)
+	c.Assert(err, ErrorMatches, "context canceled")
+
+	// timeout in executing
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("DELETE FROM t").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 1))
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = BatchExecute(ctx, s.db, []string{"DELETE FROM t", "DELETE FROM u"}, nil)
+	c.Assert(err, ErrorMatches, "canceling query due to user request")
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValueChange is the change of a value, Added or Removed is set if the key is absent in the old or new values.
+type ValueChange struct {
+	Old     interface{}
+	New     interface{}
+	Added   bool
+	Removed bool
+}
+
+// ValueDiff is the changed values by key.
+type ValueDiff map[string]ValueChange
+
+// DiffValues returns the values changed from old to new, including the keys added or removed.
+func DiffValues(old, new map[string]interface{}) ValueDiff {
+	diff := make(ValueDiff)
+	for key, oldValue := range old {
+		newValue, ok := new[key]
+		if !ok {
+			diff[key] = ValueChange{Old: oldValue, Removed: true}
+		} else if !reflect.DeepEqual(oldValue, newValue) {
+			diff[key] = ValueChange{Old: oldValue, New: newValue}
+		}
+	}
+	for key, newValue := range new {
+		if _, ok := old[key]; !ok {
+			diff[key] = ValueChange{New: newValue, Added: true}
+		}
+	}
+	return diff
+}
+
+// String formats the diff like `{age: <absent> -> 18, name: "b" -> "a"}` in the order of keys,
+// nil is formatted as NULL.
+func (d ValueDiff) String() string {
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		change := d[key]
+		old, new := formatDiffValue(change.Old), formatDiffValue(change.New)
+		if change.Added {
+			old = "<absent>"
+		}
+		if change.Removed {
+			new = "<absent>"
+		}
+		fmt.Fprintf(&builder, "%s: %s -> %s", key, old, new)
+	}
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+func formatDiffValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		return strconv.Quote(string(v))
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
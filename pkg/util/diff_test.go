@@ -0,0 +1,49 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type diffSuite struct{}
+
+var _ = Suite(&diffSuite{})
+
+func (s *diffSuite) TestDiffValues(c *C) {
+	old := map[string]interface{}{"id": 1, "name": "b", "data": []byte("x"), "email": "b@example.com", "note": nil}
+	new := map[string]interface{}{"id": 1, "name": "a", "data": []byte("x"), "age": 18, "note": "n"}
+
+	diff := DiffValues(old, new)
+	c.Assert(diff, DeepEquals, ValueDiff{
+		"name":  {Old: "b", New: "a"},
+		"note":  {Old: nil, New: "n"},
+		"age":   {New: 18, Added: true},
+		"email": {Old: "b@example.com", Removed: true},
+	})
+	c.Assert(diff.String(), Equals, `{age: <absent> -> 18, email: "b@example.com" -> <absent>, name: "b" -> "a", note: NULL -> "n"}`)
+}
+
+func (s *diffSuite) TestNoChange(c *C) {
+	values := map[string]interface{}{"id": int64(1), "data": []byte("x")}
+	diff := DiffValues(values, map[string]interface{}{"id": int64(1), "data": []byte("x")})
+	c.Assert(diff, HasLen, 0)
+	c.Assert(diff.String(), Equals, "{}")
+
+	// the values of different types are changed
+	diff = DiffValues(values, map[string]interface{}{"id": 1, "data": []byte("y")})
+	c.Assert(diff.String(), Equals, `{data: "x" -> "y", id: 1 -> 1}`)
+
+	c.Assert(DiffValues(nil, nil), HasLen, 0)
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"time"
+)
+
+// RetryStats records the retries of RetryContextWithStats, Attempts[i] is the number of the i-th retry
+// counted from the first call of fn, i.e. starting at 2, and Durations[i] is the time waited before it.
+type RetryStats struct {
+	Attempts  []int
+	Durations []time.Duration
+}
+
+// Retries returns the number of retries, 0 if fn succeeds or quits at the first call.
+func (s *RetryStats) Retries() int {
+	return len(s.Attempts)
+}
+
+// RetryContextWithStats is the same as RetryContext, and returns the stats of the retries.
+func RetryContextWithStats(ctx context.Context, retryCount int, sleepTime time.Duration, backoffFactor int, fn func(context.Context) error) (*RetryStats, error) {
+	return RetryContextWithMaxDelayAndStats(ctx, retryCount, sleepTime, backoffFactor, 0, fn)
+}
+
+// RetryContextWithMaxDelayAndStats is the same as RetryContextWithMaxDelay, and returns the stats of the retries.
+func RetryContextWithMaxDelayAndStats(ctx context.Context, retryCount int, sleepTime time.Duration, backoffFactor int, maxDelay time.Duration, fn func(context.Context) error) (*RetryStats, error) {
+	stats := new(RetryStats)
+	err := retryContext(ctx, retryCount, sleepTime, backoffFactor, maxDelay, fn, stats)
+	return stats, err
+}
+
+// retryContext calls fn until it succeeds for at most retryCount times, the retries are recorded in stats
+// if it's not nil.
+func retryContext(ctx context.Context, retryCount int, sleepTime time.Duration, backoffFactor int, maxDelay time.Duration, fn func(context.Context) error, stats *RetryStats) error {
+	var err error
+	var waited time.Duration
+	for i := 0; i < retryCount; i++ {
+		if i > 0 && stats != nil {
+			stats.Attempts = append(stats.Attempts, i+1)
+			stats.Durations = append(stats.Durations, waited)
+		}
+		err = fn(ctx)
+		if err == nil {
+			break
+		}
+
+		if maxDelay > 0 && sleepTime > maxDelay {
+			sleepTime = maxDelay
+		}
+		select {
+		case <-retryAfter(sleepTime):
+			waited = sleepTime
+		case <-ctx.Done():
+			return err
+		}
+		if maxDelay > 0 && backoffFactor > 0 && sleepTime > maxDelay/time.Duration(backoffFactor) {
+			// avoid overflow of the multiplication
+			sleepTime = maxDelay
+		} else {
+			sleepTime = sleepTime * time.Duration(backoffFactor)
+		}
+	}
+	return err
+}
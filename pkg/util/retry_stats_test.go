@@ -0,0 +1,77 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type retryStatsSuite struct{}
+
+var _ = Suite(&retryStatsSuite{})
+
+func (s *retryStatsSuite) TestNoRetry(c *C) {
+	stats, err := RetryContextWithStats(context.Background(), 3, time.Millisecond, 2, func(context.Context) error {
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(stats.Retries(), Equals, 0)
+	c.Assert(stats.Attempts, IsNil)
+}
+
+func (s *retryStatsSuite) TestRetries(c *C) {
+	origAfter := retryAfter
+	retryAfter = func(d time.Duration) <-chan time.Time {
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+	defer func() {
+		retryAfter = origAfter
+	}()
+
+	var callCount int
+	stats, err := RetryContextWithStats(context.Background(), 5, time.Millisecond, 2, func(context.Context) error {
+		callCount++
+		if callCount == 3 {
+			return nil
+		}
+		return errors.New("Fail")
+	})
+	c.Assert(err, IsNil)
+	c.Assert(stats.Attempts, DeepEquals, []int{2, 3})
+	c.Assert(stats.Durations, DeepEquals, []time.Duration{time.Millisecond, 2 * time.Millisecond})
+
+	// the wait after the last attempt is not a retry
+	stats, err = RetryContextWithMaxDelayAndStats(context.Background(), 3, time.Millisecond, 10, 5*time.Millisecond, func(context.Context) error {
+		return errors.New("Fail")
+	})
+	c.Assert(err, ErrorMatches, "Fail")
+	c.Assert(stats.Retries(), Equals, 2)
+	c.Assert(stats.Durations, DeepEquals, []time.Duration{time.Millisecond, 5 * time.Millisecond})
+}
+
+func (s *retryStatsSuite) TestCanceled(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err := RetryContextWithStats(ctx, 3, time.Hour, 2, func(context.Context) error {
+		return errors.New("Fail")
+	})
+	c.Assert(err, ErrorMatches, "Fail")
+	c.Assert(stats.Retries(), Equals, 0)
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+)
+
+// SchemaColumn is a column of table used to calculate the schema hash.
+type SchemaColumn struct {
+	Name string
+	// the COLUMN_TYPE in INFORMATION_SCHEMA.COLUMNS, like "int(11)"
+	Type string
+	// starts from 1
+	Position int
+}
+
+// HashSchema returns the hash of the columns of the table got from INFORMATION_SCHEMA.COLUMNS of db,
+// the tables with the same hash have the same column names, types and positions. The query is cancelled with ctx.
+func HashSchema(ctx context.Context, db *sql.DB, schema, table string) (string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT COLUMN_NAME, COLUMN_TYPE, ORDINAL_POSITION FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", schema, table)
+	if err != nil {
+		return "", errors.Annotatef(err, "query columns of `%s`.`%s`", schema, table)
+	}
+	defer rows.Close()
+
+	var columns []SchemaColumn
+	for rows.Next() {
+		var col SchemaColumn
+		if err := rows.Scan(&col.Name, &col.Type, &col.Position); err != nil {
+			return "", errors.Trace(err)
+		}
+		columns = append(columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return "", errors.Trace(err)
+	}
+	if len(columns) == 0 {
+		return "", errors.NotFoundf("table `%s`.`%s`", schema, table)
+	}
+
+	return HashColumns(columns), nil
+}
+
+// HashTableInfo returns the hash of the public columns of info, it's the same as the one returned by HashSchema
+// for the table created by info in TiDB.
+func HashTableInfo(info *model.TableInfo) string {
+	var columns []SchemaColumn
+	for _, col := range info.Columns {
+		if col.State != model.StatePublic {
+			continue
+		}
+		columns = append(columns, SchemaColumn{
+			Name:     col.Name.O,
+			Type:     col.FieldType.InfoSchemaStr(),
+			Position: len(columns) + 1,
+		})
+	}
+	return HashColumns(columns)
+}
+
+// HashColumns returns the SHA-256 hex digest of columns sorted by position, names and types are case insensitive.
+func HashColumns(columns []SchemaColumn) string {
+	sorted := make([]SchemaColumn, len(columns))
+	copy(sorted, columns)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Position != sorted[j].Position {
+			return sorted[i].Position < sorted[j].Position
+		}
+		return strings.ToLower(sorted[i].Name) < strings.ToLower(sorted[j].Name)
+	})
+
+	h := sha256.New()
+	for _, col := range sorted {
+		fmt.Fprintf(h, "%d\x00%s\x00%s\n", col.Position, strings.ToLower(col.Name), strings.ToLower(col.Type))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+type schemaHashSuite struct{}
+
+var _ = Suite(&schemaHashSuite{})
+
+func (s *schemaHashSuite) expectColumns(mock sqlmock.Sqlmock, columns ...SchemaColumn) {
+	rows := sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "ORDINAL_POSITION"})
+	for _, col := range columns {
+		rows.AddRow(col.Name, col.Type, col.Position)
+	}
+	mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE, ORDINAL_POSITION FROM INFORMATION_SCHEMA.COLUMNS.*").
+		WithArgs("test", "t").WillReturnRows(rows)
+}
+
+func (s *schemaHashSuite) hash(c *C, columns ...SchemaColumn) string {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	s.expectColumns(mock, columns...)
+	hash, err := HashSchema(context.Background(), db, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	return hash
+}
+
+func (s *schemaHashSuite) TestIdentical(c *C) {
+	hash := s.hash(c, SchemaColumn{"id", "int(11)", 1}, SchemaColumn{"name", "varchar(20)", 2})
+	c.Assert(hash, HasLen, 64)
+
+	// the order of rows and the case don't matter
+	c.Assert(s.hash(c, SchemaColumn{"NAME", "VARCHAR(20)", 2}, SchemaColumn{"ID", "INT(11)", 1}), Equals, hash)
+}
+
+func (s *schemaHashSuite) TestDiverged(c *C) {
+	hash := s.hash(c, SchemaColumn{"id", "int(11)", 1}, SchemaColumn{"name", "varchar(20)", 2})
+
+	diverged := [][]SchemaColumn{
+		// type changed
+		{{"id", "int(11)", 1}, {"name", "varchar(40)", 2}},
+		// column added
+		{{"id", "int(11)", 1}, {"name", "varchar(20)", 2}, {"age", "int(11)", 3}},
+		// column renamed
+		{{"id", "int(11)", 1}, {"title", "varchar(20)", 2}},
+		// column reordered
+		{{"name", "varchar(20)", 1}, {"id", "int(11)", 2}},
+	}
+	for _, columns := range diverged {
+		c.Assert(s.hash(c, columns...), Not(Equals), hash, Commentf("columns: %v", columns))
+	}
+}
+
+func (s *schemaHashSuite) TestTableNotFound(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	s.expectColumns(mock)
+	_, err = HashSchema(context.Background(), db, "test", "t")
+	c.Assert(errors.IsNotFound(err), IsTrue)
+}
+
+func (s *schemaHashSuite) TestHashTableInfo(c *C) {
+	intType := types.NewFieldType(mysql.TypeLong)
+	intType.Flen = 11
+	varcharType := types.NewFieldType(mysql.TypeVarchar)
+	varcharType.Flen = 20
+	info := &model.TableInfo{
+		Columns: []*model.ColumnInfo{
+			{Name: model.NewCIStr("id"), FieldType: *intType, State: model.StatePublic},
+			{Name: model.NewCIStr("dropping"), FieldType: *intType, State: model.StateDeleteOnly},
+			{Name: model.NewCIStr("name"), FieldType: *varcharType, State: model.StatePublic},
+		},
+	}
+
+	hash := s.hash(c, SchemaColumn{"id", "int(11)", 1}, SchemaColumn{"name", "varchar(20)", 2})
+	c.Assert(HashTableInfo(info), Equals, hash)
+}
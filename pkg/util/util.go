@@ -168,25 +168,20 @@ func RetryOnError(retryCount int, sleepTime time.Duration, errStr string, fn fun
 	return errors.Trace(err)
 }
 
+// retryAfter is replaced in unit test to check the wait time without sleeping.
+var retryAfter = time.After
+
 // RetryContext retries the specified `fn` until it returns no error or the context is canceled,
 // for at most `retryCount` times.
 // The wait time before the `i`th retry is calculated with `sleepTime` * (`backoffFactor` ** i).
 func RetryContext(ctx context.Context, retryCount int, sleepTime time.Duration, backoffFactor int, fn func(context.Context) error) error {
-	var err error
-	for i := 0; i < retryCount; i++ {
-		err = fn(ctx)
-		if err == nil {
-			break
-		}
+	return RetryContextWithMaxDelay(ctx, retryCount, sleepTime, backoffFactor, 0, fn)
+}
 
-		select {
-		case <-time.After(sleepTime):
-		case <-ctx.Done():
-			return err
-		}
-		sleepTime = sleepTime * time.Duration(backoffFactor)
-	}
-	return err
+// RetryContextWithMaxDelay is the same as RetryContext, except that the wait time before each retry
+// is at most `maxDelay`, 0 means no limit.
+func RetryContextWithMaxDelay(ctx context.Context, retryCount int, sleepTime time.Duration, backoffFactor int, maxDelay time.Duration, fn func(context.Context) error) error {
+	return retryContext(ctx, retryCount, sleepTime, backoffFactor, maxDelay, fn, nil)
 }
 
 // StrictDecodeFile decodes the toml file strictly. If any item in confFile file is not mapped
@@ -327,6 +327,39 @@ func (s *retryCtxSuite) TestSuccessAfterRetry(c *C) {
 	c.Assert(callCount, Equals, 2)
 }
 
+func (s *retryCtxSuite) TestMaxDelay(c *C) {
+	var sleeps []time.Duration
+	origAfter := retryAfter
+	retryAfter = func(d time.Duration) <-chan time.Time {
+		sleeps = append(sleeps, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+	defer func() {
+		retryAfter = origAfter
+	}()
+
+	ctx := context.Background()
+	err := RetryContextWithMaxDelay(ctx, 20, 10*time.Millisecond, 1000, 100*time.Millisecond, func(ictx context.Context) error {
+		return errors.New("Fail")
+	})
+	c.Assert(err, ErrorMatches, "Fail")
+	c.Assert(sleeps, HasLen, 20)
+	c.Assert(sleeps[0], Equals, 10*time.Millisecond)
+	for _, d := range sleeps[1:] {
+		c.Assert(d, Equals, 100*time.Millisecond)
+	}
+
+	// no limit
+	sleeps = nil
+	err = RetryContextWithMaxDelay(ctx, 3, time.Millisecond, 1000, 0, func(ictx context.Context) error {
+		return errors.New("Fail")
+	})
+	c.Assert(err, ErrorMatches, "Fail")
+	c.Assert(sleeps, DeepEquals, []time.Duration{time.Millisecond, time.Second, 1000 * time.Second})
+}
+
 type waitUntilTimeoutSuit struct{}
 
 var _ = Suite(&waitUntilTimeoutSuit{})
@@ -40,11 +40,12 @@ func (s *testMysqlSuite) testMysqlSyncer(c *check.C, safemode bool) {
 	mock.ExpectExec("create database test").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectCommit()
 
-	mock.ExpectQuery("SELECT column_name, extra FROM information_schema.columns").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", "").AddRow("b", "").AddRow("c", ""))
+	// the table info of all tables in the schema are fetched together
+	mock.ExpectQuery("SELECT table_name, column_name, extra, column_type FROM information_schema.columns").WithArgs("test").WillReturnRows(sqlmock.NewRows([]string{"table_name", "column_name", "extra", "column_type"}).AddRow("t1", "a", "", "int(11)").AddRow("t1", "b", "", "int(11)").AddRow("t1", "c", "", "int(11)"))
 
-	rows := sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"})
-	mock.ExpectQuery("SELECT non_unique, index_name, seq_in_index, column_name FROM information_schema.statistics").
-		WithArgs("test", "t1").
+	rows := sqlmock.NewRows([]string{"table_name", "non_unique", "index_name", "seq_in_index", "column_name"})
+	mock.ExpectQuery("SELECT table_name, non_unique, index_name, seq_in_index, column_name\\s+FROM information_schema.statistics").
+		WithArgs("test").
 		WillReturnRows(rows)
 
 	mock.ExpectBegin()